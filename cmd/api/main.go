@@ -1,10 +1,13 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"io"
 	"log"
 	"net/http"
+	"os"
+	"time"
 
 	"github.com/diorshelton/golden-market-api/internal/auth"
 	"github.com/diorshelton/golden-market-api/internal/cart"
@@ -12,13 +15,30 @@ import (
 	"github.com/diorshelton/golden-market-api/internal/database"
 	"github.com/diorshelton/golden-market-api/internal/handlers"
 	"github.com/diorshelton/golden-market-api/internal/inventory"
+	"github.com/diorshelton/golden-market-api/internal/mailer"
 	"github.com/diorshelton/golden-market-api/internal/middleware"
+	"github.com/diorshelton/golden-market-api/internal/models"
 	"github.com/diorshelton/golden-market-api/internal/order"
 	"github.com/diorshelton/golden-market-api/internal/product"
+	"github.com/diorshelton/golden-market-api/internal/promotion"
 	"github.com/diorshelton/golden-market-api/internal/repository"
+	"github.com/diorshelton/golden-market-api/internal/wallet"
+	"github.com/diorshelton/golden-market-api/internal/wishlist"
 	"github.com/gorilla/mux"
 )
 
+// guestReapInterval is how often expired guest accounts are deleted
+const guestReapInterval = 10 * time.Minute
+
+// cartHoldSweepInterval is how often expired cart holds are released
+const cartHoldSweepInterval = time.Minute
+
+// passwordResetsPerIPPerHour caps forgot-password requests, which send mail
+const passwordResetsPerIPPerHour = 5
+
+// mfaAttemptsPerIPPerHour caps two-factor code guesses
+const mfaAttemptsPerIPPerHour = 30
+
 func main() {
 	// Load configuration
 	cfg, err := config.Load()
@@ -26,7 +46,15 @@ func main() {
 		log.Fatal(err)
 	}
 
-	// Set up databases
+	// `api migrate ...` manages the schema and exits without serving
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := runMigrate(cfg.DatabaseURL, os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	// Set up databases (applies pending migrations)
 	database, err := database.SetupDB(cfg.DatabaseURL)
 	if err != nil {
 		log.Fatal(err)
@@ -35,28 +63,81 @@ func main() {
 
 	// Create repositories
 	tokenRepo := repository.NewRefreshTokenRepository(database)
+	userTokenRepo := repository.NewUserTokenRepository(database)
+	loginAttemptRepo := repository.NewLoginAttemptRepository(database)
+	apiKeyRepo := repository.NewAPIKeyRepository(database)
 	userRepo := repository.NewUserRepository(database)
 	productRepo := repository.NewProductRepository(database)
 	cartRepo := repository.NewCartRepository(database)
 	orderRepo := repository.NewOrderRepository(database)
 	orderItemRepo := repository.NewOrderItemRepository(database)
 	inventoryRepo := repository.NewInventoryRepository(database)
+	coinTxRepo := repository.NewCoinTransactionRepository(database)
+	promotionRepo := repository.NewPromotionRepository(database)
+	wishlistRepo := repository.NewWishlistRepository(database)
+	transferRepo := repository.NewCoinTransferRepository(database)
 
 	// Create  auth service
 	authService := auth.NewAuthService(
 		userRepo,
 		tokenRepo,
+		userTokenRepo,
+		loginAttemptRepo,
+		apiKeyRepo,
 		cfg.JWTSecret,
 		cfg.RefreshSecret,
 		cfg.AccessTokenExpiry,
 		cfg.RefreshTokenExpiry,
 	)
+	authService.ConfigureGuests(cfg.GuestTTL, cfg.MaxActiveGuests)
+	authService.ConfigurePasswordHashing(auth.PasswordParams{
+		Memory:      uint32(cfg.Argon2MemoryKiB),
+		Iterations:  uint32(cfg.Argon2Iterations),
+		Parallelism: uint8(cfg.Argon2Parallelism),
+	})
+	authService.ConfigureLockout(cfg.MaxLoginFailures, cfg.MaxLoginFailuresPerIP, cfg.LoginLockout)
+
+	// Create mailer for password resets and email verification
+	mail, err := newMailer(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	authService.ConfigureMail(mail, cfg.AppURL)
+
+	if cfg.MFAEncryptionKey == nil {
+		log.Print("MFA_ENCRYPTION_KEY not set; two-factor secrets are encrypted with a key derived from JWT_SECRET")
+	}
+	authService.ConfigureMFA(cfg.MFAEncryptionKey)
+
+	// Load the access token signing keys
+	var keys *auth.Keyring
+	if cfg.JWTSigningKey == nil {
+		log.Print("JWT_SIGNING_KEY not set; signing tokens with a throwaway key that changes on every restart")
+		keys = auth.NewEphemeralKeyring()
+	} else {
+		keys, err = auth.NewKeyring(cfg.JWTSigningKey, cfg.JWTVerifyKeys)
+		if err != nil {
+			log.Fatalf("Failed to load JWT keys: %v", err)
+		}
+	}
+	log.Printf("Signing access tokens with key %s", keys.SigningKeyID())
+	authService.ConfigureSigning(keys, cfg.JWTIssuer, cfg.JWTAudience)
+
+	// Delete expired guest accounts in the background
+	authService.StartGuestReaper(context.Background(), guestReapInterval)
 
 	// Create product service
-	productService := product.NewProductService(productRepo)
+	productService := product.NewProductService(database, productRepo, cartRepo)
 
 	// Create cart service
-	cartService := cart.NewCartService(cartRepo, productRepo)
+	cartService := cart.NewCartService(database, cartRepo, productRepo, promotionRepo)
+	if cfg.CartHoldTTL > 0 {
+		cartService.ConfigureHolds(cfg.CartHoldTTL)
+		cartService.StartHoldSweeper(context.Background(), cartHoldSweepInterval)
+	}
+
+	// Create wishlist service
+	wishlistService := wishlist.NewWishlistService(database, wishlistRepo, cartRepo, productRepo, cartService)
 
 	// Create order service
 	orderService := order.NewOrderService(
@@ -67,19 +148,31 @@ func main() {
 		userRepo,
 		productRepo,
 		cartRepo,
+		promotionRepo,
 	)
+	orderService.ConfigureCancelWindow(cfg.OrderCancelWindow)
 
 	// Create inventory service
 	inventoryService := inventory.NewInventoryService(inventoryRepo)
 
+	// Create wallet service
+	walletService := wallet.NewWalletService(database, userRepo, coinTxRepo, transferRepo)
+	walletService.ConfigureTransfers(cfg.TransferDailyLimit, cfg.TransferMinAccountAge)
+
+	// Create promotion service
+	promotionService := promotion.NewPromotionService(promotionRepo)
+
 	// Create handlers
 	authHandler := handlers.NewAuthHandler(authService, cfg.Environment)
-	userHandler := handlers.NewUserHandler(userRepo)
+	userHandler := handlers.NewUserHandler(userRepo, authService, orderService, inventoryService)
 	productHandler := handlers.NewProductHandler(productService)
 	cartHandler := handlers.NewCartHandler(cartService)
+	wishlistHandler := handlers.NewWishlistHandler(wishlistService)
 	orderHandler := handlers.NewOrderHandler(orderService)
 	inventoryHandler := handlers.NewInventoryHandler(inventoryService)
-	//adminHandler := handlers.NewAdminHandler(database, userRepo, inventoryRepo)
+	walletHandler := handlers.NewWalletHandler(walletService)
+	promotionHandler := handlers.NewPromotionHandler(promotionService)
+	adminHandler := handlers.NewAdminHandler(database, userRepo, inventoryRepo, coinTxRepo, loginAttemptRepo)
 
 	// Create router
 	r := mux.NewRouter()
@@ -103,8 +196,12 @@ func main() {
 		})
 	}).Methods("GET")
 
+	// Public keys for verifying access tokens
+	r.HandleFunc("/.well-known/jwks.json", authHandler.JWKS).Methods("GET", "OPTIONS")
+
 	// --- Product API Endpoints (Public - Read Only) --
 	r.HandleFunc("/api/v1/products", productHandler.GetProducts).Methods("GET", "OPTIONS")
+	r.HandleFunc("/api/v1/products/search", productHandler.SearchProducts).Methods("GET", "OPTIONS")
 	r.HandleFunc("/api/v1/products/{id}", productHandler.GetProduct).Methods("GET", "OPTIONS")
 
 	// --- Auth API Endpoints (rate limited) ---
@@ -114,47 +211,131 @@ func main() {
 
 	authRouter.HandleFunc("/register", authHandler.Register).Methods("POST", "OPTIONS")
 	authRouter.HandleFunc("/login", authHandler.Login).Methods("POST", "OPTIONS")
-	authRouter.HandleFunc("/guest-login", authHandler.GuestLogin).Methods("POST", "OPTIONS")
+	mfaLimit := middleware.LimitPerIP(mfaAttemptsPerIPPerHour, time.Hour)
+	authRouter.Handle("/login/mfa", mfaLimit(http.HandlerFunc(authHandler.LoginMFA))).Methods("POST", "OPTIONS")
+	guestLimit := middleware.LimitPerIP(cfg.GuestLoginsPerIPPerHour, time.Hour)
+	authRouter.Handle("/guest-login", guestLimit(http.HandlerFunc(authHandler.GuestLogin))).Methods("POST", "OPTIONS")
 	authRouter.HandleFunc("/refresh", authHandler.Refresh).Methods("POST", "OPTIONS")
 	authRouter.HandleFunc("/logout", authHandler.Logout).Methods("POST", "OPTIONS")
+	resetLimit := middleware.LimitPerIP(passwordResetsPerIPPerHour, time.Hour)
+	authRouter.Handle("/forgot-password", resetLimit(http.HandlerFunc(authHandler.ForgotPassword))).Methods("POST", "OPTIONS")
+	authRouter.HandleFunc("/reset-password", authHandler.ResetPassword).Methods("POST", "OPTIONS")
+	authRouter.HandleFunc("/verify-email", authHandler.VerifyEmail).Methods("GET", "OPTIONS")
+	authRouter.HandleFunc("/unlock-account", authHandler.UnlockAccount).Methods("GET", "OPTIONS")
+	authRouter.HandleFunc("/confirm-email", userHandler.ConfirmEmailChange).Methods("GET", "OPTIONS")
+
+	// Account management needs a real login; API keys are refused
+	requireSession := func(next http.HandlerFunc) http.Handler {
+		return middleware.Auth(authService)(middleware.RejectAPIKeys(next))
+	}
+	authRouter.Handle("/upgrade", requireSession(authHandler.UpgradeGuest)).Methods("POST", "OPTIONS")
+	authRouter.Handle("/mfa/enroll", requireSession(authHandler.EnrollMFA)).Methods("POST", "OPTIONS")
+	authRouter.Handle("/mfa/confirm", requireSession(authHandler.ConfirmMFA)).Methods("POST", "OPTIONS")
+	authRouter.Handle("/mfa", mfaLimit(requireSession(authHandler.DisableMFA))).Methods("DELETE", "OPTIONS")
 
 	// --- Protected routes ---
 	protected := r.PathPrefix("/api/v1").Subrouter()
 	protected.Use(corsMiddleware) // Apply CORS to Subrouter
 	protected.Use(middleware.Auth(authService))
-	protected.HandleFunc("/profile", userHandler.Profile).Methods("GET", "OPTIONS")
 
-	// Product write operations (protected)
-	protected.HandleFunc("/products", productHandler.Create).Methods("POST", "OPTIONS")
-	protected.HandleFunc("/products/{id}", productHandler.Update).Methods("PUT", "PATCH", "OPTIONS")
-	protected.HandleFunc("/products/{id}", productHandler.Delete).Methods("DELETE", "OPTIONS")
+	// Requests with an API key only reach routes granting one of its scopes
+	scoped := func(scope string, next http.HandlerFunc) http.Handler {
+		return middleware.RequireScope(scope)(next)
+	}
+	sessionOnly := middleware.RejectAPIKeys
+
+	protected.Handle("/profile", scoped(models.ScopeProfileRead, userHandler.Profile)).Methods("GET", "OPTIONS")
+	protected.Handle("/profile", scoped(models.ScopeProfileWrite, userHandler.UpdateProfile)).Methods("PATCH", "OPTIONS")
+
+	// Account self-service (protected, login session only)
+	protected.Handle("/profile", sessionOnly(http.HandlerFunc(userHandler.DeleteAccount))).Methods("DELETE", "OPTIONS")
+	protected.Handle("/profile/password", sessionOnly(http.HandlerFunc(userHandler.ChangePassword))).Methods("POST", "OPTIONS")
+	protected.Handle("/profile/email", sessionOnly(http.HandlerFunc(userHandler.ChangeEmail))).Methods("POST", "OPTIONS")
+	protected.Handle("/profile/export", sessionOnly(http.HandlerFunc(userHandler.Export))).Methods("GET", "OPTIONS")
+
+	// Sessions (protected)
+	protected.Handle("/sessions", sessionOnly(http.HandlerFunc(authHandler.ListSessions))).Methods("GET", "OPTIONS")
+	protected.Handle("/sessions", sessionOnly(http.HandlerFunc(authHandler.RevokeOtherSessions))).Methods("DELETE", "OPTIONS")
+	protected.Handle("/sessions/{id}", sessionOnly(http.HandlerFunc(authHandler.RevokeSession))).Methods("DELETE", "OPTIONS")
+
+	// API keys (protected, managed from a login session only)
+	protected.Handle("/api-keys", sessionOnly(http.HandlerFunc(authHandler.CreateAPIKey))).Methods("POST", "OPTIONS")
+	protected.Handle("/api-keys", sessionOnly(http.HandlerFunc(authHandler.ListAPIKeys))).Methods("GET", "OPTIONS")
+	protected.Handle("/api-keys/{id}", sessionOnly(http.HandlerFunc(authHandler.RevokeAPIKey))).Methods("DELETE", "OPTIONS")
+
+	// Product write operations (admin only, with two-factor when REQUIRE_ADMIN_MFA is set)
+	requireAdminMFA := middleware.RequireMFA(cfg.RequireAdminMFA)
+	adminOnly := func(next http.Handler) http.Handler {
+		return middleware.RequireRole(models.RoleAdmin)(requireAdminMFA(next))
+	}
+	protected.Handle("/products", adminOnly(scoped(models.ScopeProductsWrite, productHandler.Create))).Methods("POST", "OPTIONS")
+	protected.Handle("/products/{id}", adminOnly(scoped(models.ScopeProductsWrite, productHandler.Update))).Methods("PUT", "PATCH", "OPTIONS")
+	protected.Handle("/products/{id}", adminOnly(scoped(models.ScopeProductsWrite, productHandler.Delete))).Methods("DELETE", "OPTIONS")
 
 	// Cart operations (protected)
-	protected.HandleFunc("/cart", cartHandler.GetCart).Methods("GET", "OPTIONS")
-	protected.HandleFunc("/cart/items", cartHandler.AddToCart).Methods("POST", "OPTIONS")
-	protected.HandleFunc("/cart/items/{id}", cartHandler.UpdateCartItem).Methods("PUT", "PATCH", "OPTIONS")
-	protected.HandleFunc("/cart/items/{id}", cartHandler.RemoveFromCart).Methods("DELETE", "OPTIONS")
+	protected.Handle("/cart", scoped(models.ScopeCartRead, cartHandler.GetCart)).Methods("GET", "OPTIONS")
+	protected.Handle("/cart/items", scoped(models.ScopeCartWrite, cartHandler.AddToCart)).Methods("POST", "OPTIONS")
+	protected.Handle("/cart/items/{id}", scoped(models.ScopeCartWrite, cartHandler.UpdateCartItem)).Methods("PUT", "PATCH", "OPTIONS")
+	protected.Handle("/cart/items/{id}", scoped(models.ScopeCartWrite, cartHandler.RemoveFromCart)).Methods("DELETE", "OPTIONS")
+	protected.Handle("/cart/promo", scoped(models.ScopeCartWrite, cartHandler.ApplyPromo)).Methods("POST", "OPTIONS")
+	protected.Handle("/cart/promo", scoped(models.ScopeCartWrite, cartHandler.RemovePromo)).Methods("DELETE", "OPTIONS")
+
+	// Wishlist (protected). Moving items between it and the cart needs both
+	// write scopes.
+	protected.Handle("/wishlist", scoped(models.ScopeWishlistRead, wishlistHandler.GetWishlist)).Methods("GET", "OPTIONS")
+	protected.Handle("/wishlist", scoped(models.ScopeWishlistWrite, wishlistHandler.AddToWishlist)).Methods("POST", "OPTIONS")
+	protected.Handle("/wishlist/{id}", scoped(models.ScopeWishlistWrite, wishlistHandler.RemoveFromWishlist)).Methods("DELETE", "OPTIONS")
+	protected.Handle("/wishlist/{id}/move-to-cart",
+		middleware.RequireScope(models.ScopeCartWrite)(scoped(models.ScopeWishlistWrite, wishlistHandler.MoveToCart))).Methods("POST", "OPTIONS")
+	protected.Handle("/cart/items/{id}/save-for-later",
+		middleware.RequireScope(models.ScopeWishlistWrite)(scoped(models.ScopeCartWrite, wishlistHandler.SaveForLater))).Methods("POST", "OPTIONS")
 
 	// Order operations (protected)
-	protected.HandleFunc("/orders", orderHandler.CreateOrder).Methods("POST", "OPTIONS")
-	protected.HandleFunc("/orders", orderHandler.GetOrders).Methods("GET", "OPTIONS")
-	protected.HandleFunc("/orders/{id}", orderHandler.GetOrder).Methods("GET", "OPTIONS")
+	protected.Handle("/orders", scoped(models.ScopeOrdersWrite, orderHandler.CreateOrder)).Methods("POST", "OPTIONS")
+	protected.Handle("/orders", scoped(models.ScopeOrdersRead, orderHandler.GetOrders)).Methods("GET", "OPTIONS")
+	protected.Handle("/orders/{id}", scoped(models.ScopeOrdersRead, orderHandler.GetOrder)).Methods("GET", "OPTIONS")
+	protected.Handle("/orders/{id}/cancel", scoped(models.ScopeOrdersWrite, orderHandler.CancelOrder)).Methods("POST", "OPTIONS")
 
 	// Inventory operations (protected)
-	protected.HandleFunc("/inventory", inventoryHandler.GetInventory).Methods("GET", "OPTIONS")
-	/*
-		TODO IMPLEMENT ADMIN FEATURES
-
-		// Admin operations (protected)
-		protected.HandleFunc("/admin/users/{id}/coins", adminHandler.AdjustCoins).Methods("PATCH", "OPTIONS")
-		protected.HandleFunc("/admin/users/{id}/inventory", adminHandler.ClearInventory).Methods("DELETE", "OPTIONS")
-	*/
+	protected.Handle("/inventory", scoped(models.ScopeInventoryRead, inventoryHandler.GetInventory)).Methods("GET", "OPTIONS")
+
+	// Wallet operations (protected)
+	protected.Handle("/wallet/transactions", scoped(models.ScopeWalletRead, walletHandler.GetTransactions)).Methods("GET", "OPTIONS")
+	protected.Handle("/wallet/transfer", scoped(models.ScopeWalletWrite, walletHandler.Transfer)).Methods("POST", "OPTIONS")
+
+	// --- Admin routes (admin role required) ---
+	admin := protected.PathPrefix("/admin").Subrouter()
+	admin.Use(adminOnly)
+	admin.Use(middleware.RequireScope(models.ScopeAdmin))
+	admin.HandleFunc("/users/{id}/coins", adminHandler.AdjustCoins).Methods("PATCH", "OPTIONS")
+	admin.HandleFunc("/users/{id}/inventory", adminHandler.ClearInventory).Methods("DELETE", "OPTIONS")
+	admin.HandleFunc("/users/{id}/unlock", adminHandler.UnlockUser).Methods("POST", "OPTIONS")
+	admin.HandleFunc("/orders/{id}/refund", orderHandler.RefundOrder).Methods("POST", "OPTIONS")
+	admin.HandleFunc("/ledger/reconcile", adminHandler.ReconcileLedger).Methods("GET", "OPTIONS")
+	admin.HandleFunc("/promotions", promotionHandler.Create).Methods("POST", "OPTIONS")
+	admin.HandleFunc("/promotions", promotionHandler.List).Methods("GET", "OPTIONS")
+	admin.HandleFunc("/promotions/{id}", promotionHandler.SetActive).Methods("PATCH", "OPTIONS")
+
 	// Start server
 	addr := ":" + cfg.Port
 	log.Printf("Server starting on port %s", cfg.Port)
 	log.Printf("Environment: %s", cfg.Environment)
 
-	if err := http.ListenAndServe(addr, r); err != nil {
+	// Resolve client IPs before anything keys on them
+	handler := middleware.ClientIP(cfg.TrustedProxies)(r)
+	if err := http.ListenAndServe(addr, handler); err != nil {
 		log.Fatal(err)
 	}
 }
+
+// newMailer builds the mailer selected by MAILER
+func newMailer(cfg *config.Config) (mailer.Mailer, error) {
+	switch cfg.Mailer {
+	case "smtp":
+		return mailer.NewSMTPMailer(cfg.SMTPHost, cfg.SMTPPort, cfg.SMTPUsername, cfg.SMTPPassword, cfg.MailFrom), nil
+	case "file":
+		return mailer.NewFileMailer(cfg.MailDir, cfg.MailFrom)
+	default:
+		return mailer.NewLogMailer(), nil
+	}
+}
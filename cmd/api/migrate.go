@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/diorshelton/golden-market-api/internal/database"
+)
+
+const migrateUsage = "usage: api migrate [up | down [steps] | status]"
+
+// runMigrate handles the `migrate` subcommand. It connects without applying
+// migrations on boot so that down and status see the database as it is.
+func runMigrate(databaseURL string, args []string) error {
+	db, err := database.Connect(databaseURL)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+
+	command := "up"
+	if len(args) > 0 {
+		command = args[0]
+	}
+
+	switch command {
+	case "up":
+		return database.MigrateUp(ctx, db)
+
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps <= 0 {
+				return fmt.Errorf("invalid step count %q\n%s", args[1], migrateUsage)
+			}
+		}
+		return database.MigrateDown(ctx, db, steps)
+
+	case "status":
+		statuses, err := database.Status(ctx, db)
+		if err != nil {
+			return err
+		}
+		for _, s := range statuses {
+			state := "pending"
+			if s.Applied {
+				state = "applied " + s.AppliedAt.UTC().Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%04d_%-40s %s\n", s.Version, s.Name, state)
+		}
+		return nil
+
+	default:
+		return fmt.Errorf("unknown migrate command %q\n%s", command, migrateUsage)
+	}
+}
@@ -0,0 +1,268 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/diorshelton/golden-market-api/internal/mailer"
+	"github.com/diorshelton/golden-market-api/internal/models"
+	"github.com/diorshelton/golden-market-api/internal/repository"
+	"github.com/google/uuid"
+)
+
+var (
+	ErrAccountGuest = errors.New("guest accounts must register first")
+	ErrSameEmail    = errors.New("that is already the account's email")
+)
+
+const (
+	// EmailChangeTTL is how long the link confirming a new email works
+	EmailChangeTTL = 24 * time.Hour
+
+	// AccountDeletionGrace is how long a deleted account is kept, so its
+	// owner can change their mind by logging in again
+	AccountDeletionGrace = 30 * 24 * time.Hour
+)
+
+// UpdateProfile changes a user's names. A nil name is left as it is.
+func (s *AuthService) UpdateProfile(userID uuid.UUID, firstName, lastName *string) (*models.User, error) {
+	user, err := s.userRepo.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if firstName != nil {
+		user.FirstName = *firstName
+	}
+	if lastName != nil {
+		user.LastName = *lastName
+	}
+
+	if err := s.userRepo.UpdateUserNames(context.Background(), userID, user.FirstName, user.LastName); err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// ChangePassword replaces a user's password after checking the current
+// one. Every session but the current one is signed out.
+func (s *AuthService) ChangePassword(userID, currentSessionID uuid.UUID, currentPassword, newPassword string) error {
+	ctx := context.Background()
+
+	user, err := s.confirmPassword(ctx, userID, currentPassword)
+	if err != nil {
+		return err
+	}
+
+	hashedPassword, err := hashPassword(newPassword, s.passwordParams)
+	if err != nil {
+		return err
+	}
+
+	if err := s.userRepo.UpdatePassword(ctx, userID, hashedPassword); err != nil {
+		return err
+	}
+
+	if err := s.refreshTokenRepo.RevokeAllUserTokens(userID, currentSessionID); err != nil {
+		return err
+	}
+
+	log.Printf("Password changed for user %s; other sessions revoked", userID)
+
+	err = s.mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Your Golden Market password was changed",
+		Body: fmt.Sprintf(
+			"Hi %s,\n\nThe password for your Golden Market account was just changed, "+
+				"and every other device was signed out.\n\n"+
+				"If you didn't do this, reset your password right away.\n",
+			user.FirstName),
+	})
+	if err != nil {
+		log.Printf("Failed to send password change notice to user %s: %v", userID, err)
+	}
+
+	return nil
+}
+
+// RequestEmailChange mails a confirmation link to newEmail. The account
+// keeps its current email until the link is opened, and the old address
+// is told about the request.
+func (s *AuthService) RequestEmailChange(userID uuid.UUID, newEmail, password string) error {
+	ctx := context.Background()
+
+	user, err := s.confirmPassword(ctx, userID, password)
+	if err != nil {
+		return err
+	}
+
+	newEmail = normalizeEmail(newEmail)
+	if strings.EqualFold(newEmail, user.Email) {
+		return ErrSameEmail
+	}
+	if _, err := s.userRepo.GetUserByEmail(newEmail); err == nil {
+		return ErrEmailInUse
+	}
+
+	if err := s.userRepo.SetPendingEmail(ctx, userID, newEmail); err != nil {
+		return err
+	}
+
+	token, err := s.userTokenRepo.CreateUserToken(ctx, userID, models.TokenPurposeEmailChange, EmailChangeTTL)
+	if err != nil {
+		return err
+	}
+
+	link := s.appURL + "/confirm-email?token=" + url.QueryEscape(token)
+	err = s.mailer.Send(ctx, mailer.Message{
+		To:      newEmail,
+		Subject: "Confirm your new Golden Market email",
+		Body: fmt.Sprintf(
+			"Hi %s,\n\nTo start using this address for your Golden Market account, open this link "+
+				"within the next 24 hours:\n\n%s\n\n"+
+				"If you didn't ask for this, you can ignore this email.\n",
+			user.FirstName, link),
+	})
+	if err != nil {
+		return err
+	}
+
+	err = s.mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Your Golden Market email is being changed",
+		Body: fmt.Sprintf(
+			"Hi %s,\n\nSomeone asked to change the email on your Golden Market account to %s. "+
+				"Nothing changes until the new address is confirmed.\n\n"+
+				"If this wasn't you, change your password right away.\n",
+			user.FirstName, newEmail),
+	})
+	if err != nil {
+		log.Printf("Failed to send email change notice to user %s: %v", userID, err)
+	}
+
+	return nil
+}
+
+// ConfirmEmailChange switches the account to its pending email using the
+// token mailed by RequestEmailChange
+func (s *AuthService) ConfirmEmailChange(token string) error {
+	ctx := context.Background()
+
+	userToken, err := s.userTokenRepo.ConsumeUserToken(ctx, models.TokenPurposeEmailChange, token)
+	if err != nil {
+		if errors.Is(err, repository.ErrUserTokenInvalid) {
+			return ErrInvalidToken
+		}
+		return err
+	}
+
+	email, err := s.userRepo.ConfirmPendingEmail(ctx, userToken.UserID)
+	if err != nil {
+		if errors.Is(err, repository.ErrEmailTaken) {
+			return ErrEmailInUse
+		}
+		return err
+	}
+
+	log.Printf("Email changed for user %s to %s", userToken.UserID, email)
+	return nil
+}
+
+// DeleteAccount schedules a user's account for deletion after
+// AccountDeletionGrace and signs it out everywhere. Logging in again before
+// then keeps the account. It returns when the account will be deleted.
+func (s *AuthService) DeleteAccount(userID uuid.UUID, password string) (time.Time, error) {
+	ctx := context.Background()
+
+	user, err := s.confirmPassword(ctx, userID, password)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	deleteAt := time.Now().Add(AccountDeletionGrace).UTC()
+	if err := s.userRepo.ScheduleDeletion(ctx, userID, deleteAt); err != nil {
+		return time.Time{}, err
+	}
+
+	if err := s.refreshTokenRepo.RevokeAllUserTokens(userID); err != nil {
+		return time.Time{}, err
+	}
+
+	log.Printf("User %s scheduled for deletion at %s", userID, deleteAt.Format(time.RFC3339))
+
+	err = s.mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Your Golden Market account will be deleted",
+		Body: fmt.Sprintf(
+			"Hi %s,\n\nYour Golden Market account, with its orders, inventory and coins, "+
+				"will be deleted on %s.\n\n"+
+				"Changed your mind? Just log in before then and your account stays.\n",
+			user.FirstName, deleteAt.Format("January 2, 2006")),
+	})
+	if err != nil {
+		log.Printf("Failed to send deletion notice to user %s: %v", userID, err)
+	}
+
+	return deleteAt, nil
+}
+
+// PurgeDeletedAccounts removes accounts whose deletion grace period is over
+func (s *AuthService) PurgeDeletedAccounts(ctx context.Context) (int64, error) {
+	return s.userRepo.DeleteScheduledUsers(ctx)
+}
+
+// cancelDeletion keeps an account scheduled for deletion whose owner has
+// just logged in
+func (s *AuthService) cancelDeletion(ctx context.Context, user *models.User) error {
+	if user.DeletionScheduledAt == nil {
+		return nil
+	}
+
+	if err := s.userRepo.CancelDeletion(ctx, user.ID); err != nil {
+		return err
+	}
+
+	log.Printf("Deletion of user %s cancelled by login", user.ID)
+	user.DeletionScheduledAt = nil
+	return nil
+}
+
+// confirmPassword checks a registered user's password before an account
+// change. Wrong passwords count towards the account's login lockout, so a
+// stolen access token can't be used to guess it.
+func (s *AuthService) confirmPassword(ctx context.Context, userID uuid.UUID, password string) (*models.User, error) {
+	user, err := s.userRepo.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.IsGuest {
+		return nil, ErrAccountGuest
+	}
+
+	if err := s.checkLoginLockout(ctx, models.LoginScopeAccount, user.ID.String()); err != nil {
+		return nil, err
+	}
+
+	needsRehash, err := verifyPassword(user.PasswordHash, password, s.passwordParams)
+	if err != nil {
+		if !errors.Is(err, ErrInvalidCredentials) {
+			return nil, err
+		}
+		if err := s.recordLoginFailure(ctx, user, user.Email, ""); err != nil {
+			return nil, err
+		}
+		return nil, ErrInvalidCredentials
+	}
+
+	if needsRehash {
+		s.rehashPassword(ctx, user, password)
+	}
+
+	return user, nil
+}
@@ -0,0 +1,166 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/diorshelton/golden-market-api/internal/models"
+	"github.com/google/uuid"
+)
+
+func TestChangePassword(t *testing.T) {
+	service, cleanup := setupTestService(t)
+	defer cleanup()
+
+	service.ConfigureMail(&recordingMailer{}, "http://app.test")
+
+	user, err := service.Register("Marceline", "Abadeer", "marceline@example.com", "vampirequeen", "password123")
+	if err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+
+	accessToken, current, err := service.Login(user.Email, "password123", models.ClientInfo{})
+	if err != nil {
+		t.Fatalf("Login failed: %v", err)
+	}
+	_, other, err := service.Login(user.Email, "password123", models.ClientInfo{})
+	if err != nil {
+		t.Fatalf("Second login failed: %v", err)
+	}
+
+	claims, err := service.ValidateToken(accessToken)
+	if err != nil {
+		t.Fatalf("ValidateToken failed: %v", err)
+	}
+	sessionID := uuid.MustParse(claims["sid"].(string))
+
+	if err := service.ChangePassword(user.ID, sessionID, "wrong", "newpassword456"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("Expected ErrInvalidCredentials for a wrong current password, got %v", err)
+	}
+
+	if err := service.ChangePassword(user.ID, sessionID, "password123", "newpassword456"); err != nil {
+		t.Fatalf("ChangePassword failed: %v", err)
+	}
+
+	if _, _, err := service.Login(user.Email, "password123", models.ClientInfo{}); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Expected the old password to stop working, got %v", err)
+	}
+	if _, _, err := service.Login(user.Email, "newpassword456", models.ClientInfo{}); err != nil {
+		t.Errorf("Expected the new password to work, got %v", err)
+	}
+
+	if _, err := service.Refresh(current, models.ClientInfo{}); err != nil {
+		t.Errorf("Expected the current session to survive, got %v", err)
+	}
+	if _, err := service.Refresh(other, models.ClientInfo{}); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Expected other sessions to be revoked, got %v", err)
+	}
+}
+
+func TestEmailChange(t *testing.T) {
+	service, cleanup := setupTestService(t)
+	defer cleanup()
+
+	mail := &recordingMailer{}
+	service.ConfigureMail(mail, "http://app.test")
+
+	user, err := service.Register("Flame", "Princess", "flame@example.com", "flameprincess", "password123")
+	if err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+	if _, err := service.Register("Cinnamon", "Bun", "cinnamon@example.com", "cinnamonbun", "password123"); err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+
+	if err := service.RequestEmailChange(user.ID, "cinnamon@example.com", "password123"); !errors.Is(err, ErrEmailInUse) {
+		t.Errorf("Expected ErrEmailInUse, got %v", err)
+	}
+	if err := service.RequestEmailChange(user.ID, "FLAME@example.com", "password123"); !errors.Is(err, ErrSameEmail) {
+		t.Errorf("Expected ErrSameEmail, got %v", err)
+	}
+
+	if err := service.RequestEmailChange(user.ID, "fp@example.com", "password123"); err != nil {
+		t.Fatalf("RequestEmailChange failed: %v", err)
+	}
+
+	// Nothing changes until the new address is confirmed
+	if _, _, err := service.Login(user.Email, "password123", models.ClientInfo{}); err != nil {
+		t.Fatalf("Expected the old email to work before confirming, got %v", err)
+	}
+
+	token := mail.lastToken(t, "fp@example.com")
+	if err := service.ConfirmEmailChange(token); err != nil {
+		t.Fatalf("ConfirmEmailChange failed: %v", err)
+	}
+	if err := service.ConfirmEmailChange(token); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Expected a used token to be rejected, got %v", err)
+	}
+
+	updated, err := service.userRepo.GetUserByID(user.ID)
+	if err != nil {
+		t.Fatalf("GetUserByID failed: %v", err)
+	}
+	if updated.Email != "fp@example.com" {
+		t.Errorf("Expected email fp@example.com, got %s", updated.Email)
+	}
+	if updated.EmailVerifiedAt == nil {
+		t.Error("Expected the confirmed email to be verified")
+	}
+}
+
+func TestDeleteAccount(t *testing.T) {
+	service, cleanup := setupTestService(t)
+	defer cleanup()
+
+	service.ConfigureMail(&recordingMailer{}, "http://app.test")
+	ctx := context.Background()
+
+	user, err := service.Register("Tree", "Trunks", "treetrunks@example.com", "treetrunks", "password123")
+	if err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+	_, refreshToken, err := service.Login(user.Email, "password123", models.ClientInfo{})
+	if err != nil {
+		t.Fatalf("Login failed: %v", err)
+	}
+
+	if _, err := service.DeleteAccount(user.ID, "wrong"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("Expected ErrInvalidCredentials, got %v", err)
+	}
+
+	deleteAt, err := service.DeleteAccount(user.ID, "password123")
+	if err != nil {
+		t.Fatalf("DeleteAccount failed: %v", err)
+	}
+	if until := time.Until(deleteAt); until < AccountDeletionGrace-time.Minute {
+		t.Errorf("Expected deletion after the grace period, got %v from now", until)
+	}
+	if _, err := service.Refresh(refreshToken, models.ClientInfo{}); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Expected sessions to be revoked, got %v", err)
+	}
+
+	// Logging in takes the request back
+	if _, _, err := service.Login(user.Email, "password123", models.ClientInfo{}); err != nil {
+		t.Fatalf("Login during the grace period failed: %v", err)
+	}
+	kept, err := service.userRepo.GetUserByID(user.ID)
+	if err != nil {
+		t.Fatalf("GetUserByID failed: %v", err)
+	}
+	if kept.DeletionScheduledAt != nil {
+		t.Error("Expected logging in to cancel the deletion")
+	}
+
+	// Once the grace period is over the reaper removes the account
+	if err := service.userRepo.ScheduleDeletion(ctx, user.ID, time.Now().Add(-time.Minute)); err != nil {
+		t.Fatalf("ScheduleDeletion failed: %v", err)
+	}
+	if _, err := service.PurgeDeletedAccounts(ctx); err != nil {
+		t.Fatalf("PurgeDeletedAccounts failed: %v", err)
+	}
+	if _, err := service.userRepo.GetUserByID(user.ID); err == nil {
+		t.Error("Expected the account to be deleted")
+	}
+}
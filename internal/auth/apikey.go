@@ -0,0 +1,116 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"log"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/diorshelton/golden-market-api/internal/models"
+	"github.com/diorshelton/golden-market-api/internal/repository"
+	"github.com/google/uuid"
+)
+
+var (
+	ErrInvalidAPIKey    = errors.New("invalid or expired API key")
+	ErrAPIKeyNotFound   = errors.New("API key not found")
+	ErrInvalidScope     = errors.New("invalid scope")
+	ErrAPIKeyGuest      = errors.New("guest accounts can't create API keys")
+	ErrTooManyAPIKeys   = errors.New("too many API keys")
+	ErrAPIKeyExpiryPast = errors.New("API key expiry must be in the future")
+)
+
+// MaxAPIKeysPerUser caps how many unrevoked keys one account can hold
+const MaxAPIKeysPerUser = 25
+
+// CreateAPIKey mints a named key limited to scopes, optionally expiring.
+// The returned plaintext is the only time the key is ever shown.
+func (s *AuthService) CreateAPIKey(userID uuid.UUID, name string, scopes []string, expiresAt *time.Time) (*models.APIKey, string, error) {
+	ctx := context.Background()
+
+	user, err := s.userRepo.GetUserByID(userID)
+	if err != nil {
+		return nil, "", err
+	}
+	if user.IsGuest {
+		return nil, "", ErrAPIKeyGuest
+	}
+
+	if len(scopes) == 0 {
+		return nil, "", ErrInvalidScope
+	}
+	for _, scope := range scopes {
+		if !slices.Contains(models.APIKeyScopes, scope) {
+			return nil, "", ErrInvalidScope
+		}
+		// A key can't do more than its owner
+		if slices.Contains(models.AdminScopes, scope) && user.Role != models.RoleAdmin {
+			return nil, "", ErrInvalidScope
+		}
+	}
+	slices.Sort(scopes)
+	scopes = slices.Compact(scopes)
+
+	if expiresAt != nil && !expiresAt.After(time.Now()) {
+		return nil, "", ErrAPIKeyExpiryPast
+	}
+
+	existing, err := s.apiKeyRepo.ListAPIKeys(ctx, userID)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(existing) >= MaxAPIKeysPerUser {
+		return nil, "", ErrTooManyAPIKeys
+	}
+
+	key, plaintext, err := s.apiKeyRepo.CreateAPIKey(ctx, userID, name, scopes, expiresAt)
+	if err != nil {
+		return nil, "", err
+	}
+
+	log.Printf("User %s created API key %s (%s) with scopes %v", userID, key.ID, key.Prefix, key.Scopes)
+	return key, plaintext, nil
+}
+
+// ListAPIKeys returns the user's unrevoked keys
+func (s *AuthService) ListAPIKeys(userID uuid.UUID) ([]models.APIKey, error) {
+	return s.apiKeyRepo.ListAPIKeys(context.Background(), userID)
+}
+
+// RevokeAPIKey revokes one of the user's keys; it stops working immediately
+func (s *AuthService) RevokeAPIKey(userID, keyID uuid.UUID) error {
+	err := s.apiKeyRepo.RevokeAPIKey(context.Background(), userID, keyID)
+	if err != nil && strings.Contains(err.Error(), "not found") {
+		return ErrAPIKeyNotFound
+	}
+	return err
+}
+
+// AuthenticateAPIKey checks a key from the X-API-Key header and returns it
+// with its owner, whose current role the request runs with
+func (s *AuthService) AuthenticateAPIKey(plaintext string) (*models.APIKey, *models.User, error) {
+	ctx := context.Background()
+
+	key, err := s.apiKeyRepo.GetActiveAPIKey(ctx, plaintext)
+	if err != nil {
+		if errors.Is(err, repository.ErrAPIKeyInvalid) {
+			return nil, nil, ErrInvalidAPIKey
+		}
+		return nil, nil, err
+	}
+
+	// Keys stop working while their account waits to be deleted
+	user, err := s.userRepo.GetUserByID(key.UserID)
+	if err != nil || user.DeletionScheduledAt != nil {
+		return nil, nil, ErrInvalidAPIKey
+	}
+
+	// Failing to record the use shouldn't fail the request
+	if err := s.apiKeyRepo.TouchAPIKey(ctx, key.ID); err != nil {
+		log.Printf("API key %s: %v", key.ID, err)
+	}
+
+	return key, user, nil
+}
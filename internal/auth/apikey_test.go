@@ -0,0 +1,70 @@
+package auth
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/diorshelton/golden-market-api/internal/models"
+)
+
+func TestAPIKeys(t *testing.T) {
+	service, cleanup := setupTestService(t)
+	defer cleanup()
+
+	user, err := service.Register("Tree", "Trunks", "trunks@example.com", "treetrunks", "password123")
+	if err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+
+	// Only admins can hand out admin scopes
+	if _, _, err := service.CreateAPIKey(user.ID, "restock", []string{models.ScopeProductsWrite}, nil); !errors.Is(err, ErrInvalidScope) {
+		t.Errorf("Expected ErrInvalidScope for products:write, got %v", err)
+	}
+	if _, _, err := service.CreateAPIKey(user.ID, "bot", []string{"orders:delete"}, nil); !errors.Is(err, ErrInvalidScope) {
+		t.Errorf("Expected ErrInvalidScope for an unknown scope, got %v", err)
+	}
+	past := time.Now().Add(-time.Minute)
+	if _, _, err := service.CreateAPIKey(user.ID, "bot", []string{models.ScopeOrdersRead}, &past); !errors.Is(err, ErrAPIKeyExpiryPast) {
+		t.Errorf("Expected ErrAPIKeyExpiryPast, got %v", err)
+	}
+
+	key, plaintext, err := service.CreateAPIKey(user.ID, "purchases", []string{models.ScopeOrdersWrite, models.ScopeOrdersRead}, nil)
+	if err != nil {
+		t.Fatalf("CreateAPIKey failed: %v", err)
+	}
+	if !strings.HasPrefix(plaintext, key.Prefix) || key.KeyHash == plaintext {
+		t.Errorf("Expected a prefixed key stored only as a hash, got %q / %+v", plaintext, key)
+	}
+
+	authed, owner, err := service.AuthenticateAPIKey(plaintext)
+	if err != nil {
+		t.Fatalf("AuthenticateAPIKey failed: %v", err)
+	}
+	if owner.ID != user.ID || !authed.HasScope(models.ScopeOrdersRead) || authed.HasScope(models.ScopeCartWrite) {
+		t.Errorf("Unexpected key or owner: %+v / %s", authed, owner.ID)
+	}
+
+	keys, err := service.ListAPIKeys(user.ID)
+	if err != nil {
+		t.Fatalf("ListAPIKeys failed: %v", err)
+	}
+	if len(keys) != 1 || keys[0].LastUsedAt == nil {
+		t.Errorf("Expected one key with last use recorded, got %+v", keys)
+	}
+
+	if _, _, err := service.AuthenticateAPIKey(plaintext + "x"); !errors.Is(err, ErrInvalidAPIKey) {
+		t.Errorf("Expected ErrInvalidAPIKey for a wrong key, got %v", err)
+	}
+
+	if err := service.RevokeAPIKey(user.ID, key.ID); err != nil {
+		t.Fatalf("RevokeAPIKey failed: %v", err)
+	}
+	if _, _, err := service.AuthenticateAPIKey(plaintext); !errors.Is(err, ErrInvalidAPIKey) {
+		t.Errorf("Expected a revoked key to be rejected, got %v", err)
+	}
+	if err := service.RevokeAPIKey(user.ID, key.ID); !errors.Is(err, ErrAPIKeyNotFound) {
+		t.Errorf("Expected ErrAPIKeyNotFound revoking twice, got %v", err)
+	}
+}
@@ -0,0 +1,130 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/diorshelton/golden-market-api/internal/mailer"
+	"github.com/diorshelton/golden-market-api/internal/models"
+	"github.com/diorshelton/golden-market-api/internal/repository"
+)
+
+// Lifetimes of mailed tokens, and the frontend links default to
+const (
+	PasswordResetTTL     = time.Hour
+	EmailVerificationTTL = 48 * time.Hour
+	DefaultAppURL        = "http://localhost:5173"
+)
+
+// ConfigureMail sets how emails are sent and the frontend base URL that
+// emailed links point at
+func (s *AuthService) ConfigureMail(m mailer.Mailer, appURL string) {
+	if m != nil {
+		s.mailer = m
+	}
+	if appURL != "" {
+		s.appURL = strings.TrimRight(appURL, "/")
+	}
+}
+
+// RequestPasswordReset mails a reset link to a registered account. Unknown
+// emails and guests get no mail but also no error, so the endpoint can't be
+// used to find out which addresses have accounts.
+func (s *AuthService) RequestPasswordReset(email string) error {
+	ctx := context.Background()
+
+	user, err := s.userRepo.GetUserByEmail(email)
+	if err != nil || user.IsGuest {
+		return nil
+	}
+
+	token, err := s.userTokenRepo.CreateUserToken(ctx, user.ID, models.TokenPurposePasswordReset, PasswordResetTTL)
+	if err != nil {
+		return err
+	}
+
+	link := s.appURL + "/reset-password?token=" + url.QueryEscape(token)
+	return s.mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your Golden Market password",
+		Body: fmt.Sprintf(
+			"Hi %s,\n\nSomeone asked to reset the password for your Golden Market account. "+
+				"If it was you, open this link within the next hour:\n\n%s\n\n"+
+				"If it wasn't, you can ignore this email; your password hasn't changed.\n",
+			user.FirstName, link),
+	})
+}
+
+// ResetPassword sets a new password using a token from RequestPasswordReset.
+// Every refresh token the user holds is revoked, signing out all devices.
+func (s *AuthService) ResetPassword(token, newPassword string) error {
+	ctx := context.Background()
+
+	userToken, err := s.userTokenRepo.ConsumeUserToken(ctx, models.TokenPurposePasswordReset, token)
+	if err != nil {
+		if errors.Is(err, repository.ErrUserTokenInvalid) {
+			return ErrInvalidToken
+		}
+		return err
+	}
+
+	hashedPassword, err := hashPassword(newPassword, s.passwordParams)
+	if err != nil {
+		return err
+	}
+
+	if err := s.userRepo.UpdatePassword(ctx, userToken.UserID, hashedPassword); err != nil {
+		return err
+	}
+
+	if err := s.refreshTokenRepo.RevokeAllUserTokens(userToken.UserID); err != nil {
+		return err
+	}
+
+	// The reset proves the owner has the account back, so lift any lockout
+	if err := s.UnlockUser(userToken.UserID); err != nil {
+		return err
+	}
+
+	log.Printf("Password reset for user %s; all sessions revoked", userToken.UserID)
+	return nil
+}
+
+// VerifyEmail marks the user's email verified using a token from the
+// verification email
+func (s *AuthService) VerifyEmail(token string) error {
+	ctx := context.Background()
+
+	userToken, err := s.userTokenRepo.ConsumeUserToken(ctx, models.TokenPurposeEmailVerification, token)
+	if err != nil {
+		if errors.Is(err, repository.ErrUserTokenInvalid) {
+			return ErrInvalidToken
+		}
+		return err
+	}
+
+	return s.userRepo.MarkEmailVerified(ctx, userToken.UserID)
+}
+
+// sendVerificationEmail mails a link proving the user owns their address
+func (s *AuthService) sendVerificationEmail(ctx context.Context, user *models.User) error {
+	token, err := s.userTokenRepo.CreateUserToken(ctx, user.ID, models.TokenPurposeEmailVerification, EmailVerificationTTL)
+	if err != nil {
+		return err
+	}
+
+	link := s.appURL + "/verify-email?token=" + url.QueryEscape(token)
+	return s.mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Confirm your Golden Market email",
+		Body: fmt.Sprintf(
+			"Hi %s,\n\nWelcome to Golden Market! Please confirm your email address by opening this link:\n\n%s\n\n"+
+				"The link expires in 48 hours.\n",
+			user.FirstName, link),
+	})
+}
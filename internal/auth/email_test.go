@@ -0,0 +1,141 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"sync"
+	"testing"
+
+	"github.com/diorshelton/golden-market-api/internal/mailer"
+	"github.com/diorshelton/golden-market-api/internal/models"
+)
+
+// recordingMailer keeps sent messages so tests can follow emailed links
+type recordingMailer struct {
+	mu       sync.Mutex
+	messages []mailer.Message
+}
+
+func (m *recordingMailer) Send(ctx context.Context, msg mailer.Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messages = append(m.messages, msg)
+	return nil
+}
+
+var linkTokenPattern = regexp.MustCompile(`token=([0-9a-f]{64})`)
+
+// lastToken returns the token in the most recent message sent to email
+func (m *recordingMailer) lastToken(t *testing.T, email string) string {
+	t.Helper()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := len(m.messages) - 1; i >= 0; i-- {
+		if m.messages[i].To != email {
+			continue
+		}
+		match := linkTokenPattern.FindStringSubmatch(m.messages[i].Body)
+		if match == nil {
+			t.Fatalf("No token in message body: %q", m.messages[i].Body)
+		}
+		return match[1]
+	}
+	t.Fatalf("No message sent to %s", email)
+	return ""
+}
+
+func TestPasswordReset(t *testing.T) {
+	service, cleanup := setupTestService(t)
+	defer cleanup()
+
+	mail := &recordingMailer{}
+	service.ConfigureMail(mail, "http://app.test/")
+
+	user, err := service.Register("Flame", "Princess", "flame@example.com", "flameprincess", "password123")
+	if err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+	_, refreshToken, _ := service.Login(user.Email, "password123", models.ClientInfo{})
+
+	// Unknown emails succeed silently
+	sent := len(mail.messages)
+	if err := service.RequestPasswordReset("nobody@example.com"); err != nil {
+		t.Errorf("Expected no error for an unknown email, got %v", err)
+	}
+	if len(mail.messages) != sent {
+		t.Error("Expected no mail for an unknown email")
+	}
+
+	if err := service.RequestPasswordReset(user.Email); err != nil {
+		t.Fatalf("RequestPasswordReset failed: %v", err)
+	}
+	staleToken := mail.lastToken(t, user.Email)
+
+	// A second request replaces the first link
+	if err := service.RequestPasswordReset(user.Email); err != nil {
+		t.Fatalf("RequestPasswordReset failed: %v", err)
+	}
+	token := mail.lastToken(t, user.Email)
+
+	if err := service.ResetPassword(staleToken, "newpassword123"); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Expected superseded token to fail with ErrInvalidToken, got %v", err)
+	}
+	if err := service.ResetPassword(token, "newpassword123"); err != nil {
+		t.Fatalf("ResetPassword failed: %v", err)
+	}
+	if err := service.ResetPassword(token, "anotherpassword"); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Expected reused token to fail with ErrInvalidToken, got %v", err)
+	}
+
+	if _, err := service.Refresh(refreshToken, models.ClientInfo{}); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Expected existing sessions to be revoked, got %v", err)
+	}
+	if _, _, err := service.Login(user.Email, "password123", models.ClientInfo{}); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Expected old password to stop working, got %v", err)
+	}
+	if _, _, err := service.Login(user.Email, "newpassword123", models.ClientInfo{}); err != nil {
+		t.Errorf("Expected new password to work, got %v", err)
+	}
+}
+
+func TestVerifyEmail(t *testing.T) {
+	service, cleanup := setupTestService(t)
+	defer cleanup()
+
+	mail := &recordingMailer{}
+	service.ConfigureMail(mail, "")
+
+	user, err := service.Register("Lumpy", "Space", "lsp@example.com", "lumpyspace", "password123")
+	if err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+	if user.EmailVerifiedAt != nil {
+		t.Fatal("Expected a new account to be unverified")
+	}
+	token := mail.lastToken(t, user.Email)
+
+	if err := service.VerifyEmail("not-a-real-token"); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Expected ErrInvalidToken for a bogus token, got %v", err)
+	}
+	if err := service.VerifyEmail(token); err != nil {
+		t.Fatalf("VerifyEmail failed: %v", err)
+	}
+	if err := service.VerifyEmail(token); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Expected reused token to fail with ErrInvalidToken, got %v", err)
+	}
+
+	// A verification token can't be used to reset the password
+	if err := service.ResetPassword(token, "newpassword123"); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Expected ErrInvalidToken using a verification token for a reset, got %v", err)
+	}
+
+	reloaded, err := service.userRepo.GetUserByID(user.ID)
+	if err != nil {
+		t.Fatalf("Failed to reload user: %v", err)
+	}
+	if reloaded.EmailVerifiedAt == nil {
+		t.Error("Expected email_verified_at to be set")
+	}
+}
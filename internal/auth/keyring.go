@@ -0,0 +1,269 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// minRSABits is the smallest RSA key accepted for RS256
+const minRSABits = 2048
+
+// Keyring holds the key tokens are signed with and every public key tokens
+// are accepted from. Keeping the previous signing key as a verification key
+// lets tokens it issued keep working while a new key is rolled out.
+type Keyring struct {
+	signing *signingKey
+	verify  map[string]*verifyKey
+	order   []string // kids in load order, for a stable JWKS
+}
+
+type signingKey struct {
+	kid     string
+	method  jwt.SigningMethod
+	private crypto.Signer
+}
+
+type verifyKey struct {
+	kid    string
+	method jwt.SigningMethod
+	public crypto.PublicKey
+}
+
+// JWK is a public key in JSON Web Key form (RFC 7517)
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+}
+
+// JWKSet is the document served at /.well-known/jwks.json
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// NewKeyring builds a keyring from a PEM private key to sign with (Ed25519
+// or RSA, PKCS#8 or PKCS#1) and optional extra PEM blocks, public or
+// private, whose public keys are still accepted. Key IDs are RFC 7638
+// thumbprints, so they stay the same wherever a key is loaded.
+func NewKeyring(signingPEM, verifyPEM []byte) (*Keyring, error) {
+	block, _ := pem.Decode(signingPEM)
+	if block == nil {
+		return nil, errors.New("signing key: no PEM block found")
+	}
+	private, err := parsePrivateKey(block)
+	if err != nil {
+		return nil, fmt.Errorf("signing key: %w", err)
+	}
+
+	k := &Keyring{verify: map[string]*verifyKey{}}
+	signingPublic, err := k.add(private.Public())
+	if err != nil {
+		return nil, fmt.Errorf("signing key: %w", err)
+	}
+	k.signing = &signingKey{
+		kid:     signingPublic.kid,
+		method:  signingPublic.method,
+		private: private,
+	}
+
+	for rest := verifyPEM; ; {
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		public, err := parsePublicKey(block)
+		if err != nil {
+			return nil, fmt.Errorf("verification key: %w", err)
+		}
+		if _, err := k.add(public); err != nil {
+			return nil, fmt.Errorf("verification key: %w", err)
+		}
+	}
+
+	return k, nil
+}
+
+// NewEphemeralKeyring generates a throwaway Ed25519 keyring. Tokens it
+// signs stop validating when the process restarts, so it only suits
+// development and tests.
+func NewEphemeralKeyring() *Keyring {
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		// crypto/rand doesn't fail on supported platforms
+		panic(fmt.Sprintf("generating ephemeral signing key: %v", err))
+	}
+
+	k := &Keyring{verify: map[string]*verifyKey{}}
+	public, _ := k.add(private.Public())
+	k.signing = &signingKey{kid: public.kid, method: public.method, private: private}
+	return k
+}
+
+// SigningKeyID returns the kid new tokens are signed with
+func (k *Keyring) SigningKeyID() string {
+	return k.signing.kid
+}
+
+// sign signs claims with the current key and sets the kid header
+func (k *Keyring) sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(k.signing.method, claims)
+	token.Header["kid"] = k.signing.kid
+	return token.SignedString(k.signing.private)
+}
+
+// keyFunc picks the verification key named by a token's kid header,
+// refusing tokens whose alg doesn't match that key
+func (k *Keyring) keyFunc(token *jwt.Token) (any, error) {
+	kid, _ := token.Header["kid"].(string)
+	key, ok := k.verify[kid]
+	if !ok {
+		return nil, ErrInvalidToken
+	}
+	if token.Method.Alg() != key.method.Alg() {
+		return nil, ErrInvalidToken
+	}
+	return key.public, nil
+}
+
+// validMethods lists the algorithms the keyring can verify
+func (k *Keyring) validMethods() []string {
+	seen := map[string]bool{}
+	methods := []string{}
+	for _, kid := range k.order {
+		alg := k.verify[kid].method.Alg()
+		if !seen[alg] {
+			seen[alg] = true
+			methods = append(methods, alg)
+		}
+	}
+	return methods
+}
+
+// JWKS returns every accepted public key, signing key first
+func (k *Keyring) JWKS() JWKSet {
+	set := JWKSet{Keys: make([]JWK, 0, len(k.order))}
+	for _, kid := range k.order {
+		jwk, _ := publicJWK(k.verify[kid].public)
+		jwk.Kid = kid
+		jwk.Use = "sig"
+		jwk.Alg = k.verify[kid].method.Alg()
+		set.Keys = append(set.Keys, jwk)
+	}
+	return set
+}
+
+// add registers a public key for verification, ignoring duplicates
+func (k *Keyring) add(public crypto.PublicKey) (*verifyKey, error) {
+	jwk, err := publicJWK(public)
+	if err != nil {
+		return nil, err
+	}
+	kid := jwkThumbprint(jwk)
+
+	if existing, ok := k.verify[kid]; ok {
+		return existing, nil
+	}
+
+	var method jwt.SigningMethod = jwt.SigningMethodEdDSA
+	if jwk.Kty == "RSA" {
+		method = jwt.SigningMethodRS256
+	}
+
+	key := &verifyKey{kid: kid, method: method, public: public}
+	k.verify[kid] = key
+	k.order = append(k.order, kid)
+	return key, nil
+}
+
+func parsePrivateKey(block *pem.Block) (crypto.Signer, error) {
+	var key any
+	var err error
+	switch block.Type {
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM type %q", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch key := key.(type) {
+	case ed25519.PrivateKey:
+		return key, nil
+	case *rsa.PrivateKey:
+		return key, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %T, want Ed25519 or RSA", key)
+	}
+}
+
+func parsePublicKey(block *pem.Block) (crypto.PublicKey, error) {
+	switch block.Type {
+	case "PUBLIC KEY":
+		return x509.ParsePKIXPublicKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		return x509.ParsePKCS1PublicKey(block.Bytes)
+	default:
+		// A retired private key works too; only its public half is kept
+		private, err := parsePrivateKey(block)
+		if err != nil {
+			return nil, err
+		}
+		return private.Public(), nil
+	}
+}
+
+// publicJWK returns the key-specific members of a JWK
+func publicJWK(public crypto.PublicKey) (JWK, error) {
+	switch key := public.(type) {
+	case ed25519.PublicKey:
+		return JWK{
+			Kty: "OKP",
+			Crv: "Ed25519",
+			X:   base64.RawURLEncoding.EncodeToString(key),
+		}, nil
+	case *rsa.PublicKey:
+		if key.N.BitLen() < minRSABits {
+			return JWK{}, fmt.Errorf("RSA key is %d bits, need at least %d", key.N.BitLen(), minRSABits)
+		}
+		return JWK{
+			Kty: "RSA",
+			N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}, nil
+	default:
+		return JWK{}, fmt.Errorf("unsupported key type %T, want Ed25519 or RSA", public)
+	}
+}
+
+// jwkThumbprint computes the RFC 7638 SHA-256 thumbprint: a hash of the
+// required members in lexicographic order with no whitespace
+func jwkThumbprint(jwk JWK) string {
+	var canonical string
+	if jwk.Kty == "RSA" {
+		canonical = fmt.Sprintf(`{"e":"%s","kty":"RSA","n":"%s"}`, jwk.E, jwk.N)
+	} else {
+		canonical = fmt.Sprintf(`{"crv":"%s","kty":"OKP","x":"%s"}`, jwk.Crv, jwk.X)
+	}
+	sum := sha256.Sum256([]byte(canonical))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
@@ -0,0 +1,182 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func ed25519PEM(t *testing.T) []byte {
+	t.Helper()
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		t.Fatalf("MarshalPKCS8PrivateKey failed: %v", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+}
+
+func rsaPEM(t *testing.T, bits int) []byte {
+	t.Helper()
+	private, err := rsa.GenerateKey(rand.Reader, bits)
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(private)})
+}
+
+func testClaims() jwt.MapClaims {
+	return jwt.MapClaims{
+		"sub": "user",
+		"iss": DefaultIssuer,
+		"aud": DefaultAudience,
+		"exp": time.Now().Add(time.Minute).Unix(),
+	}
+}
+
+func parseWith(k *Keyring, token string, opts ...jwt.ParserOption) error {
+	opts = append([]jwt.ParserOption{
+		jwt.WithValidMethods(k.validMethods()),
+		jwt.WithIssuer(DefaultIssuer),
+		jwt.WithAudience(DefaultAudience),
+	}, opts...)
+	_, err := jwt.Parse(token, k.keyFunc, opts...)
+	return err
+}
+
+func TestJWKThumbprint(t *testing.T) {
+	// RFC 7638 section 3.1
+	rsaKey := JWK{
+		Kty: "RSA",
+		N:   "0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxuhDR1L6tSoc_BJECPebWKRXjBZCiFV4n3oknjhMstn64tZ_2W-5JsGY4Hc5n9yBXArwl93lqt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FDW2QvzqY368QQMicAtaSqzs8KJZgnYb9c7d0zgdAZHzu6qMQvRL5hajrn1n91CbOpbISD08qNLyrdkt-bFTWhAI4vMQFh6WeZu0fM4lFd2NcRwr3XPksINHaQ-G_xBniIqbw0Ls1jF44-csFCur-kEgU8awapJzKnqDKgw",
+		E:   "AQAB",
+	}
+	if got := jwkThumbprint(rsaKey); got != "NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs" {
+		t.Errorf("RSA thumbprint = %s", got)
+	}
+
+	// RFC 8037 appendix A.3
+	okpKey := JWK{Kty: "OKP", Crv: "Ed25519", X: "11qYAYKxCrfVS_7TyWQHOg7hcvPapiMlrwIaaPcHURo"}
+	if got := jwkThumbprint(okpKey); got != "kPrK_qmxVWaYVA9wwBF6Iuo3vVzz7TxHCTwXBygrS4k" {
+		t.Errorf("Ed25519 thumbprint = %s", got)
+	}
+}
+
+func TestKeyringSignAndVerify(t *testing.T) {
+	for name, signingPEM := range map[string][]byte{
+		"EdDSA": ed25519PEM(t),
+		"RS256": rsaPEM(t, 2048),
+	} {
+		t.Run(name, func(t *testing.T) {
+			k, err := NewKeyring(signingPEM, nil)
+			if err != nil {
+				t.Fatalf("NewKeyring failed: %v", err)
+			}
+
+			token, err := k.sign(testClaims())
+			if err != nil {
+				t.Fatalf("sign failed: %v", err)
+			}
+
+			parsed, _, err := jwt.NewParser().ParseUnverified(token, jwt.MapClaims{})
+			if err != nil {
+				t.Fatalf("ParseUnverified failed: %v", err)
+			}
+			if parsed.Header["kid"] != k.SigningKeyID() || parsed.Header["alg"] != name {
+				t.Errorf("Expected kid %s and alg %s, got %v", k.SigningKeyID(), name, parsed.Header)
+			}
+
+			if err := parseWith(k, token); err != nil {
+				t.Errorf("Expected token to verify, got %v", err)
+			}
+
+			jwks := k.JWKS()
+			if len(jwks.Keys) != 1 || jwks.Keys[0].Kid != k.SigningKeyID() || jwks.Keys[0].Alg != name {
+				t.Errorf("Unexpected JWKS: %+v", jwks)
+			}
+		})
+	}
+}
+
+func TestKeyringRotation(t *testing.T) {
+	oldPEM := ed25519PEM(t)
+	newPEM := rsaPEM(t, 2048)
+
+	oldKeys, err := NewKeyring(oldPEM, nil)
+	if err != nil {
+		t.Fatalf("NewKeyring failed: %v", err)
+	}
+	oldToken, _ := oldKeys.sign(testClaims())
+
+	// The retired private key file can be passed straight in as a verify key
+	rotated, err := NewKeyring(newPEM, oldPEM)
+	if err != nil {
+		t.Fatalf("NewKeyring with previous key failed: %v", err)
+	}
+	if err := parseWith(rotated, oldToken); err != nil {
+		t.Errorf("Expected a token from the previous key to verify, got %v", err)
+	}
+	if got := len(rotated.JWKS().Keys); got != 2 {
+		t.Errorf("Expected both keys in the JWKS, got %d", got)
+	}
+	if rotated.JWKS().Keys[0].Kid != rotated.SigningKeyID() {
+		t.Error("Expected the signing key first in the JWKS")
+	}
+
+	// Once the old key is dropped its tokens stop working
+	newOnly, _ := NewKeyring(newPEM, nil)
+	if err := parseWith(newOnly, oldToken); err == nil {
+		t.Error("Expected a token from a removed key to be rejected")
+	}
+}
+
+func TestKeyringRejects(t *testing.T) {
+	k, err := NewKeyring(ed25519PEM(t), nil)
+	if err != nil {
+		t.Fatalf("NewKeyring failed: %v", err)
+	}
+
+	hmacToken, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, testClaims()).SignedString([]byte("secret"))
+	if err := parseWith(k, hmacToken); err == nil {
+		t.Error("Expected an HS256 token to be rejected")
+	}
+
+	// Right key, wrong algorithm in the header
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, testClaims())
+	forged.Header["kid"] = k.SigningKeyID()
+	forgedToken, _ := forged.SignedString([]byte("secret"))
+	if err := parseWith(k, forgedToken); err == nil {
+		t.Error("Expected an HS256 token naming the Ed25519 kid to be rejected")
+	}
+
+	claims := testClaims()
+	claims["aud"] = "some-other-service"
+	wrongAudience, _ := k.sign(claims)
+	if err := parseWith(k, wrongAudience); !errors.Is(err, jwt.ErrTokenInvalidAudience) {
+		t.Errorf("Expected ErrTokenInvalidAudience, got %v", err)
+	}
+
+	claims = testClaims()
+	claims["iss"] = "someone-else"
+	wrongIssuer, _ := k.sign(claims)
+	if err := parseWith(k, wrongIssuer); !errors.Is(err, jwt.ErrTokenInvalidIssuer) {
+		t.Errorf("Expected ErrTokenInvalidIssuer, got %v", err)
+	}
+
+	if _, err := NewKeyring(rsaPEM(t, 1024), nil); err == nil {
+		t.Error("Expected a 1024-bit RSA key to be refused")
+	}
+	if _, err := NewKeyring([]byte("not a pem"), nil); err == nil {
+		t.Error("Expected garbage to be refused")
+	}
+}
@@ -0,0 +1,203 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/diorshelton/golden-market-api/internal/mailer"
+	"github.com/diorshelton/golden-market-api/internal/models"
+	"github.com/diorshelton/golden-market-api/internal/repository"
+	"github.com/google/uuid"
+)
+
+var ErrTooManyLoginAttempts = errors.New("too many failed login attempts")
+
+// Defaults for login lockout, overridable with ConfigureLockout
+const (
+	DefaultMaxLoginFailures      = 10
+	DefaultMaxLoginFailuresPerIP = 50
+	DefaultLoginLockout          = 15 * time.Minute
+
+	// AccountUnlockTTL is how long the link in a lockout email works
+	AccountUnlockTTL = 24 * time.Hour
+
+	// loginFailureWindow is how long a failure counts towards a lockout
+	loginFailureWindow = time.Hour
+)
+
+// LoginThrottledError is returned by Login while an account or IP is locked
+// out. RetryAfter says how long until the next attempt is allowed.
+type LoginThrottledError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LoginThrottledError) Error() string {
+	return ErrTooManyLoginAttempts.Error()
+}
+
+// Is lets errors.Is(err, ErrTooManyLoginAttempts) match
+func (e *LoginThrottledError) Is(target error) bool {
+	return target == ErrTooManyLoginAttempts
+}
+
+// ConfigureLockout sets how many failed logins an account and an IP get
+// within an hour before they are locked out, and for how long. Zero
+// disables the limit.
+func (s *AuthService) ConfigureLockout(maxFailures, maxFailuresPerIP int, lockout time.Duration) {
+	s.maxLoginFailures = maxFailures
+	s.maxLoginFailuresPerIP = maxFailuresPerIP
+	if lockout > 0 {
+		s.loginLockout = lockout
+	}
+}
+
+// accountSubject is what failures are counted against for a login: the
+// account when it exists, otherwise the identifier itself, so unknown
+// emails and usernames lock out exactly like real ones
+func accountSubject(user *models.User, identifier string) string {
+	if user != nil {
+		return user.ID.String()
+	}
+	return "login:" + strings.ToLower(strings.TrimSpace(identifier))
+}
+
+// checkLoginLockout returns a LoginThrottledError if subject may not log in
+// yet
+func (s *AuthService) checkLoginLockout(ctx context.Context, scope models.LoginAttemptScope, subject string) error {
+	if subject == "" {
+		return nil
+	}
+
+	lockedUntil, err := s.loginAttemptRepo.GetLockedUntil(ctx, scope, subject)
+	if err != nil {
+		return err
+	}
+	if wait := time.Until(lockedUntil); wait > 0 {
+		return &LoginThrottledError{RetryAfter: wait}
+	}
+	return nil
+}
+
+// recordLoginFailure counts a failed password against the account and the
+// client IP, delaying or locking out whichever has failed too often. The
+// first time an account is locked its owner is mailed an unlock link.
+func (s *AuthService) recordLoginFailure(ctx context.Context, user *models.User, identifier, ip string) error {
+	accountFailures, err := s.throttle(ctx, models.LoginScopeAccount, accountSubject(user, identifier), s.maxLoginFailures)
+	if err != nil {
+		return err
+	}
+	if _, err := s.throttle(ctx, models.LoginScopeIP, ip, s.maxLoginFailuresPerIP); err != nil {
+		return err
+	}
+
+	if user != nil && s.maxLoginFailures > 0 && accountFailures == s.maxLoginFailures {
+		log.Printf("SECURITY: account %s locked after %d failed logins (last from %s)", user.ID, accountFailures, ip)
+		if err := s.sendUnlockEmail(ctx, user); err != nil {
+			log.Printf("Failed to send unlock email to user %s: %v", user.ID, err)
+		}
+	}
+	return nil
+}
+
+// throttle records one failure for subject and locks it for as long as
+// loginDelay says. It returns the failure count.
+func (s *AuthService) throttle(ctx context.Context, scope models.LoginAttemptScope, subject string, maxFailures int) (int, error) {
+	if subject == "" || maxFailures <= 0 {
+		return 0, nil
+	}
+
+	failures, err := s.loginAttemptRepo.RecordLoginFailure(ctx, scope, subject, loginFailureWindow)
+	if err != nil {
+		return 0, err
+	}
+
+	if delay := loginDelay(failures, maxFailures, s.loginLockout); delay > 0 {
+		if err := s.loginAttemptRepo.LockLogin(ctx, scope, subject, time.Now().Add(delay)); err != nil {
+			return 0, err
+		}
+	}
+	return failures, nil
+}
+
+// clearLoginFailures resets both counters after a correct password
+func (s *AuthService) clearLoginFailures(ctx context.Context, user *models.User, ip string) error {
+	if err := s.loginAttemptRepo.ClearLoginFailures(ctx, models.LoginScopeAccount, user.ID.String()); err != nil {
+		return err
+	}
+	if ip == "" {
+		return nil
+	}
+	return s.loginAttemptRepo.ClearLoginFailures(ctx, models.LoginScopeIP, ip)
+}
+
+// loginDelay is how long to wait after the given number of failures. The
+// first half of maxFailures are free, then the wait doubles from one second
+// with each failure, and at maxFailures it is the full lockout.
+func loginDelay(failures, maxFailures int, lockout time.Duration) time.Duration {
+	if failures >= maxFailures {
+		return lockout
+	}
+
+	free := maxFailures / 2
+	if failures <= free {
+		return 0
+	}
+
+	// Past 2^20 seconds the delay is longer than any sensible lockout
+	shift := failures - free - 1
+	if shift >= 20 {
+		return lockout
+	}
+	return min(time.Second<<shift, lockout)
+}
+
+// UnlockAccount lifts a lockout using the token from the lockout email
+func (s *AuthService) UnlockAccount(token string) error {
+	ctx := context.Background()
+
+	userToken, err := s.userTokenRepo.ConsumeUserToken(ctx, models.TokenPurposeAccountUnlock, token)
+	if err != nil {
+		if errors.Is(err, repository.ErrUserTokenInvalid) {
+			return ErrInvalidToken
+		}
+		return err
+	}
+
+	return s.UnlockUser(userToken.UserID)
+}
+
+// UnlockUser lifts a lockout on an account, for admins and the unlock link
+func (s *AuthService) UnlockUser(userID uuid.UUID) error {
+	return s.loginAttemptRepo.ClearLoginFailures(context.Background(), models.LoginScopeAccount, userID.String())
+}
+
+// PruneLoginAttempts forgets failure counters that no longer matter
+func (s *AuthService) PruneLoginAttempts(ctx context.Context) (int64, error) {
+	return s.loginAttemptRepo.DeleteStaleLoginAttempts(ctx, loginFailureWindow)
+}
+
+// sendUnlockEmail tells a user their account was locked and mails a link
+// that lifts the lockout early
+func (s *AuthService) sendUnlockEmail(ctx context.Context, user *models.User) error {
+	token, err := s.userTokenRepo.CreateUserToken(ctx, user.ID, models.TokenPurposeAccountUnlock, AccountUnlockTTL)
+	if err != nil {
+		return err
+	}
+
+	link := s.appURL + "/unlock-account?token=" + url.QueryEscape(token)
+	return s.mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Your Golden Market account was locked",
+		Body: fmt.Sprintf(
+			"Hi %s,\n\nThere were too many failed attempts to log in to your Golden Market account, "+
+				"so logins are paused for the next %d minutes.\n\n"+
+				"If that was you, you can unlock your account now with this link:\n\n%s\n\n"+
+				"If it wasn't, someone may be guessing your password. Consider resetting it.\n",
+			user.FirstName, int(s.loginLockout.Round(time.Minute)/time.Minute), link),
+	})
+}
@@ -0,0 +1,171 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/diorshelton/golden-market-api/internal/models"
+)
+
+func TestLoginDelay(t *testing.T) {
+	lockout := 15 * time.Minute
+
+	tests := []struct {
+		failures    int
+		maxFailures int
+		want        time.Duration
+	}{
+		{failures: 1, maxFailures: 10, want: 0},
+		{failures: 5, maxFailures: 10, want: 0},
+		{failures: 6, maxFailures: 10, want: time.Second},
+		{failures: 7, maxFailures: 10, want: 2 * time.Second},
+		{failures: 9, maxFailures: 10, want: 8 * time.Second},
+		{failures: 10, maxFailures: 10, want: lockout},
+		{failures: 11, maxFailures: 10, want: lockout},
+		{failures: 40, maxFailures: 50, want: lockout}, // 2^14s is capped
+		{failures: 200, maxFailures: 1000, want: 0},
+		{failures: 900, maxFailures: 1000, want: lockout},
+	}
+
+	for _, tt := range tests {
+		if got := loginDelay(tt.failures, tt.maxFailures, lockout); got != tt.want {
+			t.Errorf("loginDelay(%d, %d) = %v, want %v", tt.failures, tt.maxFailures, got, tt.want)
+		}
+	}
+}
+
+func TestLoginLockout(t *testing.T) {
+	service, cleanup := setupTestService(t)
+	defer cleanup()
+
+	mail := &recordingMailer{}
+	service.ConfigureMail(mail, "http://app.test")
+	service.ConfigureLockout(2, 0, time.Hour)
+
+	user, err := service.Register("Lumpy", "Space", "lsp@example.com", "lumpyspace", "password123")
+	if err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+	client := models.ClientInfo{IPAddress: "203.0.113.7"}
+
+	// A success resets the count
+	if _, _, err := service.Login(user.Email, "wrong", client); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("Expected ErrInvalidCredentials, got %v", err)
+	}
+	if _, _, err := service.Login(user.Email, "password123", client); err != nil {
+		t.Fatalf("Expected the right password to work before the limit, got %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, _, err := service.Login(user.Email, "wrong", client); !errors.Is(err, ErrInvalidCredentials) {
+			t.Fatalf("Attempt %d: expected ErrInvalidCredentials, got %v", i+1, err)
+		}
+	}
+
+	var throttled *LoginThrottledError
+	if _, _, err := service.Login(user.Email, "password123", client); !errors.As(err, &throttled) {
+		t.Fatalf("Expected a locked account to refuse even the right password, got %v", err)
+	}
+	if throttled.RetryAfter <= 0 || throttled.RetryAfter > time.Hour {
+		t.Errorf("Expected RetryAfter within the lockout, got %v", throttled.RetryAfter)
+	}
+
+	// The lockout email's link lifts it
+	if err := service.UnlockAccount(mail.lastToken(t, user.Email)); err != nil {
+		t.Fatalf("UnlockAccount failed: %v", err)
+	}
+	if _, _, err := service.Login(user.Email, "password123", client); err != nil {
+		t.Errorf("Expected login after unlocking, got %v", err)
+	}
+}
+
+func TestLoginLockoutUnknownEmail(t *testing.T) {
+	service, cleanup := setupTestService(t)
+	defer cleanup()
+
+	mail := &recordingMailer{}
+	service.ConfigureMail(mail, "http://app.test")
+	service.ConfigureLockout(1, 0, time.Hour)
+
+	// An unregistered email locks out just like a real account would
+	if _, _, err := service.Login("nobody@example.com", "guess", models.ClientInfo{}); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("Expected ErrInvalidCredentials, got %v", err)
+	}
+	if _, _, err := service.Login("NOBODY@example.com", "guess", models.ClientInfo{}); !errors.Is(err, ErrTooManyLoginAttempts) {
+		t.Errorf("Expected ErrTooManyLoginAttempts, got %v", err)
+	}
+	if len(mail.messages) != 0 {
+		t.Errorf("Expected no email for an unknown address, got %d", len(mail.messages))
+	}
+}
+
+func TestLoginLockoutPerIP(t *testing.T) {
+	service, cleanup := setupTestService(t)
+	defer cleanup()
+
+	service.ConfigureLockout(0, 2, time.Hour)
+	client := models.ClientInfo{IPAddress: "198.51.100.9"}
+
+	// Guesses spread over accounts still add up against the IP
+	service.Login("a@example.com", "guess", client)
+	service.Login("b@example.com", "guess", client)
+
+	if _, _, err := service.Login("c@example.com", "guess", client); !errors.Is(err, ErrTooManyLoginAttempts) {
+		t.Errorf("Expected ErrTooManyLoginAttempts for the IP, got %v", err)
+	}
+	if _, _, err := service.Login("c@example.com", "guess", models.ClientInfo{IPAddress: "198.51.100.10"}); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Expected another IP to be unaffected, got %v", err)
+	}
+}
+
+func TestLoginLockoutMFA(t *testing.T) {
+	service, cleanup := setupTestService(t)
+	defer cleanup()
+
+	service.ConfigureLockout(2, 0, time.Hour)
+
+	user, err := service.Register("Tree", "Trunks", "treetrunks@example.com", "treetrunks", "password123")
+	if err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+	enrollment, err := service.EnrollMFA(user.ID)
+	if err != nil {
+		t.Fatalf("EnrollMFA failed: %v", err)
+	}
+	secret, err := totpEncoding.DecodeString(enrollment.Secret)
+	if err != nil {
+		t.Fatalf("Secret is not base32: %v", err)
+	}
+	step := totpStep(time.Now())
+	if err := service.ConfirmMFA(user.ID, user.ID, totpCode(secret, step)); err != nil {
+		t.Fatalf("ConfirmMFA failed: %v", err)
+	}
+	client := models.ClientInfo{IPAddress: "203.0.113.9"}
+
+	_, _, err = service.Login(user.Email, "password123", client)
+	var mfaErr *MFARequiredError
+	if !errors.As(err, &mfaErr) {
+		t.Fatalf("Expected MFARequiredError, got %v", err)
+	}
+
+	// Wrong codes lock the account even with the password known
+	for i := 0; i < 2; i++ {
+		if _, _, err := service.LoginMFA(mfaErr.Token, totpCode(secret, step+5), client); !errors.Is(err, ErrInvalidMFACode) {
+			t.Fatalf("Attempt %d: expected ErrInvalidMFACode, got %v", i+1, err)
+		}
+	}
+	if _, _, err := service.LoginMFA(mfaErr.Token, totpCode(secret, step+1), client); !errors.Is(err, ErrTooManyLoginAttempts) {
+		t.Errorf("Expected the right code to be refused while locked, got %v", err)
+	}
+	if _, _, err := service.Login(user.Email, "password123", client); !errors.Is(err, ErrTooManyLoginAttempts) {
+		t.Errorf("Expected the password step to be locked too, got %v", err)
+	}
+
+	if err := service.UnlockUser(user.ID); err != nil {
+		t.Fatalf("UnlockUser failed: %v", err)
+	}
+	if _, _, err := service.LoginMFA(mfaErr.Token, totpCode(secret, step+1), client); err != nil {
+		t.Errorf("Expected the right code to work after unlocking, got %v", err)
+	}
+}
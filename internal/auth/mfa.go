@@ -0,0 +1,321 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/diorshelton/golden-market-api/internal/models"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+var (
+	ErrMFARequired       = errors.New("two-factor authentication required")
+	ErrInvalidMFACode    = errors.New("invalid authentication code")
+	ErrMFAAlreadyEnabled = errors.New("two-factor authentication already enabled")
+	ErrMFANotEnabled     = errors.New("two-factor authentication not enabled")
+	ErrMFANotEnrolled    = errors.New("two-factor enrollment not started")
+	ErrMFAGuest          = errors.New("guest accounts can't use two-factor authentication")
+)
+
+const (
+	// MFAPendingTTL is how long a user has to enter their code after the
+	// password step
+	MFAPendingTTL = 5 * time.Minute
+
+	// recoveryCodeCount codes are issued at enrollment, each usable once
+	recoveryCodeCount = 10
+
+	// mfaPendingType marks tokens that only prove the password step
+	mfaPendingType = "mfa_pending"
+)
+
+// MFARequiredError is returned by Login when the password was right but the
+// account has two-factor on. Token is exchanged at LoginMFA with a code.
+type MFARequiredError struct {
+	Token string
+}
+
+func (e *MFARequiredError) Error() string {
+	return ErrMFARequired.Error()
+}
+
+// Is lets errors.Is(err, ErrMFARequired) match
+func (e *MFARequiredError) Is(target error) bool {
+	return target == ErrMFARequired
+}
+
+// MFAEnrollment is what a user needs to set up their authenticator app.
+// The secret and recovery codes are only ever shown here.
+type MFAEnrollment struct {
+	Secret        string   `json:"secret"`
+	OTPAuthURI    string   `json:"otpauth_uri"`
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// ConfigureMFA sets the AES-256 key two-factor secrets are encrypted with
+func (s *AuthService) ConfigureMFA(encryptionKey []byte) {
+	if len(encryptionKey) == 32 {
+		s.mfaKey = encryptionKey
+	}
+}
+
+// deriveMFAKey is the fallback encryption key when none is configured.
+// Changing the JWT secret then makes existing secrets unreadable.
+func deriveMFAKey(jwtSecret string) []byte {
+	sum := sha256.Sum256([]byte("golden-market mfa:" + jwtSecret))
+	return sum[:]
+}
+
+// EnrollMFA starts two-factor setup for a user. It stays off until
+// ConfirmMFA sees a valid code, and enrolling again replaces an unfinished
+// enrollment.
+func (s *AuthService) EnrollMFA(userID uuid.UUID) (*MFAEnrollment, error) {
+	ctx := context.Background()
+
+	user, err := s.userRepo.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.IsGuest {
+		return nil, ErrMFAGuest
+	}
+	if user.MFAEnabledAt != nil {
+		return nil, ErrMFAAlreadyEnabled
+	}
+
+	secret, err := newTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := sealSecret(s.mfaKey, secret)
+	if err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		codes[i], err = newRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		hashes[i] = hashRecoveryCode(codes[i])
+	}
+
+	if err := s.userRepo.StartMFAEnrollment(ctx, userID, sealed, hashes); err != nil {
+		return nil, err
+	}
+
+	return &MFAEnrollment{
+		Secret:        totpEncoding.EncodeToString(secret),
+		OTPAuthURI:    totpURI(secret, user.Email),
+		RecoveryCodes: codes,
+	}, nil
+}
+
+// ConfirmMFA turns two-factor on with a code from the newly enrolled app.
+// Every other session is signed out and every API key revoked, since none
+// of them passed a second factor.
+func (s *AuthService) ConfirmMFA(userID, currentSessionID uuid.UUID, code string) error {
+	ctx := context.Background()
+
+	mfa, err := s.userRepo.GetUserMFA(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if mfa.EnabledAt != nil {
+		return ErrMFAAlreadyEnabled
+	}
+	if mfa.Secret == nil {
+		return ErrMFANotEnrolled
+	}
+
+	secret, err := openSecret(s.mfaKey, mfa.Secret)
+	if err != nil {
+		return err
+	}
+	step, ok := validateTOTP(secret, normalizeMFACode(code), time.Now())
+	if !ok {
+		return ErrInvalidMFACode
+	}
+
+	if err := s.userRepo.EnableMFA(ctx, userID, step); err != nil {
+		return err
+	}
+
+	if err := s.refreshTokenRepo.RevokeAllUserTokens(userID, currentSessionID); err != nil {
+		return err
+	}
+
+	_, err = s.apiKeyRepo.RevokeAllAPIKeys(ctx, userID)
+	return err
+}
+
+// DisableMFA turns two-factor off. It takes the current password and a
+// current code or a recovery code, so a stolen access token alone can't
+// remove the second factor. Wrong guesses at either count towards the login
+// lockout.
+func (s *AuthService) DisableMFA(userID uuid.UUID, password, code string, client models.ClientInfo) error {
+	ctx := context.Background()
+
+	user, err := s.confirmPassword(ctx, userID, password)
+	if err != nil {
+		return err
+	}
+
+	mfa, err := s.userRepo.GetUserMFA(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if mfa.EnabledAt == nil {
+		return ErrMFANotEnabled
+	}
+
+	if err := s.checkMFACode(ctx, user, mfa, code, client.IPAddress); err != nil {
+		return err
+	}
+
+	return s.userRepo.DisableMFA(ctx, userID)
+}
+
+// LoginMFA finishes a two-factor login: it takes the pending token from
+// Login plus a TOTP or recovery code and starts a session. It returns a
+// LoginThrottledError while the account or IP is locked out.
+func (s *AuthService) LoginMFA(mfaToken, code string, client models.ClientInfo) (accessToken string, refreshToken string, err error) {
+	ctx := context.Background()
+
+	claims, err := s.parseToken(mfaToken)
+	if err != nil {
+		return "", "", err
+	}
+	if typ, _ := claims["typ"].(string); typ != mfaPendingType {
+		return "", "", ErrInvalidToken
+	}
+	sub, _ := claims["sub"].(string)
+	userID, err := uuid.Parse(sub)
+	if err != nil {
+		return "", "", ErrInvalidToken
+	}
+
+	user, err := s.userRepo.GetUserByID(userID)
+	if err != nil {
+		return "", "", ErrInvalidToken
+	}
+
+	mfa, err := s.userRepo.GetUserMFA(ctx, userID)
+	if err != nil {
+		return "", "", err
+	}
+	// Two-factor was turned off since the password step; log in again
+	if mfa.EnabledAt == nil {
+		return "", "", ErrInvalidToken
+	}
+
+	if err := s.checkMFACode(ctx, user, mfa, code, client.IPAddress); err != nil {
+		return "", "", err
+	}
+
+	if err := s.clearLoginFailures(ctx, user, client.IPAddress); err != nil {
+		return "", "", err
+	}
+
+	return s.startSession(user, s.refreshTokenTTL, client)
+}
+
+// checkMFACode verifies a code like verifyMFACode, behind the login
+// lockout. Wrong codes count against the same lockout as wrong passwords, so
+// the code can't be guessed from many IPs once the password is known.
+func (s *AuthService) checkMFACode(ctx context.Context, user *models.User, mfa *models.UserMFA, code, ip string) error {
+	if err := s.checkLoginLockout(ctx, models.LoginScopeIP, ip); err != nil {
+		return err
+	}
+	if err := s.checkLoginLockout(ctx, models.LoginScopeAccount, user.ID.String()); err != nil {
+		return err
+	}
+
+	err := s.verifyMFACode(ctx, user.ID, mfa, code)
+	if errors.Is(err, ErrInvalidMFACode) {
+		if err := s.recordLoginFailure(ctx, user, "", ip); err != nil {
+			return err
+		}
+	}
+	return err
+}
+
+// verifyMFACode accepts either a TOTP code, which can't be replayed, or an
+// unused recovery code, which is spent
+func (s *AuthService) verifyMFACode(ctx context.Context, userID uuid.UUID, mfa *models.UserMFA, code string) error {
+	code = normalizeMFACode(code)
+
+	if len(code) == totpDigits {
+		secret, err := openSecret(s.mfaKey, mfa.Secret)
+		if err != nil {
+			return err
+		}
+		step, ok := validateTOTP(secret, code, time.Now())
+		if !ok {
+			return ErrInvalidMFACode
+		}
+		claimed, err := s.userRepo.ClaimMFAStep(ctx, userID, step)
+		if err != nil {
+			return err
+		}
+		if !claimed {
+			return ErrInvalidMFACode
+		}
+		return nil
+	}
+
+	used, err := s.userRepo.UseRecoveryCode(ctx, userID, hashRecoveryCode(code))
+	if err != nil {
+		return err
+	}
+	if !used {
+		return ErrInvalidMFACode
+	}
+	return nil
+}
+
+// generateMFAPendingToken signs a short-lived token proving the password
+// step of a two-factor login. ValidateToken rejects it as an access token.
+func (s *AuthService) generateMFAPendingToken(user *models.User) (string, error) {
+	claims := jwt.MapClaims{
+		"sub": user.ID.String(),
+		"typ": mfaPendingType,
+		"exp": time.Now().Add(MFAPendingTTL).Unix(),
+		"iat": time.Now().Unix(),
+		"iss": s.issuer,
+		"aud": s.audience,
+	}
+
+	return s.keys.sign(claims)
+}
+
+// newRecoveryCode returns 80 random bits as XXXX-XXXX-XXXX-XXXX
+func newRecoveryCode() (string, error) {
+	raw := make([]byte, 10)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+
+	encoded := totpEncoding.EncodeToString(raw)
+	return encoded[0:4] + "-" + encoded[4:8] + "-" + encoded[8:12] + "-" + encoded[12:16], nil
+}
+
+// normalizeMFACode strips the spaces and dashes people type or paste
+func normalizeMFACode(code string) string {
+	return strings.ToUpper(strings.NewReplacer(" ", "", "-", "").Replace(strings.TrimSpace(code)))
+}
+
+// hashRecoveryCode returns the stored form of a recovery code. The codes
+// carry 80 random bits, so a fast hash is enough.
+func hashRecoveryCode(code string) string {
+	sum := sha256.Sum256([]byte(normalizeMFACode(code)))
+	return hex.EncodeToString(sum[:])
+}
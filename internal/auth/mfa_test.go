@@ -0,0 +1,189 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/diorshelton/golden-market-api/internal/models"
+)
+
+func TestMFALogin(t *testing.T) {
+	service, cleanup := setupTestService(t)
+	defer cleanup()
+
+	user, err := service.Register("Hunson", "Abadeer", "hunson@example.com", "hunson", "password123")
+	if err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+	accessToken, _, err := service.Login(user.Email, "password123", models.ClientInfo{})
+	if err != nil {
+		t.Fatalf("Login failed: %v", err)
+	}
+	claims, _ := service.ValidateToken(accessToken)
+	if claims["mfa"] != false {
+		t.Errorf("Expected mfa=false before enrolling, got %v", claims["mfa"])
+	}
+
+	enrollment, err := service.EnrollMFA(user.ID)
+	if err != nil {
+		t.Fatalf("EnrollMFA failed: %v", err)
+	}
+	if len(enrollment.RecoveryCodes) != recoveryCodeCount {
+		t.Fatalf("Expected %d recovery codes, got %d", recoveryCodeCount, len(enrollment.RecoveryCodes))
+	}
+	secret, err := totpEncoding.DecodeString(enrollment.Secret)
+	if err != nil {
+		t.Fatalf("Secret is not base32: %v", err)
+	}
+
+	// Enrolling doesn't turn two-factor on by itself
+	if _, _, err := service.Login(user.Email, "password123", models.ClientInfo{}); err != nil {
+		t.Fatalf("Expected password-only login before confirming, got %v", err)
+	}
+
+	step := totpStep(time.Now())
+	if err := service.ConfirmMFA(user.ID, user.ID, totpCode(secret, step+5)); !errors.Is(err, ErrInvalidMFACode) {
+		t.Errorf("Expected ErrInvalidMFACode for a wrong code, got %v", err)
+	}
+	if err := service.ConfirmMFA(user.ID, user.ID, totpCode(secret, step)); err != nil {
+		t.Fatalf("ConfirmMFA failed: %v", err)
+	}
+
+	_, _, err = service.Login(user.Email, "password123", models.ClientInfo{})
+	var mfaErr *MFARequiredError
+	if !errors.As(err, &mfaErr) || !errors.Is(err, ErrMFARequired) {
+		t.Fatalf("Expected MFARequiredError, got %v", err)
+	}
+	if _, err := service.ValidateToken(mfaErr.Token); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Expected the pending token to be refused as an access token, got %v", err)
+	}
+
+	// The confirming code's step is spent
+	if _, _, err := service.LoginMFA(mfaErr.Token, totpCode(secret, step), models.ClientInfo{}); !errors.Is(err, ErrInvalidMFACode) {
+		t.Errorf("Expected a replayed code to fail, got %v", err)
+	}
+
+	accessToken, _, err = service.LoginMFA(mfaErr.Token, totpCode(secret, step+1), models.ClientInfo{})
+	if err != nil {
+		t.Fatalf("LoginMFA with the next code failed: %v", err)
+	}
+	claims, _ = service.ValidateToken(accessToken)
+	if claims["mfa"] != true {
+		t.Errorf("Expected mfa=true after two-factor login, got %v", claims["mfa"])
+	}
+
+	// Recovery codes work once, with or without dashes
+	recovery := enrollment.RecoveryCodes[0]
+	if _, _, err := service.LoginMFA(mfaErr.Token, recovery, models.ClientInfo{}); err != nil {
+		t.Errorf("LoginMFA with a recovery code failed: %v", err)
+	}
+	if _, _, err := service.LoginMFA(mfaErr.Token, normalizeMFACode(recovery), models.ClientInfo{}); !errors.Is(err, ErrInvalidMFACode) {
+		t.Errorf("Expected a spent recovery code to fail, got %v", err)
+	}
+
+	if err := service.DisableMFA(user.ID, "wrong", enrollment.RecoveryCodes[1], models.ClientInfo{}); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Expected DisableMFA to need the password, got %v", err)
+	}
+	if err := service.DisableMFA(user.ID, "password123", "AAAA-AAAA-AAAA-AAAA", models.ClientInfo{}); !errors.Is(err, ErrInvalidMFACode) {
+		t.Errorf("Expected ErrInvalidMFACode for an unknown recovery code, got %v", err)
+	}
+	if err := service.DisableMFA(user.ID, "password123", enrollment.RecoveryCodes[1], models.ClientInfo{}); err != nil {
+		t.Fatalf("DisableMFA failed: %v", err)
+	}
+	if _, _, err := service.Login(user.Email, "password123", models.ClientInfo{}); err != nil {
+		t.Errorf("Expected password-only login after disabling, got %v", err)
+	}
+}
+
+// TestLoginRefreshToken verifies both the password and the two-factor
+// login hand out a refresh token that Refresh accepts.
+func TestLoginRefreshToken(t *testing.T) {
+	service, cleanup := setupTestService(t)
+	defer cleanup()
+
+	user, err := service.Register("Marceline", "Abadeer", "marceline@example.com", "marceline", "password123")
+	if err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+
+	_, refreshToken, err := service.Login(user.Email, "password123", models.ClientInfo{})
+	if err != nil {
+		t.Fatalf("Login failed: %v", err)
+	}
+	if refreshToken == "" {
+		t.Fatal("Expected a refresh token from Login, got empty string")
+	}
+	if _, err := service.Refresh(refreshToken, models.ClientInfo{}); err != nil {
+		t.Errorf("Refresh refused the token from Login: %v", err)
+	}
+
+	enrollment, err := service.EnrollMFA(user.ID)
+	if err != nil {
+		t.Fatalf("EnrollMFA failed: %v", err)
+	}
+	secret, err := totpEncoding.DecodeString(enrollment.Secret)
+	if err != nil {
+		t.Fatalf("Secret is not base32: %v", err)
+	}
+	step := totpStep(time.Now())
+	if err := service.ConfirmMFA(user.ID, user.ID, totpCode(secret, step)); err != nil {
+		t.Fatalf("ConfirmMFA failed: %v", err)
+	}
+
+	_, _, err = service.Login(user.Email, "password123", models.ClientInfo{})
+	var mfaErr *MFARequiredError
+	if !errors.As(err, &mfaErr) {
+		t.Fatalf("Expected MFARequiredError, got %v", err)
+	}
+
+	_, refreshToken, err = service.LoginMFA(mfaErr.Token, totpCode(secret, step+1), models.ClientInfo{})
+	if err != nil {
+		t.Fatalf("LoginMFA failed: %v", err)
+	}
+	if refreshToken == "" {
+		t.Fatal("Expected a refresh token from LoginMFA, got empty string")
+	}
+	if _, err := service.Refresh(refreshToken, models.ClientInfo{}); err != nil {
+		t.Errorf("Refresh refused the token from LoginMFA: %v", err)
+	}
+}
+
+// TestConfirmMFARevokesAPIKeys verifies keys issued before two-factor was
+// turned on stop working, like the other sessions
+func TestConfirmMFARevokesAPIKeys(t *testing.T) {
+	service, cleanup := setupTestService(t)
+	defer cleanup()
+
+	user, err := service.Register("Flame", "Princess", "flameprincess@example.com", "flameprincess", "password123")
+	if err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+	_, plaintext, err := service.CreateAPIKey(user.ID, "script", []string{models.ScopeOrdersRead}, nil)
+	if err != nil {
+		t.Fatalf("CreateAPIKey failed: %v", err)
+	}
+
+	enrollment, err := service.EnrollMFA(user.ID)
+	if err != nil {
+		t.Fatalf("EnrollMFA failed: %v", err)
+	}
+	secret, err := totpEncoding.DecodeString(enrollment.Secret)
+	if err != nil {
+		t.Fatalf("Secret is not base32: %v", err)
+	}
+	if err := service.ConfirmMFA(user.ID, user.ID, totpCode(secret, totpStep(time.Now()))); err != nil {
+		t.Fatalf("ConfirmMFA failed: %v", err)
+	}
+
+	if _, _, err := service.AuthenticateAPIKey(plaintext); !errors.Is(err, ErrInvalidAPIKey) {
+		t.Errorf("Expected the old API key to be revoked, got %v", err)
+	}
+	keys, err := service.ListAPIKeys(user.ID)
+	if err != nil {
+		t.Fatalf("ListAPIKeys failed: %v", err)
+	}
+	if len(keys) != 0 {
+		t.Errorf("Expected no API keys left, got %d", len(keys))
+	}
+}
@@ -0,0 +1,136 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/diorshelton/golden-market-api/internal/models"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var errUnknownHashFormat = errors.New("unknown password hash format")
+
+// PasswordParams are the argon2id costs new password hashes are made with.
+// Memory is in KiB.
+type PasswordParams struct {
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+}
+
+// DefaultPasswordParams is the OWASP-recommended minimum for argon2id:
+// 19 MiB, two passes, one lane
+var DefaultPasswordParams = PasswordParams{Memory: 19 * 1024, Iterations: 2, Parallelism: 1}
+
+const (
+	argon2SaltLength = 16
+	argon2KeyLength  = 32
+)
+
+// ConfigurePasswordHashing sets the argon2id costs for new hashes. Stored
+// hashes made with other costs keep working and are upgraded at the next
+// login.
+func (s *AuthService) ConfigurePasswordHashing(params PasswordParams) {
+	if params.Memory > 0 && params.Iterations > 0 && params.Parallelism > 0 {
+		s.passwordParams = params
+	}
+}
+
+// hashPassword hashes a password with argon2id, returning it in the PHC
+// string format ($argon2id$v=19$m=...,t=...,p=...$salt$hash) so the
+// algorithm and costs travel with the hash
+func hashPassword(password string, params PasswordParams) (string, error) {
+	salt := make([]byte, argon2SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, argon2KeyLength)
+
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, params.Memory, params.Iterations, params.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+// verifyPassword checks a password against a stored argon2id or legacy
+// bcrypt hash. needsRehash is true when the password was right but the hash
+// isn't argon2id with the current params, so the caller can replace it.
+func verifyPassword(hashedPassword, password string, current PasswordParams) (needsRehash bool, err error) {
+	switch {
+	case strings.HasPrefix(hashedPassword, "$argon2id$"):
+		params, salt, key, err := parseArgon2Hash(hashedPassword)
+		if err != nil {
+			return false, err
+		}
+
+		candidate := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, uint32(len(key)))
+		if subtle.ConstantTimeCompare(candidate, key) != 1 {
+			return false, ErrInvalidCredentials
+		}
+		return params != current, nil
+
+	case strings.HasPrefix(hashedPassword, "$2a$"), strings.HasPrefix(hashedPassword, "$2b$"), strings.HasPrefix(hashedPassword, "$2y$"):
+		if err := bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password)); err != nil {
+			return false, ErrInvalidCredentials
+		}
+		return true, nil
+
+	default:
+		return false, errUnknownHashFormat
+	}
+}
+
+// parseArgon2Hash splits a PHC-format argon2id hash into its parts
+func parseArgon2Hash(encoded string) (PasswordParams, []byte, []byte, error) {
+	// "", "argon2id", "v=19", "m=...,t=...,p=...", salt, hash
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 {
+		return PasswordParams{}, nil, nil, errUnknownHashFormat
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return PasswordParams{}, nil, nil, fmt.Errorf("unsupported argon2 version %q", parts[2])
+	}
+
+	var params PasswordParams
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism); err != nil {
+		return PasswordParams{}, nil, nil, fmt.Errorf("invalid argon2 parameters %q", parts[3])
+	}
+	if params.Memory == 0 || params.Iterations == 0 || params.Parallelism == 0 {
+		return PasswordParams{}, nil, nil, fmt.Errorf("invalid argon2 parameters %q", parts[3])
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return PasswordParams{}, nil, nil, fmt.Errorf("invalid argon2 salt: %w", err)
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return PasswordParams{}, nil, nil, errors.New("invalid argon2 hash")
+	}
+
+	return params, salt, key, nil
+}
+
+// rehashPassword stores a fresh hash of a just-verified password. Failing
+// only means the upgrade is retried at the next login, so it doesn't fail
+// the login.
+func (s *AuthService) rehashPassword(ctx context.Context, user *models.User, password string) {
+	hashed, err := hashPassword(password, s.passwordParams)
+	if err == nil {
+		err = s.userRepo.UpdatePassword(ctx, user.ID, hashed)
+	}
+	if err != nil {
+		log.Printf("Failed to upgrade password hash for user %s: %v", user.ID, err)
+	}
+}
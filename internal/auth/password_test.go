@@ -0,0 +1,135 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/diorshelton/golden-market-api/internal/models"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// fastParams keeps the tests quick; the format is what's under test
+var fastParams = PasswordParams{Memory: 64, Iterations: 1, Parallelism: 1}
+
+func TestHashPassword(t *testing.T) {
+	hash, err := hashPassword("correct horse", fastParams)
+	if err != nil {
+		t.Fatalf("hashPassword failed: %v", err)
+	}
+	if !strings.HasPrefix(hash, "$argon2id$v=19$m=64,t=1,p=1$") {
+		t.Errorf("Expected a PHC argon2id hash, got %q", hash)
+	}
+
+	other, _ := hashPassword("correct horse", fastParams)
+	if other == hash {
+		t.Error("Expected a fresh salt for every hash")
+	}
+
+	if needsRehash, err := verifyPassword(hash, "correct horse", fastParams); err != nil || needsRehash {
+		t.Errorf("Expected a match without rehash, got %v / %v", needsRehash, err)
+	}
+	if _, err := verifyPassword(hash, "correct horse!", fastParams); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Expected ErrInvalidCredentials for a wrong password, got %v", err)
+	}
+
+	// Raising the cost flags hashes made with the old one
+	stronger := PasswordParams{Memory: 128, Iterations: 2, Parallelism: 1}
+	if needsRehash, err := verifyPassword(hash, "correct horse", stronger); err != nil || !needsRehash {
+		t.Errorf("Expected a match needing rehash after a param change, got %v / %v", needsRehash, err)
+	}
+}
+
+func TestVerifyPasswordLongPasswords(t *testing.T) {
+	// bcrypt ignored everything past 72 bytes; argon2id doesn't
+	base := strings.Repeat("ü", 40) // 80 bytes
+	hash, _ := hashPassword(base+"a", fastParams)
+
+	if _, err := verifyPassword(hash, base+"b", fastParams); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Expected passwords differing past 72 bytes to differ, got %v", err)
+	}
+}
+
+func TestVerifyPasswordLegacyBcrypt(t *testing.T) {
+	legacy, err := bcrypt.GenerateFromPassword([]byte("password123"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("GenerateFromPassword failed: %v", err)
+	}
+
+	if needsRehash, err := verifyPassword(string(legacy), "password123", fastParams); err != nil || !needsRehash {
+		t.Errorf("Expected a bcrypt match needing rehash, got %v / %v", needsRehash, err)
+	}
+	if _, err := verifyPassword(string(legacy), "password124", fastParams); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Expected ErrInvalidCredentials, got %v", err)
+	}
+}
+
+func TestVerifyPasswordMalformed(t *testing.T) {
+	for _, hash := range []string{
+		"",
+		"plaintext",
+		"$argon2i$v=19$m=64,t=1,p=1$c2FsdA$aGFzaA",
+		"$argon2id$v=18$m=64,t=1,p=1$c2FsdA$aGFzaA",
+		"$argon2id$v=19$m=0,t=1,p=1$c2FsdA$aGFzaA",
+		"$argon2id$v=19$m=64,t=1,p=1$c2FsdA",
+		"$argon2id$v=19$m=64,t=1,p=1$!!!$aGFzaA",
+	} {
+		if _, err := verifyPassword(hash, "anything", fastParams); err == nil || errors.Is(err, ErrInvalidCredentials) {
+			t.Errorf("verifyPassword(%q): expected a format error, got %v", hash, err)
+		}
+	}
+}
+
+func TestLoginUpgradesBcryptHash(t *testing.T) {
+	service, cleanup := setupTestService(t)
+	defer cleanup()
+	service.ConfigurePasswordHashing(fastParams)
+
+	user, err := service.Register("Peppermint", "Butler", "butler@example.com", "pbutler", "password123")
+	if err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+
+	// Put the account back on a bcrypt hash, as it was before argon2id
+	legacy, _ := bcrypt.GenerateFromPassword([]byte("password123"), bcrypt.MinCost)
+	if err := service.userRepo.UpdatePassword(t.Context(), user.ID, string(legacy)); err != nil {
+		t.Fatalf("UpdatePassword failed: %v", err)
+	}
+
+	if _, _, err := service.Login(user.Email, "password123", models.ClientInfo{}); err != nil {
+		t.Fatalf("Expected the bcrypt password to log in, got %v", err)
+	}
+
+	stored, err := service.userRepo.GetUserByID(user.ID)
+	if err != nil {
+		t.Fatalf("GetUserByID failed: %v", err)
+	}
+	if !strings.HasPrefix(stored.PasswordHash, "$argon2id$") {
+		t.Errorf("Expected the hash to be upgraded to argon2id, got %q", stored.PasswordHash)
+	}
+	if _, _, err := service.Login(user.Email, "password123", models.ClientInfo{}); err != nil {
+		t.Errorf("Expected login with the upgraded hash, got %v", err)
+	}
+}
+
+// BenchmarkHashPassword times one hash at a few cost settings. Run it on the
+// target instance to pick ARGON2_* values that keep a login around 50-100ms:
+//
+//	go test ./internal/auth -run '^$' -bench HashPassword -benchmem
+func BenchmarkHashPassword(b *testing.B) {
+	for _, params := range []PasswordParams{
+		DefaultPasswordParams,
+		{Memory: 46 * 1024, Iterations: 1, Parallelism: 1},
+		{Memory: 64 * 1024, Iterations: 3, Parallelism: 1},
+		{Memory: 64 * 1024, Iterations: 3, Parallelism: 2},
+	} {
+		b.Run(fmt.Sprintf("m=%d,t=%d,p=%d", params.Memory, params.Iterations, params.Parallelism), func(b *testing.B) {
+			for b.Loop() {
+				if _, err := hashPassword("correct horse battery staple", params); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
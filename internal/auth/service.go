@@ -4,13 +4,15 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"log"
+	"strings"
 	"time"
 
+	"github.com/diorshelton/golden-market-api/internal/mailer"
 	"github.com/diorshelton/golden-market-api/internal/models"
 	"github.com/diorshelton/golden-market-api/internal/repository"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
-	"golang.org/x/crypto/bcrypt"
 )
 
 var (
@@ -19,22 +21,56 @@ var (
 	ErrExpiredToken       = errors.New("token has expired")
 	ErrEmailInUse         = errors.New("email already in use")
 	ErrUsernameExists     = errors.New("username already exists")
+	ErrTooManyGuests      = errors.New("too many active guest sessions")
+	ErrNotGuest           = errors.New("account is not a guest")
+	ErrSessionNotFound    = errors.New("session not found")
+)
+
+// Default iss and aud claims, overridable with ConfigureSigning
+const (
+	DefaultIssuer   = "golden-market-api"
+	DefaultAudience = "golden-market"
+)
+
+// Defaults for guest sessions, overridable with ConfigureGuests
+const (
+	DefaultGuestTTL        = 2 * time.Hour
+	DefaultMaxActiveGuests = 500
 )
 
 // AuthService provides authentication functionality
 type AuthService struct {
 	userRepo         *repository.UserRepository
 	refreshTokenRepo *repository.RefreshTokenRepository
-	jwtSecret        []byte
+	userTokenRepo    *repository.UserTokenRepository
+	loginAttemptRepo *repository.LoginAttemptRepository
+	apiKeyRepo       *repository.APIKeyRepository
+	mailer           mailer.Mailer
+	appURL           string
+	mfaKey           []byte
+	keys             *Keyring
+	issuer           string
+	audience         string
 	refreshSecret    []byte
 	accessTokenTTL   time.Duration
 	refreshTokenTTL  time.Duration
+	guestTTL         time.Duration
+	maxActiveGuests  int
+	passwordParams   PasswordParams
+
+	maxLoginFailures      int
+	maxLoginFailuresPerIP int
+	loginLockout          time.Duration
 }
 
 // NewAuthService creates a new authentication service
 func NewAuthService(
 	userRepo *repository.UserRepository,
-	refreshTokenRepo *repository.RefreshTokenRepository, jwtSecret string,
+	refreshTokenRepo *repository.RefreshTokenRepository,
+	userTokenRepo *repository.UserTokenRepository,
+	loginAttemptRepo *repository.LoginAttemptRepository,
+	apiKeyRepo *repository.APIKeyRepository,
+	jwtSecret string,
 	refreshSecret string,
 	accessTokenTTL time.Duration,
 	refreshTokenTTL time.Duration,
@@ -42,15 +78,78 @@ func NewAuthService(
 	return &AuthService{
 		userRepo:         userRepo,
 		refreshTokenRepo: refreshTokenRepo,
-		jwtSecret:        []byte(jwtSecret),
+		userTokenRepo:    userTokenRepo,
+		loginAttemptRepo: loginAttemptRepo,
+		apiKeyRepo:       apiKeyRepo,
+		mailer:           mailer.NewLogMailer(),
+		appURL:           DefaultAppURL,
+		mfaKey:           deriveMFAKey(jwtSecret),
+		keys:             NewEphemeralKeyring(),
+		issuer:           DefaultIssuer,
+		audience:         DefaultAudience,
 		refreshSecret:    []byte(refreshSecret),
 		accessTokenTTL:   accessTokenTTL,
 		refreshTokenTTL:  refreshTokenTTL,
+		guestTTL:         DefaultGuestTTL,
+		maxActiveGuests:  DefaultMaxActiveGuests,
+		passwordParams:   DefaultPasswordParams,
+
+		maxLoginFailures:      DefaultMaxLoginFailures,
+		maxLoginFailuresPerIP: DefaultMaxLoginFailuresPerIP,
+		loginLockout:          DefaultLoginLockout,
+	}
+}
+
+// ConfigureSigning sets the keys tokens are signed and verified with and
+// the iss/aud claims they carry
+func (s *AuthService) ConfigureSigning(keys *Keyring, issuer, audience string) {
+	if keys != nil {
+		s.keys = keys
+	}
+	if issuer != "" {
+		s.issuer = issuer
+	}
+	if audience != "" {
+		s.audience = audience
+	}
+}
+
+// JWKS returns the public keys tokens can be verified with
+func (s *AuthService) JWKS() JWKSet {
+	return s.keys.JWKS()
+}
+
+// ConfigureGuests sets how long a guest account lives and how many may be
+// active at once. maxActive <= 0 removes the cap.
+func (s *AuthService) ConfigureGuests(ttl time.Duration, maxActive int) {
+	if ttl > 0 {
+		s.guestTTL = ttl
+	}
+	s.maxActiveGuests = maxActive
+}
+
+// normalizeEmail is the form emails are stored and compared in
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// takenError maps the repository's uniqueness errors to the service's
+func takenError(err error) error {
+	switch {
+	case errors.Is(err, repository.ErrEmailTaken):
+		return ErrEmailInUse
+	case errors.Is(err, repository.ErrUsernameTaken):
+		return ErrUsernameExists
+	default:
+		return err
 	}
 }
 
-// Register creates a new user with the provided credentials
+// Register creates a new user with the provided credentials. Emails and
+// usernames must be unique ignoring case.
 func (s *AuthService) Register(firstName, lastName, email, username, password string) (*models.User, error) {
+	email = normalizeEmail(email)
+
 	//Check if user already exists
 	_, err := s.userRepo.GetUserByEmail(email)
 	if err == nil {
@@ -69,7 +168,7 @@ func (s *AuthService) Register(firstName, lastName, email, username, password st
 	}
 
 	//Hash the password
-	hashedPassword, err := hashPassword(password)
+	hashedPassword, err := hashPassword(password, s.passwordParams)
 	if err != nil {
 		return nil, err
 	}
@@ -77,30 +176,39 @@ func (s *AuthService) Register(firstName, lastName, email, username, password st
 	//Create the user
 	user, err := s.userRepo.CreateUser(username, firstName, lastName, email, hashedPassword)
 	if err != nil {
-		return nil, err
+		return nil, takenError(err)
+	}
+
+	// The account works unverified, so a mail failure shouldn't fail signup
+	if err := s.sendVerificationEmail(context.Background(), user); err != nil {
+		log.Printf("Failed to send verification email to user %s: %v", user.ID, err)
 	}
+
 	return user, nil
 }
 
-// generateAccessToken creates a new JWT access token
-func (s *AuthService) generateAccessToken(user *models.User) (string, error) {
+// generateAccessToken creates a new JWT access token bound to the session
+// (refresh token family) it was issued for
+func (s *AuthService) generateAccessToken(user *models.User, sessionID uuid.UUID) (string, error) {
 	// Set the expiration time
 	expirationTime := time.Now().Add(s.accessTokenTTL)
 
 	// Create the JWT claims
 	claims := jwt.MapClaims{
-		"sub":      user.ID.String(),      // subject (user ID)
-		"username": user.Username,         // custom claim
-		"email":    user.Email,            // custom claim
-		"exp":      expirationTime.Unix(), // expiration time
-		"iat":      time.Now().Unix(),     // issued at time
+		"sub":      user.ID.String(),         // subject (user ID)
+		"username": user.Username,            // custom claim
+		"email":    user.Email,               // custom claim
+		"role":     user.Role,                // custom claim
+		"sid":      sessionID.String(),       // session (refresh token family)
+		"mfa":      user.MFAEnabledAt != nil, // signed in with a second factor
+		"exp":      expirationTime.Unix(),    // expiration time
+		"iat":      time.Now().Unix(),        // issued at time
+		"iss":      s.issuer,                 // issuer
+		"aud":      s.audience,               // audience
 	}
 
-	// Create the token with claims
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-
-	// Sign the token with secret key
-	tokenString, err := token.SignedString(s.jwtSecret)
+	// Sign the token with the current key; the kid header names it
+	tokenString, err := s.keys.sign(claims)
 	if err != nil {
 		return "", err
 	}
@@ -108,16 +216,31 @@ func (s *AuthService) generateAccessToken(user *models.User) (string, error) {
 	return tokenString, nil
 }
 
-// ValidateToken verifies a JWT token and returns the claim
+// ValidateToken verifies a JWT access token and returns the claim
 func (s *AuthService) ValidateToken(tokenString string) (jwt.MapClaims, error) {
-	// Parse the token
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (any, error) {
-		// Validate the signing method
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, ErrInvalidToken
-		}
-		return s.jwtSecret, nil
-	})
+	claims, err := s.parseToken(tokenString)
+	if err != nil {
+		return nil, err
+	}
+
+	// A half-finished two-factor login is not an access token
+	if typ, _ := claims["typ"].(string); typ == mfaPendingType {
+		return nil, ErrInvalidToken
+	}
+
+	return claims, nil
+}
+
+// parseToken verifies the signature, expiry, issuer and audience of any
+// token this service signs and returns its claims
+func (s *AuthService) parseToken(tokenString string) (jwt.MapClaims, error) {
+	// The keyring picks the key by kid and only allows that key's algorithm
+	token, err := jwt.Parse(tokenString, s.keys.keyFunc,
+		jwt.WithValidMethods(s.keys.validMethods()),
+		jwt.WithIssuer(s.issuer),
+		jwt.WithAudience(s.audience),
+		jwt.WithExpirationRequired(),
+	)
 
 	if err != nil {
 		if errors.Is(err, jwt.ErrTokenExpired) {
@@ -133,93 +256,260 @@ func (s *AuthService) ValidateToken(tokenString string) (jwt.MapClaims, error) {
 	return nil, ErrInvalidToken
 }
 
-// Login authenticates a user and returns both access and refresh tokens
+// Login authenticates a user by email or username and returns both access
+// and refresh tokens
 func (s *AuthService) Login(
-	email, password string) (accessToken string, refreshToken string, err error) {
-	// Get the user from the database
-	user, err := s.userRepo.GetUserByEmail(email)
+	identifier, password string, client models.ClientInfo) (accessToken string, refreshToken string, err error) {
+	ctx := context.Background()
+
+	// An IP guessing across many accounts is stopped before any lookup
+	if err := s.checkLoginLockout(ctx, models.LoginScopeIP, client.IPAddress); err != nil {
+		return "", "", err
+	}
+
+	// Get the user from the database; a missing user is handled like a
+	// wrong password so responses don't reveal which accounts exist
+	user := s.findLoginUser(identifier)
+
+	if err := s.checkLoginLockout(ctx, models.LoginScopeAccount, accountSubject(user, identifier)); err != nil {
+		return "", "", err
+	}
+
+	// Verify the password. With no user, hash it anyway so the response
+	// takes as long as a wrong password for a real account.
+	var needsRehash bool
+	if user != nil {
+		needsRehash, err = verifyPassword(user.PasswordHash, password, s.passwordParams)
+	} else {
+		_, _ = hashPassword(password, s.passwordParams)
+		err = ErrInvalidCredentials
+	}
 	if err != nil {
+		if !errors.Is(err, ErrInvalidCredentials) {
+			log.Printf("Password check for user %s failed: %v", user.ID, err)
+		}
+		if err := s.recordLoginFailure(ctx, user, identifier, client.IPAddress); err != nil {
+			return "", "", err
+		}
 		return "", "", ErrInvalidCredentials
 	}
 
-	// Verify the password
-	if err := verifyPassword(user.PasswordHash, password); err != nil {
-		return "", "", ErrInvalidCredentials
+	// Upgrade bcrypt and outdated argon2id hashes while we have the password
+	if needsRehash {
+		s.rehashPassword(ctx, user, password)
 	}
 
-	// Generate an access token
-	accessToken, err = s.generateAccessToken(user)
-	if err != nil {
-		return "", "", err
+	// With two-factor on, the password only earns a pending token. Failures
+	// are only cleared once the code is right too, so a known password can't
+	// reset the count between guesses at the code.
+	if user.MFAEnabledAt != nil {
+		pendingToken, err := s.generateMFAPendingToken(user)
+		if err != nil {
+			return "", "", err
+		}
+		return "", "", &MFARequiredError{Token: pendingToken}
 	}
 
-	// Create a refresh token (using service's refreshTokenTTL)
-	refreshTokenObj, err := s.refreshTokenRepo.CreateRefreshToken(user.ID, s.refreshTokenTTL)
-	if err != nil {
+	if err := s.clearLoginFailures(ctx, user, client.IPAddress); err != nil {
 		return "", "", err
 	}
 
-	refreshToken = refreshTokenObj.Token
+	return s.startSession(user, s.refreshTokenTTL, client)
+}
+
+// findLoginUser resolves a login identifier to an account, or nil. Anything
+// with an @ is tried as an email first; usernames registered before they
+// were barred from containing one are still found.
+func (s *AuthService) findLoginUser(identifier string) *models.User {
+	identifier = strings.TrimSpace(identifier)
 
-	return accessToken, refreshToken, nil
+	if strings.Contains(identifier, "@") {
+		if user, err := s.userRepo.GetUserByEmail(identifier); err == nil {
+			return user
+		}
+	}
+	if user, err := s.userRepo.GetUserByUsername(identifier); err == nil {
+		return user
+	}
+	return nil
 }
 
-// GuestLogin finds or creates the single shared guest account, wipes its
-// cart/inventory/order history on every login so each session starts fresh,
-// and returns access and refresh tokens like Login does.
-func (s *AuthService) GuestLogin() (accessToken string, refreshToken string, err error) {
-	user, err := s.userRepo.GetGuestUser()
+// startSession creates a refresh token family for a freshly authenticated
+// user and an access token bound to it
+func (s *AuthService) startSession(user *models.User, refreshTTL time.Duration, client models.ClientInfo) (accessToken string, refreshToken string, err error) {
+	// Logging in is how an owner takes back a deletion request
+	if err := s.cancelDeletion(context.Background(), user); err != nil {
+		return "", "", err
+	}
+
+	refreshTokenObj, err := s.refreshTokenRepo.CreateRefreshToken(user.ID, refreshTTL, client)
 	if err != nil {
-		if !errors.Is(err, sql.ErrNoRows) {
-			return "", "", err
-		}
+		return "", "", err
+	}
 
-		randomPassword := uuid.New().String()
-		hashedPassword, hashErr := hashPassword(randomPassword)
-		if hashErr != nil {
-			return "", "", hashErr
-		}
+	accessToken, err = s.generateAccessToken(user, refreshTokenObj.FamilyID)
+	if err != nil {
+		return "", "", err
+	}
 
-		user, err = s.userRepo.CreateGuestUser(hashedPassword)
+	return accessToken, refreshTokenObj.Token, nil
+}
+
+// GuestLogin creates a fresh guest account for this session, so guests
+// never share a cart, orders or balance, and returns access and refresh
+// tokens like Login does. The account expires after the guest TTL.
+func (s *AuthService) GuestLogin(client models.ClientInfo) (accessToken string, refreshToken string, err error) {
+	if s.maxActiveGuests > 0 {
+		active, err := s.userRepo.CountActiveGuests(context.Background())
 		if err != nil {
 			return "", "", err
 		}
-	} else {
-		if err := s.userRepo.ResetGuestData(context.Background(), user.ID); err != nil {
-			return "", "", err
+		if active >= s.maxActiveGuests {
+			return "", "", ErrTooManyGuests
 		}
 	}
 
-	accessToken, err = s.generateAccessToken(user)
+	// Guests never log in with a password; this just fills the column
+	hashedPassword, err := hashPassword(uuid.New().String(), s.passwordParams)
+	if err != nil {
+		return "", "", err
+	}
+
+	user, err := s.userRepo.CreateGuestUser(hashedPassword, time.Now().Add(s.guestTTL))
+	if err != nil {
+		return "", "", err
+	}
+
+	// The session can't outlive the account
+	return s.startSession(user, min(s.refreshTokenTTL, s.guestTTL), client)
+}
+
+// UpgradeGuest registers a guest account in place so its inventory and
+// order history carry over. The guest's refresh tokens are revoked and a new
+// session is returned for the registered account.
+func (s *AuthService) UpgradeGuest(userID uuid.UUID, firstName, lastName, email, username, password string, client models.ClientInfo) (accessToken string, refreshToken string, err error) {
+	user, err := s.userRepo.GetUserByID(userID)
 	if err != nil {
 		return "", "", err
 	}
 
-	refreshTokenObj, err := s.refreshTokenRepo.CreateRefreshToken(user.ID, s.refreshTokenTTL)
+	if !user.IsGuest {
+		return "", "", ErrNotGuest
+	}
+	if user.GuestExpiresAt != nil && time.Now().After(*user.GuestExpiresAt) {
+		return "", "", ErrExpiredToken
+	}
+
+	email = normalizeEmail(email)
+
+	//Check if email or username is taken by another account
+	if _, err := s.userRepo.GetUserByEmail(email); err == nil {
+		return "", "", ErrEmailInUse
+	}
+	_, err = s.userRepo.GetUserByUsername(username)
+	if err == nil {
+		return "", "", ErrUsernameExists
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return "", "", err
+	}
+
+	hashedPassword, err := hashPassword(password, s.passwordParams)
 	if err != nil {
 		return "", "", err
 	}
 
-	refreshToken = refreshTokenObj.Token
+	user.Username = username
+	user.FirstName = firstName
+	user.LastName = lastName
+	user.Email = email
+	user.PasswordHash = hashedPassword
+
+	if err := s.userRepo.UpgradeGuestUser(context.Background(), user); err != nil {
+		return "", "", takenError(err)
+	}
+
+	// The guest session ends here; only the new tokens remain valid
+	if err := s.refreshTokenRepo.RevokeAllUserTokens(user.ID); err != nil {
+		return "", "", err
+	}
+
+	accessToken, refreshToken, err = s.startSession(user, s.refreshTokenTTL, client)
+	if err != nil {
+		return "", "", err
+	}
+
+	if err := s.sendVerificationEmail(context.Background(), user); err != nil {
+		log.Printf("Failed to send verification email to user %s: %v", user.ID, err)
+	}
 
 	return accessToken, refreshToken, nil
 }
 
+// ReapExpiredGuests deletes guest accounts past their expiry along with
+// everything they own
+func (s *AuthService) ReapExpiredGuests(ctx context.Context) (int64, error) {
+	return s.userRepo.DeleteExpiredGuests(ctx)
+}
+
+// StartGuestReaper runs ReapExpiredGuests every interval until ctx is done.
+// Accounts past their deletion grace period and stale login failure
+// counters are removed on the same schedule.
+func (s *AuthService) StartGuestReaper(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				removed, err := s.ReapExpiredGuests(ctx)
+				if err != nil {
+					log.Printf("Guest reaper error: %v", err)
+					continue
+				}
+				if removed > 0 {
+					log.Printf("Guest reaper removed %d expired guest account(s)", removed)
+				}
+
+				purged, err := s.PurgeDeletedAccounts(ctx)
+				if err != nil {
+					log.Printf("Account deletion error: %v", err)
+				} else if purged > 0 {
+					log.Printf("Deleted %d account(s) past their grace period", purged)
+				}
+
+				if _, err := s.PruneLoginAttempts(ctx); err != nil {
+					log.Printf("Login attempt pruning error: %v", err)
+				}
+			}
+		}
+	}()
+}
+
 type TokenPair struct {
 	AccessToken  string `json:"access_token"`
 	RefreshToken string `json:"refresh_token"`
 }
 
-// Refresh creates new access and refresh tokens
-func (s *AuthService) Refresh(oldRefreshToken string) (*TokenPair, error) {
+// Refresh rotates a refresh token: the presented token is marked used and
+// a new one is issued in the same family. A token that was already used or
+// revoked is treated as stolen, so its whole family is revoked and the
+// holder of the latest token has to log in again.
+func (s *AuthService) Refresh(oldRefreshToken string, client models.ClientInfo) (*TokenPair, error) {
+	ctx := context.Background()
+
 	// Retrieve old refresh token
 	token, err := s.refreshTokenRepo.GetRefreshToken(oldRefreshToken)
 	if err != nil {
 		return nil, ErrInvalidToken
 	}
 
-	// Check if the token is valid or expired
-	if token.Revoked {
+	// A used or revoked token being replayed means it leaked
+	if token.Revoked || token.UsedAt != nil {
+		s.revokeReusedFamily(ctx, token)
 		return nil, ErrInvalidToken
 	}
 
@@ -234,20 +524,24 @@ func (s *AuthService) Refresh(oldRefreshToken string) (*TokenPair, error) {
 		return nil, err
 	}
 
-	// Delete old refresh token
-	err = s.refreshTokenRepo.DeleteRefreshToken(oldRefreshToken)
-	if err != nil {
-		return nil, err
+	// Guest sessions end with the account, even before the reaper runs
+	if user.IsGuest && user.GuestExpiresAt != nil && time.Now().After(*user.GuestExpiresAt) {
+		return nil, ErrExpiredToken
 	}
 
-	// Generate a new refresh token (rotated)
-	newRefreshToken, err := s.refreshTokenRepo.CreateRefreshToken(user.ID, s.refreshTokenTTL)
+	// Mark the old token used and issue the next one in its family
+	newRefreshToken, err := s.refreshTokenRepo.RotateRefreshToken(ctx, token, s.refreshTokenTTL, client)
 	if err != nil {
+		if errors.Is(err, repository.ErrRefreshTokenReused) {
+			// Lost a race with another request presenting the same token
+			s.revokeReusedFamily(ctx, token)
+			return nil, ErrInvalidToken
+		}
 		return nil, err
 	}
 
 	// Generate a new access token
-	accessToken, err := s.generateAccessToken(user)
+	accessToken, err := s.generateAccessToken(user, newRefreshToken.FamilyID)
 	if err != nil {
 		return nil, err
 	}
@@ -259,21 +553,50 @@ func (s *AuthService) Refresh(oldRefreshToken string) (*TokenPair, error) {
 	}, nil
 }
 
+// revokeReusedFamily revokes every token in a reused token's family and
+// records the security event
+func (s *AuthService) revokeReusedFamily(ctx context.Context, token *models.RefreshToken) {
+	revoked, err := s.refreshTokenRepo.RevokeFamily(ctx, token.FamilyID)
+	if err != nil {
+		log.Printf("SECURITY: refresh token reuse for user %s (family %s), but revoking the family failed: %v",
+			token.UserID, token.FamilyID, err)
+		return
+	}
+	log.Printf("SECURITY: refresh token reuse for user %s (family %s); revoked %d active token(s)",
+		token.UserID, token.FamilyID, revoked)
+}
+
 func (s *AuthService) Logout(tokenString string) error {
 	return s.refreshTokenRepo.DeleteRefreshToken(tokenString)
 }
 
-// hashPassword hashes a plaintext password using bcrypt
-func hashPassword(password string) (string, error) {
-	hashedBytes, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+// ListSessions returns the user's active sessions, marking the one
+// identified by currentSessionID
+func (s *AuthService) ListSessions(userID, currentSessionID uuid.UUID) ([]models.Session, error) {
+	sessions, err := s.refreshTokenRepo.ListActiveSessions(context.Background(), userID)
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID == currentSessionID
 	}
 
-	return string(hashedBytes), nil
+	return sessions, nil
+}
+
+// RevokeSession signs the user out of one session. Access tokens already
+// issued for it stay valid until they expire.
+func (s *AuthService) RevokeSession(userID, sessionID uuid.UUID) error {
+	err := s.refreshTokenRepo.RevokeUserSession(context.Background(), userID, sessionID)
+	if err != nil && strings.Contains(err.Error(), "not found") {
+		return ErrSessionNotFound
+	}
+	return err
 }
 
-// verifyPassword compares a hashed password with a plaintext password
-func verifyPassword(hashedPassword, providedPassword string) error {
-	return bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(providedPassword))
+// RevokeOtherSessions signs the user out everywhere except the current
+// session
+func (s *AuthService) RevokeOtherSessions(userID, currentSessionID uuid.UUID) error {
+	return s.refreshTokenRepo.RevokeAllUserTokens(userID, currentSessionID)
 }
@@ -1,12 +1,16 @@
 package auth
 
 import (
+	"context"
+	"errors"
 	"os"
 	"testing"
 	"time"
 
 	"github.com/diorshelton/golden-market-api/internal/database"
+	"github.com/diorshelton/golden-market-api/internal/models"
 	"github.com/diorshelton/golden-market-api/internal/repository"
+	"github.com/google/uuid"
 	"github.com/joho/godotenv"
 )
 
@@ -25,10 +29,16 @@ func setupTestService(t *testing.T) (*AuthService, func()) {
 
 	userRepo := repository.NewUserRepository(db)
 	tokenRepo := repository.NewRefreshTokenRepository(db)
+	userTokenRepo := repository.NewUserTokenRepository(db)
+	loginAttemptRepo := repository.NewLoginAttemptRepository(db)
+	apiKeyRepo := repository.NewAPIKeyRepository(db)
 
 	service := NewAuthService(
 		userRepo,
 		tokenRepo,
+		userTokenRepo,
+		loginAttemptRepo,
+		apiKeyRepo,
 		"test_jwt_secret",
 		"test_refresh_secret",
 		time.Minute*15,
@@ -124,34 +134,58 @@ func TestLogin(t *testing.T) {
 	}
 
 	tests := []struct {
-		name     string
-		email    string
-		password string
-		wantErr  error
+		name       string
+		identifier string
+		password   string
+		wantErr    error
 	}{
 		{
-			name:     "successful login",
-			email:    user.Email,
-			password: testPassword,
-			wantErr:  nil,
+			name:       "successful login",
+			identifier: user.Email,
+			password:   testPassword,
+			wantErr:    nil,
 		},
 		{
-			name:     "wrong password",
-			email:    user.Email,
-			password: "wrongpassword",
-			wantErr:  ErrInvalidCredentials,
+			name:       "wrong password",
+			identifier: user.Email,
+			password:   "wrongpassword",
+			wantErr:    ErrInvalidCredentials,
 		},
 		{
-			name:     "non-existent email",
-			email:    "nonexistant@example.com",
-			password: "password",
-			wantErr:  ErrInvalidCredentials,
+			name:       "email in another case",
+			identifier: "OooFinn@Example.com",
+			password:   testPassword,
+			wantErr:    nil,
+		},
+		{
+			name:       "username",
+			identifier: "finn",
+			password:   testPassword,
+			wantErr:    nil,
+		},
+		{
+			name:       "username in another case",
+			identifier: "FINN",
+			password:   testPassword,
+			wantErr:    nil,
+		},
+		{
+			name:       "non-existent email",
+			identifier: "nonexistant@example.com",
+			password:   "password",
+			wantErr:    ErrInvalidCredentials,
+		},
+		{
+			name:       "non-existent username",
+			identifier: "jake",
+			password:   "password",
+			wantErr:    ErrInvalidCredentials,
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			accessToken, refreshToken, err := service.Login(tt.email, tt.password)
+			accessToken, refreshToken, err := service.Login(tt.identifier, tt.password, models.ClientInfo{})
 
 			if tt.wantErr != nil {
 				if err == nil {
@@ -183,13 +217,36 @@ func TestLogin(t *testing.T) {
 	}
 }
 
+func TestRegisterIgnoresCase(t *testing.T) {
+	service, cleanup := setupTestService(t)
+	defer cleanup()
+
+	user, err := service.Register("Bob", "Builder", " Bob@Example.com ", "BobTheBuilder", "password123")
+	if err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+	if user.Email != "bob@example.com" {
+		t.Errorf("Expected the email to be stored lowercased, got %q", user.Email)
+	}
+	if user.Username != "BobTheBuilder" {
+		t.Errorf("Expected the username to keep its case, got %q", user.Username)
+	}
+
+	if _, err := service.Register("Bob", "Builder", "bob@EXAMPLE.com", "bob2", "password123"); !errors.Is(err, ErrEmailInUse) {
+		t.Errorf("Expected ErrEmailInUse for the same email in another case, got %v", err)
+	}
+	if _, err := service.Register("Bob", "Builder", "bob2@example.com", "bobthebuilder", "password123"); !errors.Is(err, ErrUsernameExists) {
+		t.Errorf("Expected ErrUsernameExists for the same username in another case, got %v", err)
+	}
+}
+
 func TestRefresh(t *testing.T) {
 	service, cleanup := setupTestService(t)
 	defer cleanup()
 
 	// Create test user and login
 	user, _ := service.Register("Cosmic", "Owl", "cosmico@example.com", "cosmico", "password123")
-	_, refreshToken, _ := service.Login(user.Email, "password123")
+	_, refreshToken, _ := service.Login(user.Email, "password123", models.ClientInfo{})
 
 	tests := []struct {
 		name    string
@@ -215,7 +272,7 @@ func TestRefresh(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			tokenPair, err := service.Refresh(tt.token)
+			tokenPair, err := service.Refresh(tt.token, models.ClientInfo{})
 
 			if tt.wantErr != nil {
 				if err == nil {
@@ -235,13 +292,16 @@ func TestRefresh(t *testing.T) {
 				t.Error("Expected new refresh token")
 			}
 
-			// Verify old token was deleted
-			_, err = service.refreshTokenRepo.GetRefreshToken(tt.token)
-			if err == nil {
-				t.Error("Expected old token to be deleted")
+			// Verify old token was kept but marked used
+			oldTokenRecord, err := service.refreshTokenRepo.GetRefreshToken(tt.token)
+			if err != nil {
+				t.Fatalf("Failed to retrieve old refresh token: %v", err)
+			}
+			if oldTokenRecord.UsedAt == nil {
+				t.Error("Expected old token to be marked used")
 			}
 
-			// Verify new token exists
+			// Verify new token exists in the same family
 			newTokenRecord, err := service.refreshTokenRepo.GetRefreshToken(tokenPair.RefreshToken)
 			if err != nil {
 				t.Fatalf("Failed to retrieve new refresh token: %v", err)
@@ -249,10 +309,43 @@ func TestRefresh(t *testing.T) {
 			if newTokenRecord.UserID != user.ID {
 				t.Error("New token should belong to same user")
 			}
+			if newTokenRecord.FamilyID != oldTokenRecord.FamilyID {
+				t.Error("New token should stay in the old token's family")
+			}
 		})
 	}
 }
 
+func TestRefreshTokenReuseRevokesFamily(t *testing.T) {
+	service, cleanup := setupTestService(t)
+	defer cleanup()
+
+	user, _ := service.Register("Lemon", "Grab", "lemongrab@example.com", "lemongrab", "password123")
+	_, first, _ := service.Login(user.Email, "password123", models.ClientInfo{})
+
+	// An unrelated session for the same user must survive
+	_, otherSession, _ := service.Login(user.Email, "password123", models.ClientInfo{})
+
+	pair, err := service.Refresh(first, models.ClientInfo{})
+	if err != nil {
+		t.Fatalf("First refresh failed: %v", err)
+	}
+
+	// Replaying the rotated token looks like theft
+	if _, err := service.Refresh(first, models.ClientInfo{}); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Expected replayed token to fail with ErrInvalidToken, got %v", err)
+	}
+
+	// The legitimate successor was revoked along with the family
+	if _, err := service.Refresh(pair.RefreshToken, models.ClientInfo{}); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Expected successor token to be revoked, got %v", err)
+	}
+
+	if _, err := service.Refresh(otherSession, models.ClientInfo{}); err != nil {
+		t.Errorf("Expected a separate login's family to be unaffected, got %v", err)
+	}
+}
+
 func TestRefreshWithExpiredToken(t *testing.T) {
 	service, cleanup := setupTestService(t)
 	defer cleanup()
@@ -261,9 +354,9 @@ func TestRefreshWithExpiredToken(t *testing.T) {
 	user, _ := service.Register("Marceline", "Abadeer", "MarcelineTheVampireQueen@example.com", "marcelinequeen", "password123")
 
 	// Create an expired refresh token
-	expiredToken, _ := service.refreshTokenRepo.CreateRefreshToken(user.ID, -1*time.Hour)
+	expiredToken, _ := service.refreshTokenRepo.CreateRefreshToken(user.ID, -1*time.Hour, models.ClientInfo{})
 
-	_, err := service.Refresh(expiredToken.Token)
+	_, err := service.Refresh(expiredToken.Token, models.ClientInfo{})
 	if err != ErrExpiredToken {
 		t.Errorf("Expected ErrExpiredToken, got %v", err)
 	}
@@ -275,7 +368,7 @@ func TestLogout(t *testing.T) {
 
 	// Create test user and login
 	user, _ := service.Register("Peppermint", "Butler", "Pepbut@example.com", "pepbut", "password123")
-	_, refreshToken, _ := service.Login(user.Email, "password123")
+	_, refreshToken, _ := service.Login(user.Email, "password123", models.ClientInfo{})
 
 	// Logout
 	err := service.Logout(refreshToken)
@@ -289,3 +382,221 @@ func TestLogout(t *testing.T) {
 		t.Error("Expected token to be deleted after logout")
 	}
 }
+
+func TestGuestLoginCreatesSeparateAccounts(t *testing.T) {
+	service, cleanup := setupTestService(t)
+	defer cleanup()
+
+	_, firstRefresh, err := service.GuestLogin(models.ClientInfo{})
+	if err != nil {
+		t.Fatalf("First guest login failed: %v", err)
+	}
+	_, secondRefresh, err := service.GuestLogin(models.ClientInfo{})
+	if err != nil {
+		t.Fatalf("Second guest login failed: %v", err)
+	}
+
+	first, _ := service.refreshTokenRepo.GetRefreshToken(firstRefresh)
+	second, _ := service.refreshTokenRepo.GetRefreshToken(secondRefresh)
+	if first == nil || second == nil {
+		t.Fatal("Expected both guest sessions to have refresh tokens")
+	}
+	if first.UserID == second.UserID {
+		t.Error("Expected each guest login to get its own account")
+	}
+
+	guest, err := service.userRepo.GetUserByID(first.UserID)
+	if err != nil {
+		t.Fatalf("Failed to load guest: %v", err)
+	}
+	if !guest.IsGuest || guest.GuestExpiresAt == nil {
+		t.Errorf("Expected an expiring guest account, got %+v", guest)
+	}
+	if guest.Balance != 5000 {
+		t.Errorf("Expected guest to start with 5000 coins, got %d", guest.Balance)
+	}
+}
+
+func TestGuestLoginCap(t *testing.T) {
+	service, cleanup := setupTestService(t)
+	defer cleanup()
+
+	active, err := service.userRepo.CountActiveGuests(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to count guests: %v", err)
+	}
+	service.ConfigureGuests(time.Hour, active+1)
+
+	if _, _, err := service.GuestLogin(models.ClientInfo{}); err != nil {
+		t.Fatalf("Guest login under the cap failed: %v", err)
+	}
+	if _, _, err := service.GuestLogin(models.ClientInfo{}); !errors.Is(err, ErrTooManyGuests) {
+		t.Errorf("Expected ErrTooManyGuests at the cap, got %v", err)
+	}
+}
+
+func TestReapExpiredGuests(t *testing.T) {
+	service, cleanup := setupTestService(t)
+	defer cleanup()
+
+	ctx := context.Background()
+
+	service.ConfigureGuests(time.Millisecond, 0)
+	_, refreshToken, err := service.GuestLogin(models.ClientInfo{})
+	if err != nil {
+		t.Fatalf("Guest login failed: %v", err)
+	}
+	token, err := service.refreshTokenRepo.GetRefreshToken(refreshToken)
+	if err != nil {
+		t.Fatalf("Failed to load refresh token: %v", err)
+	}
+
+	time.Sleep(5 * time.Millisecond)
+
+	if _, err := service.Refresh(refreshToken, models.ClientInfo{}); !errors.Is(err, ErrExpiredToken) {
+		t.Errorf("Expected refresh of an expired guest to fail with ErrExpiredToken, got %v", err)
+	}
+
+	removed, err := service.ReapExpiredGuests(ctx)
+	if err != nil {
+		t.Fatalf("ReapExpiredGuests failed: %v", err)
+	}
+	if removed < 1 {
+		t.Errorf("Expected at least one guest reaped, got %d", removed)
+	}
+
+	if _, err := service.userRepo.GetUserByID(token.UserID); err == nil {
+		t.Error("Expected expired guest to be deleted")
+	}
+}
+
+func TestUpgradeGuest(t *testing.T) {
+	service, cleanup := setupTestService(t)
+	defer cleanup()
+
+	_, guestRefresh, err := service.GuestLogin(models.ClientInfo{})
+	if err != nil {
+		t.Fatalf("Guest login failed: %v", err)
+	}
+	token, err := service.refreshTokenRepo.GetRefreshToken(guestRefresh)
+	if err != nil {
+		t.Fatalf("Failed to load guest refresh token: %v", err)
+	}
+	guestID := token.UserID
+
+	suffix := time.Now().Format("150405.000000")
+	email := "upgraded" + suffix + "@example.com"
+	_, newRefresh, err := service.UpgradeGuest(guestID, "Fionna", "Campbell", email, "fionna"+suffix, "password123", models.ClientInfo{})
+	if err != nil {
+		t.Fatalf("UpgradeGuest failed: %v", err)
+	}
+
+	user, err := service.userRepo.GetUserByID(guestID)
+	if err != nil {
+		t.Fatalf("Failed to reload user: %v", err)
+	}
+	if user.IsGuest || user.GuestExpiresAt != nil || user.Email != email {
+		t.Errorf("Expected a registered account keeping the guest's ID, got %+v", user)
+	}
+
+	if _, err := service.Refresh(guestRefresh, models.ClientInfo{}); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Expected guest refresh token to be revoked, got %v", err)
+	}
+	if _, err := service.Refresh(newRefresh, models.ClientInfo{}); err != nil {
+		t.Errorf("Expected new refresh token to work, got %v", err)
+	}
+	if _, _, err := service.Login(email, "password123", models.ClientInfo{}); err != nil {
+		t.Errorf("Expected login with the new credentials to work, got %v", err)
+	}
+
+	if _, _, err := service.UpgradeGuest(guestID, "Fionna", "Campbell", "other"+suffix+"@example.com", "other"+suffix, "password123", models.ClientInfo{}); !errors.Is(err, ErrNotGuest) {
+		t.Errorf("Expected second upgrade to fail with ErrNotGuest, got %v", err)
+	}
+}
+
+func TestSessions(t *testing.T) {
+	service, cleanup := setupTestService(t)
+	defer cleanup()
+
+	user, _ := service.Register("Princess", "Bubblegum", "pb@example.com", "bubblegum", "password123")
+	laptop := models.ClientInfo{UserAgent: "Firefox on Linux", IPAddress: "10.0.0.1"}
+	phone := models.ClientInfo{UserAgent: "Safari on iOS", IPAddress: "10.0.0.2"}
+
+	accessToken, _, err := service.Login(user.Email, "password123", laptop)
+	if err != nil {
+		t.Fatalf("Login failed: %v", err)
+	}
+	_, phoneRefresh, _ := service.Login(user.Email, "password123", phone)
+	_, tabletRefresh, _ := service.Login(user.Email, "password123", models.ClientInfo{})
+
+	claims, err := service.ValidateToken(accessToken)
+	if err != nil {
+		t.Fatalf("ValidateToken failed: %v", err)
+	}
+	current, err := uuid.Parse(claims["sid"].(string))
+	if err != nil {
+		t.Fatalf("Expected a sid claim, got %v", claims["sid"])
+	}
+
+	// Rotating keeps the session but records the latest device details
+	phoneOnWifi := models.ClientInfo{UserAgent: "Safari on iOS", IPAddress: "10.0.0.3"}
+	if _, err := service.Refresh(phoneRefresh, phoneOnWifi); err != nil {
+		t.Fatalf("Refresh failed: %v", err)
+	}
+
+	sessions, err := service.ListSessions(user.ID, current)
+	if err != nil {
+		t.Fatalf("ListSessions failed: %v", err)
+	}
+	if len(sessions) != 3 {
+		t.Fatalf("Expected 3 sessions, got %d", len(sessions))
+	}
+
+	var phoneSession *models.Session
+	currentCount := 0
+	for i := range sessions {
+		if sessions[i].Current {
+			currentCount++
+			if sessions[i].ID != current || sessions[i].UserAgent != laptop.UserAgent {
+				t.Errorf("Wrong session marked current: %+v", sessions[i])
+			}
+		}
+		if sessions[i].UserAgent == phone.UserAgent {
+			phoneSession = &sessions[i]
+		}
+	}
+	if currentCount != 1 {
+		t.Errorf("Expected exactly one current session, got %d", currentCount)
+	}
+	if phoneSession == nil || phoneSession.IPAddress != phoneOnWifi.IPAddress {
+		t.Fatalf("Expected the phone session with its latest IP, got %+v", phoneSession)
+	}
+	if !phoneSession.LastUsedAt.After(phoneSession.CreatedAt) {
+		t.Errorf("Expected last_used_at after created_at, got %v and %v", phoneSession.LastUsedAt, phoneSession.CreatedAt)
+	}
+
+	if err := service.RevokeSession(user.ID, phoneSession.ID); err != nil {
+		t.Fatalf("RevokeSession failed: %v", err)
+	}
+	if err := service.RevokeSession(user.ID, phoneSession.ID); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("Expected ErrSessionNotFound revoking twice, got %v", err)
+	}
+	if err := service.RevokeSession(uuid.New(), current); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("Expected ErrSessionNotFound for another user's session, got %v", err)
+	}
+
+	if err := service.RevokeOtherSessions(user.ID, current); err != nil {
+		t.Fatalf("RevokeOtherSessions failed: %v", err)
+	}
+	if _, err := service.Refresh(tabletRefresh, models.ClientInfo{}); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Expected other session to be revoked, got %v", err)
+	}
+
+	sessions, err = service.ListSessions(user.ID, current)
+	if err != nil {
+		t.Fatalf("ListSessions failed: %v", err)
+	}
+	if len(sessions) != 1 || !sessions[0].Current {
+		t.Errorf("Expected only the current session to remain, got %+v", sessions)
+	}
+}
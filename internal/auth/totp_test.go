@@ -0,0 +1,81 @@
+package auth
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTOTPCode(t *testing.T) {
+	// RFC 6238 appendix B SHA1 vectors, truncated to six digits
+	secret := []byte("12345678901234567890")
+
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+
+	for _, tt := range tests {
+		if got := totpCode(secret, totpStep(time.Unix(tt.unix, 0))); got != tt.want {
+			t.Errorf("totpCode at %d = %s, want %s", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	secret := []byte("12345678901234567890")
+	now := time.Unix(1234567890, 0)
+	code := totpCode(secret, totpStep(now))
+
+	if step, ok := validateTOTP(secret, code, now); !ok || step != totpStep(now) {
+		t.Errorf("Expected current code to validate at step %d, got %d, %v", totpStep(now), step, ok)
+	}
+	if _, ok := validateTOTP(secret, code, now.Add(totpPeriod)); !ok {
+		t.Error("Expected the previous step's code to be accepted for clock skew")
+	}
+	if _, ok := validateTOTP(secret, code, now.Add(3*totpPeriod)); ok {
+		t.Error("Expected a code three steps old to be rejected")
+	}
+	if _, ok := validateTOTP(secret, "12345", now); ok {
+		t.Error("Expected a short code to be rejected")
+	}
+}
+
+func TestTOTPURI(t *testing.T) {
+	uri := totpURI([]byte("12345678901234567890"), "finn@example.com")
+
+	if !strings.HasPrefix(uri, "otpauth://totp/Golden%20Market:finn@example.com?") {
+		t.Errorf("Unexpected URI label: %s", uri)
+	}
+	if !strings.Contains(uri, "secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ") || !strings.Contains(uri, "issuer=Golden+Market") {
+		t.Errorf("Expected base32 secret and issuer in URI: %s", uri)
+	}
+}
+
+func TestSealSecret(t *testing.T) {
+	key := bytes.Repeat([]byte{7}, 32)
+	secret := []byte("12345678901234567890")
+
+	sealed, err := sealSecret(key, secret)
+	if err != nil {
+		t.Fatalf("sealSecret failed: %v", err)
+	}
+	if bytes.Contains(sealed, secret) {
+		t.Error("Expected the sealed secret not to contain the plaintext")
+	}
+
+	opened, err := openSecret(key, sealed)
+	if err != nil || !bytes.Equal(opened, secret) {
+		t.Fatalf("openSecret = %q, %v; want %q", opened, err, secret)
+	}
+
+	if _, err := openSecret(bytes.Repeat([]byte{8}, 32), sealed); err == nil {
+		t.Error("Expected opening with the wrong key to fail")
+	}
+}
@@ -2,41 +2,158 @@ package cart
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log"
+	"time"
 
 	"github.com/diorshelton/golden-market-api/internal/models"
+	"github.com/diorshelton/golden-market-api/internal/promotion"
 	"github.com/diorshelton/golden-market-api/internal/repository"
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 type CartService struct {
-	CartRepository    *repository.CartRepository
-	ProductRepository *repository.ProductRepository
+	db                  *pgxpool.Pool
+	CartRepository      *repository.CartRepository
+	ProductRepository   *repository.ProductRepository
+	PromotionRepository *repository.PromotionRepository
+
+	// holdTTL is how long adding to the cart holds stock; zero disables holds
+	holdTTL time.Duration
 }
 
-func NewCartService(cartRepo *repository.CartRepository, productRepo *repository.ProductRepository) *CartService {
+func NewCartService(
+	db *pgxpool.Pool,
+	cartRepo *repository.CartRepository,
+	productRepo *repository.ProductRepository,
+	promotionRepo *repository.PromotionRepository,
+) *CartService {
 	return &CartService{
-		CartRepository:    cartRepo,
-		ProductRepository: productRepo,
+		db:                  db,
+		CartRepository:      cartRepo,
+		ProductRepository:   productRepo,
+		PromotionRepository: promotionRepo,
+	}
+}
+
+// ConfigureHolds makes adding to or updating the cart hold the item's
+// quantity for ttl, so other shoppers can't buy it out from under the user.
+// A ttl of zero turns holds off.
+func (s *CartService) ConfigureHolds(ttl time.Duration) {
+	s.holdTTL = ttl
+}
+
+// holdUntil is when a hold placed now runs out, or nil if holds are off
+func (s *CartService) holdUntil() *time.Time {
+	if s.holdTTL <= 0 {
+		return nil
 	}
+	until := time.Now().Add(s.holdTTL).UTC()
+	return &until
 }
 
 func (s *CartService) AddToCart(ctx context.Context, userID, productID uuid.UUID, quantity int) error {
-	//verify product is available
-	product, err := s.ProductRepository.GetByID(ctx, productID)
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if err := s.AddToCartTx(ctx, tx, userID, productID, quantity); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// AddToCartTx is AddToCart within the caller's transaction, for moving
+// items into the cart from elsewhere
+func (s *CartService) AddToCartTx(ctx context.Context, tx repository.DBTX, userID, productID uuid.UUID, quantity int) error {
+	//verify product is available, locking it so holds can't race
+	product, err := s.ProductRepository.GetByIDForUpdate(ctx, tx, productID)
 	if err != nil {
 		return fmt.Errorf("product not found or unavailable: %w", err)
 	}
 
-	//Check stock availability
-	if product.Stock < quantity {
-		return fmt.Errorf("insufficient stock: only %d available", product.Stock)
+	inCart, err := s.CartRepository.CartQuantityTx(ctx, tx, userID, productID)
+	if err != nil {
+		return err
+	}
+
+	//Check stock availability, less what other carts are holding
+	available, err := s.availableTo(ctx, tx, product, userID)
+	if err != nil {
+		return err
+	}
+	if available < inCart+quantity {
+		return fmt.Errorf("insufficient stock: only %d available", available)
 	}
-	return s.CartRepository.AddToCart(ctx, userID, productID, quantity)
+
+	return s.CartRepository.AddToCartTx(ctx, tx, userID, productID, quantity, s.holdUntil())
 }
 
+// GetCart returns the user's cart with its promo code applied. If the code
+// no longer applies, the cart is priced without it and PromoError says why.
 func (s *CartService) GetCart(ctx context.Context, userID uuid.UUID) (*models.CartSummary, error) {
-	return s.CartRepository.GetCart(ctx, userID)
+	cart, err := s.CartRepository.GetCart(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	promo, err := s.PromotionRepository.GetCartPromotion(ctx, s.db, userID)
+	if err != nil {
+		return nil, err
+	}
+	if promo == nil {
+		return cart, nil
+	}
+
+	discount, err := s.evaluatePromo(ctx, promo, cart, userID)
+	if errors.Is(err, promotion.ErrNotApplicable) {
+		cart.PromoError = fmt.Sprintf("%s: %v", promo.Code, err)
+		return cart, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	discount.ApplyTo(cart)
+	return cart, nil
+}
+
+// ApplyPromo applies a promo code to the user's cart, replacing any code
+// applied before. The code must apply to the cart as it is now; it is
+// checked again at checkout.
+func (s *CartService) ApplyPromo(ctx context.Context, userID uuid.UUID, code string) (*models.CartSummary, error) {
+	promo, err := s.PromotionRepository.GetByCode(ctx, promotion.NormalizeCode(code))
+	if err != nil {
+		return nil, err
+	}
+
+	cart, err := s.CartRepository.GetCart(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := s.evaluatePromo(ctx, promo, cart, userID); err != nil {
+		return nil, err
+	}
+
+	if err := s.PromotionRepository.SetCartPromotion(ctx, userID, promo.ID); err != nil {
+		return nil, err
+	}
+
+	return s.GetCart(ctx, userID)
+}
+
+// RemovePromo takes the promo code off the user's cart
+func (s *CartService) RemovePromo(ctx context.Context, userID uuid.UUID) error {
+	return s.PromotionRepository.ClearCartPromotion(ctx, s.db, userID)
 }
 
 func (s *CartService) UpdateCartItemQuantity(ctx context.Context, userID, cartItemID uuid.UUID, quantity int) error {
@@ -59,14 +176,89 @@ func (s *CartService) UpdateCartItemQuantity(ctx context.Context, userID, cartIt
 		return fmt.Errorf("cart item not found or does not belong to user")
 	}
 
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	product, err := s.ProductRepository.GetByIDForUpdate(ctx, tx, cartItem.Product.ID)
+	if err != nil {
+		return fmt.Errorf("product not found or unavailable: %w", err)
+	}
+
 	// Verify stock availability for the new quantity
-	if cartItem.Product.Stock < quantity {
-		return fmt.Errorf("insufficient stock: only %d available", cartItem.Product.Stock)
+	available, err := s.availableTo(ctx, tx, product, userID)
+	if err != nil {
+		return err
+	}
+	if available < quantity {
+		return fmt.Errorf("insufficient stock: only %d available", available)
 	}
 
-	return s.CartRepository.UpdateCartItemQuantity(ctx, cartItemID, quantity)
+	if err := s.CartRepository.UpdateCartItemQuantityTx(ctx, tx, cartItemID, quantity, s.holdUntil()); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
 }
 
 func (s *CartService) RemoveFromCart(ctx context.Context, userID, cartItemID uuid.UUID) error {
 	return s.CartRepository.RemoveFromCart(ctx, userID, cartItemID)
 }
+
+// ReleaseExpiredHolds clears holds that have run out. Expired holds already
+// stop counting against stock, so this only tidies up.
+func (s *CartService) ReleaseExpiredHolds(ctx context.Context) (int64, error) {
+	return s.CartRepository.ReleaseExpiredHolds(ctx)
+}
+
+// StartHoldSweeper runs ReleaseExpiredHolds every interval until ctx is done
+func (s *CartService) StartHoldSweeper(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				released, err := s.ReleaseExpiredHolds(ctx)
+				if err != nil {
+					log.Printf("Cart hold sweeper error: %v", err)
+					continue
+				}
+				if released > 0 {
+					log.Printf("Cart hold sweeper released %d expired hold(s)", released)
+				}
+			}
+		}
+	}()
+}
+
+// evaluatePromo works out what promo takes off the cart, including whether
+// the user has redemptions left
+func (s *CartService) evaluatePromo(ctx context.Context, promo *models.Promotion, cart *models.CartSummary, userID uuid.UUID) (*promotion.Discount, error) {
+	discount, err := promotion.Evaluate(promo, cart, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if err := promotion.CheckLimits(ctx, s.db, s.PromotionRepository, promo, userID); err != nil {
+		return nil, err
+	}
+	return discount, nil
+}
+
+// availableTo is how much of a locked product the user can have in their
+// cart: its stock less what other carts are holding
+func (s *CartService) availableTo(ctx context.Context, tx repository.DBTX, product *models.Product, userID uuid.UUID) (int, error) {
+	held, err := s.CartRepository.HeldByOthersTx(ctx, tx, product.ID, userID)
+	if err != nil {
+		return 0, err
+	}
+	return max(product.Stock-held, 0), nil
+}
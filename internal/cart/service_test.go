@@ -11,10 +11,12 @@ import (
 	"github.com/diorshelton/golden-market-api/internal/models"
 	"github.com/diorshelton/golden-market-api/internal/repository"
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/joho/godotenv"
 )
 
 type testDeps struct {
+	db          *pgxpool.Pool
 	cartService *CartService
 	userRepo    *repository.UserRepository
 	productRepo *repository.ProductRepository
@@ -39,9 +41,10 @@ func setupCartTest(t *testing.T) *testDeps {
 	productRepo := repository.NewProductRepository(db)
 	cartRepo := repository.NewCartRepository(db)
 
-	cartService := NewCartService(cartRepo, productRepo)
+	cartService := NewCartService(db, cartRepo, productRepo, repository.NewPromotionRepository(db))
 
 	return &testDeps{
+		db:          db,
 		cartService: cartService,
 		userRepo:    userRepo,
 		productRepo: productRepo,
@@ -252,3 +255,58 @@ func TestUpdateCartItemQuantity_WrongOwner(t *testing.T) {
 		t.Errorf("expected owner's cart item quantity unchanged at 1, got %d", ownerCart.Items[0].Quantity)
 	}
 }
+
+// TestAddToCart_HoldsStock verifies a hold keeps other shoppers from adding
+// the held quantity, and that it stops counting once it expires.
+func TestAddToCart_HoldsStock(t *testing.T) {
+	deps := setupCartTest(t)
+	ctx := context.Background()
+	deps.cartService.ConfigureHolds(10 * time.Minute)
+
+	holder := createTestUser(t, deps)
+	other := createTestUser(t, deps)
+	product := createTestProduct(t, deps, 100, 3)
+
+	if err := deps.cartService.AddToCart(ctx, holder.ID, product.ID, 2); err != nil {
+		t.Fatalf("AddToCart returned unexpected error: %v", err)
+	}
+
+	cart, err := deps.cartRepo.GetCart(ctx, holder.ID)
+	if err != nil {
+		t.Fatalf("failed to load cart: %v", err)
+	}
+	if cart.Items[0].ReservedUntil == nil {
+		t.Error("expected the cart item to be held")
+	}
+
+	fresh, err := deps.productRepo.GetByID(ctx, product.ID)
+	if err != nil {
+		t.Fatalf("failed to load product: %v", err)
+	}
+	if fresh.Stock != 3 || fresh.Available != 1 {
+		t.Errorf("expected stock 3 and 1 available, got %d and %d", fresh.Stock, fresh.Available)
+	}
+
+	if err := deps.cartService.AddToCart(ctx, other.ID, product.ID, 2); err == nil {
+		t.Fatal("expected error adding held stock, got nil")
+	}
+	if err := deps.cartService.AddToCart(ctx, other.ID, product.ID, 1); err != nil {
+		t.Fatalf("AddToCart of the unheld unit returned unexpected error: %v", err)
+	}
+
+	// Once the holder's hold runs out the stock is free again
+	expired := time.Now().Add(-time.Minute)
+	if err := deps.cartRepo.UpdateCartItemQuantityTx(ctx, deps.db, cart.Items[0].CartItemID, 2, &expired); err != nil {
+		t.Fatalf("failed to expire hold: %v", err)
+	}
+	if released, err := deps.cartService.ReleaseExpiredHolds(ctx); err != nil || released < 1 {
+		t.Errorf("expected the expired hold to be released, got %d (%v)", released, err)
+	}
+	otherCart, err := deps.cartRepo.GetCart(ctx, other.ID)
+	if err != nil {
+		t.Fatalf("failed to load cart: %v", err)
+	}
+	if err := deps.cartService.UpdateCartItemQuantity(ctx, other.ID, otherCart.Items[0].CartItemID, 3); err != nil {
+		t.Errorf("expected released stock to be available, got %v", err)
+	}
+}
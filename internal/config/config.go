@@ -1,9 +1,12 @@
 package config
 
 import (
+	"encoding/hex"
 	"fmt"
 	"log"
+	"net"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 
@@ -19,17 +22,77 @@ type Config struct {
 	AllowedOrigins     []string
 	Port               string
 	Environment        string
+
+	// Guest sessions
+	GuestTTL                time.Duration
+	MaxActiveGuests         int
+	GuestLoginsPerIPPerHour int
+
+	// Outgoing mail
+	Mailer       string // "log", "file" or "smtp"
+	MailFrom     string
+	MailDir      string
+	SMTPHost     string
+	SMTPPort     string
+	SMTPUsername string
+	SMTPPassword string
+	AppURL       string // frontend base URL used in emailed links
+
+	// Two-factor authentication
+	MFAEncryptionKey []byte // AES-256 key for TOTP secrets; nil derives one from JWTSecret
+	RequireAdminMFA  bool
+
+	// Password hashing (argon2id)
+	Argon2MemoryKiB   int
+	Argon2Iterations  int
+	Argon2Parallelism int
+
+	// Login lockout
+	MaxLoginFailures      int // per account per hour; 0 disables
+	MaxLoginFailuresPerIP int // per client IP per hour; 0 disables
+	LoginLockout          time.Duration
+
+	// Reverse proxies whose X-Forwarded-For is trusted for the client IP
+	// that rate limits and login lockouts key on; empty uses RemoteAddr
+	TrustedProxies []*net.IPNet
+
+	// Cart stock holds
+	CartHoldTTL time.Duration // how long adding to the cart holds stock; 0 disables
+
+	// Order cancellation
+	OrderCancelWindow time.Duration // how long after purchase owners may cancel
+
+	// Coin transfers between players
+	TransferDailyLimit    int           // coins a user may send per 24 hours; 0 disables
+	TransferMinAccountAge time.Duration // how old an account must be to send; 0 disables
+
+	// Access token signing
+	JWTSigningKey []byte // PEM private key; nil signs with a throwaway key
+	JWTVerifyKeys []byte // PEM keys still accepted, e.g. the previous signing key
+	JWTIssuer     string
+	JWTAudience   string
 }
 
 const redacted = "[REDACTED]"
 
 // String implements fmt.Stringer, redacting DatabaseURL (which embeds
-// credentials) and the JWT/refresh secrets so an accidental
+// credentials), the JWT/refresh secrets, the SMTP password, the MFA
+// encryption key and the JWT signing key so an accidental
 // log.Printf("%v", cfg) or similar doesn't leak them.
 func (c *Config) String() string {
 	return fmt.Sprintf(
-		"Config{DatabaseURL:%s JWTSecret:%s RefreshSecret:%s AccessTokenExpiry:%s RefreshTokenExpiry:%s AllowedOrigins:%v Port:%s Environment:%s}",
+		"Config{DatabaseURL:%s JWTSecret:%s RefreshSecret:%s AccessTokenExpiry:%s RefreshTokenExpiry:%s AllowedOrigins:%v Port:%s Environment:%s GuestTTL:%s MaxActiveGuests:%d GuestLoginsPerIPPerHour:%d Mailer:%s MailFrom:%s MailDir:%s SMTPHost:%s SMTPPort:%s SMTPUsername:%s SMTPPassword:%s AppURL:%s MFAEncryptionKey:%s RequireAdminMFA:%t Argon2MemoryKiB:%d Argon2Iterations:%d Argon2Parallelism:%d MaxLoginFailures:%d MaxLoginFailuresPerIP:%d LoginLockout:%s TrustedProxies:%v CartHoldTTL:%s OrderCancelWindow:%s TransferDailyLimit:%d TransferMinAccountAge:%s JWTSigningKey:%s JWTIssuer:%s JWTAudience:%s}",
 		redacted, redacted, redacted, c.AccessTokenExpiry, c.RefreshTokenExpiry, c.AllowedOrigins, c.Port, c.Environment,
+		c.GuestTTL, c.MaxActiveGuests, c.GuestLoginsPerIPPerHour,
+		c.Mailer, c.MailFrom, c.MailDir, c.SMTPHost, c.SMTPPort, c.SMTPUsername, redacted, c.AppURL,
+		redacted, c.RequireAdminMFA,
+		c.Argon2MemoryKiB, c.Argon2Iterations, c.Argon2Parallelism,
+		c.MaxLoginFailures, c.MaxLoginFailuresPerIP, c.LoginLockout,
+		c.TrustedProxies,
+		c.CartHoldTTL,
+		c.OrderCancelWindow,
+		c.TransferDailyLimit, c.TransferMinAccountAge,
+		redacted, c.JWTIssuer, c.JWTAudience,
 	)
 }
 
@@ -99,6 +162,152 @@ func Load() (*Config, error) {
 		environment = "development"
 	}
 
+	guestTTL := 2 * time.Hour
+	if raw := os.Getenv("GUEST_TTL"); raw != "" {
+		guestTTL, err = time.ParseDuration(raw)
+		if err != nil || guestTTL <= 0 {
+			return nil, fmt.Errorf("invalid GUEST_TTL: %q", raw)
+		}
+	}
+
+	maxActiveGuests, err := intFromEnv("MAX_ACTIVE_GUESTS", 500)
+	if err != nil {
+		return nil, err
+	}
+
+	guestLoginsPerIP, err := intFromEnv("GUEST_LOGINS_PER_IP_PER_HOUR", 5)
+	if err != nil {
+		return nil, err
+	}
+
+	mailer := stringFromEnv("MAILER", "log")
+	switch mailer {
+	case "log", "file":
+	case "smtp":
+		if os.Getenv("SMTP_HOST") == "" {
+			return nil, fmt.Errorf("SMTP_HOST is required when MAILER=smtp")
+		}
+	default:
+		return nil, fmt.Errorf("invalid MAILER: %q (want log, file or smtp)", mailer)
+	}
+
+	var mfaKey []byte
+	if raw := os.Getenv("MFA_ENCRYPTION_KEY"); raw != "" {
+		mfaKey, err = hex.DecodeString(raw)
+		if err != nil || len(mfaKey) != 32 {
+			return nil, fmt.Errorf("invalid MFA_ENCRYPTION_KEY: want 64 hex characters")
+		}
+	}
+
+	requireAdminMFA := false
+	if raw := os.Getenv("REQUIRE_ADMIN_MFA"); raw != "" {
+		requireAdminMFA, err = strconv.ParseBool(raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid REQUIRE_ADMIN_MFA: %q", raw)
+		}
+	}
+
+	// Defaults match auth.DefaultPasswordParams
+	argon2Memory, err := intFromEnv("ARGON2_MEMORY_KIB", 19*1024)
+	if err != nil {
+		return nil, err
+	}
+	argon2Iterations, err := intFromEnv("ARGON2_ITERATIONS", 2)
+	if err != nil {
+		return nil, err
+	}
+	argon2Parallelism, err := intFromEnv("ARGON2_PARALLELISM", 1)
+	if err != nil {
+		return nil, err
+	}
+	if argon2Iterations < 1 || argon2Parallelism < 1 || argon2Parallelism > 255 {
+		return nil, fmt.Errorf("invalid ARGON2_ITERATIONS or ARGON2_PARALLELISM: want at least 1 (parallelism at most 255)")
+	}
+	if argon2Memory < 8*argon2Parallelism {
+		return nil, fmt.Errorf("invalid ARGON2_MEMORY_KIB: want at least 8 KiB per lane")
+	}
+
+	maxLoginFailures, err := intFromEnv("LOGIN_MAX_FAILURES", 10)
+	if err != nil {
+		return nil, err
+	}
+
+	maxLoginFailuresPerIP, err := intFromEnv("LOGIN_MAX_FAILURES_PER_IP", 50)
+	if err != nil {
+		return nil, err
+	}
+
+	loginLockout := 15 * time.Minute
+	if raw := os.Getenv("LOGIN_LOCKOUT"); raw != "" {
+		loginLockout, err = time.ParseDuration(raw)
+		if err != nil || loginLockout <= 0 {
+			return nil, fmt.Errorf("invalid LOGIN_LOCKOUT: %q", raw)
+		}
+	}
+
+	var trustedProxies []*net.IPNet
+	if raw := os.Getenv("TRUSTED_PROXIES"); raw != "" {
+		for _, entry := range strings.Split(raw, ",") {
+			proxy, err := parseIPNet(strings.TrimSpace(entry))
+			if err != nil {
+				return nil, fmt.Errorf("invalid TRUSTED_PROXIES: %q", entry)
+			}
+			trustedProxies = append(trustedProxies, proxy)
+		}
+	}
+
+	var cartHoldTTL time.Duration
+	if raw := os.Getenv("CART_HOLD_TTL"); raw != "" {
+		cartHoldTTL, err = time.ParseDuration(raw)
+		if err != nil || cartHoldTTL < 0 {
+			return nil, fmt.Errorf("invalid CART_HOLD_TTL: %q", raw)
+		}
+	}
+
+	orderCancelWindow := 30 * time.Minute
+	if raw := os.Getenv("ORDER_CANCEL_WINDOW"); raw != "" {
+		orderCancelWindow, err = time.ParseDuration(raw)
+		if err != nil || orderCancelWindow <= 0 {
+			return nil, fmt.Errorf("invalid ORDER_CANCEL_WINDOW: %q", raw)
+		}
+	}
+
+	transferDailyLimit, err := intFromEnv("TRANSFER_DAILY_LIMIT", 1000)
+	if err != nil {
+		return nil, err
+	}
+
+	transferMinAccountAge := 7 * 24 * time.Hour
+	if raw := os.Getenv("TRANSFER_MIN_ACCOUNT_AGE"); raw != "" {
+		transferMinAccountAge, err = time.ParseDuration(raw)
+		if err != nil || transferMinAccountAge < 0 {
+			return nil, fmt.Errorf("invalid TRANSFER_MIN_ACCOUNT_AGE: %q", raw)
+		}
+	}
+
+	signingKey, err := pemFromEnv("JWT_SIGNING_KEY")
+	if err != nil {
+		return nil, err
+	}
+	if signingKey == nil && environment == "production" {
+		return nil, fmt.Errorf("JWT_SIGNING_KEY or JWT_SIGNING_KEY_FILE is required in production")
+	}
+
+	verifyKeys, err := pemFromEnv("JWT_VERIFY_KEYS")
+	if err != nil {
+		return nil, err
+	}
+	if raw := os.Getenv("JWT_VERIFY_KEY_FILES"); raw != "" {
+		for _, path := range strings.Split(raw, ",") {
+			pem, err := os.ReadFile(strings.TrimSpace(path))
+			if err != nil {
+				return nil, fmt.Errorf("invalid JWT_VERIFY_KEY_FILES: %w", err)
+			}
+			verifyKeys = append(verifyKeys, '\n')
+			verifyKeys = append(verifyKeys, pem...)
+		}
+	}
+
 	return &Config{
 		DatabaseURL:        required["DATABASE_URL"],
 		JWTSecret:          required["JWT_SECRET"],
@@ -108,5 +317,103 @@ func Load() (*Config, error) {
 		AllowedOrigins:     allowedOrigins,
 		Port:               port,
 		Environment:        environment,
+
+		GuestTTL:                guestTTL,
+		MaxActiveGuests:         maxActiveGuests,
+		GuestLoginsPerIPPerHour: guestLoginsPerIP,
+
+		Mailer:       mailer,
+		MailFrom:     stringFromEnv("MAIL_FROM", "Golden Market <no-reply@goldenmarket.local>"),
+		MailDir:      stringFromEnv("MAIL_DIR", "tmp/mail"),
+		SMTPHost:     os.Getenv("SMTP_HOST"),
+		SMTPPort:     stringFromEnv("SMTP_PORT", "587"),
+		SMTPUsername: os.Getenv("SMTP_USERNAME"),
+		SMTPPassword: os.Getenv("SMTP_PASSWORD"),
+		AppURL:       strings.TrimRight(stringFromEnv("APP_URL", "http://localhost:5173"), "/"),
+
+		MFAEncryptionKey: mfaKey,
+		RequireAdminMFA:  requireAdminMFA,
+
+		Argon2MemoryKiB:   argon2Memory,
+		Argon2Iterations:  argon2Iterations,
+		Argon2Parallelism: argon2Parallelism,
+
+		MaxLoginFailures:      maxLoginFailures,
+		MaxLoginFailuresPerIP: maxLoginFailuresPerIP,
+		LoginLockout:          loginLockout,
+
+		TrustedProxies: trustedProxies,
+
+		CartHoldTTL: cartHoldTTL,
+
+		OrderCancelWindow: orderCancelWindow,
+
+		TransferDailyLimit:    transferDailyLimit,
+		TransferMinAccountAge: transferMinAccountAge,
+
+		JWTSigningKey: signingKey,
+		JWTVerifyKeys: verifyKeys,
+		JWTIssuer:     stringFromEnv("JWT_ISSUER", "golden-market-api"),
+		JWTAudience:   stringFromEnv("JWT_AUDIENCE", "golden-market"),
 	}, nil
 }
+
+// parseIPNet reads a CIDR, or a single address as a network of one
+func parseIPNet(raw string) (*net.IPNet, error) {
+	if strings.Contains(raw, "/") {
+		_, ipNet, err := net.ParseCIDR(raw)
+		return ipNet, err
+	}
+
+	ip := net.ParseIP(raw)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid IP address %q", raw)
+	}
+	bits := 8 * net.IPv6len
+	if ip4 := ip.To4(); ip4 != nil {
+		ip, bits = ip4, 8*net.IPv4len
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+}
+
+// stringFromEnv reads a string, falling back to def when unset
+func stringFromEnv(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+
+// pemFromEnv reads PEM data inline from key, where "\n" escapes stand in
+// for newlines, or from the file named by key+"_FILE". It returns nil when
+// neither is set.
+func pemFromEnv(key string) ([]byte, error) {
+	if raw := os.Getenv(key); raw != "" {
+		return []byte(strings.ReplaceAll(raw, `\n`, "\n")), nil
+	}
+
+	path := os.Getenv(key + "_FILE")
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s_FILE: %w", key, err)
+	}
+	return data, nil
+}
+
+// intFromEnv reads a non-negative integer, falling back to def when unset.
+// Zero disables the limit it configures.
+func intFromEnv(key string, def int) (int, error) {
+	raw := os.Getenv(key)
+	if raw == "" {
+		return def, nil
+	}
+
+	v, err := strconv.Atoi(raw)
+	if err != nil || v < 0 {
+		return 0, fmt.Errorf("invalid %s: %q", key, raw)
+	}
+	return v, nil
+}
@@ -0,0 +1,47 @@
+package database
+
+import "testing"
+
+func TestLoadMigrations(t *testing.T) {
+	migrations, err := LoadMigrations()
+	if err != nil {
+		t.Fatalf("LoadMigrations returned error: %v", err)
+	}
+
+	if len(migrations) == 0 {
+		t.Fatal("expected at least one embedded migration")
+	}
+
+	for i, m := range migrations {
+		// Versions must be contiguous so a missing file is caught at build time
+		if m.Version != i+1 {
+			t.Errorf("expected migration %d at position %d, got %d (%s)", i+1, i, m.Version, m.Name)
+		}
+		if m.Up == "" {
+			t.Errorf("migration %d (%s) has empty up SQL", m.Version, m.Name)
+		}
+		if len(m.Checksum) != 64 {
+			t.Errorf("migration %d (%s) has invalid checksum %q", m.Version, m.Name, m.Checksum)
+		}
+	}
+}
+
+func TestIsBlankSQL(t *testing.T) {
+	tests := []struct {
+		name string
+		sql  string
+		want bool
+	}{
+		{name: "empty", sql: "", want: true},
+		{name: "comments only", sql: "-- nothing to undo\n  -- really\n", want: true},
+		{name: "statement", sql: "-- drop it\nDROP TABLE foo;", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isBlankSQL(tt.sql); got != tt.want {
+				t.Errorf("isBlankSQL(%q) = %v, want %v", tt.sql, got, tt.want)
+			}
+		})
+	}
+}
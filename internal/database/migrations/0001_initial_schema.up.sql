@@ -0,0 +1,94 @@
+-- Baseline schema. Uses IF NOT EXISTS so databases created by the old
+-- boot-time CREATE TABLE logic adopt this migration without changes.
+
+CREATE TABLE IF NOT EXISTS users (
+	id UUID PRIMARY KEY,
+	username VARCHAR(255) NOT NULL UNIQUE,
+	first_name VARCHAR(255) NOT NULL,
+	last_name VARCHAR(255) NOT NULL,
+	email VARCHAR(255) NOT NULL UNIQUE,
+	password_hash VARCHAR(255) NOT NULL,
+	balance INTEGER NOT NULL DEFAULT 5000 CHECK (balance >= 0),
+	is_guest BOOLEAN NOT NULL DEFAULT false,
+	role VARCHAR(20) NOT NULL DEFAULT 'user',
+	created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+	last_login TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+	id UUID PRIMARY KEY,
+	user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	token VARCHAR(512) NOT NULL UNIQUE,
+	expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+	created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+	revoked BOOLEAN NOT NULL DEFAULT FALSE
+);
+
+CREATE TABLE IF NOT EXISTS products (
+	id UUID PRIMARY KEY,
+	name VARCHAR(255) NOT NULL CHECK (name <> ''),
+	description TEXT,
+	price INTEGER NOT NULL,
+	stock INTEGER NOT NULL CHECK (stock >= 0),
+	image_url TEXT,
+	category VARCHAR(255),
+	is_available BOOLEAN NOT NULL DEFAULT true,
+	last_restock TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+	created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+	updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS inventory (
+	user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	product_id UUID NOT NULL REFERENCES products(id) ON DELETE RESTRICT,
+	quantity INTEGER NOT NULL DEFAULT 0,
+	acquired_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+	updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+	PRIMARY KEY (user_id, product_id),
+	CONSTRAINT quantity_non_negative CHECK (quantity >= 0)
+);
+
+CREATE TABLE IF NOT EXISTS orders (
+	id UUID PRIMARY KEY,
+	user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	order_number VARCHAR(20) NOT NULL UNIQUE,
+	total_amount INTEGER NOT NULL,
+	status VARCHAR(20) NOT NULL DEFAULT 'completed',
+	created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+	updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS order_items (
+	id UUID PRIMARY KEY,
+	order_id UUID NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+	product_id UUID NOT NULL REFERENCES products(id) ON DELETE RESTRICT,
+	product_name VARCHAR(255) NOT NULL,
+	quantity INTEGER NOT NULL,
+	price_per_unit INTEGER NOT NULL,
+	subtotal INTEGER NOT NULL,
+	created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS cart_items (
+	id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	product_id UUID NOT NULL REFERENCES products(id) ON DELETE RESTRICT,
+	quantity INTEGER NOT NULL CHECK (quantity > 0),
+	added_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+	updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+	UNIQUE(user_id, product_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_user_id ON refresh_tokens(user_id);
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_token ON refresh_tokens(token);
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_expires_at ON refresh_tokens(expires_at);
+CREATE INDEX IF NOT EXISTS idx_inventory_user_id ON inventory(user_id);
+CREATE INDEX IF NOT EXISTS idx_inventory_product_id ON inventory(product_id);
+CREATE INDEX IF NOT EXISTS idx_cart_items_user_id ON cart_items(user_id);
+CREATE INDEX IF NOT EXISTS idx_cart_items_product_id ON cart_items(product_id);
+CREATE INDEX IF NOT EXISTS idx_users_email ON users(email);
+CREATE INDEX IF NOT EXISTS idx_users_username ON users(username);
+CREATE INDEX IF NOT EXISTS idx_orders_user_id ON orders(user_id);
+CREATE INDEX IF NOT EXISTS idx_orders_order_number ON orders(order_number);
+CREATE INDEX IF NOT EXISTS idx_orders_created_at ON orders(created_at);
+CREATE INDEX IF NOT EXISTS idx_order_items_order_id ON order_items(order_id);
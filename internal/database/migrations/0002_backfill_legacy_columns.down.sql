@@ -0,0 +1,2 @@
+-- Irreversible: the backfilled columns and constraints are part of the
+-- baseline schema, so rolling back 0001 is what removes them.
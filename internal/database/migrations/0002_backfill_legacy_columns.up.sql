@@ -0,0 +1,18 @@
+-- Brings databases created before the migration system up to the
+-- baseline shape. Every statement is idempotent, so it is a no-op on a
+-- fresh database.
+
+ALTER TABLE inventory DROP CONSTRAINT IF EXISTS quantity_positive;
+ALTER TABLE inventory DROP CONSTRAINT IF EXISTS quantity_non_negative;
+ALTER TABLE inventory ADD CONSTRAINT quantity_non_negative CHECK (quantity >= 0);
+ALTER TABLE inventory ADD COLUMN IF NOT EXISTS acquired_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW();
+ALTER TABLE inventory ADD COLUMN IF NOT EXISTS updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW();
+
+ALTER TABLE users ALTER COLUMN balance SET DEFAULT 5000;
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_balance_check;
+ALTER TABLE users ADD CONSTRAINT users_balance_check CHECK (balance >= 0);
+ALTER TABLE users ADD COLUMN IF NOT EXISTS is_guest BOOLEAN NOT NULL DEFAULT false;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS role VARCHAR(20) NOT NULL DEFAULT 'user';
+
+ALTER TABLE products DROP CONSTRAINT IF EXISTS products_stock_check;
+ALTER TABLE products ADD CONSTRAINT products_stock_check CHECK (stock >= 0);
@@ -0,0 +1,19 @@
+CREATE TABLE IF NOT EXISTS coin_transactions (
+	id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	amount INTEGER NOT NULL CHECK (amount <> 0),
+	balance_after INTEGER NOT NULL CHECK (balance_after >= 0),
+	reason VARCHAR(32) NOT NULL,
+	reference_id UUID,
+	created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_coin_transactions_user_id_created_at ON coin_transactions(user_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_coin_transactions_reference_id ON coin_transactions(reference_id);
+
+-- Seed every existing user with an opening entry so the ledger reconciles
+-- from day one.
+INSERT INTO coin_transactions (user_id, amount, balance_after, reason)
+SELECT id, balance, balance, 'opening_balance'
+FROM users
+WHERE balance <> 0;
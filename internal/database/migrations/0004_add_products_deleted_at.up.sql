@@ -0,0 +1,6 @@
+-- Products are soft deleted: order_items, inventory, and cart_items all
+-- reference products with ON DELETE RESTRICT, so a hard delete would fail
+-- for anything that has ever been bought.
+ALTER TABLE products ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP WITH TIME ZONE;
+
+CREATE INDEX IF NOT EXISTS idx_products_deleted_at ON products(deleted_at);
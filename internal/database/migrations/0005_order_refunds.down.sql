@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS order_status_history;
+ALTER TABLE order_items DROP CONSTRAINT IF EXISTS order_items_refunded_quantity_check;
+ALTER TABLE order_items DROP COLUMN IF EXISTS refunded_quantity;
+ALTER TABLE orders DROP COLUMN IF EXISTS refunded_amount;
@@ -0,0 +1,23 @@
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS refunded_amount INTEGER NOT NULL DEFAULT 0 CHECK (refunded_amount >= 0);
+
+ALTER TABLE order_items ADD COLUMN IF NOT EXISTS refunded_quantity INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE order_items DROP CONSTRAINT IF EXISTS order_items_refunded_quantity_check;
+ALTER TABLE order_items ADD CONSTRAINT order_items_refunded_quantity_check
+	CHECK (refunded_quantity >= 0 AND refunded_quantity <= quantity);
+
+CREATE TABLE IF NOT EXISTS order_status_history (
+	id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	order_id UUID NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+	from_status VARCHAR(20),
+	to_status VARCHAR(20) NOT NULL,
+	reason TEXT,
+	changed_by UUID,
+	created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_order_status_history_order_id ON order_status_history(order_id, created_at);
+
+-- Give existing orders a starting history entry
+INSERT INTO order_status_history (order_id, from_status, to_status, created_at)
+SELECT id, NULL, status, created_at
+FROM orders;
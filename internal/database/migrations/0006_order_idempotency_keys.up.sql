@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS order_idempotency_keys (
+	user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	idempotency_key VARCHAR(255) NOT NULL,
+	request_hash CHAR(64) NOT NULL,
+	order_id UUID NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+	response JSONB NOT NULL,
+	created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+	PRIMARY KEY (user_id, idempotency_key)
+);
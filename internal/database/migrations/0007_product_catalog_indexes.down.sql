@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_products_catalog_last_restock;
+DROP INDEX IF EXISTS idx_products_catalog_created_at;
+DROP INDEX IF EXISTS idx_products_catalog_price;
+DROP INDEX IF EXISTS idx_products_catalog_name;
@@ -0,0 +1,6 @@
+-- Keyset pagination orders by (sort column, id); these keep each sort
+-- order an index scan over the live catalog.
+CREATE INDEX IF NOT EXISTS idx_products_catalog_name ON products(name, id) WHERE deleted_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_products_catalog_price ON products(price, id) WHERE deleted_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_products_catalog_created_at ON products(created_at, id) WHERE deleted_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_products_catalog_last_restock ON products(last_restock, id) WHERE deleted_at IS NULL;
@@ -0,0 +1,4 @@
+-- pg_trgm is left installed; other databases on the server may rely on it.
+DROP INDEX IF EXISTS idx_products_name_trgm;
+DROP INDEX IF EXISTS idx_products_search_vector;
+ALTER TABLE products DROP COLUMN IF EXISTS search_vector;
@@ -0,0 +1,17 @@
+-- pg_trgm powers the typo-tolerant fallback. It is created in public
+-- explicitly because the test pool puts pg_temp first on the search_path,
+-- and extensions can't live in a temporary schema.
+CREATE EXTENSION IF NOT EXISTS pg_trgm SCHEMA public;
+
+-- A generated column keeps the search document in sync with every insert
+-- and update without triggers. Name matches outrank category matches,
+-- which outrank description matches.
+ALTER TABLE products ADD COLUMN IF NOT EXISTS search_vector tsvector
+	GENERATED ALWAYS AS (
+		setweight(to_tsvector('english', coalesce(name, '')), 'A') ||
+		setweight(to_tsvector('english', coalesce(category, '')), 'B') ||
+		setweight(to_tsvector('english', coalesce(description, '')), 'C')
+	) STORED;
+
+CREATE INDEX IF NOT EXISTS idx_products_search_vector ON products USING GIN (search_vector);
+CREATE INDEX IF NOT EXISTS idx_products_name_trgm ON products USING GIN (name gin_trgm_ops);
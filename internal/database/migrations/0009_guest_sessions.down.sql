@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_users_guest_expires_at;
+ALTER TABLE users DROP COLUMN IF EXISTS guest_expires_at;
@@ -0,0 +1,9 @@
+-- Every guest login now gets its own short-lived user. Guests past
+-- guest_expires_at are deleted by the reaper; cart, inventory, orders and
+-- ledger entries go with them through ON DELETE CASCADE.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS guest_expires_at TIMESTAMP WITH TIME ZONE;
+
+CREATE INDEX IF NOT EXISTS idx_users_guest_expires_at ON users(guest_expires_at) WHERE is_guest = true;
+
+-- Retire the old shared guest account on the next reaper pass
+UPDATE users SET guest_expires_at = NOW() WHERE is_guest = true AND guest_expires_at IS NULL;
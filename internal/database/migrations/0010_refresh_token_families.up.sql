@@ -0,0 +1,11 @@
+-- Each login starts a token family. Rotation marks the presented token as
+-- used and issues the next one in the same family; presenting a used or
+-- revoked token again revokes the whole family (OAuth 2.0 Security BCP).
+ALTER TABLE refresh_tokens ADD COLUMN IF NOT EXISTS family_id UUID;
+ALTER TABLE refresh_tokens ADD COLUMN IF NOT EXISTS used_at TIMESTAMP WITH TIME ZONE;
+
+-- Existing tokens each become the start of their own family
+UPDATE refresh_tokens SET family_id = id WHERE family_id IS NULL;
+ALTER TABLE refresh_tokens ALTER COLUMN family_id SET NOT NULL;
+
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_family_id ON refresh_tokens(family_id);
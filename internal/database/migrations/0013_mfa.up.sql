@@ -0,0 +1,16 @@
+-- Optional TOTP two-factor authentication. mfa_secret is AES-GCM encrypted
+-- by the application; it is set at enrollment and only enforced once
+-- mfa_enabled_at is set. mfa_last_step stops a code being replayed.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS mfa_secret BYTEA;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS mfa_enabled_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS mfa_last_step BIGINT;
+
+-- One-time recovery codes, stored as SHA-256 hashes
+CREATE TABLE IF NOT EXISTS mfa_recovery_codes (
+    id UUID PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    code_hash CHAR(64) NOT NULL,
+    used_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    UNIQUE (user_id, code_hash)
+);
@@ -0,0 +1,8 @@
+-- Self-service account changes. pending_email holds a new address until
+-- the link mailed to it is opened; deletion_scheduled_at is when an account
+-- whose owner asked to delete it is removed, unless they log in first.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS pending_email VARCHAR(255);
+ALTER TABLE users ADD COLUMN IF NOT EXISTS deletion_scheduled_at TIMESTAMP WITH TIME ZONE;
+
+CREATE INDEX IF NOT EXISTS idx_users_deletion_scheduled_at
+    ON users(deletion_scheduled_at) WHERE deletion_scheduled_at IS NOT NULL;
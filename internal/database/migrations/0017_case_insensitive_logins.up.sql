@@ -0,0 +1,31 @@
+-- Emails and usernames are matched case-insensitively, so two accounts may
+-- not differ only by case. Existing collisions can't be resolved safely
+-- here; the migration stops and lists them so they can be merged or
+-- renamed by hand first.
+DO $$
+DECLARE
+    collisions TEXT;
+BEGIN
+    SELECT string_agg(format('%s %L (%s accounts)', kind, folded, n), ', ')
+    INTO collisions
+    FROM (
+        SELECT 'email' AS kind, lower(email) AS folded, COUNT(*) AS n
+        FROM users GROUP BY lower(email) HAVING COUNT(*) > 1
+        UNION ALL
+        SELECT 'username', lower(username), COUNT(*)
+        FROM users GROUP BY lower(username) HAVING COUNT(*) > 1
+    ) dupes;
+
+    IF collisions IS NOT NULL THEN
+        RAISE EXCEPTION 'accounts differ only by case: %', collisions
+            USING HINT = 'Rename or merge these accounts, then run the migration again.';
+    END IF;
+END $$;
+
+-- Emails are stored lowercased from now on; usernames keep their case for
+-- display
+UPDATE users SET email = lower(email) WHERE email <> lower(email);
+UPDATE users SET pending_email = lower(pending_email) WHERE pending_email <> lower(pending_email);
+
+CREATE UNIQUE INDEX IF NOT EXISTS users_email_lower_key ON users (lower(email));
+CREATE UNIQUE INDEX IF NOT EXISTS users_username_lower_key ON users (lower(username));
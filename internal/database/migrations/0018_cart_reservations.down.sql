@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_cart_items_active_holds;
+ALTER TABLE cart_items DROP COLUMN IF EXISTS reserved_until;
@@ -0,0 +1,7 @@
+-- Soft stock reservations. While reserved_until is in the future the cart
+-- item's quantity is held back from everyone else's available stock; once it
+-- passes, the hold lapses and a background sweeper clears it.
+ALTER TABLE cart_items ADD COLUMN IF NOT EXISTS reserved_until TIMESTAMP WITH TIME ZONE;
+
+CREATE INDEX IF NOT EXISTS idx_cart_items_active_holds
+    ON cart_items(product_id, reserved_until) WHERE reserved_until IS NOT NULL;
@@ -0,0 +1,52 @@
+-- Promo codes. A promotion takes a percentage or a fixed number of coins off
+-- the cart items it covers: every item, or only one category or product.
+-- Zero redemption limits mean unlimited; redemption_count is bumped in the
+-- checkout transaction so the global limit can't be oversubscribed.
+CREATE TABLE IF NOT EXISTS promotions (
+	id UUID PRIMARY KEY,
+	code VARCHAR(50) NOT NULL,
+	description TEXT NOT NULL DEFAULT '',
+	discount_type VARCHAR(10) NOT NULL CHECK (discount_type IN ('percent', 'fixed')),
+	discount_value INTEGER NOT NULL CHECK (discount_value > 0),
+	min_cart_total INTEGER NOT NULL DEFAULT 0 CHECK (min_cart_total >= 0),
+	category VARCHAR(255),
+	product_id UUID REFERENCES products(id) ON DELETE CASCADE,
+	max_redemptions INTEGER NOT NULL DEFAULT 0 CHECK (max_redemptions >= 0),
+	max_redemptions_per_user INTEGER NOT NULL DEFAULT 0 CHECK (max_redemptions_per_user >= 0),
+	redemption_count INTEGER NOT NULL DEFAULT 0,
+	starts_at TIMESTAMP WITH TIME ZONE,
+	ends_at TIMESTAMP WITH TIME ZONE,
+	is_active BOOLEAN NOT NULL DEFAULT true,
+	created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+	updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+	CONSTRAINT percent_at_most_100 CHECK (discount_type <> 'percent' OR discount_value <= 100),
+	CONSTRAINT one_scope CHECK (category IS NULL OR product_id IS NULL),
+	CONSTRAINT ends_after_start CHECK (starts_at IS NULL OR ends_at IS NULL OR ends_at > starts_at)
+);
+
+-- Codes are matched ignoring case
+CREATE UNIQUE INDEX IF NOT EXISTS promotions_code_upper_key ON promotions (upper(code));
+
+CREATE TABLE IF NOT EXISTS promotion_redemptions (
+	id UUID PRIMARY KEY,
+	promotion_id UUID NOT NULL REFERENCES promotions(id) ON DELETE CASCADE,
+	user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	order_id UUID NOT NULL UNIQUE REFERENCES orders(id) ON DELETE CASCADE,
+	discount INTEGER NOT NULL,
+	created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_promotion_redemptions_promotion_user
+    ON promotion_redemptions(promotion_id, user_id);
+
+-- The code a user has applied to their cart, at most one
+CREATE TABLE IF NOT EXISTS cart_promotions (
+	user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+	promotion_id UUID NOT NULL REFERENCES promotions(id) ON DELETE CASCADE,
+	applied_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+-- What a promotion took off an order, and each item's share of it so
+-- refunds give back only what was paid
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS discount_amount INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE order_items ADD COLUMN IF NOT EXISTS discount INTEGER NOT NULL DEFAULT 0;
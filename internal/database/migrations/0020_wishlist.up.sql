@@ -0,0 +1,14 @@
+-- Products a user has saved for later. saved_price and saved_in_stock are
+-- the product as it was when first saved, so the wishlist can flag price
+-- drops and restocks.
+CREATE TABLE IF NOT EXISTS wishlist_items (
+	id UUID PRIMARY KEY,
+	user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	product_id UUID NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+	quantity INTEGER NOT NULL DEFAULT 1 CHECK (quantity > 0),
+	saved_price INTEGER NOT NULL,
+	saved_in_stock BOOLEAN NOT NULL,
+	added_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+	updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+	UNIQUE (user_id, product_id)
+);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_coin_transfers_sender_created_at;
+DROP TABLE IF EXISTS coin_transfers;
@@ -0,0 +1,15 @@
+-- Coins sent from one player to another. Each transfer has a ledger entry
+-- on both sides referencing it. A deleted account leaves the other side's
+-- record in place.
+CREATE TABLE IF NOT EXISTS coin_transfers (
+	id UUID PRIMARY KEY,
+	sender_id UUID REFERENCES users(id) ON DELETE SET NULL,
+	recipient_id UUID REFERENCES users(id) ON DELETE SET NULL,
+	amount INTEGER NOT NULL CHECK (amount > 0),
+	created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+	CONSTRAINT no_self_transfer CHECK (sender_id <> recipient_id)
+);
+
+-- Backs the daily sending cap
+CREATE INDEX IF NOT EXISTS idx_coin_transfers_sender_created_at
+    ON coin_transfers(sender_id, created_at DESC);
@@ -8,6 +8,7 @@ import (
 	"strings"
 
 	"github.com/diorshelton/golden-market-api/internal/middleware"
+	"github.com/diorshelton/golden-market-api/internal/models"
 	"github.com/diorshelton/golden-market-api/internal/repository"
 	"github.com/google/uuid"
 	"github.com/gorilla/mux"
@@ -16,16 +17,26 @@ import (
 )
 
 type AdminHandler struct {
-	db            *pgxpool.Pool
-	userRepo      *repository.UserRepository
-	inventoryRepo *repository.InventoryRepository
+	db               *pgxpool.Pool
+	userRepo         *repository.UserRepository
+	inventoryRepo    *repository.InventoryRepository
+	coinTxRepo       *repository.CoinTransactionRepository
+	loginAttemptRepo *repository.LoginAttemptRepository
 }
 
-func NewAdminHandler(db *pgxpool.Pool, userRepo *repository.UserRepository, inventoryRepo *repository.InventoryRepository) *AdminHandler {
+func NewAdminHandler(
+	db *pgxpool.Pool,
+	userRepo *repository.UserRepository,
+	inventoryRepo *repository.InventoryRepository,
+	coinTxRepo *repository.CoinTransactionRepository,
+	loginAttemptRepo *repository.LoginAttemptRepository,
+) *AdminHandler {
 	return &AdminHandler{
-		db:            db,
-		userRepo:      userRepo,
-		inventoryRepo: inventoryRepo,
+		db:               db,
+		userRepo:         userRepo,
+		inventoryRepo:    inventoryRepo,
+		coinTxRepo:       coinTxRepo,
+		loginAttemptRepo: loginAttemptRepo,
 	}
 }
 
@@ -35,8 +46,8 @@ type AdjustCoinsRequest struct {
 
 // AdjustCoins handles PATCH /api/v1/admin/users/{id}/coins
 func (h *AdminHandler) AdjustCoins(w http.ResponseWriter, r *http.Request) {
-	// Verify admin is authenticated
-	_, ok := middleware.GetUserID(r)
+	// Verify caller is authenticated (role is enforced by RequireRole)
+	adminID, ok := middleware.GetUserID(r)
 	if !ok {
 		http.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
@@ -71,9 +82,9 @@ func (h *AdminHandler) AdjustCoins(w http.ResponseWriter, r *http.Request) {
 	defer tx.Rollback(ctx)
 
 	if req.Amount > 0 {
-		err = h.userRepo.AddCoins(ctx, tx, targetUserID, req.Amount)
+		err = h.userRepo.AddCoins(ctx, tx, targetUserID, req.Amount, models.CoinReasonAdminAdjustment, &adminID)
 	} else {
-		err = h.userRepo.DeductCoins(ctx, tx, targetUserID, -req.Amount)
+		err = h.userRepo.DeductCoins(ctx, tx, targetUserID, -req.Amount, models.CoinReasonAdminAdjustment, &adminID)
 	}
 
 	if err != nil {
@@ -112,7 +123,7 @@ func (h *AdminHandler) AdjustCoins(w http.ResponseWriter, r *http.Request) {
 
 // ClearInventory handles DELETE /api/v1/admin/users/{id}/inventory
 func (h *AdminHandler) ClearInventory(w http.ResponseWriter, r *http.Request) {
-	// Verify admin is authenticated
+	// Verify caller is authenticated (role is enforced by RequireRole)
 	_, ok := middleware.GetUserID(r)
 	if !ok {
 		http.Error(w, "unauthorized", http.StatusUnauthorized)
@@ -155,3 +166,62 @@ func (h *AdminHandler) ClearInventory(w http.ResponseWriter, r *http.Request) {
 		"message": "inventory cleared successfully",
 	})
 }
+
+// UnlockUser handles POST /api/v1/admin/users/{id}/unlock. It lifts a
+// login lockout on the account and resets its failure count.
+func (h *AdminHandler) UnlockUser(w http.ResponseWriter, r *http.Request) {
+	adminID, ok := middleware.GetUserID(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	targetUserID, err := uuid.Parse(vars["id"])
+	if err != nil {
+		http.Error(w, "invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	if _, err := h.userRepo.GetUserByID(targetUserID); err != nil {
+		http.Error(w, "user not found", http.StatusNotFound)
+		return
+	}
+
+	if err := h.loginAttemptRepo.ClearLoginFailures(r.Context(), models.LoginScopeAccount, targetUserID.String()); err != nil {
+		log.Printf("UnlockUser error for user %s: %v", targetUserID, err)
+		http.Error(w, "failed to unlock user", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Admin %s unlocked logins for user %s", adminID, targetUserID)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "user unlocked successfully",
+	})
+}
+
+// ReconcileLedger handles GET /api/v1/admin/ledger/reconcile. It checks that
+// every user's balance equals the sum of their coin ledger entries.
+func (h *AdminHandler) ReconcileLedger(w http.ResponseWriter, r *http.Request) {
+	mismatches, err := h.coinTxRepo.Reconcile(r.Context())
+	if err != nil {
+		log.Printf("ReconcileLedger error: %v", err)
+		http.Error(w, "failed to reconcile ledger", http.StatusInternalServerError)
+		return
+	}
+
+	// Return empty array instead of null
+	if mismatches == nil {
+		mismatches = []models.LedgerMismatch{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]any{
+		"consistent": len(mismatches) == 0,
+		"mismatches": mismatches,
+	})
+}
@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/diorshelton/golden-market-api/internal/auth"
+	"github.com/diorshelton/golden-market-api/internal/middleware"
+	"github.com/diorshelton/golden-market-api/internal/models"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+func TestCreateAPIKeyHandler(t *testing.T) {
+	tests := []struct {
+		name           string
+		requestBody    map[string]any
+		mockCreate     func(userID uuid.UUID, name string, scopes []string, expiresAt *time.Time) (*models.APIKey, string, error)
+		expectedStatus int
+	}{
+		{
+			name:        "created",
+			requestBody: map[string]any{"name": "restock bot", "scopes": []string{models.ScopeProductsWrite}},
+			mockCreate: func(userID uuid.UUID, name string, scopes []string, expiresAt *time.Time) (*models.APIKey, string, error) {
+				return &models.APIKey{ID: uuid.New(), Name: name, Prefix: "gmk_12345678", Scopes: scopes}, "gmk_secret", nil
+			},
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name:           "missing name",
+			requestBody:    map[string]any{"name": " ", "scopes": []string{models.ScopeOrdersRead}},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "no scopes",
+			requestBody:    map[string]any{"name": "bot"},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:        "unknown scope",
+			requestBody: map[string]any{"name": "bot", "scopes": []string{"everything"}},
+			mockCreate: func(userID uuid.UUID, name string, scopes []string, expiresAt *time.Time) (*models.APIKey, string, error) {
+				return nil, "", auth.ErrInvalidScope
+			},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:        "guest",
+			requestBody: map[string]any{"name": "bot", "scopes": []string{models.ScopeOrdersRead}},
+			mockCreate: func(userID uuid.UUID, name string, scopes []string, expiresAt *time.Time) (*models.APIKey, string, error) {
+				return nil, "", auth.ErrAPIKeyGuest
+			},
+			expectedStatus: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := NewAuthHandler(&MockAuthService{CreateAPIKeyFunc: tt.mockCreate}, "development")
+
+			jsonBody, _ := json.Marshal(tt.requestBody)
+			req := httptest.NewRequest(http.MethodPost, "/api-keys", bytes.NewBuffer(jsonBody))
+			req = req.WithContext(context.WithValue(req.Context(), middleware.UserIDKey, uuid.New()))
+
+			rr := httptest.NewRecorder()
+			handler.CreateAPIKey(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+
+			if rr.Code == http.StatusCreated {
+				var resp CreateAPIKeyResponse
+				if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+					t.Fatalf("Failed to decode response: %v", err)
+				}
+				if resp.Key != "gmk_secret" || resp.APIKey == nil {
+					t.Errorf("Expected the key and its details, got %+v", resp)
+				}
+			}
+		})
+	}
+}
+
+func TestRevokeAPIKeyHandler(t *testing.T) {
+	tests := []struct {
+		name           string
+		keyID          string
+		mockRevoke     func(userID, keyID uuid.UUID) error
+		expectedStatus int
+	}{
+		{
+			name:  "revoked",
+			keyID: uuid.New().String(),
+			mockRevoke: func(userID, keyID uuid.UUID) error {
+				return nil
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "invalid id",
+			keyID:          "not-a-uuid",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:  "not found",
+			keyID: uuid.New().String(),
+			mockRevoke: func(userID, keyID uuid.UUID) error {
+				return auth.ErrAPIKeyNotFound
+			},
+			expectedStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := NewAuthHandler(&MockAuthService{RevokeAPIKeyFunc: tt.mockRevoke}, "development")
+
+			req := httptest.NewRequest(http.MethodDelete, "/api-keys/"+tt.keyID, nil)
+			req = req.WithContext(context.WithValue(req.Context(), middleware.UserIDKey, uuid.New()))
+			req = mux.SetURLVars(req, map[string]string{"id": tt.keyID})
+
+			rr := httptest.NewRecorder()
+			handler.RevokeAPIKey(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+		})
+	}
+}
@@ -4,13 +4,19 @@ import (
 	"encoding/json"
 	"errors"
 	"log"
+	"math"
 	"net/http"
 	"net/mail"
+	"strconv"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/diorshelton/golden-market-api/internal/auth"
+	"github.com/diorshelton/golden-market-api/internal/middleware"
 	"github.com/diorshelton/golden-market-api/internal/models"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
 )
 
 // refreshCookieAttrs returns the SameSite mode and Secure flag for the
@@ -25,12 +31,70 @@ func (h *AuthHandler) refreshCookieAttrs() (http.SameSite, bool) {
 	return http.SameSiteLaxMode, false
 }
 
+// refreshCookieMaxAge is how long browsers keep the refresh token cookie
+const refreshCookieMaxAge = 7 * 24 * time.Hour
+
+// setRefreshCookie hands the client a refresh token. Every handler that
+// starts or rotates a session sets it here, so the attributes can't drift.
+func (h *AuthHandler) setRefreshCookie(w http.ResponseWriter, token string, maxAge time.Duration) {
+	sameSite, secure := h.refreshCookieAttrs()
+	http.SetCookie(w, &http.Cookie{
+		Name:     "refresh_token",
+		Value:    token,
+		Path:     "/",
+		MaxAge:   int(maxAge.Seconds()),
+		HttpOnly: true,
+		Secure:   secure,
+		SameSite: sameSite,
+		Expires:  time.Now().Add(maxAge),
+	})
+}
+
+// clearRefreshCookie tells the client to drop its refresh token cookie
+func (h *AuthHandler) clearRefreshCookie(w http.ResponseWriter) {
+	sameSite, secure := h.refreshCookieAttrs()
+	http.SetCookie(w, &http.Cookie{
+		Name:     "refresh_token",
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   secure,
+		SameSite: sameSite,
+	})
+}
+
 type AuthServiceInterface interface {
 	Register(firstName, lastName, email, username, password string) (*models.User, error)
-	Login(email, password string) (string, string, error)
-	GuestLogin() (string, string, error)
-	Refresh(oldRefreshToken string) (*auth.TokenPair, error)
+	Login(identifier, password string, client models.ClientInfo) (string, string, error)
+	GuestLogin(client models.ClientInfo) (string, string, error)
+	UpgradeGuest(userID uuid.UUID, firstName, lastName, email, username, password string, client models.ClientInfo) (string, string, error)
+	Refresh(oldRefreshToken string, client models.ClientInfo) (*auth.TokenPair, error)
 	Logout(refreshToken string) error
+	ListSessions(userID, currentSessionID uuid.UUID) ([]models.Session, error)
+	RevokeSession(userID, sessionID uuid.UUID) error
+	RevokeOtherSessions(userID, currentSessionID uuid.UUID) error
+	RequestPasswordReset(email string) error
+	ResetPassword(token, newPassword string) error
+	VerifyEmail(token string) error
+	LoginMFA(mfaToken, code string, client models.ClientInfo) (string, string, error)
+	EnrollMFA(userID uuid.UUID) (*auth.MFAEnrollment, error)
+	ConfirmMFA(userID, currentSessionID uuid.UUID, code string) error
+	DisableMFA(userID uuid.UUID, password, code string, client models.ClientInfo) error
+	JWKS() auth.JWKSet
+	UnlockAccount(token string) error
+	CreateAPIKey(userID uuid.UUID, name string, scopes []string, expiresAt *time.Time) (*models.APIKey, string, error)
+	ListAPIKeys(userID uuid.UUID) ([]models.APIKey, error)
+	RevokeAPIKey(userID, keyID uuid.UUID) error
+}
+
+// clientInfo describes the device making the request, for the sessions list
+// and login lockouts
+func clientInfo(r *http.Request) models.ClientInfo {
+	return models.ClientInfo{
+		UserAgent: r.UserAgent(),
+		IPAddress: middleware.ClientIPFrom(r),
+	}
 }
 
 // AuthHandler contains HTTP handlers for authentication
@@ -76,7 +140,12 @@ func (r *RegisterRequest) Validate() error {
 		return errors.New("username must be between 3 and 30 characters")
 	}
 
-	if len(r.Password) < 8 || len(r.Password) > 64 {
+	// Logins treat anything with an @ as an email
+	if strings.Contains(r.Username, "@") {
+		return errors.New("username can't contain @")
+	}
+
+	if n := utf8.RuneCountInString(r.Password); n < 8 || n > 64 {
 		return errors.New("password must be between 8 and 64 characters")
 	}
 
@@ -148,22 +217,24 @@ func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(response)
 }
 
+// LoginRequest takes an email or username as the identifier. Email is
+// the older name for the same field and is still accepted.
 type LoginRequest struct {
-	Email    string `json:"email"`
-	Password string `json:"password"`
+	Identifier string `json:"identifier"`
+	Email      string `json:"email"`
+	Password   string `json:"password"`
 }
 
 func (r *LoginRequest) Validate() error {
 	// Trim whitespace
-	r.Email = strings.TrimSpace(r.Email)
+	r.Identifier = strings.TrimSpace(r.Identifier)
+	if r.Identifier == "" {
+		r.Identifier = strings.TrimSpace(r.Email)
+	}
 	r.Password = strings.TrimSpace(r.Password)
 
 	// Check for empty credentials
-	if r.Email == "" || r.Password == "" {
-		return errors.New("invalid credentials")
-	}
-
-	if _, err := mail.ParseAddress(r.Email); err != nil {
+	if r.Identifier == "" || r.Password == "" {
 		return errors.New("invalid credentials")
 	}
 	return nil
@@ -174,6 +245,13 @@ type LoginResponse struct {
 	AccessToken string `json:"token"`
 }
 
+// MFARequiredResponse is returned by Login instead of tokens when the
+// account has two-factor on; MFAToken goes to /auth/login/mfa with a code
+type MFARequiredResponse struct {
+	MFARequired bool   `json:"mfa_required"`
+	MFAToken    string `json:"mfa_token"`
+}
+
 // Login handles user login with access and refresh tokens
 func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 	// Parse JSON
@@ -191,8 +269,20 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Attempt to login
-	accessToken, refreshToken, err := h.authService.Login(req.Email, req.Password)
+	accessToken, refreshToken, err := h.authService.Login(req.Identifier, req.Password, clientInfo(r))
 	if err != nil {
+		var mfaErr *auth.MFARequiredError
+		if errors.As(err, &mfaErr) {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(MFARequiredResponse{MFARequired: true, MFAToken: mfaErr.Token})
+			return
+		}
+		var throttleErr *auth.LoginThrottledError
+		if errors.As(err, &throttleErr) {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(throttleErr.RetryAfter.Seconds()))))
+			http.Error(w, "Too many failed login attempts, try again later", http.StatusTooManyRequests)
+			return
+		}
 		if errors.Is(err, auth.ErrInvalidCredentials) {
 			http.Error(w, "Invalid credentials", http.StatusUnauthorized)
 		} else {
@@ -201,18 +291,7 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	maxAge := int((7 * 24 * time.Hour).Seconds())
-	sameSite, secure := h.refreshCookieAttrs()
-	http.SetCookie(w, &http.Cookie{
-		Name:     "refresh_token",
-		Value:    refreshToken,
-		Path:     "/",
-		MaxAge:   maxAge,
-		HttpOnly: true,
-		Secure:   secure,
-		SameSite: sameSite,
-		Expires:  time.Now().Add(7 * 24 * time.Hour),
-	})
+	h.setRefreshCookie(w, refreshToken, refreshCookieMaxAge)
 
 	response := LoginResponse{AccessToken: accessToken}
 	// Return access tokens
@@ -220,33 +299,132 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(response)
 }
 
-// GuestLogin handles login to the single shared guest account
+type LoginMFARequest struct {
+	MFAToken string `json:"mfa_token"`
+	Code     string `json:"code"`
+}
+
+// LoginMFA finishes a two-factor login with a TOTP or recovery code
+func (h *AuthHandler) LoginMFA(w http.ResponseWriter, r *http.Request) {
+	var req LoginMFARequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON format", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	if strings.TrimSpace(req.MFAToken) == "" || strings.TrimSpace(req.Code) == "" {
+		http.Error(w, "mfa_token and code required", http.StatusBadRequest)
+		return
+	}
+
+	accessToken, refreshToken, err := h.authService.LoginMFA(req.MFAToken, req.Code, clientInfo(r))
+	if err != nil {
+		var throttleErr *auth.LoginThrottledError
+		switch {
+		case errors.As(err, &throttleErr):
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(throttleErr.RetryAfter.Seconds()))))
+			http.Error(w, "Too many failed login attempts, try again later", http.StatusTooManyRequests)
+		case errors.Is(err, auth.ErrInvalidToken) || errors.Is(err, auth.ErrExpiredToken):
+			http.Error(w, "Invalid or expired MFA token, please log in again", http.StatusUnauthorized)
+		case errors.Is(err, auth.ErrInvalidMFACode):
+			http.Error(w, "Invalid authentication code", http.StatusUnauthorized)
+		default:
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			log.Printf("MFA login error: %v", err)
+		}
+		return
+	}
+
+	h.setRefreshCookie(w, refreshToken, refreshCookieMaxAge)
+
+	response := LoginResponse{AccessToken: accessToken}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// GuestLogin handles login as a new, short-lived guest account
 func (h *AuthHandler) GuestLogin(w http.ResponseWriter, r *http.Request) {
-	accessToken, refreshToken, err := h.authService.GuestLogin()
+	accessToken, refreshToken, err := h.authService.GuestLogin(clientInfo(r))
 	if err != nil {
+		if errors.Is(err, auth.ErrTooManyGuests) {
+			http.Error(w, "Guest demo is at capacity, please try again later", http.StatusServiceUnavailable)
+			return
+		}
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		log.Printf("Guest login error: %v", err)
 		return
 	}
 
-	maxAge := int((7 * 24 * time.Hour).Seconds())
-	sameSite, secure := h.refreshCookieAttrs()
-	http.SetCookie(w, &http.Cookie{
-		Name:     "refresh_token",
-		Value:    refreshToken,
-		Path:     "/",
-		MaxAge:   maxAge,
-		HttpOnly: true,
-		Secure:   secure,
-		SameSite: sameSite,
-		Expires:  time.Now().Add(7 * 24 * time.Hour),
-	})
+	h.setRefreshCookie(w, refreshToken, refreshCookieMaxAge)
 
 	response := LoginResponse{AccessToken: accessToken}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
 }
 
+// UpgradeResponse is the registered account plus its new access token
+type UpgradeResponse struct {
+	RegisterResponse
+	AccessToken string `json:"token"`
+}
+
+// UpgradeGuest turns the calling guest into a registered account. It takes
+// the same payload as Register and replaces the guest session.
+func (h *AuthHandler) UpgradeGuest(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req RegisterRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON format", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	if err := req.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	accessToken, refreshToken, err := h.authService.UpgradeGuest(userID, req.FirstName, req.LastName, req.Email, req.Username, req.Password, clientInfo(r))
+	if err != nil {
+		switch {
+		case errors.Is(err, auth.ErrNotGuest):
+			http.Error(w, "Account is already registered", http.StatusConflict)
+		case errors.Is(err, auth.ErrExpiredToken):
+			http.Error(w, "Guest session has expired", http.StatusUnauthorized)
+		case errors.Is(err, auth.ErrEmailInUse):
+			http.Error(w, "Email already in use", http.StatusConflict)
+		case errors.Is(err, auth.ErrUsernameExists):
+			http.Error(w, "Username already exists", http.StatusConflict)
+		default:
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			log.Printf("Guest upgrade error for user %s: %v", userID, err)
+		}
+		return
+	}
+
+	h.setRefreshCookie(w, refreshToken, refreshCookieMaxAge)
+
+	response := UpgradeResponse{
+		RegisterResponse: RegisterResponse{
+			ID:        userID.String(),
+			Username:  req.Username,
+			FirstName: req.FirstName,
+			LastName:  req.LastName,
+			Email:     req.Email,
+			Message:   "Account upgraded",
+		},
+		AccessToken: accessToken,
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
 type RefreshResponse struct {
 	Token string `json:"token"`
 }
@@ -263,7 +441,7 @@ func (h *AuthHandler) Refresh(w http.ResponseWriter, r *http.Request) {
 	oldRefreshToken := cookie.Value
 
 	// Refresh and rotate tokens
-	tokenPair, err := h.authService.Refresh(oldRefreshToken)
+	tokenPair, err := h.authService.Refresh(oldRefreshToken, clientInfo(r))
 	if err != nil {
 		if errors.Is(err, auth.ErrInvalidToken) || errors.Is(err, auth.ErrExpiredToken) {
 			http.Error(w, "Invalid or expired refresh token", http.StatusUnauthorized)
@@ -272,17 +450,7 @@ func (h *AuthHandler) Refresh(w http.ResponseWriter, r *http.Request) {
 		}
 		return
 	}
-	maxAge := int((7 * 24 * time.Hour).Seconds())
-	sameSite, secure := h.refreshCookieAttrs()
-	http.SetCookie(w, &http.Cookie{
-		Name:     "refresh_token",
-		Value:    tokenPair.RefreshToken,
-		Path:     "/",
-		MaxAge:   maxAge,
-		HttpOnly: true,
-		Secure:   secure,
-		SameSite: sameSite,
-	})
+	h.setRefreshCookie(w, tokenPair.RefreshToken, refreshCookieMaxAge)
 	// Return the new access token
 	response := RefreshResponse{Token: tokenPair.AccessToken}
 	w.Header().Set("Content-Type", "application/json")
@@ -293,17 +461,8 @@ func (h *AuthHandler) Refresh(w http.ResponseWriter, r *http.Request) {
 func (h *AuthHandler) Logout(w http.ResponseWriter, r *http.Request) {
 	// Read refresh token from cookie
 	cookie, err := r.Cookie("refresh_token")
-	sameSite, secure := h.refreshCookieAttrs()
 	if err != nil {
-		http.SetCookie(w, &http.Cookie{
-			Name:     "refresh_token",
-			Value:    "",
-			Path:     "/",
-			MaxAge:   -1,
-			HttpOnly: true,
-			Secure:   secure,
-			SameSite: sameSite,
-		})
+		h.clearRefreshCookie(w)
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(map[string]string{"message": "Logged out successfully"})
 		return
@@ -319,16 +478,355 @@ func (h *AuthHandler) Logout(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Clear cookie
-	http.SetCookie(w, &http.Cookie{
-		Name:     "refresh_token",
-		Value:    "",
-		Path:     "/",
-		MaxAge:   -1,
-		HttpOnly: true,
-		Secure:   secure,
-		SameSite: sameSite,
-	})
+	h.clearRefreshCookie(w)
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{"message": "Logged out successfully"})
 }
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email"`
+}
+
+// ForgotPassword mails a password reset link. It answers the same way
+// whether or not the email has an account.
+func (h *AuthHandler) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	var req ForgotPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON format", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	req.Email = strings.TrimSpace(req.Email)
+	if _, err := mail.ParseAddress(req.Email); err != nil {
+		http.Error(w, "invalid email address", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.authService.RequestPasswordReset(req.Email); err != nil {
+		// Still answer normally; an error here must not reveal the account exists
+		log.Printf("Password reset request error: %v", err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{"message": "If that email has an account, a reset link is on its way"})
+}
+
+type ResetPasswordRequest struct {
+	Token           string `json:"token"`
+	Password        string `json:"password"`
+	PasswordConfirm string `json:"password_confirm"`
+}
+
+func (r *ResetPasswordRequest) Validate() error {
+	r.Token = strings.TrimSpace(r.Token)
+	r.Password = strings.TrimSpace(r.Password)
+	r.PasswordConfirm = strings.TrimSpace(r.PasswordConfirm)
+
+	if r.Token == "" || r.Password == "" {
+		return errors.New("token and password required")
+	}
+
+	if n := utf8.RuneCountInString(r.Password); n < 8 || n > 64 {
+		return errors.New("password must be between 8 and 64 characters")
+	}
+
+	if r.Password != r.PasswordConfirm {
+		return errors.New("passwords must match")
+	}
+
+	return nil
+}
+
+// ResetPassword sets a new password from an emailed reset token and signs
+// the user out everywhere
+func (h *AuthHandler) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	var req ResetPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON format", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	if err := req.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.authService.ResetPassword(req.Token, req.Password); err != nil {
+		if errors.Is(err, auth.ErrInvalidToken) {
+			http.Error(w, "Invalid or expired reset token", http.StatusBadRequest)
+			return
+		}
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		log.Printf("Password reset error: %v", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Password has been reset, please log in"})
+}
+
+// VerifyEmail confirms the user's email from the token in the verification
+// email
+func (h *AuthHandler) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	token := strings.TrimSpace(r.URL.Query().Get("token"))
+	if token == "" {
+		http.Error(w, "Verification token required", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.authService.VerifyEmail(token); err != nil {
+		if errors.Is(err, auth.ErrInvalidToken) {
+			http.Error(w, "Invalid or expired verification token", http.StatusBadRequest)
+			return
+		}
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		log.Printf("Email verification error: %v", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Email verified"})
+}
+
+// UnlockAccount lifts a login lockout from the token in the lockout email
+func (h *AuthHandler) UnlockAccount(w http.ResponseWriter, r *http.Request) {
+	token := strings.TrimSpace(r.URL.Query().Get("token"))
+	if token == "" {
+		http.Error(w, "Unlock token required", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.authService.UnlockAccount(token); err != nil {
+		if errors.Is(err, auth.ErrInvalidToken) {
+			http.Error(w, "Invalid or expired unlock token", http.StatusBadRequest)
+			return
+		}
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		log.Printf("Account unlock error: %v", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Account unlocked, you can log in again"})
+}
+
+// JWKS publishes the public keys access tokens are signed with, so other
+// services can verify them without sharing a secret
+func (h *AuthHandler) JWKS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	// Short enough that a newly added key is picked up well before it signs
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	json.NewEncoder(w).Encode(h.authService.JWKS())
+}
+
+// ListSessions returns the devices the user is signed in on
+func (h *AuthHandler) ListSessions(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	// Older access tokens have no session; nothing is marked current then
+	currentSessionID, _ := middleware.GetSessionID(r)
+
+	sessions, err := h.authService.ListSessions(userID, currentSessionID)
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		log.Printf("List sessions error for user %s: %v", userID, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(sessions)
+}
+
+// RevokeSession signs the user out of one session
+func (h *AuthHandler) RevokeSession(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	sessionID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid session ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.authService.RevokeSession(userID, sessionID); err != nil {
+		if errors.Is(err, auth.ErrSessionNotFound) {
+			http.Error(w, "Session not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		log.Printf("Revoke session error for user %s: %v", userID, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Session revoked"})
+}
+
+// RevokeOtherSessions signs the user out everywhere but the current session
+func (h *AuthHandler) RevokeOtherSessions(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	// Without a session claim we can't tell which session to keep
+	currentSessionID, ok := middleware.GetSessionID(r)
+	if !ok {
+		http.Error(w, "Current session unknown, please log in again", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.authService.RevokeOtherSessions(userID, currentSessionID); err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		log.Printf("Revoke other sessions error for user %s: %v", userID, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Signed out of all other sessions"})
+}
+
+// EnrollMFA starts two-factor setup and returns the secret, otpauth URI and
+// recovery codes. Nothing changes for the user until ConfirmMFA.
+func (h *AuthHandler) EnrollMFA(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	enrollment, err := h.authService.EnrollMFA(userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, auth.ErrMFAAlreadyEnabled):
+			http.Error(w, "Two-factor authentication is already enabled", http.StatusConflict)
+		case errors.Is(err, auth.ErrMFAGuest):
+			http.Error(w, "Guest accounts can't enable two-factor authentication", http.StatusForbidden)
+		default:
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			log.Printf("MFA enroll error for user %s: %v", userID, err)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(enrollment)
+}
+
+type MFACodeRequest struct {
+	Code string `json:"code"`
+}
+
+// decodeMFACode reads a {"code": "..."} body, writing a 400 on failure
+func decodeMFACode(w http.ResponseWriter, r *http.Request) (string, bool) {
+	var req MFACodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON format", http.StatusBadRequest)
+		return "", false
+	}
+	defer r.Body.Close()
+
+	code := strings.TrimSpace(req.Code)
+	if code == "" {
+		http.Error(w, "code required", http.StatusBadRequest)
+		return "", false
+	}
+	return code, true
+}
+
+// ConfirmMFA turns two-factor on with a code from the enrolled app. Other
+// sessions are signed out.
+func (h *AuthHandler) ConfirmMFA(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	code, ok := decodeMFACode(w, r)
+	if !ok {
+		return
+	}
+
+	currentSessionID, _ := middleware.GetSessionID(r)
+	if err := h.authService.ConfirmMFA(userID, currentSessionID, code); err != nil {
+		switch {
+		case errors.Is(err, auth.ErrInvalidMFACode):
+			http.Error(w, "Invalid authentication code", http.StatusBadRequest)
+		case errors.Is(err, auth.ErrMFANotEnrolled):
+			http.Error(w, "Start enrollment first", http.StatusConflict)
+		case errors.Is(err, auth.ErrMFAAlreadyEnabled):
+			http.Error(w, "Two-factor authentication is already enabled", http.StatusConflict)
+		default:
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			log.Printf("MFA confirm error for user %s: %v", userID, err)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Two-factor authentication enabled"})
+}
+
+type DisableMFARequest struct {
+	Password string `json:"password"`
+	Code     string `json:"code"`
+}
+
+// DisableMFA turns two-factor off given the current password and a current
+// TOTP or recovery code
+func (h *AuthHandler) DisableMFA(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req DisableMFARequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON format", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	code := strings.TrimSpace(req.Code)
+	if req.Password == "" || code == "" {
+		http.Error(w, "password and code required", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.authService.DisableMFA(userID, req.Password, code, clientInfo(r)); err != nil {
+		var throttleErr *auth.LoginThrottledError
+		switch {
+		case errors.As(err, &throttleErr):
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(throttleErr.RetryAfter.Seconds()))))
+			http.Error(w, "Too many failed attempts, try again later", http.StatusTooManyRequests)
+		case errors.Is(err, auth.ErrInvalidCredentials):
+			http.Error(w, "Password is incorrect", http.StatusForbidden)
+		case errors.Is(err, auth.ErrInvalidMFACode):
+			http.Error(w, "Invalid authentication code", http.StatusBadRequest)
+		case errors.Is(err, auth.ErrMFANotEnabled), errors.Is(err, auth.ErrAccountGuest):
+			http.Error(w, "Two-factor authentication is not enabled", http.StatusConflict)
+		default:
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			log.Printf("MFA disable error for user %s: %v", userID, err)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Two-factor authentication disabled"})
+}
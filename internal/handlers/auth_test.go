@@ -2,14 +2,20 @@ package handlers
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/diorshelton/golden-market-api/internal/auth"
+	"github.com/diorshelton/golden-market-api/internal/middleware"
 	"github.com/diorshelton/golden-market-api/internal/models"
 	"github.com/google/uuid"
+	"github.com/gorilla/mux"
 )
 
 // Mock AuthService for testing
@@ -17,23 +23,48 @@ type MockAuthService struct {
 	RegisterFunc   func(firstName, lastName, email, username, password string) (*models.User, error)
 	LoginFunc      func(email, password string) (accessToken string, refreshToken string, err error)
 	GuestLoginFunc func() (accessToken string, refreshToken string, err error)
+	UpgradeFunc    func(userID uuid.UUID, firstName, lastName, email, username, password string) (string, string, error)
 	RefreshFunc    func(oldRefreshToken string) (*auth.TokenPair, error)
 	LogoutFunc     func(tokenString string) error
+
+	ListSessionsFunc        func(userID, currentSessionID uuid.UUID) ([]models.Session, error)
+	RevokeSessionFunc       func(userID, sessionID uuid.UUID) error
+	RevokeOtherSessionsFunc func(userID, currentSessionID uuid.UUID) error
+
+	RequestPasswordResetFunc func(email string) error
+	ResetPasswordFunc        func(token, newPassword string) error
+	VerifyEmailFunc          func(token string) error
+
+	LoginMFAFunc   func(mfaToken, code string) (string, string, error)
+	EnrollMFAFunc  func(userID uuid.UUID) (*auth.MFAEnrollment, error)
+	ConfirmMFAFunc func(userID, currentSessionID uuid.UUID, code string) error
+	DisableMFAFunc func(userID uuid.UUID, password, code string) error
+
+	JWKSFunc          func() auth.JWKSet
+	UnlockAccountFunc func(token string) error
+
+	CreateAPIKeyFunc func(userID uuid.UUID, name string, scopes []string, expiresAt *time.Time) (*models.APIKey, string, error)
+	ListAPIKeysFunc  func(userID uuid.UUID) ([]models.APIKey, error)
+	RevokeAPIKeyFunc func(userID, keyID uuid.UUID) error
 }
 
 func (m *MockAuthService) Register(firstName, lastName, email, username, password string) (*models.User, error) {
 	return m.RegisterFunc(firstName, lastName, email, username, password)
 }
 
-func (m *MockAuthService) Login(email, password string) (string, string, error) {
-	return m.LoginFunc(email, password)
+func (m *MockAuthService) Login(identifier, password string, client models.ClientInfo) (string, string, error) {
+	return m.LoginFunc(identifier, password)
 }
 
-func (m *MockAuthService) GuestLogin() (string, string, error) {
+func (m *MockAuthService) GuestLogin(client models.ClientInfo) (string, string, error) {
 	return m.GuestLoginFunc()
 }
 
-func (m *MockAuthService) Refresh(oldRefreshToken string) (*auth.TokenPair, error) {
+func (m *MockAuthService) UpgradeGuest(userID uuid.UUID, firstName, lastName, email, username, password string, client models.ClientInfo) (string, string, error) {
+	return m.UpgradeFunc(userID, firstName, lastName, email, username, password)
+}
+
+func (m *MockAuthService) Refresh(oldRefreshToken string, client models.ClientInfo) (*auth.TokenPair, error) {
 	return m.RefreshFunc(oldRefreshToken)
 }
 
@@ -41,6 +72,92 @@ func (m *MockAuthService) Logout(tokenString string) error {
 	return m.LogoutFunc(tokenString)
 }
 
+func (m *MockAuthService) ListSessions(userID, currentSessionID uuid.UUID) ([]models.Session, error) {
+	return m.ListSessionsFunc(userID, currentSessionID)
+}
+
+func (m *MockAuthService) RevokeSession(userID, sessionID uuid.UUID) error {
+	return m.RevokeSessionFunc(userID, sessionID)
+}
+
+func (m *MockAuthService) RevokeOtherSessions(userID, currentSessionID uuid.UUID) error {
+	return m.RevokeOtherSessionsFunc(userID, currentSessionID)
+}
+
+func (m *MockAuthService) RequestPasswordReset(email string) error {
+	return m.RequestPasswordResetFunc(email)
+}
+
+func (m *MockAuthService) ResetPassword(token, newPassword string) error {
+	return m.ResetPasswordFunc(token, newPassword)
+}
+
+func (m *MockAuthService) VerifyEmail(token string) error {
+	return m.VerifyEmailFunc(token)
+}
+
+func (m *MockAuthService) LoginMFA(mfaToken, code string, client models.ClientInfo) (string, string, error) {
+	return m.LoginMFAFunc(mfaToken, code)
+}
+
+func (m *MockAuthService) EnrollMFA(userID uuid.UUID) (*auth.MFAEnrollment, error) {
+	return m.EnrollMFAFunc(userID)
+}
+
+func (m *MockAuthService) ConfirmMFA(userID, currentSessionID uuid.UUID, code string) error {
+	return m.ConfirmMFAFunc(userID, currentSessionID, code)
+}
+
+func (m *MockAuthService) DisableMFA(userID uuid.UUID, password, code string, client models.ClientInfo) error {
+	return m.DisableMFAFunc(userID, password, code)
+}
+
+func (m *MockAuthService) JWKS() auth.JWKSet {
+	return m.JWKSFunc()
+}
+
+func (m *MockAuthService) UnlockAccount(token string) error {
+	return m.UnlockAccountFunc(token)
+}
+
+func (m *MockAuthService) CreateAPIKey(userID uuid.UUID, name string, scopes []string, expiresAt *time.Time) (*models.APIKey, string, error) {
+	return m.CreateAPIKeyFunc(userID, name, scopes, expiresAt)
+}
+
+func (m *MockAuthService) ListAPIKeys(userID uuid.UUID) ([]models.APIKey, error) {
+	return m.ListAPIKeysFunc(userID)
+}
+
+func (m *MockAuthService) RevokeAPIKey(userID, keyID uuid.UUID) error {
+	return m.RevokeAPIKeyFunc(userID, keyID)
+}
+
+func TestRefreshCookie(t *testing.T) {
+	handler := NewAuthHandler(&MockAuthService{}, "production")
+
+	rr := httptest.NewRecorder()
+	handler.setRefreshCookie(rr, "refresh_token_here", refreshCookieMaxAge)
+	handler.clearRefreshCookie(rr)
+
+	cookies := rr.Result().Cookies()
+	if len(cookies) != 2 {
+		t.Fatalf("Expected 2 cookies, got %d", len(cookies))
+	}
+	set, cleared := cookies[0], cookies[1]
+
+	if set.Value != "refresh_token_here" || set.MaxAge != int(refreshCookieMaxAge.Seconds()) {
+		t.Errorf("Unexpected refresh cookie: %+v", set)
+	}
+	if cleared.Value != "" || cleared.MaxAge >= 0 {
+		t.Errorf("Expected a cleared cookie, got %+v", cleared)
+	}
+	for _, cookie := range cookies {
+		if cookie.Name != "refresh_token" || cookie.Path != "/" || !cookie.HttpOnly || !cookie.Secure || cookie.SameSite != http.SameSiteNoneMode {
+			t.Errorf("Expected matching production attributes, got %+v", cookie)
+		}
+	}
+}
+
 func TestRegisterHandler(t *testing.T) {
 	tests := []struct {
 		name           string
@@ -90,6 +207,36 @@ func TestRegisterHandler(t *testing.T) {
 			expectedStatus: http.StatusBadRequest,
 			checkResponse:  nil,
 		},
+		{
+			name: "password of 64 multibyte characters",
+			requestBody: map[string]string{
+				"first_name":       "Dandara",
+				"last_name":        "dos Palmares",
+				"email":            "dandap@example.com",
+				"username":         "dandap",
+				"password":         strings.Repeat("é", 64),
+				"password_confirm": strings.Repeat("é", 64),
+			},
+			mockRegister: func(firstName, lastName, email, username, password string) (*models.User, error) {
+				return &models.User{ID: uuid.New(), Email: email, Username: username}, nil
+			},
+			expectedStatus: http.StatusCreated,
+			checkResponse:  nil,
+		},
+		{
+			name: "username that looks like an email",
+			requestBody: map[string]string{
+				"first_name":       "Dandara",
+				"last_name":        "dos Palmares",
+				"email":            "dandap@example.com",
+				"username":         "dandap@example.com",
+				"password":         "password123",
+				"password_confirm": "password123",
+			},
+			mockRegister:   nil,
+			expectedStatus: http.StatusBadRequest,
+			checkResponse:  nil,
+		},
 		{
 			name: "passwords don't match",
 			requestBody: map[string]string{
@@ -180,6 +327,30 @@ func TestLoginHandler(t *testing.T) {
 			expectedStatus: http.StatusUnauthorized,
 			checkCookie:    false,
 		},
+		{
+			name: "two-factor required",
+			requestBody: map[string]string{
+				"email":    "john@example.com",
+				"password": "password123",
+			},
+			mockLogin: func(email string, password string) (string, string, error) {
+				return "", "", &auth.MFARequiredError{Token: "pending_token"}
+			},
+			expectedStatus: http.StatusOK,
+			checkCookie:    false,
+		},
+		{
+			name: "locked out",
+			requestBody: map[string]string{
+				"email":    "john@example.com",
+				"password": "password123",
+			},
+			mockLogin: func(email string, password string) (string, string, error) {
+				return "", "", &auth.LoginThrottledError{RetryAfter: 90 * time.Second}
+			},
+			expectedStatus: http.StatusTooManyRequests,
+			checkCookie:    false,
+		},
 		{
 			name: "missing email",
 			requestBody: map[string]string{
@@ -210,6 +381,10 @@ func TestLoginHandler(t *testing.T) {
 				t.Errorf("Expected status %d, got %d", tt.expectedStatus, rr.Code)
 			}
 
+			if rr.Code == http.StatusTooManyRequests && rr.Header().Get("Retry-After") != "90" {
+				t.Errorf("Expected Retry-After 90, got %q", rr.Header().Get("Retry-After"))
+			}
+
 			if tt.checkCookie {
 				cookies := rr.Result().Cookies()
 				found := false
@@ -232,6 +407,205 @@ func TestLoginHandler(t *testing.T) {
 	}
 }
 
+func TestLoginHandlerIdentifier(t *testing.T) {
+	tests := []struct {
+		name        string
+		requestBody map[string]string
+		expected    string
+	}{
+		{
+			name:        "username",
+			requestBody: map[string]string{"identifier": " finn ", "password": "password123"},
+			expected:    "finn",
+		},
+		{
+			name:        "email",
+			requestBody: map[string]string{"identifier": "Finn@Example.com", "password": "password123"},
+			expected:    "Finn@Example.com",
+		},
+		{
+			name:        "legacy email field",
+			requestBody: map[string]string{"email": "finn@example.com", "password": "password123"},
+			expected:    "finn@example.com",
+		},
+		{
+			name:        "identifier wins over email",
+			requestBody: map[string]string{"identifier": "finn", "email": "jake@example.com", "password": "password123"},
+			expected:    "finn",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			mockService := &MockAuthService{
+				LoginFunc: func(identifier, password string) (string, string, error) {
+					got = identifier
+					return "access_token_here", "refresh_token_here", nil
+				},
+			}
+			handler := NewAuthHandler(mockService, "development")
+
+			jsonBody, _ := json.Marshal(tt.requestBody)
+			req := httptest.NewRequest(http.MethodPost, "/auth/login", bytes.NewBuffer(jsonBody))
+
+			rr := httptest.NewRecorder()
+			handler.Login(rr, req)
+
+			if rr.Code != http.StatusOK {
+				t.Fatalf("Expected status 200, got %d", rr.Code)
+			}
+			if got != tt.expected {
+				t.Errorf("Expected identifier %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestGuestLoginHandler(t *testing.T) {
+	tests := []struct {
+		name           string
+		mockGuestLogin func() (string, string, error)
+		expectedStatus int
+	}{
+		{
+			name: "successful guest login",
+			mockGuestLogin: func() (string, string, error) {
+				return "access_token_here", "refresh_token_here", nil
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name: "guest capacity reached",
+			mockGuestLogin: func() (string, string, error) {
+				return "", "", auth.ErrTooManyGuests
+			},
+			expectedStatus: http.StatusServiceUnavailable,
+		},
+		{
+			name: "internal error",
+			mockGuestLogin: func() (string, string, error) {
+				return "", "", errors.New("db down")
+			},
+			expectedStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := NewAuthHandler(&MockAuthService{GuestLoginFunc: tt.mockGuestLogin}, "development")
+
+			req := httptest.NewRequest(http.MethodPost, "/auth/guest-login", nil)
+			rr := httptest.NewRecorder()
+			handler.GuestLogin(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+		})
+	}
+}
+
+func TestUpgradeGuestHandler(t *testing.T) {
+	validBody := map[string]string{
+		"username":         "fionna",
+		"first_name":       "Fionna",
+		"last_name":        "Campbell",
+		"email":            "fionna@example.com",
+		"password":         "password123",
+		"password_confirm": "password123",
+	}
+
+	tests := []struct {
+		name           string
+		requestBody    map[string]string
+		authenticated  bool
+		mockUpgrade    func(userID uuid.UUID, firstName, lastName, email, username, password string) (string, string, error)
+		expectedStatus int
+	}{
+		{
+			name:          "successful upgrade",
+			requestBody:   validBody,
+			authenticated: true,
+			mockUpgrade: func(userID uuid.UUID, firstName, lastName, email, username, password string) (string, string, error) {
+				return "access_token_here", "refresh_token_here", nil
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "not logged in",
+			requestBody:    validBody,
+			authenticated:  false,
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "invalid payload",
+			requestBody:    map[string]string{"username": "fionna"},
+			authenticated:  true,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:          "already registered",
+			requestBody:   validBody,
+			authenticated: true,
+			mockUpgrade: func(userID uuid.UUID, firstName, lastName, email, username, password string) (string, string, error) {
+				return "", "", auth.ErrNotGuest
+			},
+			expectedStatus: http.StatusConflict,
+		},
+		{
+			name:          "email taken",
+			requestBody:   validBody,
+			authenticated: true,
+			mockUpgrade: func(userID uuid.UUID, firstName, lastName, email, username, password string) (string, string, error) {
+				return "", "", auth.ErrEmailInUse
+			},
+			expectedStatus: http.StatusConflict,
+		},
+		{
+			name:          "guest expired",
+			requestBody:   validBody,
+			authenticated: true,
+			mockUpgrade: func(userID uuid.UUID, firstName, lastName, email, username, password string) (string, string, error) {
+				return "", "", auth.ErrExpiredToken
+			},
+			expectedStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := NewAuthHandler(&MockAuthService{UpgradeFunc: tt.mockUpgrade}, "development")
+
+			jsonBody, _ := json.Marshal(tt.requestBody)
+			req := httptest.NewRequest(http.MethodPost, "/auth/upgrade", bytes.NewBuffer(jsonBody))
+			req.Header.Set("Content-Type", "application/json")
+			if tt.authenticated {
+				req = req.WithContext(context.WithValue(req.Context(), middleware.UserIDKey, uuid.New()))
+			}
+
+			rr := httptest.NewRecorder()
+			handler.UpgradeGuest(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+
+			if tt.expectedStatus == http.StatusOK {
+				found := false
+				for _, cookie := range rr.Result().Cookies() {
+					if cookie.Name == "refresh_token" && cookie.Value == "refresh_token_here" {
+						found = true
+					}
+				}
+				if !found {
+					t.Error("Expected new refresh_token cookie to be set")
+				}
+			}
+		})
+	}
+}
+
 func TestRefreshHandler(t *testing.T) {
 	tests := []struct {
 		name           string
@@ -358,6 +732,10 @@ func TestLogoutHandler(t *testing.T) {
 				t.Errorf("Expected status %d, got %d", tt.expectedStatus, rr.Code)
 			}
 
+			if rr.Code == http.StatusTooManyRequests && rr.Header().Get("Retry-After") != "90" {
+				t.Errorf("Expected Retry-After 90, got %q", rr.Header().Get("Retry-After"))
+			}
+
 			if tt.checkCookie {
 				cookies := rr.Result().Cookies()
 				found := false
@@ -376,3 +754,595 @@ func TestLogoutHandler(t *testing.T) {
 		})
 	}
 }
+
+func TestListSessionsHandler(t *testing.T) {
+	userID := uuid.New()
+	current := uuid.New()
+
+	mockService := &MockAuthService{
+		ListSessionsFunc: func(gotUser, currentSessionID uuid.UUID) ([]models.Session, error) {
+			if gotUser != userID || currentSessionID != current {
+				t.Errorf("Expected user %s and session %s, got %s and %s", userID, current, gotUser, currentSessionID)
+			}
+			return []models.Session{
+				{ID: current, UserAgent: "Firefox", Current: true},
+				{ID: uuid.New(), UserAgent: "Safari"},
+			}, nil
+		},
+	}
+	handler := NewAuthHandler(mockService, "development")
+
+	req := httptest.NewRequest(http.MethodGet, "/sessions", nil)
+	ctx := context.WithValue(req.Context(), middleware.UserIDKey, userID)
+	ctx = context.WithValue(ctx, middleware.SessionIDKey, current)
+	req = req.WithContext(ctx)
+
+	rr := httptest.NewRecorder()
+	handler.ListSessions(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, rr.Code)
+	}
+
+	var sessions []models.Session
+	if err := json.NewDecoder(rr.Body).Decode(&sessions); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(sessions) != 2 || !sessions[0].Current || sessions[1].Current {
+		t.Errorf("Unexpected sessions: %+v", sessions)
+	}
+}
+
+func TestRevokeSessionHandler(t *testing.T) {
+	tests := []struct {
+		name           string
+		sessionID      string
+		mockRevoke     func(userID, sessionID uuid.UUID) error
+		expectedStatus int
+	}{
+		{
+			name:      "revoked",
+			sessionID: uuid.New().String(),
+			mockRevoke: func(userID, sessionID uuid.UUID) error {
+				return nil
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "invalid id",
+			sessionID:      "not-a-uuid",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:      "not found",
+			sessionID: uuid.New().String(),
+			mockRevoke: func(userID, sessionID uuid.UUID) error {
+				return auth.ErrSessionNotFound
+			},
+			expectedStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := NewAuthHandler(&MockAuthService{RevokeSessionFunc: tt.mockRevoke}, "development")
+
+			req := httptest.NewRequest(http.MethodDelete, "/sessions/"+tt.sessionID, nil)
+			req = req.WithContext(context.WithValue(req.Context(), middleware.UserIDKey, uuid.New()))
+			req = mux.SetURLVars(req, map[string]string{"id": tt.sessionID})
+
+			rr := httptest.NewRecorder()
+			handler.RevokeSession(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+		})
+	}
+}
+
+func TestRevokeOtherSessionsHandler(t *testing.T) {
+	tests := []struct {
+		name           string
+		withSession    bool
+		expectedStatus int
+	}{
+		{name: "keeps current session", withSession: true, expectedStatus: http.StatusOK},
+		{name: "token without session", withSession: false, expectedStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			current := uuid.New()
+			mockService := &MockAuthService{
+				RevokeOtherSessionsFunc: func(userID, currentSessionID uuid.UUID) error {
+					if currentSessionID != current {
+						t.Errorf("Expected current session %s to be kept, got %s", current, currentSessionID)
+					}
+					return nil
+				},
+			}
+			handler := NewAuthHandler(mockService, "development")
+
+			req := httptest.NewRequest(http.MethodDelete, "/sessions", nil)
+			ctx := context.WithValue(req.Context(), middleware.UserIDKey, uuid.New())
+			if tt.withSession {
+				ctx = context.WithValue(ctx, middleware.SessionIDKey, current)
+			}
+			req = req.WithContext(ctx)
+
+			rr := httptest.NewRecorder()
+			handler.RevokeOtherSessions(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+		})
+	}
+}
+
+func TestForgotPasswordHandler(t *testing.T) {
+	tests := []struct {
+		name           string
+		requestBody    map[string]string
+		mockRequest    func(email string) error
+		expectedStatus int
+	}{
+		{
+			name:        "reset requested",
+			requestBody: map[string]string{"email": "finn@example.com"},
+			mockRequest: func(email string) error {
+				return nil
+			},
+			expectedStatus: http.StatusAccepted,
+		},
+		{
+			name:        "mail failure is not revealed",
+			requestBody: map[string]string{"email": "finn@example.com"},
+			mockRequest: func(email string) error {
+				return errors.New("smtp unavailable")
+			},
+			expectedStatus: http.StatusAccepted,
+		},
+		{
+			name:           "invalid email",
+			requestBody:    map[string]string{"email": "not-an-email"},
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := NewAuthHandler(&MockAuthService{RequestPasswordResetFunc: tt.mockRequest}, "development")
+
+			jsonBody, _ := json.Marshal(tt.requestBody)
+			req := httptest.NewRequest(http.MethodPost, "/auth/forgot-password", bytes.NewBuffer(jsonBody))
+			req.Header.Set("Content-Type", "application/json")
+
+			rr := httptest.NewRecorder()
+			handler.ForgotPassword(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+		})
+	}
+}
+
+func TestResetPasswordHandler(t *testing.T) {
+	tests := []struct {
+		name           string
+		requestBody    map[string]string
+		mockReset      func(token, newPassword string) error
+		expectedStatus int
+	}{
+		{
+			name: "password reset",
+			requestBody: map[string]string{
+				"token":            "reset-token",
+				"password":         "newpassword123",
+				"password_confirm": "newpassword123",
+			},
+			mockReset: func(token, newPassword string) error {
+				if token != "reset-token" || newPassword != "newpassword123" {
+					return errors.New("unexpected arguments")
+				}
+				return nil
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name: "passwords differ",
+			requestBody: map[string]string{
+				"token":            "reset-token",
+				"password":         "newpassword123",
+				"password_confirm": "newpassword456",
+			},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name: "password too short",
+			requestBody: map[string]string{
+				"token":            "reset-token",
+				"password":         "short",
+				"password_confirm": "short",
+			},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name: "expired token",
+			requestBody: map[string]string{
+				"token":            "old-token",
+				"password":         "newpassword123",
+				"password_confirm": "newpassword123",
+			},
+			mockReset: func(token, newPassword string) error {
+				return auth.ErrInvalidToken
+			},
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := NewAuthHandler(&MockAuthService{ResetPasswordFunc: tt.mockReset}, "development")
+
+			jsonBody, _ := json.Marshal(tt.requestBody)
+			req := httptest.NewRequest(http.MethodPost, "/auth/reset-password", bytes.NewBuffer(jsonBody))
+			req.Header.Set("Content-Type", "application/json")
+
+			rr := httptest.NewRecorder()
+			handler.ResetPassword(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+		})
+	}
+}
+
+func TestVerifyEmailHandler(t *testing.T) {
+	tests := []struct {
+		name           string
+		query          string
+		mockVerify     func(token string) error
+		expectedStatus int
+	}{
+		{
+			name:  "verified",
+			query: "?token=abc",
+			mockVerify: func(token string) error {
+				return nil
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "missing token",
+			query:          "",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:  "invalid token",
+			query: "?token=abc",
+			mockVerify: func(token string) error {
+				return auth.ErrInvalidToken
+			},
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := NewAuthHandler(&MockAuthService{VerifyEmailFunc: tt.mockVerify}, "development")
+
+			req := httptest.NewRequest(http.MethodGet, "/auth/verify-email"+tt.query, nil)
+
+			rr := httptest.NewRecorder()
+			handler.VerifyEmail(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+		})
+	}
+}
+
+func TestLoginMFAHandler(t *testing.T) {
+	tests := []struct {
+		name           string
+		requestBody    map[string]string
+		mockLoginMFA   func(mfaToken, code string) (string, string, error)
+		expectedStatus int
+	}{
+		{
+			name:        "valid code",
+			requestBody: map[string]string{"mfa_token": "pending", "code": "123456"},
+			mockLoginMFA: func(mfaToken, code string) (string, string, error) {
+				return "access_token_here", "refresh_token_here", nil
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "missing code",
+			requestBody:    map[string]string{"mfa_token": "pending"},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:        "wrong code",
+			requestBody: map[string]string{"mfa_token": "pending", "code": "000000"},
+			mockLoginMFA: func(mfaToken, code string) (string, string, error) {
+				return "", "", auth.ErrInvalidMFACode
+			},
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:        "expired pending token",
+			requestBody: map[string]string{"mfa_token": "old", "code": "123456"},
+			mockLoginMFA: func(mfaToken, code string) (string, string, error) {
+				return "", "", auth.ErrExpiredToken
+			},
+			expectedStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := NewAuthHandler(&MockAuthService{LoginMFAFunc: tt.mockLoginMFA}, "development")
+
+			jsonBody, _ := json.Marshal(tt.requestBody)
+			req := httptest.NewRequest(http.MethodPost, "/auth/login/mfa", bytes.NewBuffer(jsonBody))
+			req.Header.Set("Content-Type", "application/json")
+
+			rr := httptest.NewRecorder()
+			handler.LoginMFA(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+
+			if tt.expectedStatus == http.StatusOK {
+				found := false
+				for _, cookie := range rr.Result().Cookies() {
+					if cookie.Name == "refresh_token" && cookie.Value == "refresh_token_here" {
+						found = true
+					}
+				}
+				if !found {
+					t.Error("Expected refresh_token cookie to be set")
+				}
+			}
+		})
+	}
+}
+
+func TestDisableMFAHandler(t *testing.T) {
+	tests := []struct {
+		name           string
+		requestBody    map[string]string
+		mockDisable    func(userID uuid.UUID, password, code string) error
+		expectedStatus int
+	}{
+		{
+			name:        "password and code",
+			requestBody: map[string]string{"password": "password123", "code": "123456"},
+			mockDisable: func(userID uuid.UUID, password, code string) error {
+				return nil
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "missing password",
+			requestBody:    map[string]string{"code": "123456"},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:        "wrong password",
+			requestBody: map[string]string{"password": "wrong", "code": "123456"},
+			mockDisable: func(userID uuid.UUID, password, code string) error {
+				return auth.ErrInvalidCredentials
+			},
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:        "locked out",
+			requestBody: map[string]string{"password": "password123", "code": "000000"},
+			mockDisable: func(userID uuid.UUID, password, code string) error {
+				return &auth.LoginThrottledError{RetryAfter: time.Minute}
+			},
+			expectedStatus: http.StatusTooManyRequests,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := NewAuthHandler(&MockAuthService{DisableMFAFunc: tt.mockDisable}, "development")
+
+			jsonBody, _ := json.Marshal(tt.requestBody)
+			req := httptest.NewRequest(http.MethodDelete, "/auth/mfa", bytes.NewBuffer(jsonBody))
+			req = req.WithContext(context.WithValue(req.Context(), middleware.UserIDKey, uuid.New()))
+
+			rr := httptest.NewRecorder()
+			handler.DisableMFA(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+		})
+	}
+}
+
+func TestEnrollMFAHandler(t *testing.T) {
+	tests := []struct {
+		name           string
+		mockEnroll     func(userID uuid.UUID) (*auth.MFAEnrollment, error)
+		expectedStatus int
+	}{
+		{
+			name: "enrollment started",
+			mockEnroll: func(userID uuid.UUID) (*auth.MFAEnrollment, error) {
+				return &auth.MFAEnrollment{
+					Secret:        "JBSWY3DPEHPK3PXP",
+					OTPAuthURI:    "otpauth://totp/Golden%20Market:finn@example.com?secret=JBSWY3DPEHPK3PXP",
+					RecoveryCodes: []string{"AAAA-BBBB-CCCC-DDDD"},
+				}, nil
+			},
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name: "already enabled",
+			mockEnroll: func(userID uuid.UUID) (*auth.MFAEnrollment, error) {
+				return nil, auth.ErrMFAAlreadyEnabled
+			},
+			expectedStatus: http.StatusConflict,
+		},
+		{
+			name: "guest",
+			mockEnroll: func(userID uuid.UUID) (*auth.MFAEnrollment, error) {
+				return nil, auth.ErrMFAGuest
+			},
+			expectedStatus: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := NewAuthHandler(&MockAuthService{EnrollMFAFunc: tt.mockEnroll}, "development")
+
+			req := httptest.NewRequest(http.MethodPost, "/auth/mfa/enroll", nil)
+			req = req.WithContext(context.WithValue(req.Context(), middleware.UserIDKey, uuid.New()))
+
+			rr := httptest.NewRecorder()
+			handler.EnrollMFA(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+		})
+	}
+}
+
+func TestConfirmMFAHandler(t *testing.T) {
+	tests := []struct {
+		name           string
+		requestBody    map[string]string
+		mockConfirm    func(userID, currentSessionID uuid.UUID, code string) error
+		expectedStatus int
+	}{
+		{
+			name:        "enabled",
+			requestBody: map[string]string{"code": "123456"},
+			mockConfirm: func(userID, currentSessionID uuid.UUID, code string) error {
+				return nil
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "missing code",
+			requestBody:    map[string]string{},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:        "wrong code",
+			requestBody: map[string]string{"code": "000000"},
+			mockConfirm: func(userID, currentSessionID uuid.UUID, code string) error {
+				return auth.ErrInvalidMFACode
+			},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:        "not enrolled",
+			requestBody: map[string]string{"code": "123456"},
+			mockConfirm: func(userID, currentSessionID uuid.UUID, code string) error {
+				return auth.ErrMFANotEnrolled
+			},
+			expectedStatus: http.StatusConflict,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := NewAuthHandler(&MockAuthService{ConfirmMFAFunc: tt.mockConfirm}, "development")
+
+			jsonBody, _ := json.Marshal(tt.requestBody)
+			req := httptest.NewRequest(http.MethodPost, "/auth/mfa/confirm", bytes.NewBuffer(jsonBody))
+			req = req.WithContext(context.WithValue(req.Context(), middleware.UserIDKey, uuid.New()))
+
+			rr := httptest.NewRecorder()
+			handler.ConfirmMFA(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+		})
+	}
+}
+
+func TestJWKSHandler(t *testing.T) {
+	keys := auth.NewEphemeralKeyring()
+	handler := NewAuthHandler(&MockAuthService{JWKSFunc: keys.JWKS}, "development")
+
+	req := httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil)
+	rr := httptest.NewRecorder()
+	handler.JWKS(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, rr.Code)
+	}
+	if got := rr.Header().Get("Cache-Control"); got != "public, max-age=300" {
+		t.Errorf("Expected Cache-Control public, max-age=300, got %q", got)
+	}
+
+	var set auth.JWKSet
+	if err := json.NewDecoder(rr.Body).Decode(&set); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(set.Keys) != 1 || set.Keys[0].Kid != keys.SigningKeyID() || set.Keys[0].Kty != "OKP" {
+		t.Errorf("Unexpected key set: %+v", set)
+	}
+}
+
+func TestUnlockAccountHandler(t *testing.T) {
+	tests := []struct {
+		name           string
+		query          string
+		mockUnlock     func(token string) error
+		expectedStatus int
+	}{
+		{
+			name:  "unlocked",
+			query: "?token=abc",
+			mockUnlock: func(token string) error {
+				return nil
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "missing token",
+			query:          "",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:  "invalid token",
+			query: "?token=abc",
+			mockUnlock: func(token string) error {
+				return auth.ErrInvalidToken
+			},
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := NewAuthHandler(&MockAuthService{UnlockAccountFunc: tt.mockUnlock}, "development")
+
+			req := httptest.NewRequest(http.MethodGet, "/auth/unlock-account"+tt.query, nil)
+
+			rr := httptest.NewRecorder()
+			handler.UnlockAccount(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+		})
+	}
+}
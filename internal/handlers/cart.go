@@ -3,12 +3,15 @@ package handlers
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
 	"strings"
 
 	"github.com/diorshelton/golden-market-api/internal/middleware"
 	"github.com/diorshelton/golden-market-api/internal/models"
+	"github.com/diorshelton/golden-market-api/internal/promotion"
+	"github.com/diorshelton/golden-market-api/internal/repository"
 	"github.com/google/uuid"
 	"github.com/gorilla/mux"
 )
@@ -18,6 +21,8 @@ type CartServiceInterface interface {
 	GetCart(ctx context.Context, userID uuid.UUID) (*models.CartSummary, error)
 	UpdateCartItemQuantity(ctx context.Context, userID, cartItemID uuid.UUID, quantity int) error
 	RemoveFromCart(ctx context.Context, userID, cartItemID uuid.UUID) error
+	ApplyPromo(ctx context.Context, userID uuid.UUID, code string) (*models.CartSummary, error)
+	RemovePromo(ctx context.Context, userID uuid.UUID) error
 }
 
 type CartHandler struct {
@@ -39,6 +44,10 @@ type UpdateCartItemRequest struct {
 	Quantity int `json:"quantity"`
 }
 
+type ApplyPromoRequest struct {
+	Code string `json:"code"`
+}
+
 func (h *CartHandler) GetCart(w http.ResponseWriter, r *http.Request) {
 	userID, ok := middleware.GetUserID(r)
 	if !ok {
@@ -170,3 +179,62 @@ func (h *CartHandler) RemoveFromCart(w http.ResponseWriter, r *http.Request) {
 		"message": "item removed from cart",
 	})
 }
+
+// ApplyPromo applies a promo code to the cart and returns the repriced cart
+func (h *CartHandler) ApplyPromo(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req ApplyPromoRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if strings.TrimSpace(req.Code) == "" {
+		http.Error(w, "code is required", http.StatusBadRequest)
+		return
+	}
+
+	cart, err := h.cartService.ApplyPromo(r.Context(), userID, req.Code)
+	if err != nil {
+		switch {
+		case errors.Is(err, repository.ErrPromotionNotFound):
+			http.Error(w, err.Error(), http.StatusNotFound)
+		case errors.Is(err, promotion.ErrNotApplicable):
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		default:
+			log.Printf("Failed to apply promo code for user %s: %v", userID, err)
+			http.Error(w, "failed to apply promo code", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(cart)
+}
+
+// RemovePromo takes the promo code off the cart
+func (h *CartHandler) RemovePromo(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if err := h.cartService.RemovePromo(r.Context(), userID); err != nil {
+		log.Printf("Failed to remove promo code for user %s: %v", userID, err)
+		http.Error(w, "failed to remove promo code", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "promo code removed",
+	})
+}
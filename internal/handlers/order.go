@@ -3,22 +3,46 @@ package handlers
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"io"
 	"log"
 	"net/http"
 	"strings"
 
 	"github.com/diorshelton/golden-market-api/internal/middleware"
 	"github.com/diorshelton/golden-market-api/internal/models"
+	"github.com/diorshelton/golden-market-api/internal/order"
+	"github.com/diorshelton/golden-market-api/internal/promotion"
+	"github.com/diorshelton/golden-market-api/internal/repository"
 	"github.com/google/uuid"
 	"github.com/gorilla/mux"
 )
 
 type OrderServiceInterface interface {
-	CreateOrder(ctx context.Context, userID uuid.UUID) (*models.Order, error)
+	CreateOrder(ctx context.Context, userID uuid.UUID, idempotencyKey string, expected models.CheckoutExpectation) (*models.Order, error)
 	GetOrderByID(ctx context.Context, orderID uuid.UUID) (*models.Order, error)
 	GetUserOrders(ctx context.Context, userID uuid.UUID) ([]*models.Order, error)
+	CancelOrder(ctx context.Context, userID, orderID uuid.UUID) (*models.Order, error)
+	RefundOrder(ctx context.Context, adminID, orderID uuid.UUID, items []models.RefundItem, reason string) (*models.Order, error)
 }
 
+type RefundOrderRequest struct {
+	Items  []models.RefundItem `json:"items"` // Empty refunds everything left on the order
+	Reason string              `json:"reason"`
+}
+
+// CheckoutConflictResponse is the 409 body when the cart drifted from what
+// the buyer saw. Total is what the cart costs now.
+type CheckoutConflictResponse struct {
+	Message       string                  `json:"message"`
+	ExpectedTotal *models.Coins           `json:"expected_total,omitempty"`
+	Total         models.Coins            `json:"total"`
+	Changes       []models.CheckoutChange `json:"changes"`
+}
+
+// maxIdempotencyKeyLength matches the order_idempotency_keys column
+const maxIdempotencyKeyLength = 255
+
 type OrderHandler struct {
 	orderService OrderServiceInterface
 }
@@ -37,22 +61,51 @@ func (h *OrderHandler) CreateOrder(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	order, err := h.orderService.CreateOrder(r.Context(), userID)
+	idempotencyKey := strings.TrimSpace(r.Header.Get("Idempotency-Key"))
+	if len(idempotencyKey) > maxIdempotencyKeyLength {
+		http.Error(w, "idempotency key is too long", http.StatusBadRequest)
+		return
+	}
+
+	// The body is optional; older clients send none
+	var expected models.CheckoutExpectation
+	if err := json.NewDecoder(r.Body).Decode(&expected); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	created, err := h.orderService.CreateOrder(r.Context(), userID, idempotencyKey, expected)
 	if err != nil {
 		// Log the full error for debugging
 		log.Printf("CreateOrder error for user %s: %v", userID, err)
 
+		var conflict *order.CheckoutConflictError
+		if errors.As(err, &conflict) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(CheckoutConflictResponse{
+				Message:       "your cart changed; review it and check out again",
+				ExpectedTotal: conflict.ExpectedTotal,
+				Total:         conflict.Total,
+				Changes:       conflict.Changes,
+			})
+			return
+		}
+
 		// Check for specific error types - these are safe to expose
 		errMsg := err.Error()
 		switch {
+		case errors.Is(err, repository.ErrInvalidCartVersion):
+			http.Error(w, errMsg, http.StatusBadRequest)
+		case errors.Is(err, order.ErrIdempotencyKeyReused):
+			http.Error(w, errMsg, http.StatusUnprocessableEntity)
+		case errors.Is(err, promotion.ErrNotApplicable),
+			errors.Is(err, repository.ErrPromotionExhausted):
+			http.Error(w, errMsg, http.StatusConflict)
 		case strings.Contains(errMsg, "cart is empty"):
 			http.Error(w, errMsg, http.StatusBadRequest)
 		case strings.Contains(errMsg, "insufficient coins"):
 			http.Error(w, errMsg, http.StatusPaymentRequired)
-		case strings.Contains(errMsg, "insufficient stock"):
-			http.Error(w, errMsg, http.StatusConflict)
-		case strings.Contains(errMsg, "no longer available"):
-			http.Error(w, errMsg, http.StatusConflict)
 		default:
 			http.Error(w, "failed to create order", http.StatusInternalServerError)
 		}
@@ -61,7 +114,7 @@ func (h *OrderHandler) CreateOrder(w http.ResponseWriter, r *http.Request) {
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(order)
+	json.NewEncoder(w).Encode(created)
 }
 
 // GetOrders handles GET /api/v1/orders
@@ -125,3 +178,80 @@ func (h *OrderHandler) GetOrder(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(order)
 }
+
+// CancelOrder handles POST /api/v1/orders/{id}/cancel
+func (h *OrderHandler) CancelOrder(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	orderID, err := uuid.Parse(vars["id"])
+	if err != nil {
+		http.Error(w, "invalid order ID", http.StatusBadRequest)
+		return
+	}
+
+	order, err := h.orderService.CancelOrder(r.Context(), userID, orderID)
+	if err != nil {
+		writeRefundError(w, "CancelOrder", orderID, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(order)
+}
+
+// RefundOrder handles POST /api/v1/admin/orders/{id}/refund
+func (h *OrderHandler) RefundOrder(w http.ResponseWriter, r *http.Request) {
+	adminID, ok := middleware.GetUserID(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	orderID, err := uuid.Parse(vars["id"])
+	if err != nil {
+		http.Error(w, "invalid order ID", http.StatusBadRequest)
+		return
+	}
+
+	var req RefundOrderRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+	}
+
+	order, err := h.orderService.RefundOrder(r.Context(), adminID, orderID, req.Items, strings.TrimSpace(req.Reason))
+	if err != nil {
+		writeRefundError(w, "RefundOrder", orderID, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(order)
+}
+
+// writeRefundError maps cancellation/refund failures to HTTP responses
+func writeRefundError(w http.ResponseWriter, op string, orderID uuid.UUID, err error) {
+	switch {
+	case errors.Is(err, order.ErrOrderNotFound):
+		http.Error(w, "order not found", http.StatusNotFound)
+	case errors.Is(err, order.ErrCancelWindowExpired),
+		errors.Is(err, order.ErrOrderNotRefundable),
+		errors.Is(err, order.ErrItemsNotInInventory):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, order.ErrInvalidRefundItem):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		log.Printf("%s error for order %s: %v", op, orderID, err)
+		http.Error(w, "failed to refund order", http.StatusInternalServerError)
+	}
+}
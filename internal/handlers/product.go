@@ -6,20 +6,24 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
 
 	"github.com/diorshelton/golden-market-api/internal/models"
+	"github.com/diorshelton/golden-market-api/internal/product"
+	"github.com/diorshelton/golden-market-api/internal/repository"
 	"github.com/google/uuid"
 	"github.com/gorilla/mux"
 )
 
 type ProductServiceInterface interface {
 	Create(*models.Product) error
-	GetProducts() ([]*models.Product, error)
+	GetProducts(filter models.ProductFilter) (*models.ProductPage, error)
+	SearchProducts(q string, filter models.ProductFilter, offset int) (*models.ProductSearchPage, error)
 	GetProduct(id uuid.UUID) (*models.Product, error)
-	Update(id uuid.UUID)
-	Delete(id uuid.UUID)
+	Update(id uuid.UUID, edit func(*models.Product) error) (*models.Product, error)
+	Delete(id uuid.UUID) error
 }
 
 type ProductHandler struct {
@@ -68,7 +72,75 @@ func (r *ProductRequest) Validate() error {
 	return nil
 }
 
-type ProductResponse struct {
+// ProductPatchRequest is a partial update: only the fields present in the
+// JSON body are changed
+type ProductPatchRequest struct {
+	Name        *string `json:"product_name"`
+	Description *string `json:"product_description"`
+	Price       *string `json:"price"`
+	Stock       *string `json:"stock"`
+	ImageURL    *string `json:"image_url"`
+	Category    *string `json:"category"`
+	IsAvailable *bool   `json:"is_available"`
+}
+
+// productRequestFrom renders an existing product in request form, so a
+// patch can be layered on top and validated like a full request
+func productRequestFrom(p *models.Product) ProductRequest {
+	return ProductRequest{
+		Name:        p.Name,
+		Description: p.Description,
+		Price:       strconv.FormatInt(int64(p.Price), 10),
+		Stock:       strconv.Itoa(p.Stock),
+		ImageURL:    p.ImageURL,
+		Category:    p.Category,
+	}
+}
+
+// apply overlays the fields present in the patch onto req
+func (p *ProductPatchRequest) apply(req *ProductRequest) {
+	if p.Name != nil {
+		req.Name = *p.Name
+	}
+	if p.Description != nil {
+		req.Description = *p.Description
+	}
+	if p.Price != nil {
+		req.Price = *p.Price
+	}
+	if p.Stock != nil {
+		req.Stock = *p.Stock
+	}
+	if p.ImageURL != nil {
+		req.ImageURL = *p.ImageURL
+	}
+	if p.Category != nil {
+		req.Category = *p.Category
+	}
+}
+
+// applyTo copies a validated request onto product
+func (r *ProductRequest) applyTo(product *models.Product) error {
+	price, err := strconv.ParseInt(r.Price, 10, 64)
+	if err != nil {
+		return errors.New("invalid price format")
+	}
+
+	stock := 0
+	if r.Stock != "" {
+		stock, err = strconv.Atoi(r.Stock)
+		if err != nil {
+			return errors.New("invalid stock format")
+		}
+	}
+
+	product.Name = r.Name
+	product.Description = r.Description
+	product.Price = models.Coins(price)
+	product.Stock = stock
+	product.ImageURL = r.ImageURL
+	product.Category = r.Category
+	return nil
 }
 
 func (h *ProductHandler) Create(w http.ResponseWriter, r *http.Request) {
@@ -84,34 +156,14 @@ func (h *ProductHandler) Create(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	priceInt, err := strconv.ParseInt(req.Price, 10, 64)
-	if err != nil {
-		http.Error(w, "Invalid price format", http.StatusBadRequest)
+	product := &models.Product{IsAvailable: true}
+	if err := req.applyTo(product); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	stockInt := 0
-	if req.Stock != "" {
-		stockInt, err = strconv.Atoi(req.Stock)
-		if err != nil {
-			http.Error(w, "Error parsing stock string", http.StatusBadRequest)
-			return
-		}
-	}
-
-	product := &models.Product{
-		Name:        req.Name,
-		Description: req.Description,
-		Price:       models.Coins(priceInt),
-		Stock:       stockInt,
-		ImageURL:    req.ImageURL,
-		Category:    req.Category,
-		IsAvailable: true,
-	}
-
 	// Call Product Service
-	err = h.productService.Create(product)
-	if err != nil {
+	if err := h.productService.Create(product); err != nil {
 		log.Printf("Error creating product: %v", err)
 		http.Error(w, "failed to create product", http.StatusInternalServerError)
 		return
@@ -122,9 +174,22 @@ func (h *ProductHandler) Create(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(product)
 }
 
+// GetProducts handles GET /api/v1/products. Supported query params:
+// category, min_price, max_price, in_stock, sort (name, price, newest,
+// last_restock), order (asc, desc), limit and cursor.
 func (h *ProductHandler) GetProducts(w http.ResponseWriter, r *http.Request) {
-	products, err := h.productService.GetProducts()
+	filter, err := parseProductFilter(r.URL.Query())
 	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	page, err := h.productService.GetProducts(filter)
+	if err != nil {
+		if errors.Is(err, repository.ErrInvalidCursor) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 		log.Printf("Error retrieving products: %v", err)
 		http.Error(w, "failed to retrieve products", http.StatusInternalServerError)
 		return
@@ -132,7 +197,120 @@ func (h *ProductHandler) GetProducts(w http.ResponseWriter, r *http.Request) {
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(products)
+	json.NewEncoder(w).Encode(page)
+}
+
+// SearchProducts handles GET /api/v1/products/search?q=. It takes the same
+// filters as GetProducts, plus offset; results are ordered by relevance,
+// so sort, order and cursor are refused rather than ignored.
+func (h *ProductHandler) SearchProducts(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	q := strings.TrimSpace(query.Get("q"))
+	if q == "" {
+		http.Error(w, "search query is required", http.StatusBadRequest)
+		return
+	}
+
+	for _, param := range []string{"sort", "order", "cursor"} {
+		if query.Has(param) {
+			http.Error(w, param+" is not supported by search", http.StatusBadRequest)
+			return
+		}
+	}
+
+	filter, err := parseProductFilter(query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	offset := 0
+	if raw := query.Get("offset"); raw != "" {
+		v, err := strconv.Atoi(raw)
+		if err != nil || v < 0 {
+			http.Error(w, "invalid offset", http.StatusBadRequest)
+			return
+		}
+		offset = v
+	}
+
+	page, err := h.productService.SearchProducts(q, filter, offset)
+	if err != nil {
+		if errors.Is(err, repository.ErrEmptySearchQuery) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		log.Printf("Error searching products: %v", err)
+		http.Error(w, "failed to search products", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(page)
+}
+
+// parseProductFilter reads the catalog query params. Newest and
+// last_restock default to descending; name and price to ascending.
+func parseProductFilter(query url.Values) (models.ProductFilter, error) {
+	filter := models.ProductFilter{
+		Category: strings.TrimSpace(query.Get("category")),
+		Sort:     models.ProductSort(query.Get("sort")),
+		Cursor:   query.Get("cursor"),
+	}
+
+	intParams := []struct {
+		name string
+		dest *int
+	}{
+		{"min_price", &filter.MinPrice},
+		{"max_price", &filter.MaxPrice},
+		{"limit", &filter.Limit},
+	}
+	for _, p := range intParams {
+		raw := query.Get(p.name)
+		if raw == "" {
+			continue
+		}
+		v, err := strconv.Atoi(raw)
+		if err != nil || v < 0 {
+			return filter, fmt.Errorf("invalid %s", p.name)
+		}
+		*p.dest = v
+	}
+
+	if filter.MinPrice > 0 && filter.MaxPrice > 0 && filter.MinPrice > filter.MaxPrice {
+		return filter, errors.New("min_price cannot be greater than max_price")
+	}
+
+	if raw := query.Get("in_stock"); raw != "" {
+		v, err := strconv.ParseBool(raw)
+		if err != nil {
+			return filter, errors.New("invalid in_stock")
+		}
+		filter.InStockOnly = v
+	}
+
+	if filter.Sort == "" {
+		filter.Sort = models.ProductSortName
+	}
+	if !filter.Sort.Valid() {
+		return filter, errors.New("invalid sort")
+	}
+
+	switch query.Get("order") {
+	case "":
+		filter.Descending = filter.Sort == models.ProductSortNewest || filter.Sort == models.ProductSortLastRestock
+	case "asc":
+		filter.Descending = false
+	case "desc":
+		filter.Descending = true
+	default:
+		return filter, errors.New("invalid order")
+	}
+
+	return filter, nil
 }
 
 func (h *ProductHandler) GetProduct(w http.ResponseWriter, r *http.Request) {
@@ -152,18 +330,96 @@ func (h *ProductHandler) GetProduct(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(product)
 }
 
+// Update handles PUT and PATCH /api/v1/products/{id}. PUT replaces every
+// editable field; PATCH changes only the fields sent. Either way the result
+// must pass ProductRequest.Validate.
 func (h *ProductHandler) Update(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusNotImplemented)
-	json.NewEncoder(w).Encode(map[string]string{
-		"message": "Update endpoint not yet implemented",
+	vars := mux.Vars(r)
+	id, err := uuid.Parse(vars["id"])
+	if err != nil {
+		http.Error(w, "invalid product ID", http.StatusBadRequest)
+		return
+	}
+
+	var put ProductRequest
+	var patch ProductPatchRequest
+	if r.Method == http.MethodPatch {
+		err = json.NewDecoder(r.Body).Decode(&patch)
+	} else {
+		err = json.NewDecoder(r.Body).Decode(&put)
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid JSON format: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	// PUT replaces the stock too, so leaving it out mustn't zero it
+	if r.Method != http.MethodPatch && put.Stock == "" {
+		http.Error(w, "stock is required", http.StatusBadRequest)
+		return
+	}
+
+	// The edit runs against the locked row, so a patch that leaves stock
+	// alone keeps whatever stock is current
+	updated, err := h.productService.Update(id, func(p *models.Product) error {
+		req := put
+		if r.Method == http.MethodPatch {
+			req = productRequestFrom(p)
+			patch.apply(&req)
+			if patch.IsAvailable != nil {
+				p.IsAvailable = *patch.IsAvailable
+			}
+		}
+
+		if err := req.Validate(); err != nil {
+			return fmt.Errorf("%w: %v", product.ErrInvalidProduct, err)
+		}
+		if err := req.applyTo(p); err != nil {
+			return fmt.Errorf("%w: %v", product.ErrInvalidProduct, err)
+		}
+		return nil
 	})
+	if err != nil {
+		switch {
+		case errors.Is(err, product.ErrInvalidProduct):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		case errors.Is(err, repository.ErrProductNotFound):
+			http.Error(w, "product not found", http.StatusNotFound)
+		default:
+			log.Printf("Error updating product %s: %v", id, err)
+			http.Error(w, "failed to update product", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(updated)
 }
 
+// Delete handles DELETE /api/v1/products/{id}. Products are soft deleted so
+// past orders and inventory keep pointing at a real row.
 func (h *ProductHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := uuid.Parse(vars["id"])
+	if err != nil {
+		http.Error(w, "invalid product ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.productService.Delete(id); err != nil {
+		if errors.Is(err, repository.ErrProductNotFound) {
+			http.Error(w, "product not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("Error deleting product %s: %v", id, err)
+		http.Error(w, "failed to delete product", http.StatusInternalServerError)
+		return
+	}
+
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusNotImplemented)
+	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]string{
-		"message": "Delete endpoint not yet implemented",
+		"message": "product deleted",
 	})
 }
@@ -9,23 +9,30 @@ import (
 	"testing"
 
 	"github.com/diorshelton/golden-market-api/internal/models"
+	"github.com/diorshelton/golden-market-api/internal/repository"
 	"github.com/google/uuid"
+	"github.com/gorilla/mux"
 )
 
 type MockProductService struct {
-	CreateFunc      func(*models.Product) error
-	GetProductsFunc func() ([]*models.Product, error)
-	GetProductFunc  func(id uuid.UUID) ([]*models.Product, error)
-	UpdateFunc      func(id uuid.UUID)
-	DeleteFunc      func(id uuid.UUID) error
+	CreateFunc         func(*models.Product) error
+	GetProductsFunc    func(filter models.ProductFilter) (*models.ProductPage, error)
+	SearchProductsFunc func(q string, filter models.ProductFilter, offset int) (*models.ProductSearchPage, error)
+	GetProductFunc     func(id uuid.UUID) ([]*models.Product, error)
+	UpdateFunc         func(id uuid.UUID, edit func(*models.Product) error) (*models.Product, error)
+	DeleteFunc         func(id uuid.UUID) error
 }
 
 func (m *MockProductService) Create(product *models.Product) error {
 	return m.CreateFunc(product)
 }
 
-func (m *MockProductService) GetProducts() ([]*models.Product, error) {
-	return m.GetProductsFunc()
+func (m *MockProductService) GetProducts(filter models.ProductFilter) (*models.ProductPage, error) {
+	return m.GetProductsFunc(filter)
+}
+
+func (m *MockProductService) SearchProducts(q string, filter models.ProductFilter, offset int) (*models.ProductSearchPage, error) {
+	return m.SearchProductsFunc(q, filter, offset)
 }
 
 func (m *MockProductService) GetProduct(id uuid.UUID) (*models.Product, error) {
@@ -35,16 +42,12 @@ func (m *MockProductService) GetProduct(id uuid.UUID) (*models.Product, error) {
 	return nil, nil
 }
 
-func (m *MockProductService) Update(id uuid.UUID) {
-	if m.UpdateFunc != nil {
-		m.UpdateFunc(id)
-	}
+func (m *MockProductService) Update(id uuid.UUID, edit func(*models.Product) error) (*models.Product, error) {
+	return m.UpdateFunc(id, edit)
 }
 
-func (m *MockProductService) Delete(id uuid.UUID) {
-	if m.DeleteFunc != nil {
-		m.DeleteFunc(id)
-	}
+func (m *MockProductService) Delete(id uuid.UUID) error {
+	return m.DeleteFunc(id)
 }
 
 func TestCreateHandler(t *testing.T) {
@@ -135,3 +138,350 @@ func TestCreateHandler(t *testing.T) {
 		})
 	}
 }
+
+func TestUpdateHandler(t *testing.T) {
+	existing := func() *models.Product {
+		return &models.Product{
+			ID:          uuid.New(),
+			Name:        "coffee mug",
+			Description: "artesenal ceramic mug made by hand",
+			Price:       45,
+			Stock:       12,
+			Category:    "Misc. Items",
+			IsAvailable: true,
+		}
+	}
+
+	tests := []struct {
+		name           string
+		method         string
+		requestBody    string
+		mockGet        func(id uuid.UUID) (*models.Product, error)
+		expectedStatus int
+		checkProduct   func(t *testing.T, p *models.Product)
+	}{
+		{
+			name:        "patch changes only sent fields",
+			method:      http.MethodPatch,
+			requestBody: `{"price": "60"}`,
+			mockGet: func(id uuid.UUID) (*models.Product, error) {
+				return existing(), nil
+			},
+			expectedStatus: http.StatusOK,
+			checkProduct: func(t *testing.T, p *models.Product) {
+				if p.Price != 60 {
+					t.Errorf("Expected price 60, got %d", p.Price)
+				}
+				if p.Name != "coffee mug" || p.Stock != 12 {
+					t.Errorf("Expected untouched fields to be kept, got %+v", p)
+				}
+			},
+		},
+		{
+			name:        "patch can unlist a product",
+			method:      http.MethodPatch,
+			requestBody: `{"is_available": false}`,
+			mockGet: func(id uuid.UUID) (*models.Product, error) {
+				return existing(), nil
+			},
+			expectedStatus: http.StatusOK,
+			checkProduct: func(t *testing.T, p *models.Product) {
+				if p.IsAvailable {
+					t.Error("Expected product to be unlisted")
+				}
+			},
+		},
+		{
+			name:        "patch result must still validate",
+			method:      http.MethodPatch,
+			requestBody: `{"price": "-5"}`,
+			mockGet: func(id uuid.UUID) (*models.Product, error) {
+				return existing(), nil
+			},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:        "put requires a full payload",
+			method:      http.MethodPut,
+			requestBody: `{"stock": "3"}`,
+			mockGet: func(id uuid.UUID) (*models.Product, error) {
+				return existing(), nil
+			},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:        "put without stock",
+			method:      http.MethodPut,
+			requestBody: `{"product_name": "coffee mug", "price": "45"}`,
+			mockGet: func(id uuid.UUID) (*models.Product, error) {
+				return existing(), nil
+			},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:        "put replaces every field",
+			method:      http.MethodPut,
+			requestBody: `{"product_name": "tea mug", "price": "50", "stock": "4"}`,
+			mockGet: func(id uuid.UUID) (*models.Product, error) {
+				return existing(), nil
+			},
+			expectedStatus: http.StatusOK,
+			checkProduct: func(t *testing.T, p *models.Product) {
+				if p.Name != "tea mug" || p.Price != 50 || p.Stock != 4 || p.Category != "" {
+					t.Errorf("Expected every field replaced, got %+v", p)
+				}
+			},
+		},
+		{
+			name:        "unknown product",
+			method:      http.MethodPatch,
+			requestBody: `{"price": "60"}`,
+			mockGet: func(id uuid.UUID) (*models.Product, error) {
+				return nil, repository.ErrProductNotFound
+			},
+			expectedStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var saved *models.Product
+			mockService := &MockProductService{
+				UpdateFunc: func(id uuid.UUID, edit func(*models.Product) error) (*models.Product, error) {
+					p, err := tt.mockGet(id)
+					if err != nil {
+						return nil, err
+					}
+					if err := edit(p); err != nil {
+						return nil, err
+					}
+					saved = p
+					return p, nil
+				},
+			}
+			handler := NewProductHandler(mockService)
+
+			id := uuid.New()
+			req := httptest.NewRequest(tt.method, "/api/v1/products/"+id.String(), bytes.NewBufferString(tt.requestBody))
+			req = mux.SetURLVars(req, map[string]string{"id": id.String()})
+			rr := httptest.NewRecorder()
+			handler.Update(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+
+			if tt.checkProduct != nil {
+				if saved == nil {
+					t.Fatal("Expected product to be saved")
+				}
+				tt.checkProduct(t, saved)
+			}
+		})
+	}
+}
+
+func TestDeleteHandler(t *testing.T) {
+	tests := []struct {
+		name           string
+		mockDelete     func(id uuid.UUID) error
+		expectedStatus int
+	}{
+		{
+			name:           "successful soft delete",
+			mockDelete:     func(id uuid.UUID) error { return nil },
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "already deleted",
+			mockDelete:     func(id uuid.UUID) error { return repository.ErrProductNotFound },
+			expectedStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := NewProductHandler(&MockProductService{DeleteFunc: tt.mockDelete})
+
+			id := uuid.New()
+			req := httptest.NewRequest(http.MethodDelete, "/api/v1/products/"+id.String(), nil)
+			req = mux.SetURLVars(req, map[string]string{"id": id.String()})
+			rr := httptest.NewRecorder()
+			handler.Delete(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+		})
+	}
+}
+
+func TestGetProductsHandler(t *testing.T) {
+	tests := []struct {
+		name           string
+		query          string
+		mockErr        error
+		expectedStatus int
+		expectedFilter models.ProductFilter
+	}{
+		{
+			name:           "defaults",
+			query:          "",
+			expectedStatus: http.StatusOK,
+			expectedFilter: models.ProductFilter{Sort: models.ProductSortName},
+		},
+		{
+			name:           "all filters",
+			query:          "?category=tools&min_price=100&max_price=500&in_stock=true&sort=price&order=desc&limit=10&cursor=abc",
+			expectedStatus: http.StatusOK,
+			expectedFilter: models.ProductFilter{
+				Category:    "tools",
+				MinPrice:    100,
+				MaxPrice:    500,
+				InStockOnly: true,
+				Sort:        models.ProductSortPrice,
+				Descending:  true,
+				Cursor:      "abc",
+				Limit:       10,
+			},
+		},
+		{
+			name:           "newest defaults to descending",
+			query:          "?sort=newest",
+			expectedStatus: http.StatusOK,
+			expectedFilter: models.ProductFilter{Sort: models.ProductSortNewest, Descending: true},
+		},
+		{
+			name:           "unknown sort",
+			query:          "?sort=popularity",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "negative limit",
+			query:          "?limit=-1",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "inverted price range",
+			query:          "?min_price=500&max_price=100",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "bad cursor",
+			query:          "?cursor=garbage",
+			mockErr:        repository.ErrInvalidCursor,
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got models.ProductFilter
+			mockService := &MockProductService{
+				GetProductsFunc: func(filter models.ProductFilter) (*models.ProductPage, error) {
+					got = filter
+					if tt.mockErr != nil {
+						return nil, tt.mockErr
+					}
+					return &models.ProductPage{Products: []*models.Product{}}, nil
+				},
+			}
+			handler := NewProductHandler(mockService)
+
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/products"+tt.query, nil)
+			rr := httptest.NewRecorder()
+			handler.GetProducts(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+			if tt.expectedStatus == http.StatusOK && got != tt.expectedFilter {
+				t.Errorf("Expected filter %+v, got %+v", tt.expectedFilter, got)
+			}
+		})
+	}
+}
+
+func TestSearchProductsHandler(t *testing.T) {
+	tests := []struct {
+		name           string
+		query          string
+		mockErr        error
+		expectedStatus int
+		expectedQuery  string
+		expectedOffset int
+	}{
+		{
+			name:           "search with filters",
+			query:          "?q=+elixir+&category=potions&offset=20",
+			expectedStatus: http.StatusOK,
+			expectedQuery:  "elixir",
+			expectedOffset: 20,
+		},
+		{
+			name:           "missing query",
+			query:          "?category=potions",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "invalid offset",
+			query:          "?q=elixir&offset=abc",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "sort is not supported",
+			query:          "?q=elixir&sort=price",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "order is not supported",
+			query:          "?q=elixir&order=desc",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "cursor is not supported",
+			query:          "?q=elixir&cursor=abc",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "nothing searchable",
+			query:          "?q=%21%21",
+			mockErr:        repository.ErrEmptySearchQuery,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "service error",
+			query:          "?q=elixir",
+			mockErr:        errors.New("db down"),
+			expectedStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotQuery string
+			var gotOffset int
+			mockService := &MockProductService{
+				SearchProductsFunc: func(q string, filter models.ProductFilter, offset int) (*models.ProductSearchPage, error) {
+					gotQuery, gotOffset = q, offset
+					if tt.mockErr != nil {
+						return nil, tt.mockErr
+					}
+					return &models.ProductSearchPage{Results: []models.ProductSearchResult{}}, nil
+				},
+			}
+			handler := NewProductHandler(mockService)
+
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/products/search"+tt.query, nil)
+			rr := httptest.NewRecorder()
+			handler.SearchProducts(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+			if tt.expectedStatus == http.StatusOK && (gotQuery != tt.expectedQuery || gotOffset != tt.expectedOffset) {
+				t.Errorf("Expected q=%q offset=%d, got q=%q offset=%d", tt.expectedQuery, tt.expectedOffset, gotQuery, gotOffset)
+			}
+		})
+	}
+}
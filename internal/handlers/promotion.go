@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/diorshelton/golden-market-api/internal/models"
+	"github.com/diorshelton/golden-market-api/internal/promotion"
+	"github.com/diorshelton/golden-market-api/internal/repository"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+type PromotionServiceInterface interface {
+	CreatePromotion(ctx context.Context, p *models.Promotion) error
+	ListPromotions(ctx context.Context) ([]*models.Promotion, error)
+	SetPromotionActive(ctx context.Context, id uuid.UUID, active bool) (*models.Promotion, error)
+}
+
+type PromotionHandler struct {
+	promotionService PromotionServiceInterface
+}
+
+func NewPromotionHandler(service PromotionServiceInterface) *PromotionHandler {
+	return &PromotionHandler{
+		promotionService: service,
+	}
+}
+
+type CreatePromotionRequest struct {
+	Code                  string              `json:"code"`
+	Description           string              `json:"description"`
+	DiscountType          models.DiscountType `json:"discount_type"`
+	DiscountValue         int                 `json:"discount_value"`
+	MinCartTotal          models.Coins        `json:"min_cart_total"`
+	Category              *string             `json:"category"`
+	ProductID             *uuid.UUID          `json:"product_id"`
+	MaxRedemptions        int                 `json:"max_redemptions"`
+	MaxRedemptionsPerUser int                 `json:"max_redemptions_per_user"`
+	StartsAt              *time.Time          `json:"starts_at"`
+	EndsAt                *time.Time          `json:"ends_at"`
+	IsActive              *bool               `json:"is_active"` // Defaults to true
+}
+
+type SetPromotionActiveRequest struct {
+	IsActive *bool `json:"is_active"`
+}
+
+// Create handles POST /api/v1/admin/promotions
+func (h *PromotionHandler) Create(w http.ResponseWriter, r *http.Request) {
+	var req CreatePromotionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	p := &models.Promotion{
+		Code:                  req.Code,
+		Description:           req.Description,
+		DiscountType:          req.DiscountType,
+		DiscountValue:         req.DiscountValue,
+		MinCartTotal:          req.MinCartTotal,
+		Category:              req.Category,
+		ProductID:             req.ProductID,
+		MaxRedemptions:        req.MaxRedemptions,
+		MaxRedemptionsPerUser: req.MaxRedemptionsPerUser,
+		StartsAt:              req.StartsAt,
+		EndsAt:                req.EndsAt,
+		IsActive:              req.IsActive == nil || *req.IsActive,
+	}
+
+	if err := h.promotionService.CreatePromotion(r.Context(), p); err != nil {
+		switch {
+		case errors.Is(err, promotion.ErrInvalidPromotion):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		case errors.Is(err, repository.ErrPromotionCodeTaken):
+			http.Error(w, err.Error(), http.StatusConflict)
+		default:
+			log.Printf("Failed to create promotion %q: %v", p.Code, err)
+			http.Error(w, "failed to create promotion", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(p)
+}
+
+// List handles GET /api/v1/admin/promotions
+func (h *PromotionHandler) List(w http.ResponseWriter, r *http.Request) {
+	promotions, err := h.promotionService.ListPromotions(r.Context())
+	if err != nil {
+		log.Printf("Failed to list promotions: %v", err)
+		http.Error(w, "failed to list promotions", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(promotions)
+}
+
+// SetActive handles PATCH /api/v1/admin/promotions/{id}
+func (h *PromotionHandler) SetActive(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "invalid promotion ID", http.StatusBadRequest)
+		return
+	}
+
+	var req SetPromotionActiveRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.IsActive == nil {
+		http.Error(w, "is_active is required", http.StatusBadRequest)
+		return
+	}
+
+	p, err := h.promotionService.SetPromotionActive(r.Context(), id, *req.IsActive)
+	if err != nil {
+		if errors.Is(err, repository.ErrPromotionNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		log.Printf("Failed to update promotion %s: %v", id, err)
+		http.Error(w, "failed to update promotion", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(p)
+}
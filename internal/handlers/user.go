@@ -2,22 +2,53 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
+	"math"
 	"net/http"
+	"net/mail"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
 
+	"github.com/diorshelton/golden-market-api/internal/auth"
 	"github.com/diorshelton/golden-market-api/internal/middleware"
+	"github.com/diorshelton/golden-market-api/internal/models"
 	"github.com/diorshelton/golden-market-api/internal/repository"
+	"github.com/google/uuid"
 )
 
+// AccountServiceInterface is the self-service part of the auth service
+type AccountServiceInterface interface {
+	UpdateProfile(userID uuid.UUID, firstName, lastName *string) (*models.User, error)
+	ChangePassword(userID, currentSessionID uuid.UUID, currentPassword, newPassword string) error
+	RequestEmailChange(userID uuid.UUID, newEmail, password string) error
+	ConfirmEmailChange(token string) error
+	DeleteAccount(userID uuid.UUID, password string) (time.Time, error)
+}
+
 // UserHandler contains HTTP handlers for user-related endpoints
 type UserHandler struct {
-	userRepo *repository.UserRepository
+	userRepo         *repository.UserRepository
+	accountService   AccountServiceInterface
+	orderService     OrderServiceInterface
+	inventoryService InventoryServiceInterface
 }
 
 // NewUserHandler creates a new user handler
-func NewUserHandler(userRepo *repository.UserRepository) *UserHandler {
+func NewUserHandler(
+	userRepo *repository.UserRepository,
+	accountService AccountServiceInterface,
+	orderService OrderServiceInterface,
+	inventoryService InventoryServiceInterface,
+) *UserHandler {
 	return &UserHandler{
-		userRepo: userRepo,
+		userRepo:         userRepo,
+		accountService:   accountService,
+		orderService:     orderService,
+		inventoryService: inventoryService,
 	}
 }
 
@@ -51,7 +82,12 @@ func (h *UserHandler) Profile(w http.ResponseWriter, r *http.Request) {
 	}
 	//TODO:Add inventory to user profile
 	// Return user profile data
-	response := UserResponse{
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(newUserResponse(user))
+}
+
+func newUserResponse(user *models.User) UserResponse {
+	return UserResponse{
 		ID:        user.ID.String(),
 		Username:  user.Username,
 		FirstName: user.FirstName,
@@ -60,7 +96,321 @@ func (h *UserHandler) Profile(w http.ResponseWriter, r *http.Request) {
 		Balance:   int64(user.Balance),
 		CreatedAt: user.CreatedAt.Format("2006-01-02T15:04:05Z"),
 	}
+}
+
+// maxNameLength matches the first_name and last_name columns
+const maxNameLength = 255
+
+// UpdateProfileRequest changes the names sent; omitted fields stay as they are
+type UpdateProfileRequest struct {
+	FirstName *string `json:"first_name"`
+	LastName  *string `json:"last_name"`
+}
+
+func (r *UpdateProfileRequest) Validate() error {
+	if r.FirstName == nil && r.LastName == nil {
+		return errors.New("first_name or last_name required")
+	}
+
+	for _, name := range []*string{r.FirstName, r.LastName} {
+		if name == nil {
+			continue
+		}
+		*name = strings.TrimSpace(*name)
+		if *name == "" {
+			return errors.New("names can't be empty")
+		}
+		if utf8.RuneCountInString(*name) > maxNameLength {
+			return fmt.Errorf("names must be at most %d characters", maxNameLength)
+		}
+	}
+
+	return nil
+}
+
+// UpdateProfile changes the authenticated user's names
+func (h *UserHandler) UpdateProfile(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req UpdateProfileRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON format", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	if err := req.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	user, err := h.accountService.UpdateProfile(userID, req.FirstName, req.LastName)
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		log.Printf("Profile update error for user %s: %v", userID, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(newUserResponse(user))
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword    string `json:"current_password"`
+	NewPassword        string `json:"new_password"`
+	NewPasswordConfirm string `json:"new_password_confirm"`
+}
+
+func (r *ChangePasswordRequest) Validate() error {
+	r.NewPassword = strings.TrimSpace(r.NewPassword)
+	r.NewPasswordConfirm = strings.TrimSpace(r.NewPasswordConfirm)
+
+	if r.CurrentPassword == "" || r.NewPassword == "" {
+		return errors.New("current_password and new_password required")
+	}
+
+	if n := utf8.RuneCountInString(r.NewPassword); n < 8 || n > 64 {
+		return errors.New("password must be between 8 and 64 characters")
+	}
+
+	if r.NewPassword != r.NewPasswordConfirm {
+		return errors.New("passwords must match")
+	}
+
+	return nil
+}
+
+// ChangePassword sets a new password given the current one. Every other
+// session is signed out.
+func (h *UserHandler) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req ChangePasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON format", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	if err := req.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	currentSessionID, _ := middleware.GetSessionID(r)
+	if err := h.accountService.ChangePassword(userID, currentSessionID, strings.TrimSpace(req.CurrentPassword), req.NewPassword); err != nil {
+		writeAccountError(w, err, userID, "Password change")
+		return
+	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Password changed; other sessions were signed out"})
+}
+
+type ChangeEmailRequest struct {
+	NewEmail string `json:"new_email"`
+	Password string `json:"password"`
+}
+
+func (r *ChangeEmailRequest) Validate() error {
+	r.NewEmail = strings.TrimSpace(r.NewEmail)
+
+	if r.NewEmail == "" || r.Password == "" {
+		return errors.New("new_email and password required")
+	}
+
+	if _, err := mail.ParseAddress(r.NewEmail); err != nil {
+		return errors.New("invalid email address")
+	}
+
+	return nil
+}
+
+// ChangeEmail starts an email change. The new address only takes effect
+// once the link mailed to it is opened.
+func (h *UserHandler) ChangeEmail(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req ChangeEmailRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON format", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	if err := req.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.accountService.RequestEmailChange(userID, req.NewEmail, strings.TrimSpace(req.Password)); err != nil {
+		writeAccountError(w, err, userID, "Email change")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Check your new email for a confirmation link"})
+}
+
+// ConfirmEmailChange switches to the new email from the token in the
+// confirmation email
+func (h *UserHandler) ConfirmEmailChange(w http.ResponseWriter, r *http.Request) {
+	token := strings.TrimSpace(r.URL.Query().Get("token"))
+	if token == "" {
+		http.Error(w, "Confirmation token required", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.accountService.ConfirmEmailChange(token); err != nil {
+		switch {
+		case errors.Is(err, auth.ErrInvalidToken):
+			http.Error(w, "Invalid or expired confirmation token", http.StatusBadRequest)
+		case errors.Is(err, auth.ErrEmailInUse):
+			http.Error(w, "Email already in use", http.StatusConflict)
+		default:
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			log.Printf("Email change confirmation error: %v", err)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Email changed"})
+}
+
+type DeleteAccountRequest struct {
+	Password string `json:"password"`
+}
+
+type DeleteAccountResponse struct {
+	Message             string    `json:"message"`
+	DeletionScheduledAt time.Time `json:"deletion_scheduled_at"`
+}
+
+// DeleteAccount schedules the account for deletion and signs it out
+// everywhere. Logging in again during the grace period keeps the account.
+func (h *UserHandler) DeleteAccount(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req DeleteAccountRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON format", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	password := strings.TrimSpace(req.Password)
+	if password == "" {
+		http.Error(w, "password required", http.StatusBadRequest)
+		return
+	}
+
+	deleteAt, err := h.accountService.DeleteAccount(userID, password)
+	if err != nil {
+		writeAccountError(w, err, userID, "Account deletion")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(DeleteAccountResponse{
+		Message:             "Account scheduled for deletion; log in again before then to keep it",
+		DeletionScheduledAt: deleteAt,
+	})
+}
+
+// AccountExport is everything the API stores about a user's account
+type AccountExport struct {
+	ExportedAt time.Time                    `json:"exported_at"`
+	Profile    *models.User                 `json:"profile"`
+	Orders     []*models.Order              `json:"orders"`
+	Inventory  []models.InventoryItemDetail `json:"inventory"`
+}
+
+// Export returns the user's profile, orders and inventory as a JSON
+// download
+func (h *UserHandler) Export(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	profile, err := h.userRepo.GetUserProfile(userID)
+	if err != nil {
+		log.Printf("Error fetching user profile: %v", err)
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	orders, err := h.orderService.GetUserOrders(r.Context(), userID)
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		log.Printf("Export orders error for user %s: %v", userID, err)
+		return
+	}
+
+	inventory, err := h.inventoryService.GetUserInventory(r.Context(), userID)
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		log.Printf("Export inventory error for user %s: %v", userID, err)
+		return
+	}
+
+	export := AccountExport{
+		ExportedAt: time.Now().UTC(),
+		Profile:    profile,
+		Orders:     orders,
+		Inventory:  inventory,
+	}
+	if export.Orders == nil {
+		export.Orders = []*models.Order{}
+	}
+	if export.Inventory == nil {
+		export.Inventory = []models.InventoryItemDetail{}
+	}
+
+	filename := fmt.Sprintf("golden-market-export-%s.json", export.ExportedAt.Format("2006-01-02"))
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+	json.NewEncoder(w).Encode(export)
+}
+
+// writeAccountError maps the errors shared by the password-confirmed
+// account changes to responses
+func writeAccountError(w http.ResponseWriter, err error, userID uuid.UUID, action string) {
+	var throttleErr *auth.LoginThrottledError
+	switch {
+	case errors.As(err, &throttleErr):
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(throttleErr.RetryAfter.Seconds()))))
+		http.Error(w, "Too many failed password attempts, try again later", http.StatusTooManyRequests)
+	case errors.Is(err, auth.ErrInvalidCredentials):
+		http.Error(w, "Password is incorrect", http.StatusForbidden)
+	case errors.Is(err, auth.ErrAccountGuest):
+		http.Error(w, "Guest accounts must register first", http.StatusForbidden)
+	case errors.Is(err, auth.ErrSameEmail):
+		http.Error(w, "That is already your email", http.StatusBadRequest)
+	case errors.Is(err, auth.ErrEmailInUse):
+		http.Error(w, "Email already in use", http.StatusConflict)
+	default:
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		log.Printf("%s error for user %s: %v", action, userID, err)
+	}
 }
@@ -0,0 +1,326 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/diorshelton/golden-market-api/internal/auth"
+	"github.com/diorshelton/golden-market-api/internal/middleware"
+	"github.com/diorshelton/golden-market-api/internal/models"
+	"github.com/google/uuid"
+)
+
+// Mock account service for testing
+type MockAccountService struct {
+	UpdateProfileFunc      func(userID uuid.UUID, firstName, lastName *string) (*models.User, error)
+	ChangePasswordFunc     func(userID, currentSessionID uuid.UUID, currentPassword, newPassword string) error
+	RequestEmailChangeFunc func(userID uuid.UUID, newEmail, password string) error
+	ConfirmEmailChangeFunc func(token string) error
+	DeleteAccountFunc      func(userID uuid.UUID, password string) (time.Time, error)
+}
+
+func (m *MockAccountService) UpdateProfile(userID uuid.UUID, firstName, lastName *string) (*models.User, error) {
+	if m.UpdateProfileFunc != nil {
+		return m.UpdateProfileFunc(userID, firstName, lastName)
+	}
+	return &models.User{ID: userID}, nil
+}
+
+func (m *MockAccountService) ChangePassword(userID, currentSessionID uuid.UUID, currentPassword, newPassword string) error {
+	if m.ChangePasswordFunc != nil {
+		return m.ChangePasswordFunc(userID, currentSessionID, currentPassword, newPassword)
+	}
+	return nil
+}
+
+func (m *MockAccountService) RequestEmailChange(userID uuid.UUID, newEmail, password string) error {
+	if m.RequestEmailChangeFunc != nil {
+		return m.RequestEmailChangeFunc(userID, newEmail, password)
+	}
+	return nil
+}
+
+func (m *MockAccountService) ConfirmEmailChange(token string) error {
+	if m.ConfirmEmailChangeFunc != nil {
+		return m.ConfirmEmailChangeFunc(token)
+	}
+	return nil
+}
+
+func (m *MockAccountService) DeleteAccount(userID uuid.UUID, password string) (time.Time, error) {
+	if m.DeleteAccountFunc != nil {
+		return m.DeleteAccountFunc(userID, password)
+	}
+	return time.Now().Add(auth.AccountDeletionGrace), nil
+}
+
+// authedRequest builds a request as the auth middleware would pass it on
+func authedRequest(method, target string, body any) *http.Request {
+	jsonBody, _ := json.Marshal(body)
+	req := httptest.NewRequest(method, target, bytes.NewBuffer(jsonBody))
+	return req.WithContext(context.WithValue(req.Context(), middleware.UserIDKey, uuid.New()))
+}
+
+func TestUpdateProfileHandler(t *testing.T) {
+	tests := []struct {
+		name           string
+		requestBody    map[string]any
+		expectedStatus int
+		expectedFirst  string
+	}{
+		{
+			name:           "first name only",
+			requestBody:    map[string]any{"first_name": "  Betty "},
+			expectedStatus: http.StatusOK,
+			expectedFirst:  "Betty",
+		},
+		{
+			name:           "nothing to change",
+			requestBody:    map[string]any{},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "blank name",
+			requestBody:    map[string]any{"last_name": " "},
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotLast *string
+			mock := &MockAccountService{
+				UpdateProfileFunc: func(userID uuid.UUID, firstName, lastName *string) (*models.User, error) {
+					gotLast = lastName
+					return &models.User{ID: userID, FirstName: *firstName, LastName: "Grof"}, nil
+				},
+			}
+			handler := NewUserHandler(nil, mock, nil, nil)
+
+			rr := httptest.NewRecorder()
+			handler.UpdateProfile(rr, authedRequest(http.MethodPatch, "/profile", tt.requestBody))
+
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+
+			if rr.Code == http.StatusOK {
+				var resp UserResponse
+				if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+					t.Fatalf("Failed to decode response: %v", err)
+				}
+				if resp.FirstName != tt.expectedFirst {
+					t.Errorf("Expected first name %q, got %q", tt.expectedFirst, resp.FirstName)
+				}
+				if gotLast != nil {
+					t.Errorf("Expected an omitted last name to stay nil, got %q", *gotLast)
+				}
+			}
+		})
+	}
+}
+
+func TestChangePasswordHandler(t *testing.T) {
+	tests := []struct {
+		name           string
+		requestBody    map[string]any
+		mockChange     func(userID, currentSessionID uuid.UUID, currentPassword, newPassword string) error
+		expectedStatus int
+	}{
+		{
+			name:           "changed",
+			requestBody:    map[string]any{"current_password": "password123", "new_password": "newpassword456", "new_password_confirm": "newpassword456"},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "passwords don't match",
+			requestBody:    map[string]any{"current_password": "password123", "new_password": "newpassword456", "new_password_confirm": "other"},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "too short",
+			requestBody:    map[string]any{"current_password": "password123", "new_password": "short", "new_password_confirm": "short"},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:        "wrong current password",
+			requestBody: map[string]any{"current_password": "wrong", "new_password": "newpassword456", "new_password_confirm": "newpassword456"},
+			mockChange: func(userID, currentSessionID uuid.UUID, currentPassword, newPassword string) error {
+				return auth.ErrInvalidCredentials
+			},
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:        "locked out",
+			requestBody: map[string]any{"current_password": "wrong", "new_password": "newpassword456", "new_password_confirm": "newpassword456"},
+			mockChange: func(userID, currentSessionID uuid.UUID, currentPassword, newPassword string) error {
+				return &auth.LoginThrottledError{RetryAfter: time.Minute}
+			},
+			expectedStatus: http.StatusTooManyRequests,
+		},
+		{
+			name:        "guest",
+			requestBody: map[string]any{"current_password": "password123", "new_password": "newpassword456", "new_password_confirm": "newpassword456"},
+			mockChange: func(userID, currentSessionID uuid.UUID, currentPassword, newPassword string) error {
+				return auth.ErrAccountGuest
+			},
+			expectedStatus: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := NewUserHandler(nil, &MockAccountService{ChangePasswordFunc: tt.mockChange}, nil, nil)
+
+			rr := httptest.NewRecorder()
+			handler.ChangePassword(rr, authedRequest(http.MethodPost, "/profile/password", tt.requestBody))
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+			if rr.Code == http.StatusTooManyRequests && rr.Header().Get("Retry-After") != "60" {
+				t.Errorf("Expected Retry-After 60, got %q", rr.Header().Get("Retry-After"))
+			}
+		})
+	}
+}
+
+func TestChangeEmailHandler(t *testing.T) {
+	tests := []struct {
+		name           string
+		requestBody    map[string]any
+		mockRequest    func(userID uuid.UUID, newEmail, password string) error
+		expectedStatus int
+	}{
+		{
+			name:           "confirmation sent",
+			requestBody:    map[string]any{"new_email": "bmo@example.com", "password": "password123"},
+			expectedStatus: http.StatusAccepted,
+		},
+		{
+			name:           "invalid email",
+			requestBody:    map[string]any{"new_email": "not-an-email", "password": "password123"},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "missing password",
+			requestBody:    map[string]any{"new_email": "bmo@example.com"},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:        "email taken",
+			requestBody: map[string]any{"new_email": "bmo@example.com", "password": "password123"},
+			mockRequest: func(userID uuid.UUID, newEmail, password string) error {
+				return auth.ErrEmailInUse
+			},
+			expectedStatus: http.StatusConflict,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := NewUserHandler(nil, &MockAccountService{RequestEmailChangeFunc: tt.mockRequest}, nil, nil)
+
+			rr := httptest.NewRecorder()
+			handler.ChangeEmail(rr, authedRequest(http.MethodPost, "/profile/email", tt.requestBody))
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+		})
+	}
+}
+
+func TestConfirmEmailChangeHandler(t *testing.T) {
+	tests := []struct {
+		name           string
+		query          string
+		mockConfirm    func(token string) error
+		expectedStatus int
+	}{
+		{name: "confirmed", query: "?token=abc", expectedStatus: http.StatusOK},
+		{name: "missing token", query: "", expectedStatus: http.StatusBadRequest},
+		{
+			name:           "invalid token",
+			query:          "?token=abc",
+			mockConfirm:    func(token string) error { return auth.ErrInvalidToken },
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "email taken since",
+			query:          "?token=abc",
+			mockConfirm:    func(token string) error { return auth.ErrEmailInUse },
+			expectedStatus: http.StatusConflict,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := NewUserHandler(nil, &MockAccountService{ConfirmEmailChangeFunc: tt.mockConfirm}, nil, nil)
+
+			req := httptest.NewRequest(http.MethodGet, "/auth/confirm-email"+tt.query, nil)
+			rr := httptest.NewRecorder()
+			handler.ConfirmEmailChange(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+		})
+	}
+}
+
+func TestDeleteAccountHandler(t *testing.T) {
+	tests := []struct {
+		name           string
+		requestBody    map[string]any
+		mockDelete     func(userID uuid.UUID, password string) (time.Time, error)
+		expectedStatus int
+	}{
+		{
+			name:           "scheduled",
+			requestBody:    map[string]any{"password": "password123"},
+			expectedStatus: http.StatusAccepted,
+		},
+		{
+			name:           "missing password",
+			requestBody:    map[string]any{},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:        "wrong password",
+			requestBody: map[string]any{"password": "wrong"},
+			mockDelete: func(userID uuid.UUID, password string) (time.Time, error) {
+				return time.Time{}, auth.ErrInvalidCredentials
+			},
+			expectedStatus: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := NewUserHandler(nil, &MockAccountService{DeleteAccountFunc: tt.mockDelete}, nil, nil)
+
+			rr := httptest.NewRecorder()
+			handler.DeleteAccount(rr, authedRequest(http.MethodDelete, "/profile", tt.requestBody))
+
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+
+			if rr.Code == http.StatusAccepted {
+				var resp DeleteAccountResponse
+				if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+					t.Fatalf("Failed to decode response: %v", err)
+				}
+				if resp.DeletionScheduledAt.Before(time.Now()) {
+					t.Errorf("Expected a deletion date in the future, got %v", resp.DeletionScheduledAt)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/diorshelton/golden-market-api/internal/middleware"
+	"github.com/diorshelton/golden-market-api/internal/models"
+	"github.com/diorshelton/golden-market-api/internal/wallet"
+	"github.com/google/uuid"
+)
+
+type WalletServiceInterface interface {
+	GetTransactions(ctx context.Context, userID uuid.UUID, limit, offset int) (*models.CoinTransactionPage, error)
+	Transfer(ctx context.Context, senderID uuid.UUID, recipientUsername string, amount int) (*models.CoinTransfer, error)
+}
+
+type WalletHandler struct {
+	walletService WalletServiceInterface
+}
+
+func NewWalletHandler(service WalletServiceInterface) *WalletHandler {
+	return &WalletHandler{
+		walletService: service,
+	}
+}
+
+// GetTransactions handles GET /api/v1/wallet/transactions?limit=&offset=
+func (h *WalletHandler) GetTransactions(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	limit, offset := 0, 0
+	query := r.URL.Query()
+	if raw := query.Get("limit"); raw != "" {
+		v, err := strconv.Atoi(raw)
+		if err != nil || v < 0 {
+			http.Error(w, "invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = v
+	}
+	if raw := query.Get("offset"); raw != "" {
+		v, err := strconv.Atoi(raw)
+		if err != nil || v < 0 {
+			http.Error(w, "invalid offset", http.StatusBadRequest)
+			return
+		}
+		offset = v
+	}
+
+	page, err := h.walletService.GetTransactions(r.Context(), userID, limit, offset)
+	if err != nil {
+		log.Printf("GetTransactions error for user %s: %v", userID, err)
+		http.Error(w, "failed to get transactions", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(page)
+}
+
+type TransferRequest struct {
+	Recipient string `json:"recipient"` // username
+	Amount    int    `json:"amount"`
+}
+
+// Transfer handles POST /api/v1/wallet/transfer
+func (h *WalletHandler) Transfer(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req TransferRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.Recipient == "" {
+		http.Error(w, "recipient is required", http.StatusBadRequest)
+		return
+	}
+
+	transfer, err := h.walletService.Transfer(r.Context(), userID, req.Recipient, req.Amount)
+	if err != nil {
+		switch {
+		case errors.Is(err, wallet.ErrInvalidTransferAmount),
+			errors.Is(err, wallet.ErrSelfTransfer):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		case errors.Is(err, wallet.ErrRecipientNotFound):
+			http.Error(w, err.Error(), http.StatusNotFound)
+		case errors.Is(err, wallet.ErrGuestTransfer),
+			errors.Is(err, wallet.ErrAccountTooNew):
+			http.Error(w, err.Error(), http.StatusForbidden)
+		case errors.Is(err, wallet.ErrTransferLimit):
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		case errors.Is(err, wallet.ErrInsufficientCoins):
+			http.Error(w, err.Error(), http.StatusPaymentRequired)
+		default:
+			log.Printf("Transfer error for user %s: %v", userID, err)
+			http.Error(w, "failed to transfer coins", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(transfer)
+}
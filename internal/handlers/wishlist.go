@@ -0,0 +1,205 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/diorshelton/golden-market-api/internal/middleware"
+	"github.com/diorshelton/golden-market-api/internal/models"
+	"github.com/diorshelton/golden-market-api/internal/repository"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+type WishlistServiceInterface interface {
+	AddToWishlist(ctx context.Context, userID, productID uuid.UUID, quantity int) error
+	GetWishlist(ctx context.Context, userID uuid.UUID) (*models.Wishlist, error)
+	RemoveFromWishlist(ctx context.Context, userID, wishlistItemID uuid.UUID) error
+	MoveToCart(ctx context.Context, userID, wishlistItemID uuid.UUID) error
+	SaveForLater(ctx context.Context, userID, cartItemID uuid.UUID) error
+}
+
+type WishlistHandler struct {
+	wishlistService WishlistServiceInterface
+}
+
+func NewWishlistHandler(service WishlistServiceInterface) *WishlistHandler {
+	return &WishlistHandler{
+		wishlistService: service,
+	}
+}
+
+type AddToWishlistRequest struct {
+	ProductID string `json:"product_id"`
+	Quantity  int    `json:"quantity"` // Defaults to 1
+}
+
+// GetWishlist handles GET /api/v1/wishlist
+func (h *WishlistHandler) GetWishlist(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	wishlist, err := h.wishlistService.GetWishlist(r.Context(), userID)
+	if err != nil {
+		log.Printf("Failed to get wishlist for user %s: %v", userID, err)
+		http.Error(w, "failed to get wishlist", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(wishlist)
+}
+
+// AddToWishlist handles POST /api/v1/wishlist
+func (h *WishlistHandler) AddToWishlist(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req AddToWishlistRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.Quantity == 0 {
+		req.Quantity = 1
+	}
+	if req.Quantity < 0 {
+		http.Error(w, "quantity must be greater than 0", http.StatusBadRequest)
+		return
+	}
+
+	productID, err := uuid.Parse(req.ProductID)
+	if err != nil {
+		http.Error(w, "invalid product ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.wishlistService.AddToWishlist(r.Context(), userID, productID, req.Quantity); err != nil {
+		log.Printf("Failed to add to wishlist for user %s: %v", userID, err)
+		if strings.Contains(err.Error(), "not found") {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		http.Error(w, "failed to add to wishlist", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "item added to wishlist",
+	})
+}
+
+// RemoveFromWishlist handles DELETE /api/v1/wishlist/{id}
+func (h *WishlistHandler) RemoveFromWishlist(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	wishlistItemID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "invalid wishlist item ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.wishlistService.RemoveFromWishlist(r.Context(), userID, wishlistItemID); err != nil {
+		if errors.Is(err, repository.ErrWishlistItemNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		log.Printf("Failed to remove wishlist item %s for user %s: %v", wishlistItemID, userID, err)
+		http.Error(w, "failed to remove from wishlist", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "item removed from wishlist",
+	})
+}
+
+// MoveToCart handles POST /api/v1/wishlist/{id}/move-to-cart
+func (h *WishlistHandler) MoveToCart(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	wishlistItemID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "invalid wishlist item ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.wishlistService.MoveToCart(r.Context(), userID, wishlistItemID); err != nil {
+		log.Printf("Failed to move wishlist item %s to cart for user %s: %v", wishlistItemID, userID, err)
+		errMsg := err.Error()
+		switch {
+		case errors.Is(err, repository.ErrWishlistItemNotFound):
+			http.Error(w, errMsg, http.StatusNotFound)
+		case strings.Contains(errMsg, "insufficient stock") || strings.Contains(errMsg, "not found"):
+			http.Error(w, errMsg, http.StatusBadRequest)
+		default:
+			http.Error(w, "failed to move item to cart", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "item moved to cart",
+	})
+}
+
+// SaveForLater handles POST /api/v1/cart/items/{id}/save-for-later
+func (h *WishlistHandler) SaveForLater(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	cartItemID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "invalid cart item ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.wishlistService.SaveForLater(r.Context(), userID, cartItemID); err != nil {
+		log.Printf("Failed to save cart item %s for later for user %s: %v", cartItemID, userID, err)
+		errMsg := err.Error()
+		switch {
+		case strings.Contains(errMsg, "cart item not found"):
+			http.Error(w, errMsg, http.StatusNotFound)
+		case strings.Contains(errMsg, "not found"):
+			http.Error(w, errMsg, http.StatusBadRequest)
+		default:
+			http.Error(w, "failed to save item for later", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "item saved for later",
+	})
+}
@@ -0,0 +1,42 @@
+// Package mailer sends the transactional emails the API needs (password
+// resets, email verification). SMTPMailer delivers for real; FileMailer and
+// LogMailer keep everything local so development works offline.
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Mailer sends an email
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// Message is a plain-text email
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// headerSanitizer drops line breaks so user-supplied values can't inject
+// extra headers
+var headerSanitizer = strings.NewReplacer("\r", "", "\n", "")
+
+// render formats msg as an RFC 5322 message from the given sender
+func render(from string, msg Message) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", headerSanitizer.Replace(from))
+	fmt.Fprintf(&b, "To: %s\r\n", headerSanitizer.Replace(msg.To))
+	fmt.Fprintf(&b, "Subject: %s\r\n", headerSanitizer.Replace(msg.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	return b.Bytes()
+}
@@ -0,0 +1,53 @@
+package mailer
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestFileMailer(t *testing.T) {
+	dir := t.TempDir()
+
+	m, err := NewFileMailer(dir, "Golden Market <no-reply@example.com>")
+	if err != nil {
+		t.Fatalf("NewFileMailer failed: %v", err)
+	}
+
+	msg := Message{
+		To:      "finn@example.com",
+		Subject: "Reset your password\r\nBcc: attacker@example.com",
+		Body:    "Use this link:\nhttp://localhost/reset",
+	}
+	if err := m.Send(context.Background(), msg); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	if err := m.Send(context.Background(), msg); err != nil {
+		t.Fatalf("Second send failed: %v", err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("ReadDir failed: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("Expected one file per message, got %d", len(entries))
+	}
+
+	raw, err := os.ReadFile(dir + "/" + entries[0].Name())
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+	content := string(raw)
+
+	if !strings.Contains(content, "To: finn@example.com\r\n") {
+		t.Errorf("Expected To header, got:\n%s", content)
+	}
+	if strings.Contains(content, "\r\nBcc:") {
+		t.Errorf("Expected line breaks in the subject to be stripped, got:\n%s", content)
+	}
+	if !strings.HasSuffix(content, "\r\n\r\nUse this link:\r\nhttp://localhost/reset") {
+		t.Errorf("Expected body with CRLF line endings, got:\n%s", content)
+	}
+}
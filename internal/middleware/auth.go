@@ -2,10 +2,14 @@ package middleware
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"log"
 	"net/http"
 	"strings"
 
 	"github.com/diorshelton/golden-market-api/internal/auth"
+	"github.com/diorshelton/golden-market-api/internal/models"
 	"github.com/google/uuid"
 )
 
@@ -15,15 +19,34 @@ type contextKey string
 const (
 	// UserIDKey is the key for user ID in the request context
 	UserIDKey contextKey = "userID"
+	// RoleKey is the key for the user's role in the request context
+	RoleKey contextKey = "role"
+	// SessionIDKey is the key for the session the access token belongs to
+	SessionIDKey contextKey = "sessionID"
+	// MFAKey is true in the request context when the user signed in with a
+	// second factor
+	MFAKey contextKey = "mfa"
+	// APIKeyKey holds the *models.APIKey when the request authenticated
+	// with an API key rather than an access token
+	APIKeyKey contextKey = "apiKey"
 )
 
-// Auth checks JWT tokens and adds user info to the request context
+// APIKeyHeader carries a personal API key, as an alternative to a bearer
+// access token
+const APIKeyHeader = "X-API-Key"
+
+// Auth checks JWT tokens, or an API key in the X-API-Key header, and adds
+// user info to the request context
 func Auth(authService *auth.AuthService) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			// Extract token from Authorization header
 			authHeader := r.Header.Get("Authorization")
 			if authHeader == "" {
+				if apiKey := r.Header.Get(APIKeyHeader); apiKey != "" {
+					authenticateAPIKey(authService, apiKey, next, w, r)
+					return
+				}
 				http.Error(w, "Authorization header required", http.StatusUnauthorized)
 				return
 			}
@@ -57,8 +80,26 @@ func Auth(authService *auth.AuthService) func(http.Handler) http.Handler {
 				return
 			}
 
-			// Add user ID to request context
+			// Tokens issued before roles existed carry no role claim;
+			// treat them as regular users
+			role, _ := claims["role"].(string)
+			if role == "" {
+				role = models.RoleUser
+			}
+
+			// Add user ID and role to request context
 			ctx := context.WithValue(r.Context(), UserIDKey, userID)
+			ctx = context.WithValue(ctx, RoleKey, role)
+
+			mfa, _ := claims["mfa"].(bool)
+			ctx = context.WithValue(ctx, MFAKey, mfa)
+
+			// Tokens issued before sessions were tracked carry no sid claim
+			if sid, ok := claims["sid"].(string); ok {
+				if sessionID, err := uuid.Parse(sid); err == nil {
+					ctx = context.WithValue(ctx, SessionIDKey, sessionID)
+				}
+			}
 
 			// Call the next handler with the enhanced context
 			next.ServeHTTP(w, r.WithContext(ctx))
@@ -66,8 +107,122 @@ func Auth(authService *auth.AuthService) func(http.Handler) http.Handler {
 	}
 }
 
+// authenticateAPIKey serves the request as the key's owner, with their
+// current role. A key is a single factor however the owner logs in, so the
+// mfa flag is always false.
+func authenticateAPIKey(authService *auth.AuthService, plaintext string, next http.Handler, w http.ResponseWriter, r *http.Request) {
+	key, user, err := authService.AuthenticateAPIKey(plaintext)
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidAPIKey) {
+			http.Error(w, "Invalid or expired API key", http.StatusUnauthorized)
+			return
+		}
+		log.Printf("API key authentication error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	ctx := context.WithValue(r.Context(), UserIDKey, user.ID)
+	ctx = context.WithValue(ctx, RoleKey, user.Role)
+	ctx = context.WithValue(ctx, MFAKey, false)
+	ctx = context.WithValue(ctx, APIKeyKey, key)
+
+	next.ServeHTTP(w, r.WithContext(ctx))
+}
+
 // GetUserID retrieves the user ID from the request context
 func GetUserID(r *http.Request) (uuid.UUID, bool) {
 	userID, ok := r.Context().Value(UserIDKey).(uuid.UUID)
 	return userID, ok
 }
+
+// GetUserRole retrieves the user's role from the request context
+func GetUserRole(r *http.Request) (string, bool) {
+	role, ok := r.Context().Value(RoleKey).(string)
+	return role, ok
+}
+
+// GetSessionID retrieves the current session ID from the request context
+func GetSessionID(r *http.Request) (uuid.UUID, bool) {
+	sessionID, ok := r.Context().Value(SessionIDKey).(uuid.UUID)
+	return sessionID, ok
+}
+
+// GetAPIKey retrieves the API key the request authenticated with, if any
+func GetAPIKey(r *http.Request) (*models.APIKey, bool) {
+	key, ok := r.Context().Value(APIKeyKey).(*models.APIKey)
+	return key, ok
+}
+
+// RequireScope refuses API keys that weren't granted scope. Requests with an
+// access token act with the user's full rights and pass. It must be chained
+// after Auth.
+func RequireScope(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if key, ok := GetAPIKey(r); ok && !key.HasScope(scope) {
+				http.Error(w, fmt.Sprintf("API key lacks the %s scope", scope), http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RejectAPIKeys keeps API keys away from account management (sessions, keys,
+// two-factor), so a leaked key can't be used to entrench itself. It must be
+// chained after Auth.
+func RejectAPIKeys(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := GetAPIKey(r); ok {
+			http.Error(w, "This endpoint requires an access token, not an API key", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RequireRole only lets a request through when the authenticated user holds
+// one of the given roles. It must be chained after Auth.
+func RequireRole(roles ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			role, ok := GetUserRole(r)
+			if !ok {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			for _, allowed := range roles {
+				if role == allowed {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+
+			http.Error(w, "Forbidden", http.StatusForbidden)
+		})
+	}
+}
+
+// RequireMFA rejects requests whose access token wasn't earned with a
+// second factor, and every API key. When enabled is false it lets everything
+// through. It must be chained after Auth.
+func RequireMFA(enabled bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if !enabled {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if _, ok := GetAPIKey(r); ok {
+				http.Error(w, "Two-factor authentication required, this endpoint doesn't accept API keys", http.StatusForbidden)
+				return
+			}
+			if mfa, _ := r.Context().Value(MFAKey).(bool); !mfa {
+				http.Error(w, "Two-factor authentication required, enable it at /api/v1/auth/mfa/enroll and log in again", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
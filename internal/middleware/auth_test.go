@@ -0,0 +1,162 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/diorshelton/golden-market-api/internal/models"
+)
+
+func TestRequireRole(t *testing.T) {
+	tests := []struct {
+		name           string
+		role           string
+		setRole        bool
+		expectedStatus int
+	}{
+		{
+			name:           "admin allowed",
+			role:           models.RoleAdmin,
+			setRole:        true,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "regular user forbidden",
+			role:           models.RoleUser,
+			setRole:        true,
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "no role in context",
+			setRole:        false,
+			expectedStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			})
+			handler := RequireRole(models.RoleAdmin)(next)
+
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/admin/users", nil)
+			if tt.setRole {
+				req = req.WithContext(context.WithValue(req.Context(), RoleKey, tt.role))
+			}
+
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+		})
+	}
+}
+
+func TestRequireMFA(t *testing.T) {
+	tests := []struct {
+		name           string
+		enabled        bool
+		mfa            bool
+		apiKey         *models.APIKey
+		expectedStatus int
+	}{
+		{name: "enforced, signed in with mfa", enabled: true, mfa: true, expectedStatus: http.StatusOK},
+		{name: "enforced, password only", enabled: true, mfa: false, expectedStatus: http.StatusForbidden},
+		{name: "enforced, admin api key", enabled: true, mfa: true, apiKey: &models.APIKey{Scopes: []string{models.ScopeAdmin}}, expectedStatus: http.StatusForbidden},
+		{name: "not enforced", enabled: false, mfa: false, expectedStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			})
+			handler := RequireMFA(tt.enabled)(next)
+
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/admin/users", nil)
+			ctx := context.WithValue(req.Context(), MFAKey, tt.mfa)
+			if tt.apiKey != nil {
+				ctx = context.WithValue(ctx, APIKeyKey, tt.apiKey)
+			}
+			req = req.WithContext(ctx)
+
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+		})
+	}
+}
+
+func TestRequireScope(t *testing.T) {
+	tests := []struct {
+		name           string
+		apiKey         *models.APIKey
+		expectedStatus int
+	}{
+		{
+			name:           "access token passes",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "key with the scope passes",
+			apiKey:         &models.APIKey{Scopes: []string{models.ScopeOrdersRead, models.ScopeCartRead}},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "key without the scope forbidden",
+			apiKey:         &models.APIKey{Scopes: []string{models.ScopeOrdersWrite}},
+			expectedStatus: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			})
+			handler := RequireScope(models.ScopeOrdersRead)(next)
+
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/orders", nil)
+			if tt.apiKey != nil {
+				req = req.WithContext(context.WithValue(req.Context(), APIKeyKey, tt.apiKey))
+			}
+
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+		})
+	}
+}
+
+func TestRejectAPIKeys(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	handler := RejectAPIKeys(next)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/sessions", nil)
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Errorf("Expected an access token request to pass, got %d", rr.Code)
+	}
+
+	key := &models.APIKey{Scopes: models.APIKeyScopes}
+	req = req.WithContext(context.WithValue(req.Context(), APIKeyKey, key))
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("Expected an API key request to get %d, got %d", http.StatusForbidden, rr.Code)
+	}
+}
@@ -0,0 +1,79 @@
+package middleware
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// ClientIPKey holds the client IP resolved by ClientIP
+const ClientIPKey contextKey = "clientIP"
+
+// ClientIP resolves each request's client IP once, for rate limits, login
+// lockouts and the sessions list. Behind a reverse proxy RemoteAddr is the
+// proxy, so when it is one of trustedProxies the IP is taken from
+// X-Forwarded-For instead: the rightmost entry that isn't itself a trusted
+// proxy. With no trusted proxies the header is ignored, since clients can
+// send anything in it.
+func ClientIP(trustedProxies []*net.IPNet) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ip := resolveClientIP(r, trustedProxies)
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), ClientIPKey, ip)))
+		})
+	}
+}
+
+// ClientIPFrom returns the IP resolved by ClientIP, or the RemoteAddr host
+// if ClientIP didn't run
+func ClientIPFrom(r *http.Request) string {
+	if ip, ok := r.Context().Value(ClientIPKey).(string); ok {
+		return ip
+	}
+	return remoteIP(r)
+}
+
+func resolveClientIP(r *http.Request, trustedProxies []*net.IPNet) string {
+	ip := remoteIP(r)
+	if !isTrusted(ip, trustedProxies) {
+		return ip
+	}
+
+	// Each proxy appends the address it received from, so walk back from
+	// the nearest hop and stop at the first one we don't run
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if net.ParseIP(hop) == nil {
+			break
+		}
+		ip = hop
+		if !isTrusted(hop, trustedProxies) {
+			break
+		}
+	}
+	return ip
+}
+
+// remoteIP is the host part of RemoteAddr
+func remoteIP(r *http.Request) string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return ip
+}
+
+func isTrusted(ip string, trustedProxies []*net.IPNet) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, proxy := range trustedProxies {
+		if proxy.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
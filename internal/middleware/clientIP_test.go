@@ -0,0 +1,81 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	_, proxies, _ := net.ParseCIDR("10.0.0.0/8")
+	trusted := []*net.IPNet{proxies}
+
+	tests := []struct {
+		name         string
+		trusted      []*net.IPNet
+		remoteAddr   string
+		forwardedFor []string
+		want         string
+	}{
+		{
+			name:       "no proxy",
+			trusted:    trusted,
+			remoteAddr: "203.0.113.7:1234",
+			want:       "203.0.113.7",
+		},
+		{
+			name:         "header ignored without trusted proxies",
+			remoteAddr:   "10.0.0.1:1234",
+			forwardedFor: []string{"203.0.113.7"},
+			want:         "10.0.0.1",
+		},
+		{
+			name:         "header ignored from an untrusted peer",
+			trusted:      trusted,
+			remoteAddr:   "198.51.100.1:1234",
+			forwardedFor: []string{"203.0.113.7"},
+			want:         "198.51.100.1",
+		},
+		{
+			name:         "client behind a trusted proxy",
+			trusted:      trusted,
+			remoteAddr:   "10.0.0.1:1234",
+			forwardedFor: []string{"203.0.113.7"},
+			want:         "203.0.113.7",
+		},
+		{
+			name:         "spoofed entries left of the client are skipped",
+			trusted:      trusted,
+			remoteAddr:   "10.0.0.1:1234",
+			forwardedFor: []string{"192.0.2.1, 203.0.113.7", "10.0.0.2"},
+			want:         "203.0.113.7",
+		},
+		{
+			name:       "trusted proxy with no header",
+			trusted:    trusted,
+			remoteAddr: "10.0.0.1:1234",
+			want:       "10.0.0.1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			handler := ClientIP(tt.trusted)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = ClientIPFrom(r)
+			}))
+
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/auth/login", nil)
+			req.RemoteAddr = tt.remoteAddr
+			for _, v := range tt.forwardedFor {
+				req.Header.Add("X-Forwarded-For", v)
+			}
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+
+			if got != tt.want {
+				t.Errorf("Expected client IP %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
@@ -1,7 +1,6 @@
 package middleware
 
 import (
-	"net"
 	"net/http"
 	"sync"
 	"time"
@@ -14,21 +13,37 @@ type client struct {
 	lastSeen time.Time
 }
 
-var (
-	clients = make(map[string]*client)
+// ipLimiter keeps one token bucket per client IP
+type ipLimiter struct {
+	clients map[string]*client
 	mu      sync.Mutex
 	once    sync.Once
-)
+	limit   rate.Limit
+	burst   int
+	idleTTL time.Duration
+}
+
+func newIPLimiter(limit rate.Limit, burst int, idleTTL time.Duration) *ipLimiter {
+	return &ipLimiter{
+		clients: make(map[string]*client),
+		limit:   limit,
+		burst:   burst,
+		idleTTL: idleTTL,
+	}
+}
+
+// defaultLimiter backs RateLimit: 1 request per second, burst of 5
+var defaultLimiter = newIPLimiter(rate.Every(time.Second), 5, 3*time.Minute)
 
 // getClient retrieves or creates a rate limiter for a given IP
-func getClient(ip string) *rate.Limiter {
-	mu.Lock()
-	defer mu.Unlock()
+func (l *ipLimiter) getClient(ip string) *rate.Limiter {
+	l.mu.Lock()
+	defer l.mu.Unlock()
 
-	c, exists := clients[ip]
+	c, exists := l.clients[ip]
 	if !exists {
-		limiter := rate.NewLimiter(rate.Every(time.Second), 5) // 1 request per second, burst of 5
-		clients[ip] = &client{limiter, time.Now()}
+		limiter := rate.NewLimiter(l.limit, l.burst)
+		l.clients[ip] = &client{limiter, time.Now()}
 		return limiter
 	}
 
@@ -37,34 +52,27 @@ func getClient(ip string) *rate.Limiter {
 }
 
 // cleanupClients removes old clients from the map
-func cleanupClients() {
+func (l *ipLimiter) cleanupClients() {
 	for {
 		time.Sleep(time.Minute)
-		mu.Lock()
-		for ip, c := range clients {
-			if time.Since(c.lastSeen) > 3*time.Minute {
-				delete(clients, ip)
+		l.mu.Lock()
+		for ip, c := range l.clients {
+			if time.Since(c.lastSeen) > l.idleTTL {
+				delete(l.clients, ip)
 			}
 		}
-		mu.Unlock()
+		l.mu.Unlock()
 	}
 }
 
-// RateLimitMiddleware limits the number of requests per client IP
-func RateLimit(next http.Handler) http.Handler {
+func (l *ipLimiter) middleware(next http.Handler) http.Handler {
 	// start cleanup goroutine only once
-	once.Do(func() {
-		go cleanupClients()
+	l.once.Do(func() {
+		go l.cleanupClients()
 	})
 
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		ip, _, err := net.SplitHostPort(r.RemoteAddr)
-		if err != nil {
-			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-			return
-		}
-
-		limiter := getClient(ip)
+		limiter := l.getClient(ClientIPFrom(r))
 
 		if !limiter.Allow() {
 			http.Error(w, "Too many requests", http.StatusTooManyRequests)
@@ -74,3 +82,23 @@ func RateLimit(next http.Handler) http.Handler {
 		next.ServeHTTP(w, r)
 	})
 }
+
+// RateLimitMiddleware limits the number of requests per client IP
+func RateLimit(next http.Handler) http.Handler {
+	return defaultLimiter.middleware(next)
+}
+
+// LimitPerIP allows each client IP n requests per period, refilled evenly
+// across the period. Use it on top of RateLimit for expensive endpoints.
+// n <= 0 disables the limit.
+func LimitPerIP(n int, period time.Duration) func(http.Handler) http.Handler {
+	if n <= 0 {
+		return func(next http.Handler) http.Handler { return next }
+	}
+
+	// Keep idle clients at least a full period, or a client could wait out
+	// the cleanup instead of the refill
+	idleTTL := max(period, 3*time.Minute)
+	l := newIPLimiter(rate.Every(period/time.Duration(n)), n, idleTTL)
+	return l.middleware
+}
@@ -0,0 +1,37 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestLimitPerIP(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	handler := LimitPerIP(2, time.Hour)(next)
+
+	send := func(remoteAddr string) int {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/auth/guest-login", nil)
+		req.RemoteAddr = remoteAddr
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	for i := 0; i < 2; i++ {
+		if code := send("10.0.0.1:1234"); code != http.StatusOK {
+			t.Fatalf("Request %d: expected status %d, got %d", i+1, http.StatusOK, code)
+		}
+	}
+
+	if code := send("10.0.0.1:5678"); code != http.StatusTooManyRequests {
+		t.Errorf("Expected third request from the same IP to get %d, got %d", http.StatusTooManyRequests, code)
+	}
+
+	if code := send("10.0.0.2:1234"); code != http.StatusOK {
+		t.Errorf("Expected another IP to be unaffected, got %d", code)
+	}
+}
@@ -0,0 +1,66 @@
+package models
+
+import (
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Scopes an API key can be granted. Each protected route requires one;
+// requests with an access token aren't limited by scopes.
+const (
+	ScopeProfileRead   = "profile:read"
+	ScopeProfileWrite  = "profile:write"
+	ScopeProductsWrite = "products:write"
+	ScopeCartRead      = "cart:read"
+	ScopeCartWrite     = "cart:write"
+	ScopeWishlistRead  = "wishlist:read"
+	ScopeWishlistWrite = "wishlist:write"
+	ScopeOrdersRead    = "orders:read"
+	ScopeOrdersWrite   = "orders:write"
+	ScopeInventoryRead = "inventory:read"
+	ScopeWalletRead    = "wallet:read"
+	ScopeWalletWrite   = "wallet:write"
+	ScopeAdmin         = "admin"
+)
+
+// APIKeyScopes lists every scope a key can be granted
+var APIKeyScopes = []string{
+	ScopeProfileRead,
+	ScopeProfileWrite,
+	ScopeProductsWrite,
+	ScopeCartRead,
+	ScopeCartWrite,
+	ScopeWishlistRead,
+	ScopeWishlistWrite,
+	ScopeOrdersRead,
+	ScopeOrdersWrite,
+	ScopeInventoryRead,
+	ScopeWalletRead,
+	ScopeWalletWrite,
+	ScopeAdmin,
+}
+
+// AdminScopes can only be granted to keys belonging to admins
+var AdminScopes = []string{ScopeProductsWrite, ScopeAdmin}
+
+// APIKey is a long-lived credential a user mints for scripts. The key
+// itself is only shown once; KeyHash is what's stored.
+type APIKey struct {
+	ID         uuid.UUID  `json:"id"`
+	UserID     uuid.UUID  `json:"-"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	KeyHash    string     `json:"-"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"-"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// HasScope reports whether the key was granted scope
+func (k *APIKey) HasScope(scope string) bool {
+	return slices.Contains(k.Scopes, scope)
+}
@@ -15,15 +15,28 @@ type CartItem struct {
 	UpdatedAt time.Time `json:"updated_at"`
 }
 
+// CartItemDetail is a cart item with its product. ReservedUntil is set
+// while the item's quantity is held for the user.
 type CartItemDetail struct {
-	CartItemID uuid.UUID `json:"cart_item_id"`
-	Product    Product   `json:"product"`
-	Quantity   int       `json:"quantity"`
-	Subtotal   Coins     `json:"subtotal"`
+	CartItemID    uuid.UUID  `json:"cart_item_id"`
+	Product       Product    `json:"product"`
+	Quantity      int        `json:"quantity"`
+	Subtotal      Coins      `json:"subtotal"`
+	ReservedUntil *time.Time `json:"reserved_until,omitempty"`
 }
 
+// CartSummary is a user's cart. Subtotal is the items before discounts and
+// TotalPrice what checkout will charge. Version fingerprints the items,
+// quantities and prices; sending it back at checkout catches anything that
+// changed.
 type CartSummary struct {
 	Items      []CartItemDetail `json:"items"`
 	TotalItems int              `json:"total_items"`
+	Subtotal   Coins            `json:"subtotal"`
+	Discounts  []CartDiscount   `json:"discounts"`
 	TotalPrice Coins            `json:"total_price"`
+	Version    string           `json:"version"`
+
+	// PromoError says why an applied promo code isn't discounting the cart
+	PromoError string `json:"promo_error,omitempty"`
 }
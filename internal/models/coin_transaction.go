@@ -0,0 +1,62 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// CoinReason explains why a user's balance moved
+type CoinReason string
+
+const (
+	CoinReasonOpeningBalance   CoinReason = "opening_balance"
+	CoinReasonPurchase         CoinReason = "purchase"
+	CoinReasonAdminAdjustment  CoinReason = "admin_adjustment"
+	CoinReasonRefund           CoinReason = "refund"
+	CoinReasonReward           CoinReason = "reward"
+	CoinReasonTransferSent     CoinReason = "transfer_sent"
+	CoinReasonTransferReceived CoinReason = "transfer_received"
+)
+
+// CoinTransaction is one entry in the coin ledger. Amount is signed: credits
+// are positive, debits negative. The sum of a user's entries always equals
+// their balance. Counterparty is the other player's username on transfer
+// entries, if their account still exists.
+type CoinTransaction struct {
+	ID           uuid.UUID  `json:"id"`
+	UserID       uuid.UUID  `json:"user_id"`
+	Amount       Coins      `json:"amount"`
+	BalanceAfter Coins      `json:"balance_after"`
+	Reason       CoinReason `json:"reason"`
+	ReferenceID  *uuid.UUID `json:"reference_id,omitempty"`
+	Counterparty string     `json:"counterparty,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+// CoinTransfer is coins sent from one player to another
+type CoinTransfer struct {
+	ID                uuid.UUID `json:"id"`
+	SenderID          uuid.UUID `json:"sender_id"`
+	SenderUsername    string    `json:"sender_username"`
+	RecipientID       uuid.UUID `json:"recipient_id"`
+	RecipientUsername string    `json:"recipient_username"`
+	Amount            Coins     `json:"amount"`
+	CreatedAt         time.Time `json:"created_at"`
+}
+
+// LedgerMismatch is a user whose stored balance disagrees with their ledger
+type LedgerMismatch struct {
+	UserID        uuid.UUID `json:"user_id"`
+	Username      string    `json:"username"`
+	Balance       Coins     `json:"balance"`
+	LedgerBalance Coins     `json:"ledger_balance"`
+}
+
+// CoinTransactionPage is one page of a user's ledger history
+type CoinTransactionPage struct {
+	Transactions []CoinTransaction `json:"transactions"`
+	Total        int               `json:"total"`
+	Limit        int               `json:"limit"`
+	Offset       int               `json:"offset"`
+}
@@ -0,0 +1,9 @@
+package models
+
+// LoginAttemptScope says what failed logins are counted against
+type LoginAttemptScope string
+
+const (
+	LoginScopeAccount LoginAttemptScope = "account"
+	LoginScopeIP      LoginAttemptScope = "ip"
+)
@@ -1,6 +1,7 @@
 package models
 
 import (
+	"encoding/json"
 	"time"
 
 	"github.com/google/uuid"
@@ -10,31 +11,97 @@ import (
 type OrderStatus string
 
 const (
-	OrderStatusPending   OrderStatus = "pending"
-	OrderStatusCompleted OrderStatus = "completed"
-	OrderStatusCancelled OrderStatus = "cancelled"
+	OrderStatusPending           OrderStatus = "pending"
+	OrderStatusCompleted         OrderStatus = "completed"
+	OrderStatusCancelled         OrderStatus = "cancelled"
+	OrderStatusPartiallyRefunded OrderStatus = "partially_refunded"
+	OrderStatusRefunded          OrderStatus = "refunded"
 )
 
 // Order represents a completed purchase
 type Order struct {
-	ID          uuid.UUID   `json:"id"`
-	UserID      uuid.UUID   `json:"user_id"`
-	OrderNumber string      `json:"order_number"`
-	TotalAmount int         `json:"total_amount"`
-	Status      OrderStatus `json:"status"`
-	CreatedAt   time.Time   `json:"created_at"`
-	UpdatedAt   time.Time   `json:"updated_at"`
-	Items       []OrderItem `json:"items"`
+	ID             uuid.UUID           `json:"id"`
+	UserID         uuid.UUID           `json:"user_id"`
+	OrderNumber    string              `json:"order_number"`
+	TotalAmount    int                 `json:"total_amount"`
+	DiscountAmount int                 `json:"discount_amount"`
+	RefundedAmount int                 `json:"refunded_amount"`
+	Status         OrderStatus         `json:"status"`
+	CreatedAt      time.Time           `json:"created_at"`
+	UpdatedAt      time.Time           `json:"updated_at"`
+	Items          []OrderItem         `json:"items"`
+	StatusHistory  []OrderStatusChange `json:"status_history,omitempty"`
 }
 
 // OrderItem represents a single product in an order
 type OrderItem struct {
-	ID           uuid.UUID `json:"id"`
-	OrderID      uuid.UUID `json:"order_id"`
-	ProductID    uuid.UUID `json:"product_id"`
-	ProductName  string    `json:"product_name"`
-	Quantity     int       `json:"quantity"`
-	PricePerUnit int       `json:"price_per_unit"`
-	Subtotal     int       `json:"subtotal"`
-	CreatedAt    time.Time `json:"created_at"`
+	ID               uuid.UUID `json:"id"`
+	OrderID          uuid.UUID `json:"order_id"`
+	ProductID        uuid.UUID `json:"product_id"`
+	ProductName      string    `json:"product_name"`
+	Quantity         int       `json:"quantity"`
+	RefundedQuantity int       `json:"refunded_quantity"`
+	PricePerUnit     int       `json:"price_per_unit"`
+	Subtotal         int       `json:"subtotal"`
+	Discount         int       `json:"discount"` // this item's share of the order's discount
+	CreatedAt        time.Time `json:"created_at"`
+}
+
+// OrderStatusChange is one entry in an order's status history
+type OrderStatusChange struct {
+	ID         uuid.UUID    `json:"id"`
+	OrderID    uuid.UUID    `json:"order_id"`
+	FromStatus *OrderStatus `json:"from_status,omitempty"`
+	ToStatus   OrderStatus  `json:"to_status"`
+	Reason     string       `json:"reason,omitempty"`
+	ChangedBy  *uuid.UUID   `json:"changed_by,omitempty"`
+	CreatedAt  time.Time    `json:"created_at"`
+}
+
+// RefundItem asks for some quantity of one order item to be refunded
+type RefundItem struct {
+	OrderItemID uuid.UUID `json:"order_item_id"`
+	Quantity    int       `json:"quantity"`
+}
+
+// OrderIdempotencyKey remembers the checkout a client-supplied
+// Idempotency-Key produced, so a retry gets the same order back
+type OrderIdempotencyKey struct {
+	UserID      uuid.UUID       `json:"user_id"`
+	Key         string          `json:"key"`
+	RequestHash string          `json:"request_hash"`
+	OrderID     uuid.UUID       `json:"order_id"`
+	Response    json.RawMessage `json:"response"`
+	CreatedAt   time.Time       `json:"created_at"`
+}
+
+// CheckoutExpectation is what the buyer last saw of their cart: the total
+// and the version from GET /cart. Both are optional; checkout refuses to
+// charge if the cart no longer matches them.
+type CheckoutExpectation struct {
+	Total       *Coins `json:"expected_total,omitempty"`
+	CartVersion string `json:"cart_version,omitempty"`
+}
+
+// CheckoutChangeKind says how a cart item drifted before checkout
+type CheckoutChangeKind string
+
+const (
+	CheckoutPriceChanged    CheckoutChangeKind = "price_changed"
+	CheckoutItemUnavailable CheckoutChangeKind = "item_unavailable"
+	CheckoutStockReduced    CheckoutChangeKind = "stock_reduced"
+	CheckoutCartChanged     CheckoutChangeKind = "cart_changed" // added, removed or requantified since the version
+)
+
+// CheckoutChange is one difference between the cart the buyer saw and the
+// locked products checkout found. Quantity is what is in the cart now.
+type CheckoutChange struct {
+	Kind         CheckoutChangeKind `json:"kind"`
+	ProductID    uuid.UUID          `json:"product_id"`
+	ProductName  string             `json:"product_name,omitempty"`
+	Quantity     int                `json:"quantity"`
+	SeenQuantity *int               `json:"seen_quantity,omitempty"`
+	OldPrice     *Coins             `json:"old_price,omitempty"`
+	NewPrice     *Coins             `json:"new_price,omitempty"`
+	Available    *int               `json:"available,omitempty"`
 }
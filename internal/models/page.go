@@ -0,0 +1,17 @@
+package models
+
+// Page size limits shared by every paginated listing, so the catalog and
+// the wallet can't drift apart
+const (
+	DefaultPageSize = 20
+	MaxPageSize     = 100
+)
+
+// ClampPageSize returns limit within 1..MaxPageSize, using DefaultPageSize
+// when it is unset. Out-of-range limits are clamped rather than rejected.
+func ClampPageSize(limit int) int {
+	if limit <= 0 {
+		return DefaultPageSize
+	}
+	return min(limit, MaxPageSize)
+}
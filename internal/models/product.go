@@ -6,19 +6,22 @@ import (
 	"github.com/google/uuid"
 )
 
-// Product represents a product in the marketplace
+// Product represents a product in the marketplace. Available is Stock less
+// the quantity held in other shoppers' carts.
 type Product struct {
-	ID          uuid.UUID `json:"id"`
-	Name        string    `json:"name"`
-	Description string    `json:"description"`
-	Price       Coins     `json:"price"`
-	Stock       int       `json:"stock"`
-	ImageURL    string    `json:"image_url,omitempty"`
-	Category    string    `json:"category"`
-	IsAvailable bool      `json:"is_available"`
-	LastRestock time.Time `json:"last_restock"`
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
+	ID          uuid.UUID  `json:"id"`
+	Name        string     `json:"name"`
+	Description string     `json:"description"`
+	Price       Coins      `json:"price"`
+	Stock       int        `json:"stock"`
+	Available   int        `json:"available"`
+	ImageURL    string     `json:"image_url,omitempty"`
+	Category    string     `json:"category"`
+	IsAvailable bool       `json:"is_available"`
+	LastRestock time.Time  `json:"last_restock"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+	DeletedAt   *time.Time `json:"deleted_at,omitempty"`
 }
 
 // Item represents a product in a user's inventory
@@ -29,3 +32,63 @@ type Item struct {
 
 // Coins represents in-game currency
 type Coins int64
+
+// ProductSort is a catalog sort order
+type ProductSort string
+
+const (
+	ProductSortName        ProductSort = "name"
+	ProductSortPrice       ProductSort = "price"
+	ProductSortNewest      ProductSort = "newest"
+	ProductSortLastRestock ProductSort = "last_restock"
+)
+
+// Valid reports whether s is a supported sort order
+func (s ProductSort) Valid() bool {
+	switch s {
+	case ProductSortName, ProductSortPrice, ProductSortNewest, ProductSortLastRestock:
+		return true
+	}
+	return false
+}
+
+// ProductFilter selects and orders one page of the catalog. Zero values
+// mean "no filter"; Cursor is the NextCursor of the previous page.
+type ProductFilter struct {
+	Category    string
+	MinPrice    int
+	MaxPrice    int
+	InStockOnly bool
+	Sort        ProductSort
+	Descending  bool
+	Cursor      string
+	Limit       int
+}
+
+// ProductPage is one page of the catalog. NextCursor is empty on the last
+// page; Total counts every product matching the filter across all pages.
+type ProductPage struct {
+	Products   []*Product `json:"products"`
+	NextCursor string     `json:"next_cursor,omitempty"`
+	Total      int        `json:"total"`
+}
+
+// ProductSearchResult is a product matched by a catalog search. Headline
+// and Snippet wrap matched terms in <mark> tags.
+type ProductSearchResult struct {
+	*Product
+	Rank     float64 `json:"rank"`
+	Headline string  `json:"headline"`
+	Snippet  string  `json:"snippet,omitempty"`
+}
+
+// ProductSearchPage is one page of search results. Fuzzy is true when no
+// product matched the query exactly and the results come from the
+// typo-tolerant fallback instead.
+type ProductSearchPage struct {
+	Results []ProductSearchResult `json:"results"`
+	Total   int                   `json:"total"`
+	Limit   int                   `json:"limit"`
+	Offset  int                   `json:"offset"`
+	Fuzzy   bool                  `json:"fuzzy"`
+}
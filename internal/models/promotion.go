@@ -0,0 +1,72 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// DiscountType is how a promotion's DiscountValue is applied
+type DiscountType string
+
+const (
+	DiscountPercent DiscountType = "percent" // DiscountValue percent off
+	DiscountFixed   DiscountType = "fixed"   // DiscountValue coins off
+)
+
+// Valid reports whether t is a supported discount type
+func (t DiscountType) Valid() bool {
+	return t == DiscountPercent || t == DiscountFixed
+}
+
+// Promotion is a promo code and the rules for redeeming it. Category or
+// ProductID narrows the discount to those cart items; with neither it
+// covers the whole cart. MinCartTotal is checked against the whole cart.
+// Zero redemption limits mean unlimited, and nil dates mean open-ended.
+type Promotion struct {
+	ID                    uuid.UUID    `json:"id"`
+	Code                  string       `json:"code"`
+	Description           string       `json:"description"`
+	DiscountType          DiscountType `json:"discount_type"`
+	DiscountValue         int          `json:"discount_value"`
+	MinCartTotal          Coins        `json:"min_cart_total"`
+	Category              *string      `json:"category,omitempty"`
+	ProductID             *uuid.UUID   `json:"product_id,omitempty"`
+	MaxRedemptions        int          `json:"max_redemptions"`
+	MaxRedemptionsPerUser int          `json:"max_redemptions_per_user"`
+	RedemptionCount       int          `json:"redemption_count"`
+	StartsAt              *time.Time   `json:"starts_at,omitempty"`
+	EndsAt                *time.Time   `json:"ends_at,omitempty"`
+	IsActive              bool         `json:"is_active"`
+	CreatedAt             time.Time    `json:"created_at"`
+	UpdatedAt             time.Time    `json:"updated_at"`
+}
+
+// Covers reports whether the promotion discounts product
+func (p *Promotion) Covers(product *Product) bool {
+	switch {
+	case p.ProductID != nil:
+		return *p.ProductID == product.ID
+	case p.Category != nil:
+		return *p.Category == product.Category
+	default:
+		return true
+	}
+}
+
+// CartDiscount is a discount line on a cart
+type CartDiscount struct {
+	Code        string `json:"code"`
+	Description string `json:"description,omitempty"`
+	Amount      Coins  `json:"amount"`
+}
+
+// PromotionRedemption records a promotion used on an order
+type PromotionRedemption struct {
+	ID          uuid.UUID `json:"id"`
+	PromotionID uuid.UUID `json:"promotion_id"`
+	UserID      uuid.UUID `json:"user_id"`
+	OrderID     uuid.UUID `json:"order_id"`
+	Discount    Coins     `json:"discount"`
+	CreatedAt   time.Time `json:"created_at"`
+}
@@ -6,12 +6,19 @@ import (
 	"github.com/google/uuid"
 )
 
-// RefreshToken represents a refresh token in the system
+// RefreshToken represents a refresh token in the system. Tokens rotated
+// from the same login share a FamilyID; UsedAt is set once a token has been
+// exchanged and it must never be accepted again.
 type RefreshToken struct {
-	ID        uuid.UUID `json:"id"`
-	UserID    uuid.UUID `json:"user_id"`
-	Token     string    `json:"token"`
-	ExpiresAt time.Time `json:"expires_at"`
-	CreatedAt time.Time `json:"created_at"`
-	Revoked   bool      `json:"revoked"`
+	ID               uuid.UUID  `json:"id"`
+	UserID           uuid.UUID  `json:"user_id"`
+	FamilyID         uuid.UUID  `json:"family_id"`
+	Token            string     `json:"token"`
+	UserAgent        string     `json:"user_agent"`
+	IPAddress        string     `json:"ip_address"`
+	SessionStartedAt time.Time  `json:"session_started_at"`
+	ExpiresAt        time.Time  `json:"expires_at"`
+	CreatedAt        time.Time  `json:"created_at"`
+	UsedAt           *time.Time `json:"used_at,omitempty"`
+	Revoked          bool       `json:"revoked"`
 }
@@ -6,17 +6,38 @@ import (
 	"github.com/google/uuid"
 )
 
+// Roles a user can hold. Every account starts as RoleUser; admins are
+// promoted out of band.
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
 // User represents a user in the system
 type User struct {
-	ID           uuid.UUID `json:"id"`
-	Username     string    `json:"username"`
-	FirstName    string    `json:"first_name"`
-	LastName     string    `json:"last_name"`
-	Email        string    `json:"email"`
-	PasswordHash string    `json:"-"`
-	Balance      Coins     `json:"balance"`
-	IsGuest      bool      `json:"is_guest"`
-	Inventory    []Item    `json:"inventory,omitempty"`
-	CreatedAt    time.Time `json:"created_at"`
-	LastLogin    time.Time `json:"last_login"`
+	ID              uuid.UUID  `json:"id"`
+	Username        string     `json:"username"`
+	FirstName       string     `json:"first_name"`
+	LastName        string     `json:"last_name"`
+	Email           string     `json:"email"`
+	PasswordHash    string     `json:"-"`
+	Balance         Coins      `json:"balance"`
+	IsGuest         bool       `json:"is_guest"`
+	Role            string     `json:"role"`
+	GuestExpiresAt  *time.Time `json:"guest_expires_at,omitempty"`
+	EmailVerifiedAt *time.Time `json:"email_verified_at,omitempty"`
+	MFAEnabledAt    *time.Time `json:"mfa_enabled_at,omitempty"`
+	// DeletionScheduledAt is set while the account is waiting to be deleted
+	DeletionScheduledAt *time.Time `json:"deletion_scheduled_at,omitempty"`
+	Inventory           []Item     `json:"inventory,omitempty"`
+	CreatedAt           time.Time  `json:"created_at"`
+	LastLogin           time.Time  `json:"last_login"`
+}
+
+// UserMFA is a user's two-factor state. Secret is encrypted; it is present
+// from enrollment on but only enforced once EnabledAt is set.
+type UserMFA struct {
+	Secret    []byte
+	EnabledAt *time.Time
+	LastStep  *int64
 }
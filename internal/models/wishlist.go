@@ -0,0 +1,26 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// WishlistItemDetail is a saved product with what changed since it was
+// saved. SavedPrice is the price when it was first saved; BackInStock is
+// set if it was out of stock then and can be bought now.
+type WishlistItemDetail struct {
+	WishlistItemID uuid.UUID `json:"wishlist_item_id"`
+	Product        Product   `json:"product"`
+	Quantity       int       `json:"quantity"`
+	SavedPrice     Coins     `json:"saved_price"`
+	PriceDropped   bool      `json:"price_dropped"`
+	BackInStock    bool      `json:"back_in_stock"`
+	AddedAt        time.Time `json:"added_at"`
+}
+
+// Wishlist is a user's saved products, most recently saved first
+type Wishlist struct {
+	Items      []WishlistItemDetail `json:"items"`
+	TotalItems int                  `json:"total_items"`
+}
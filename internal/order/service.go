@@ -2,25 +2,55 @@ package order
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/diorshelton/golden-market-api/internal/models"
+	"github.com/diorshelton/golden-market-api/internal/promotion"
 	"github.com/diorshelton/golden-market-api/internal/repository"
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+var (
+	ErrOrderNotFound        = errors.New("order not found")
+	ErrCancelWindowExpired  = errors.New("order can no longer be cancelled")
+	ErrOrderNotRefundable   = errors.New("order has nothing left to refund")
+	ErrInvalidRefundItem    = errors.New("invalid refund item")
+	ErrItemsNotInInventory  = errors.New("refunded items are no longer in the buyer's inventory")
+	ErrIdempotencyKeyReused = errors.New("idempotency key was already used for a different cart")
+)
+
+// CheckoutConflictError is returned when the cart no longer matches what
+// the buyer saw: an item became unavailable, ran short or changed price, or
+// the total differs from the one they expected. Nothing is charged.
+type CheckoutConflictError struct {
+	ExpectedTotal *models.Coins
+	Total         models.Coins
+	Changes       []models.CheckoutChange
+}
+
+func (e *CheckoutConflictError) Error() string {
+	return fmt.Sprintf("cart changed before checkout: %d change(s), total now %d", len(e.Changes), e.Total)
+}
+
 type OrderService struct {
-	db                  *pgxpool.Pool
-	orderRepo           *repository.OrderRepository
-	orderItemRepo       *repository.OrderItemRepository
-	inventoryRepo       *repository.InventoryRepository
-	userRepo            *repository.UserRepository
-	productRepo         *repository.ProductRepository
-	cartRepo            *repository.CartRepository
-	duplicateWindowSecs int
+	db            *pgxpool.Pool
+	orderRepo     *repository.OrderRepository
+	orderItemRepo *repository.OrderItemRepository
+	inventoryRepo *repository.InventoryRepository
+	userRepo      *repository.UserRepository
+	productRepo   *repository.ProductRepository
+	cartRepo      *repository.CartRepository
+	promotionRepo *repository.PromotionRepository
+	cancelWindow  time.Duration
 }
 
 func NewOrderService(
@@ -31,61 +61,52 @@ func NewOrderService(
 	userRepo *repository.UserRepository,
 	productRepo *repository.ProductRepository,
 	cartRepo *repository.CartRepository,
+	promotionRepo *repository.PromotionRepository,
 ) *OrderService {
 	return &OrderService{
-		db:                  db,
-		orderRepo:           orderRepo,
-		orderItemRepo:       orderItemRepo,
-		inventoryRepo:       inventoryRepo,
-		userRepo:            userRepo,
-		productRepo:         productRepo,
-		cartRepo:            cartRepo,
-		duplicateWindowSecs: 15, // Prevent duplicate orders within 15 seconds
+		db:            db,
+		orderRepo:     orderRepo,
+		orderItemRepo: orderItemRepo,
+		inventoryRepo: inventoryRepo,
+		userRepo:      userRepo,
+		productRepo:   productRepo,
+		cartRepo:      cartRepo,
+		promotionRepo: promotionRepo,
+		cancelWindow:  defaultCancelWindow,
 	}
 }
 
-// CreateOrder processes the checkout atomically:
-// 1. Validate cart is not empty
-// 2. Check for duplicate recent order
-// 3. Begin transaction
-// 4. Verify user has sufficient coins (with row lock)
-// 5. Verify all products have sufficient stock (with row locks)
-// 6. Deduct coins from user
-// 7. Decrement stock for each product
-// 8. Create order and order items
-// 9. Add items to user inventory
-// 10. Clear cart
-// 11. Commit transaction
-func (s *OrderService) CreateOrder(ctx context.Context, userID uuid.UUID) (*models.Order, error) {
-	// Get cart items (outside transaction - just for empty check and duplicate detection)
-	cart, err := s.cartRepo.GetCart(ctx, userID)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get cart: %w", err)
-	}
-
-	if len(cart.Items) == 0 {
-		return nil, fmt.Errorf("cart is empty")
-	}
-
-	// Check for recent duplicate orders
-	recentOrders, err := s.orderRepo.GetRecentByUserID(ctx, userID, s.duplicateWindowSecs)
-	if err != nil {
-		return nil, fmt.Errorf("failed to check recent orders: %w", err)
-	}
+// defaultCancelWindow is how long after purchase owners may cancel unless
+// ConfigureCancelWindow says otherwise
+const defaultCancelWindow = 30 * time.Minute
 
-	// If there's a recent order with the same total, return it (idempotency)
-	totalAmount := int(cart.TotalPrice)
-	for _, recentOrder := range recentOrders {
-		if recentOrder.TotalAmount == totalAmount {
-			// Load order items
-			items, err := s.orderItemRepo.GetByOrderID(ctx, recentOrder.ID)
-			if err == nil {
-				recentOrder.Items = items
-			}
-			return recentOrder, nil
-		}
+// ConfigureCancelWindow sets how long after purchase an owner may still
+// cancel an order. A window of zero or less keeps the default.
+func (s *OrderService) ConfigureCancelWindow(window time.Duration) {
+	if window > 0 {
+		s.cancelWindow = window
 	}
+}
 
+// CreateOrder processes the checkout atomically:
+// 1. Begin transaction
+// 2. Lock the user row, which serializes a user's checkouts
+// 3. Replay the stored order if idempotencyKey was already used
+// 4. Lock the cart items and validate cart is not empty
+// 5. Lock all products and recompute the cart, refusing if it drifted
+// 6. Lock the cart's promotion and apply its discount
+// 7. Verify user has sufficient coins
+// 8. Deduct coins from user
+// 9. Decrement stock for each product
+// 10. Create order and order items, and record the promo redemption
+// 11. Add items to user inventory
+// 12. Remove the ordered items and the promo code from the cart, and store idempotencyKey with the order
+// 13. Commit transaction
+//
+// idempotencyKey is optional; without one every call is a new checkout.
+// expected is optional too: without it, checkout still refuses items that
+// became unavailable, short or repriced while it ran.
+func (s *OrderService) CreateOrder(ctx context.Context, userID uuid.UUID, idempotencyKey string, expected models.CheckoutExpectation) (*models.Order, error) {
 	// Begin transaction BEFORE validation to ensure consistency
 	tx, err := s.db.Begin(ctx)
 	if err != nil {
@@ -99,39 +120,85 @@ func (s *OrderService) CreateOrder(ctx context.Context, userID uuid.UUID) (*mode
 		return nil, fmt.Errorf("failed to get user: %w", err)
 	}
 
-	if int(user.Balance) < totalAmount {
-		return nil, fmt.Errorf("insufficient coins: have %d, need %d", user.Balance, totalAmount)
+	// Read the cart under lock, so what is charged is exactly what gets
+	// removed from it
+	cart, err := s.cartRepo.GetCartForUpdate(ctx, tx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get cart: %w", err)
 	}
 
-	// Verify stock availability with row locks and get fresh product data
-	for i, item := range cart.Items {
-		product, err := s.productRepo.GetByIDForUpdate(ctx, tx, item.Product.ID)
+	requestHash := hashCart(cart)
+	if idempotencyKey != "" {
+		stored, err := s.orderRepo.GetIdempotencyKey(ctx, tx, userID, idempotencyKey)
 		if err != nil {
-			return nil, fmt.Errorf("product %s is no longer available", item.Product.Name)
+			return nil, err
 		}
-		if product.Stock < item.Quantity {
-			return nil, fmt.Errorf("insufficient stock for %s: available %d, requested %d",
-				product.Name, product.Stock, item.Quantity)
+		if stored != nil {
+			return replayOrder(stored, cart, requestHash)
 		}
-		// Update cart item with fresh product data
-		cart.Items[i].Product = *product
+	}
+
+	if len(cart.Items) == 0 {
+		return nil, fmt.Errorf("cart is empty")
+	}
+
+	// Lock every product and recompute the cart from the locked rows, so
+	// the total and the item subtotals are charged at the same prices
+	changes, err := s.lockCartProducts(ctx, tx, userID, cart, expected.CartVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	var subtotal models.Coins
+	for _, item := range cart.Items {
+		subtotal += item.Subtotal
+	}
+	cart.Subtotal = subtotal
+	cart.TotalPrice = subtotal
+
+	// A promo code that no longer applies is reported after any drift,
+	// which may well be the reason for it
+	discount, promoErr := s.lockCartPromotion(ctx, tx, userID, cart)
+	if promoErr != nil && !errors.Is(promoErr, promotion.ErrNotApplicable) {
+		return nil, promoErr
+	}
+	if discount != nil {
+		discount.ApplyTo(cart)
+	}
+
+	if len(changes) > 0 || (expected.Total != nil && *expected.Total != cart.TotalPrice) {
+		return nil, &CheckoutConflictError{
+			ExpectedTotal: expected.Total,
+			Total:         cart.TotalPrice,
+			Changes:       changes,
+		}
+	}
+	if promoErr != nil {
+		return nil, promoErr
+	}
+
+	totalAmount := int(cart.TotalPrice)
+
+	if int(user.Balance) < totalAmount {
+		return nil, fmt.Errorf("insufficient coins: have %d, need %d", user.Balance, totalAmount)
 	}
 
 	// Create order
 	now := time.Now().UTC()
 	order := &models.Order{
-		ID:          uuid.New(),
-		UserID:      userID,
-		OrderNumber: repository.GenerateOrderNumber(),
-		TotalAmount: totalAmount,
-		Status:      models.OrderStatusCompleted,
-		CreatedAt:   now,
-		UpdatedAt:   now,
-		Items:       make([]models.OrderItem, 0, len(cart.Items)),
+		ID:             uuid.New(),
+		UserID:         userID,
+		OrderNumber:    repository.GenerateOrderNumber(),
+		TotalAmount:    totalAmount,
+		DiscountAmount: int(subtotal) - totalAmount,
+		Status:         models.OrderStatusCompleted,
+		CreatedAt:      now,
+		UpdatedAt:      now,
+		Items:          make([]models.OrderItem, 0, len(cart.Items)),
 	}
 
 	// Deduct coins from user
-	if err := s.userRepo.DeductCoins(ctx, tx, userID, totalAmount); err != nil {
+	if err := s.userRepo.DeductCoins(ctx, tx, userID, totalAmount, models.CoinReasonPurchase, &order.ID); err != nil {
 		return nil, err
 	}
 
@@ -140,6 +207,21 @@ func (s *OrderService) CreateOrder(ctx context.Context, userID uuid.UUID) (*mode
 		return nil, err
 	}
 
+	// Record the redemption; the promotion row is locked, so its limits
+	// hold against concurrent checkouts
+	if discount != nil {
+		if err := s.promotionRepo.RecordRedemption(ctx, tx, &models.PromotionRedemption{
+			ID:          uuid.New(),
+			PromotionID: discount.Promotion.ID,
+			UserID:      userID,
+			OrderID:     order.ID,
+			Discount:    discount.Amount,
+			CreatedAt:   now,
+		}); err != nil {
+			return nil, err
+		}
+	}
+
 	// Process each cart item
 	for _, cartItem := range cart.Items {
 		// Decrement product stock
@@ -163,6 +245,9 @@ func (s *OrderService) CreateOrder(ctx context.Context, userID uuid.UUID) (*mode
 			Subtotal:     int(cartItem.Subtotal),
 			CreatedAt:    now,
 		}
+		if discount != nil {
+			orderItem.Discount = int(discount.ByProduct[cartItem.Product.ID])
+		}
 
 		if err := s.orderItemRepo.Create(ctx, tx, &orderItem); err != nil {
 			return nil, fmt.Errorf("failed to create order item: %w", err)
@@ -171,10 +256,45 @@ func (s *OrderService) CreateOrder(ctx context.Context, userID uuid.UUID) (*mode
 		order.Items = append(order.Items, orderItem)
 	}
 
-	// Clear cart
-	if err := s.cartRepo.ClearCart(ctx, tx, userID); err != nil {
+	// Start the order's status history
+	if err := s.orderRepo.AddStatusChange(ctx, tx, &models.OrderStatusChange{
+		ID:        uuid.New(),
+		OrderID:   order.ID,
+		ToStatus:  order.Status,
+		ChangedBy: &userID,
+		CreatedAt: now,
+	}); err != nil {
+		return nil, err
+	}
+
+	// Clear the ordered items; anything added since the cart was read stays
+	productIDs := make([]uuid.UUID, 0, len(cart.Items))
+	for _, item := range cart.Items {
+		productIDs = append(productIDs, item.Product.ID)
+	}
+	if err := s.cartRepo.RemoveProductsFromCart(ctx, tx, userID, productIDs); err != nil {
 		return nil, fmt.Errorf("failed to clear cart: %w", err)
 	}
+	if err := s.promotionRepo.ClearCartPromotion(ctx, tx, userID); err != nil {
+		return nil, err
+	}
+
+	if idempotencyKey != "" {
+		response, err := json.Marshal(order)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode order: %w", err)
+		}
+		if err := s.orderRepo.SaveIdempotencyKey(ctx, tx, &models.OrderIdempotencyKey{
+			UserID:      userID,
+			Key:         idempotencyKey,
+			RequestHash: requestHash,
+			OrderID:     order.ID,
+			Response:    response,
+			CreatedAt:   now,
+		}); err != nil {
+			return nil, err
+		}
+	}
 
 	// Commit transaction
 	if err := tx.Commit(ctx); err != nil {
@@ -184,6 +304,146 @@ func (s *OrderService) CreateOrder(ctx context.Context, userID uuid.UUID) (*mode
 	return order, nil
 }
 
+// lockCartProducts locks each cart item's product and refreshes the item
+// from it. It returns how the cart drifted from the one described by
+// cartVersion, or from the cart as read before its products were locked
+// if there is none.
+func (s *OrderService) lockCartProducts(ctx context.Context, tx pgx.Tx, userID uuid.UUID, cart *models.CartSummary, cartVersion string) ([]models.CheckoutChange, error) {
+	seen := make(map[uuid.UUID]repository.CartVersionItem, len(cart.Items))
+	if cartVersion != "" {
+		versionItems, err := repository.DecodeCartVersion(cartVersion)
+		if err != nil {
+			return nil, fmt.Errorf("checkout: %w", err)
+		}
+		for _, item := range versionItems {
+			seen[item.ProductID] = item
+		}
+	} else {
+		for _, item := range cart.Items {
+			seen[item.Product.ID] = repository.CartVersionItem{
+				ProductID: item.Product.ID,
+				Quantity:  item.Quantity,
+				Price:     item.Product.Price,
+			}
+		}
+	}
+
+	changes := []models.CheckoutChange{}
+	for i, item := range cart.Items {
+		change := models.CheckoutChange{
+			ProductID:   item.Product.ID,
+			ProductName: item.Product.Name,
+			Quantity:    item.Quantity,
+		}
+
+		seenItem, ok := seen[item.Product.ID]
+		delete(seen, item.Product.ID)
+		if !ok || seenItem.Quantity != item.Quantity {
+			change.Kind = models.CheckoutCartChanged
+			change.SeenQuantity = &seenItem.Quantity
+			changes = append(changes, change)
+		}
+
+		product, err := s.productRepo.GetByIDForUpdate(ctx, tx, item.Product.ID)
+		if err != nil {
+			change.Kind = models.CheckoutItemUnavailable
+			change.SeenQuantity = nil
+			changes = append(changes, change)
+			continue
+		}
+
+		// Stock held in other shoppers' carts isn't ours to sell
+		held, err := s.cartRepo.HeldByOthersTx(ctx, tx, product.ID, userID)
+		if err != nil {
+			return nil, err
+		}
+		if available := max(product.Stock-held, 0); available < item.Quantity {
+			change.Kind = models.CheckoutStockReduced
+			change.SeenQuantity = nil
+			change.Available = &available
+			changes = append(changes, change)
+		}
+
+		if ok && product.Price != seenItem.Price {
+			change.Kind = models.CheckoutPriceChanged
+			change.SeenQuantity = nil
+			change.Available = nil
+			change.OldPrice = &seenItem.Price
+			change.NewPrice = &product.Price
+			changes = append(changes, change)
+		}
+
+		// Update cart item with fresh product data
+		cart.Items[i].Product = *product
+		cart.Items[i].Subtotal = models.Coins(int(product.Price) * item.Quantity)
+	}
+
+	// Whatever the version still lists was removed from the cart since
+	for _, item := range seen {
+		seenQuantity := item.Quantity
+		changes = append(changes, models.CheckoutChange{
+			Kind:         models.CheckoutCartChanged,
+			ProductID:    item.ProductID,
+			SeenQuantity: &seenQuantity,
+		})
+	}
+
+	return changes, nil
+}
+
+// lockCartPromotion locks the promotion applied to the user's cart and
+// works out its discount on the recomputed cart. It returns nil if no code
+// is applied, and an error wrapping promotion.ErrNotApplicable if the code
+// can no longer be used.
+func (s *OrderService) lockCartPromotion(ctx context.Context, tx pgx.Tx, userID uuid.UUID, cart *models.CartSummary) (*promotion.Discount, error) {
+	applied, err := s.promotionRepo.GetCartPromotion(ctx, tx, userID)
+	if err != nil || applied == nil {
+		return nil, err
+	}
+
+	promo, err := s.promotionRepo.GetByIDForUpdate(ctx, tx, applied.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	discount, err := promotion.Evaluate(promo, cart, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", promo.Code, err)
+	}
+	if err := promotion.CheckLimits(ctx, tx, s.promotionRepo, promo, userID); err != nil {
+		return nil, fmt.Errorf("%s: %w", promo.Code, err)
+	}
+
+	return discount, nil
+}
+
+// replayOrder returns the order a key already produced. The original
+// checkout emptied the cart, so a retry normally arrives with an empty cart;
+// a non-empty cart must match the one the key was first used with.
+func replayOrder(stored *models.OrderIdempotencyKey, cart *models.CartSummary, requestHash string) (*models.Order, error) {
+	if len(cart.Items) > 0 && requestHash != stored.RequestHash {
+		return nil, ErrIdempotencyKeyReused
+	}
+
+	var order models.Order
+	if err := json.Unmarshal(stored.Response, &order); err != nil {
+		return nil, fmt.Errorf("failed to decode stored order: %w", err)
+	}
+	return &order, nil
+}
+
+// hashCart fingerprints what is being bought, independent of item order
+func hashCart(cart *models.CartSummary) string {
+	lines := make([]string, 0, len(cart.Items))
+	for _, item := range cart.Items {
+		lines = append(lines, fmt.Sprintf("%s:%d", item.Product.ID, item.Quantity))
+	}
+	sort.Strings(lines)
+
+	sum := sha256.Sum256([]byte(strings.Join(lines, "\n")))
+	return hex.EncodeToString(sum[:])
+}
+
 // GetOrderByID retrieves an order by ID with its items
 func (s *OrderService) GetOrderByID(ctx context.Context, orderID uuid.UUID) (*models.Order, error) {
 	order, err := s.orderRepo.GetByID(ctx, orderID)
@@ -197,9 +457,200 @@ func (s *OrderService) GetOrderByID(ctx context.Context, orderID uuid.UUID) (*mo
 	}
 
 	order.Items = items
+
+	history, err := s.orderRepo.GetStatusHistory(ctx, orderID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get order status history: %w", err)
+	}
+	order.StatusHistory = history
+
 	return order, nil
 }
 
+// CancelOrder lets the buyer cancel their own order within the cancel
+// window. Everything not already refunded is given back.
+func (s *OrderService) CancelOrder(ctx context.Context, userID, orderID uuid.UUID) (*models.Order, error) {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	order, err := s.orderRepo.GetByIDForUpdate(ctx, tx, orderID)
+	if err != nil || order.UserID != userID {
+		// Don't reveal other users' orders
+		return nil, ErrOrderNotFound
+	}
+
+	if time.Since(order.CreatedAt) > s.cancelWindow {
+		return nil, ErrCancelWindowExpired
+	}
+
+	if err := s.refund(ctx, tx, order, nil, models.OrderStatusCancelled, userID, "cancelled by buyer"); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return s.GetOrderByID(ctx, orderID)
+}
+
+// RefundOrder is the admin refund. With no items it refunds everything that
+// is left; otherwise only the given quantities of the given order items.
+func (s *OrderService) RefundOrder(ctx context.Context, adminID, orderID uuid.UUID, items []models.RefundItem, reason string) (*models.Order, error) {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	order, err := s.orderRepo.GetByIDForUpdate(ctx, tx, orderID)
+	if err != nil {
+		return nil, ErrOrderNotFound
+	}
+
+	if err := s.refund(ctx, tx, order, items, models.OrderStatusRefunded, adminID, reason); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return s.GetOrderByID(ctx, orderID)
+}
+
+// refund does the work shared by cancellation and admin refunds, inside the
+// caller's transaction with the order row already locked:
+// 1. Work out which quantities to refund (all remaining if items is empty)
+// 2. Take the items back out of the buyer's inventory
+// 3. Put the stock back on the products
+// 4. Mark the quantities refunded on the order items
+// 5. Give the coins back through the ledger
+// 6. Move the order to fullStatus, or partially_refunded if anything is left,
+// and record the change in its status history
+// 7. Once nothing is left, release any promo redemption
+func (s *OrderService) refund(
+	ctx context.Context,
+	tx pgx.Tx,
+	order *models.Order,
+	items []models.RefundItem,
+	fullStatus models.OrderStatus,
+	changedBy uuid.UUID,
+	reason string,
+) error {
+	orderItems, err := s.orderItemRepo.GetByOrderIDForUpdate(ctx, tx, order.ID)
+	if err != nil {
+		return err
+	}
+
+	byID := make(map[uuid.UUID]*models.OrderItem, len(orderItems))
+	for i := range orderItems {
+		byID[orderItems[i].ID] = &orderItems[i]
+	}
+
+	// Default to everything that hasn't been refunded yet
+	if len(items) == 0 {
+		for _, item := range orderItems {
+			if remaining := item.Quantity - item.RefundedQuantity; remaining > 0 {
+				items = append(items, models.RefundItem{OrderItemID: item.ID, Quantity: remaining})
+			}
+		}
+	}
+
+	if len(items) == 0 {
+		return ErrOrderNotRefundable
+	}
+
+	requested := map[uuid.UUID]int{}
+	for _, ri := range items {
+		item, ok := byID[ri.OrderItemID]
+		if !ok || ri.Quantity <= 0 {
+			return ErrInvalidRefundItem
+		}
+		requested[ri.OrderItemID] += ri.Quantity
+		if item.RefundedQuantity+requested[ri.OrderItemID] > item.Quantity {
+			return fmt.Errorf("%w: only %d of %s left to refund", ErrInvalidRefundItem,
+				item.Quantity-item.RefundedQuantity, item.ProductName)
+		}
+	}
+
+	refundAmount := 0
+	for itemID, quantity := range requested {
+		item := byID[itemID]
+
+		if err := s.inventoryRepo.RemoveQuantity(ctx, tx, order.UserID, item.ProductID, quantity); err != nil {
+			if strings.Contains(err.Error(), "insufficient inventory") {
+				return ErrItemsNotInInventory
+			}
+			return err
+		}
+
+		if err := s.productRepo.IncrementStockTx(ctx, tx, item.ProductID, quantity); err != nil {
+			return fmt.Errorf("failed to restore stock for %s: %w", item.ProductName, err)
+		}
+
+		if err := s.orderItemRepo.AddRefundedQuantity(ctx, tx, item.ID, quantity); err != nil {
+			return err
+		}
+
+		refundAmount += paidFor(item, item.RefundedQuantity+quantity) - paidFor(item, item.RefundedQuantity)
+		item.RefundedQuantity += quantity
+	}
+
+	if refundAmount > 0 {
+		if err := s.userRepo.AddCoins(ctx, tx, order.UserID, refundAmount, models.CoinReasonRefund, &order.ID); err != nil {
+			return fmt.Errorf("failed to refund coins: %w", err)
+		}
+	}
+
+	fullyRefunded := true
+	for _, item := range orderItems {
+		if item.RefundedQuantity < item.Quantity {
+			fullyRefunded = false
+			break
+		}
+	}
+
+	previous := order.Status
+	order.RefundedAmount += refundAmount
+	order.Status = models.OrderStatusPartiallyRefunded
+	if fullyRefunded {
+		order.Status = fullStatus
+	}
+
+	if err := s.orderRepo.UpdateRefund(ctx, tx, order); err != nil {
+		return err
+	}
+
+	// A promo code used on an order that was given back in full can be
+	// used again
+	if fullyRefunded {
+		if err := s.promotionRepo.ReleaseRedemption(ctx, tx, order.ID); err != nil {
+			return err
+		}
+	}
+
+	return s.orderRepo.AddStatusChange(ctx, tx, &models.OrderStatusChange{
+		ID:         uuid.New(),
+		OrderID:    order.ID,
+		FromStatus: &previous,
+		ToStatus:   order.Status,
+		Reason:     reason,
+		ChangedBy:  &changedBy,
+		CreatedAt:  time.Now().UTC(),
+	})
+}
+
+// paidFor is what the buyer paid for the first n units of an order item,
+// after its share of any promo discount. Refunds taken in several parts
+// add up to exactly what was paid.
+func paidFor(item *models.OrderItem, n int) int {
+	return n * (item.Subtotal - item.Discount) / item.Quantity
+}
+
 // GetUserOrders retrieves all orders for a user with their items
 func (s *OrderService) GetUserOrders(ctx context.Context, userID uuid.UUID) ([]*models.Order, error) {
 	orders, err := s.orderRepo.GetByUserID(ctx, userID)
@@ -2,24 +2,30 @@ package order
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/diorshelton/golden-market-api/internal/database"
 	"github.com/diorshelton/golden-market-api/internal/models"
+	"github.com/diorshelton/golden-market-api/internal/promotion"
 	"github.com/diorshelton/golden-market-api/internal/repository"
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/joho/godotenv"
 )
 
 type testDeps struct {
+	db            *pgxpool.Pool
 	orderService  *OrderService
 	userRepo      *repository.UserRepository
 	productRepo   *repository.ProductRepository
 	cartRepo      *repository.CartRepository
 	inventoryRepo *repository.InventoryRepository
+	promotionRepo *repository.PromotionRepository
 }
 
 func setupOrderTest(t *testing.T) *testDeps {
@@ -42,15 +48,18 @@ func setupOrderTest(t *testing.T) *testDeps {
 	inventoryRepo := repository.NewInventoryRepository(db)
 	orderRepo := repository.NewOrderRepository(db)
 	orderItemRepo := repository.NewOrderItemRepository(db)
+	promotionRepo := repository.NewPromotionRepository(db)
 
-	orderService := NewOrderService(db, orderRepo, orderItemRepo, inventoryRepo, userRepo, productRepo, cartRepo)
+	orderService := NewOrderService(db, orderRepo, orderItemRepo, inventoryRepo, userRepo, productRepo, cartRepo, promotionRepo)
 
 	return &testDeps{
+		db:            db,
 		orderService:  orderService,
 		userRepo:      userRepo,
 		productRepo:   productRepo,
 		cartRepo:      cartRepo,
 		inventoryRepo: inventoryRepo,
+		promotionRepo: promotionRepo,
 	}
 }
 
@@ -118,7 +127,7 @@ func TestCreateOrder_HappyPath(t *testing.T) {
 		t.Fatalf("failed to add to cart: %v", err)
 	}
 
-	order, err := deps.orderService.CreateOrder(ctx, user.ID)
+	order, err := deps.orderService.CreateOrder(ctx, user.ID, "", models.CheckoutExpectation{})
 	if err != nil {
 		t.Fatalf("CreateOrder returned unexpected error: %v", err)
 	}
@@ -179,7 +188,7 @@ func TestCreateOrder_InsufficientBalance(t *testing.T) {
 		t.Fatalf("failed to add to cart: %v", err)
 	}
 
-	_, err := deps.orderService.CreateOrder(ctx, user.ID)
+	_, err := deps.orderService.CreateOrder(ctx, user.ID, "", models.CheckoutExpectation{})
 	if err == nil {
 		t.Fatal("expected error for insufficient balance, got nil")
 	}
@@ -228,9 +237,13 @@ func TestCreateOrder_InsufficientStock(t *testing.T) {
 		t.Fatalf("failed to drain stock: %v", err)
 	}
 
-	_, err := deps.orderService.CreateOrder(ctx, user.ID)
-	if err == nil {
-		t.Fatal("expected error for insufficient stock, got nil")
+	_, err := deps.orderService.CreateOrder(ctx, user.ID, "", models.CheckoutExpectation{})
+	var conflict *CheckoutConflictError
+	if !errors.As(err, &conflict) {
+		t.Fatalf("expected CheckoutConflictError for insufficient stock, got %v", err)
+	}
+	if len(conflict.Changes) != 1 || conflict.Changes[0].Kind != models.CheckoutStockReduced || *conflict.Changes[0].Available != 0 {
+		t.Errorf("expected one stock_reduced change with 0 available, got %+v", conflict.Changes)
 	}
 
 	updatedUser, err := deps.userRepo.GetUserByID(user.ID)
@@ -258,16 +271,16 @@ func TestCreateOrder_EmptyCart(t *testing.T) {
 
 	user := createTestUser(t, deps, 1000)
 
-	_, err := deps.orderService.CreateOrder(ctx, user.ID)
+	_, err := deps.orderService.CreateOrder(ctx, user.ID, "", models.CheckoutExpectation{})
 	if err == nil {
 		t.Fatal("expected error for empty cart, got nil")
 	}
 }
 
-// TestCreateOrder_DuplicateIdempotency verifies that calling CreateOrder
-// again within the duplicate-detection window, for the same cart total,
-// returns the original order instead of creating a second one.
-func TestCreateOrder_DuplicateIdempotency(t *testing.T) {
+// TestCreateOrder_IdempotencyKeyReplay verifies that retrying a checkout
+// with the same Idempotency-Key returns the original order instead of
+// charging again.
+func TestCreateOrder_IdempotencyKeyReplay(t *testing.T) {
 	deps := setupOrderTest(t)
 	ctx := context.Background()
 
@@ -278,26 +291,22 @@ func TestCreateOrder_DuplicateIdempotency(t *testing.T) {
 		t.Fatalf("failed to add to cart: %v", err)
 	}
 
-	firstOrder, err := deps.orderService.CreateOrder(ctx, user.ID)
+	firstOrder, err := deps.orderService.CreateOrder(ctx, user.ID, "checkout-1", models.CheckoutExpectation{})
 	if err != nil {
 		t.Fatalf("first CreateOrder failed: %v", err)
 	}
 
-	// Re-add the same item/quantity so the cart total matches again -
-	// simulates a duplicate submit (e.g. double-click) before the cart
-	// was visibly cleared client-side.
-	if err := deps.cartRepo.AddToCart(ctx, user.ID, product.ID, 1); err != nil {
-		t.Fatalf("failed to re-add to cart: %v", err)
-	}
-
-	secondOrder, err := deps.orderService.CreateOrder(ctx, user.ID)
+	// The retry arrives after the cart was cleared by the first checkout
+	secondOrder, err := deps.orderService.CreateOrder(ctx, user.ID, "checkout-1", models.CheckoutExpectation{})
 	if err != nil {
-		t.Fatalf("second CreateOrder failed: %v", err)
+		t.Fatalf("replayed CreateOrder failed: %v", err)
 	}
 
 	if secondOrder.ID != firstOrder.ID {
-		t.Errorf("expected duplicate call to return original order %s, got new order %s",
-			firstOrder.ID, secondOrder.ID)
+		t.Errorf("expected replay to return original order %s, got %s", firstOrder.ID, secondOrder.ID)
+	}
+	if len(secondOrder.Items) != 1 {
+		t.Errorf("expected replayed order to include its items, got %d", len(secondOrder.Items))
 	}
 
 	updatedUser, err := deps.userRepo.GetUserByID(user.ID)
@@ -308,3 +317,500 @@ func TestCreateOrder_DuplicateIdempotency(t *testing.T) {
 		t.Errorf("expected balance charged only once (700), got %d", updatedUser.Balance)
 	}
 }
+
+// TestCreateOrder_SameTotalWithoutKey verifies two identical purchases
+// without a key are both placed; matching totals alone don't merge orders.
+func TestCreateOrder_SameTotalWithoutKey(t *testing.T) {
+	deps := setupOrderTest(t)
+	ctx := context.Background()
+
+	user := createTestUser(t, deps, 1000)
+	product := createTestProduct(t, deps, 300, 5)
+
+	var ids []uuid.UUID
+	for i := 0; i < 2; i++ {
+		if err := deps.cartRepo.AddToCart(ctx, user.ID, product.ID, 1); err != nil {
+			t.Fatalf("failed to add to cart: %v", err)
+		}
+		order, err := deps.orderService.CreateOrder(ctx, user.ID, "", models.CheckoutExpectation{})
+		if err != nil {
+			t.Fatalf("CreateOrder %d failed: %v", i+1, err)
+		}
+		ids = append(ids, order.ID)
+	}
+
+	if ids[0] == ids[1] {
+		t.Error("expected two distinct orders")
+	}
+
+	updatedUser, err := deps.userRepo.GetUserByID(user.ID)
+	if err != nil {
+		t.Fatalf("failed to reload user: %v", err)
+	}
+	if updatedUser.Balance != 400 {
+		t.Errorf("expected balance charged twice (400), got %d", updatedUser.Balance)
+	}
+}
+
+// TestCreateOrder_IdempotencyKeyReusedWithDifferentCart verifies a key
+// can't be reused for a different purchase.
+func TestCreateOrder_IdempotencyKeyReusedWithDifferentCart(t *testing.T) {
+	deps := setupOrderTest(t)
+	ctx := context.Background()
+
+	user := createTestUser(t, deps, 1000)
+	product := createTestProduct(t, deps, 100, 5)
+
+	if err := deps.cartRepo.AddToCart(ctx, user.ID, product.ID, 1); err != nil {
+		t.Fatalf("failed to add to cart: %v", err)
+	}
+	if _, err := deps.orderService.CreateOrder(ctx, user.ID, "checkout-1", models.CheckoutExpectation{}); err != nil {
+		t.Fatalf("first CreateOrder failed: %v", err)
+	}
+
+	if err := deps.cartRepo.AddToCart(ctx, user.ID, product.ID, 2); err != nil {
+		t.Fatalf("failed to add to cart: %v", err)
+	}
+	_, err := deps.orderService.CreateOrder(ctx, user.ID, "checkout-1", models.CheckoutExpectation{})
+	if !errors.Is(err, ErrIdempotencyKeyReused) {
+		t.Errorf("expected ErrIdempotencyKeyReused, got %v", err)
+	}
+}
+
+// TestCancelOrder_RestoresEverything verifies a buyer cancellation gives the
+// coins back, restocks the product, and empties the inventory it filled.
+func TestCancelOrder_RestoresEverything(t *testing.T) {
+	deps := setupOrderTest(t)
+	ctx := context.Background()
+
+	user := createTestUser(t, deps, 1000)
+	product := createTestProduct(t, deps, 300, 5)
+
+	if err := deps.cartRepo.AddToCart(ctx, user.ID, product.ID, 2); err != nil {
+		t.Fatalf("failed to add to cart: %v", err)
+	}
+
+	order, err := deps.orderService.CreateOrder(ctx, user.ID, "", models.CheckoutExpectation{})
+	if err != nil {
+		t.Fatalf("CreateOrder failed: %v", err)
+	}
+
+	cancelled, err := deps.orderService.CancelOrder(ctx, user.ID, order.ID)
+	if err != nil {
+		t.Fatalf("CancelOrder failed: %v", err)
+	}
+
+	if cancelled.Status != models.OrderStatusCancelled {
+		t.Errorf("expected status cancelled, got %s", cancelled.Status)
+	}
+	if cancelled.RefundedAmount != 600 {
+		t.Errorf("expected refunded amount 600, got %d", cancelled.RefundedAmount)
+	}
+	if len(cancelled.StatusHistory) != 2 {
+		t.Errorf("expected 2 status history entries, got %d", len(cancelled.StatusHistory))
+	}
+
+	updatedUser, err := deps.userRepo.GetUserByID(user.ID)
+	if err != nil {
+		t.Fatalf("failed to reload user: %v", err)
+	}
+	if updatedUser.Balance != 1000 {
+		t.Errorf("expected balance restored to 1000, got %d", updatedUser.Balance)
+	}
+
+	updatedProduct, err := deps.productRepo.GetByID(ctx, product.ID)
+	if err != nil {
+		t.Fatalf("failed to reload product: %v", err)
+	}
+	if updatedProduct.Stock != 5 {
+		t.Errorf("expected stock restored to 5, got %d", updatedProduct.Stock)
+	}
+
+	inventory, err := deps.inventoryRepo.GetByUserID(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("failed to load inventory: %v", err)
+	}
+	if len(inventory) != 0 {
+		t.Errorf("expected inventory to be emptied, got %+v", inventory)
+	}
+
+	if _, err := deps.orderService.CancelOrder(ctx, user.ID, order.ID); !errors.Is(err, ErrOrderNotRefundable) {
+		t.Errorf("expected second cancel to fail with ErrOrderNotRefundable, got %v", err)
+	}
+}
+
+// TestCancelOrder_OtherUser verifies one user can't cancel another's order
+func TestCancelOrder_OtherUser(t *testing.T) {
+	deps := setupOrderTest(t)
+	ctx := context.Background()
+
+	buyer := createTestUser(t, deps, 1000)
+	other := createTestUser(t, deps, 1000)
+	product := createTestProduct(t, deps, 100, 5)
+
+	if err := deps.cartRepo.AddToCart(ctx, buyer.ID, product.ID, 1); err != nil {
+		t.Fatalf("failed to add to cart: %v", err)
+	}
+
+	order, err := deps.orderService.CreateOrder(ctx, buyer.ID, "", models.CheckoutExpectation{})
+	if err != nil {
+		t.Fatalf("CreateOrder failed: %v", err)
+	}
+
+	if _, err := deps.orderService.CancelOrder(ctx, other.ID, order.ID); !errors.Is(err, ErrOrderNotFound) {
+		t.Errorf("expected ErrOrderNotFound, got %v", err)
+	}
+}
+
+// TestRefundOrder_Partial verifies an admin can refund part of one item and
+// the order is left partially refunded.
+func TestRefundOrder_Partial(t *testing.T) {
+	deps := setupOrderTest(t)
+	ctx := context.Background()
+
+	admin := createTestUser(t, deps, 0)
+	user := createTestUser(t, deps, 1000)
+	product := createTestProduct(t, deps, 100, 5)
+
+	if err := deps.cartRepo.AddToCart(ctx, user.ID, product.ID, 3); err != nil {
+		t.Fatalf("failed to add to cart: %v", err)
+	}
+
+	order, err := deps.orderService.CreateOrder(ctx, user.ID, "", models.CheckoutExpectation{})
+	if err != nil {
+		t.Fatalf("CreateOrder failed: %v", err)
+	}
+
+	refunded, err := deps.orderService.RefundOrder(ctx, admin.ID, order.ID, []models.RefundItem{
+		{OrderItemID: order.Items[0].ID, Quantity: 1},
+	}, "damaged in transit")
+	if err != nil {
+		t.Fatalf("RefundOrder failed: %v", err)
+	}
+
+	if refunded.Status != models.OrderStatusPartiallyRefunded {
+		t.Errorf("expected status partially_refunded, got %s", refunded.Status)
+	}
+	if refunded.Items[0].RefundedQuantity != 1 {
+		t.Errorf("expected 1 unit refunded, got %d", refunded.Items[0].RefundedQuantity)
+	}
+
+	updatedUser, err := deps.userRepo.GetUserByID(user.ID)
+	if err != nil {
+		t.Fatalf("failed to reload user: %v", err)
+	}
+	if updatedUser.Balance != 800 {
+		t.Errorf("expected balance 800 after partial refund, got %d", updatedUser.Balance)
+	}
+
+	_, err = deps.orderService.RefundOrder(ctx, admin.ID, order.ID, []models.RefundItem{
+		{OrderItemID: order.Items[0].ID, Quantity: 3},
+	}, "")
+	if !errors.Is(err, ErrInvalidRefundItem) {
+		t.Errorf("expected over-refund to fail with ErrInvalidRefundItem, got %v", err)
+	}
+}
+
+// TestCreateOrder_PriceChangedSinceCartVersion verifies a checkout against
+// an old cart version is refused with a price diff and charges nothing,
+// and that the recomputed total is what gets charged once accepted.
+func TestCreateOrder_PriceChangedSinceCartVersion(t *testing.T) {
+	deps := setupOrderTest(t)
+	ctx := context.Background()
+
+	user := createTestUser(t, deps, 1000)
+	product := createTestProduct(t, deps, 100, 5)
+
+	if err := deps.cartRepo.AddToCart(ctx, user.ID, product.ID, 2); err != nil {
+		t.Fatalf("failed to add to cart: %v", err)
+	}
+
+	seen, err := deps.cartRepo.GetCart(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("failed to load cart: %v", err)
+	}
+
+	product.Price = 150
+	if err := deps.productRepo.Update(ctx, product); err != nil {
+		t.Fatalf("failed to reprice product: %v", err)
+	}
+
+	_, err = deps.orderService.CreateOrder(ctx, user.ID, "", models.CheckoutExpectation{CartVersion: seen.Version})
+	var conflict *CheckoutConflictError
+	if !errors.As(err, &conflict) {
+		t.Fatalf("expected CheckoutConflictError, got %v", err)
+	}
+	if conflict.Total != 300 {
+		t.Errorf("expected recomputed total 300, got %d", conflict.Total)
+	}
+	if len(conflict.Changes) != 1 || conflict.Changes[0].Kind != models.CheckoutPriceChanged ||
+		*conflict.Changes[0].OldPrice != 100 || *conflict.Changes[0].NewPrice != 150 {
+		t.Fatalf("expected one price change from 100 to 150, got %+v", conflict.Changes)
+	}
+
+	updatedUser, err := deps.userRepo.GetUserByID(user.ID)
+	if err != nil {
+		t.Fatalf("failed to reload user: %v", err)
+	}
+	if updatedUser.Balance != 1000 {
+		t.Errorf("expected balance unchanged at 1000, got %d", updatedUser.Balance)
+	}
+
+	// Agreeing to the new total goes through at the new price
+	total := conflict.Total
+	order, err := deps.orderService.CreateOrder(ctx, user.ID, "", models.CheckoutExpectation{Total: &total})
+	if err != nil {
+		t.Fatalf("CreateOrder failed: %v", err)
+	}
+	if order.TotalAmount != 300 || order.Items[0].Subtotal != 300 || order.Items[0].PricePerUnit != 150 {
+		t.Errorf("expected total and subtotal 300 at 150 each, got %+v", order)
+	}
+}
+
+// TestCreateOrder_InvalidCartVersion verifies an unreadable cart version is
+// reported with the repository's sentinel.
+func TestCreateOrder_InvalidCartVersion(t *testing.T) {
+	deps := setupOrderTest(t)
+	ctx := context.Background()
+
+	user := createTestUser(t, deps, 1000)
+	product := createTestProduct(t, deps, 100, 5)
+
+	if err := deps.cartRepo.AddToCart(ctx, user.ID, product.ID, 1); err != nil {
+		t.Fatalf("failed to add to cart: %v", err)
+	}
+
+	_, err := deps.orderService.CreateOrder(ctx, user.ID, "", models.CheckoutExpectation{CartVersion: "not base64!"})
+	if !errors.Is(err, repository.ErrInvalidCartVersion) {
+		t.Fatalf("expected ErrInvalidCartVersion, got %v", err)
+	}
+}
+
+// TestCreateOrder_KeepsItemsAddedDuringCheckout verifies an item added to
+// the cart while checkout is running is neither charged nor removed.
+func TestCreateOrder_KeepsItemsAddedDuringCheckout(t *testing.T) {
+	deps := setupOrderTest(t)
+	ctx := context.Background()
+
+	user := createTestUser(t, deps, 1000)
+	ordered := createTestProduct(t, deps, 100, 5)
+	added := createTestProduct(t, deps, 200, 5)
+
+	if err := deps.cartRepo.AddToCart(ctx, user.ID, ordered.ID, 1); err != nil {
+		t.Fatalf("failed to add to cart: %v", err)
+	}
+
+	// Hold the cart item so checkout blocks while reading the cart, then
+	// add another item before letting it go
+	tx, err := deps.db.Begin(ctx)
+	if err != nil {
+		t.Fatalf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback(ctx)
+	if _, err := tx.Exec(ctx, `SELECT id FROM cart_items WHERE user_id = $1 FOR UPDATE`, user.ID); err != nil {
+		t.Fatalf("failed to lock cart: %v", err)
+	}
+
+	type result struct {
+		order *models.Order
+		err   error
+	}
+	done := make(chan result, 1)
+	go func() {
+		order, err := deps.orderService.CreateOrder(ctx, user.ID, "", models.CheckoutExpectation{})
+		done <- result{order, err}
+	}()
+
+	waitForLockWait(t, deps)
+
+	if err := deps.cartRepo.AddToCartTx(ctx, tx, user.ID, added.ID, 1, nil); err != nil {
+		t.Fatalf("failed to add to cart: %v", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		t.Fatalf("failed to commit: %v", err)
+	}
+
+	res := <-done
+	if res.err != nil {
+		t.Fatalf("CreateOrder failed: %v", res.err)
+	}
+	if res.order.TotalAmount != 100 || len(res.order.Items) != 1 || res.order.Items[0].ProductID != ordered.ID {
+		t.Errorf("expected only the original item to be ordered, got %+v", res.order)
+	}
+
+	cart, err := deps.cartRepo.GetCart(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("failed to reload cart: %v", err)
+	}
+	if len(cart.Items) != 1 || cart.Items[0].Product.ID != added.ID {
+		t.Errorf("expected the added item to stay in the cart, got %+v", cart.Items)
+	}
+}
+
+// waitForLockWait waits until some session is blocked on a row lock
+func waitForLockWait(t *testing.T, deps *testDeps) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		var waiting int
+		err := deps.db.QueryRow(context.Background(),
+			`SELECT COUNT(*) FROM pg_stat_activity WHERE wait_event_type = 'Lock' AND datname = current_database()`,
+		).Scan(&waiting)
+		if err != nil {
+			t.Fatalf("failed to check lock waits: %v", err)
+		}
+		if waiting > 0 {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("checkout never waited on the cart lock")
+}
+
+// TestCreateOrder_ExpectedTotalMismatch verifies a stale expected total is
+// refused even when nothing changed during the checkout itself.
+func TestCreateOrder_ExpectedTotalMismatch(t *testing.T) {
+	deps := setupOrderTest(t)
+	ctx := context.Background()
+
+	user := createTestUser(t, deps, 1000)
+	product := createTestProduct(t, deps, 100, 5)
+
+	if err := deps.cartRepo.AddToCart(ctx, user.ID, product.ID, 1); err != nil {
+		t.Fatalf("failed to add to cart: %v", err)
+	}
+
+	stale := models.Coins(80)
+	_, err := deps.orderService.CreateOrder(ctx, user.ID, "", models.CheckoutExpectation{Total: &stale})
+	var conflict *CheckoutConflictError
+	if !errors.As(err, &conflict) {
+		t.Fatalf("expected CheckoutConflictError, got %v", err)
+	}
+	if conflict.Total != 100 || *conflict.ExpectedTotal != 80 {
+		t.Errorf("expected total 100 against 80, got %d against %d", conflict.Total, *conflict.ExpectedTotal)
+	}
+}
+
+// TestCreateOrder_PromoRedemption verifies an applied promo code discounts
+// the order, is recorded against its limits, and that refunds give back
+// only what was paid.
+func TestCreateOrder_PromoRedemption(t *testing.T) {
+	deps := setupOrderTest(t)
+	ctx := context.Background()
+
+	admin := createTestUser(t, deps, 0)
+	user := createTestUser(t, deps, 1000)
+	product := createTestProduct(t, deps, 100, 10)
+
+	promo := &models.Promotion{
+		Code:                  "TEST" + strings.ReplaceAll(uniqueSuffix(), "_", ""),
+		DiscountType:          models.DiscountPercent,
+		DiscountValue:         10,
+		MaxRedemptionsPerUser: 1,
+		IsActive:              true,
+	}
+	if err := deps.promotionRepo.Create(ctx, promo); err != nil {
+		t.Fatalf("failed to create promotion: %v", err)
+	}
+
+	if err := deps.cartRepo.AddToCart(ctx, user.ID, product.ID, 3); err != nil {
+		t.Fatalf("failed to add to cart: %v", err)
+	}
+	if err := deps.promotionRepo.SetCartPromotion(ctx, user.ID, promo.ID); err != nil {
+		t.Fatalf("failed to apply promotion: %v", err)
+	}
+
+	total := models.Coins(270)
+	order, err := deps.orderService.CreateOrder(ctx, user.ID, "", models.CheckoutExpectation{Total: &total})
+	if err != nil {
+		t.Fatalf("CreateOrder failed: %v", err)
+	}
+	if order.TotalAmount != 270 || order.DiscountAmount != 30 || order.Items[0].Discount != 30 {
+		t.Errorf("expected total 270 with 30 off, got %+v", order)
+	}
+
+	// The code was used up for this user and taken off the cart
+	if applied, err := deps.promotionRepo.GetCartPromotion(ctx, deps.db, user.ID); err != nil || applied != nil {
+		t.Errorf("expected promo cleared from cart, got %v, %v", applied, err)
+	}
+	if err := deps.cartRepo.AddToCart(ctx, user.ID, product.ID, 1); err != nil {
+		t.Fatalf("failed to add to cart: %v", err)
+	}
+	if err := deps.promotionRepo.SetCartPromotion(ctx, user.ID, promo.ID); err != nil {
+		t.Fatalf("failed to apply promotion: %v", err)
+	}
+	if _, err := deps.orderService.CreateOrder(ctx, user.ID, "", models.CheckoutExpectation{}); !errors.Is(err, promotion.ErrNotApplicable) {
+		t.Errorf("expected second redemption to fail with ErrNotApplicable, got %v", err)
+	}
+
+	if _, err := deps.orderService.RefundOrder(ctx, admin.ID, order.ID, []models.RefundItem{
+		{OrderItemID: order.Items[0].ID, Quantity: 1},
+	}, ""); err != nil {
+		t.Fatalf("RefundOrder failed: %v", err)
+	}
+
+	updatedUser, err := deps.userRepo.GetUserByID(user.ID)
+	if err != nil {
+		t.Fatalf("failed to reload user: %v", err)
+	}
+	if updatedUser.Balance != 820 {
+		t.Errorf("expected balance 820 after refunding one discounted unit, got %d", updatedUser.Balance)
+	}
+}
+
+// TestCancelOrder_ReleasesPromoRedemption verifies a cancelled promo order
+// gives the code back, so the buyer can use it again.
+func TestCancelOrder_ReleasesPromoRedemption(t *testing.T) {
+	deps := setupOrderTest(t)
+	ctx := context.Background()
+
+	user := createTestUser(t, deps, 1000)
+	product := createTestProduct(t, deps, 100, 10)
+
+	promo := &models.Promotion{
+		Code:                  "TEST" + strings.ReplaceAll(uniqueSuffix(), "_", ""),
+		DiscountType:          models.DiscountPercent,
+		DiscountValue:         10,
+		MaxRedemptions:        1,
+		MaxRedemptionsPerUser: 1,
+		IsActive:              true,
+	}
+	if err := deps.promotionRepo.Create(ctx, promo); err != nil {
+		t.Fatalf("failed to create promotion: %v", err)
+	}
+
+	checkout := func() *models.Order {
+		t.Helper()
+		if err := deps.cartRepo.AddToCart(ctx, user.ID, product.ID, 1); err != nil {
+			t.Fatalf("failed to add to cart: %v", err)
+		}
+		if err := deps.promotionRepo.SetCartPromotion(ctx, user.ID, promo.ID); err != nil {
+			t.Fatalf("failed to apply promotion: %v", err)
+		}
+		order, err := deps.orderService.CreateOrder(ctx, user.ID, "", models.CheckoutExpectation{})
+		if err != nil {
+			t.Fatalf("CreateOrder failed: %v", err)
+		}
+		if order.DiscountAmount != 10 {
+			t.Fatalf("expected 10 off, got %d", order.DiscountAmount)
+		}
+		return order
+	}
+
+	order := checkout()
+	if _, err := deps.orderService.CancelOrder(ctx, user.ID, order.ID); err != nil {
+		t.Fatalf("CancelOrder failed: %v", err)
+	}
+
+	locked, err := deps.promotionRepo.GetByIDForUpdate(ctx, deps.db, promo.ID)
+	if err != nil {
+		t.Fatalf("failed to reload promotion: %v", err)
+	}
+	if locked.RedemptionCount != 0 {
+		t.Errorf("expected redemption count back to 0, got %d", locked.RedemptionCount)
+	}
+
+	// Both the per-user and the global limit allow it again
+	checkout()
+}
@@ -2,22 +2,30 @@ package product
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 
 	"github.com/diorshelton/golden-market-api/internal/models"
-	//"github.com/diorshelton/golden-market-api/internal/product"
 	"github.com/diorshelton/golden-market-api/internal/repository"
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+// ErrInvalidProduct wraps the reason an edit passed to Update was refused
+var ErrInvalidProduct = errors.New("invalid product")
+
 type ProductService struct {
+	db                *pgxpool.Pool
 	ProductRepository *repository.ProductRepository
+	CartRepository    *repository.CartRepository
 }
 
-func NewProductService(productRepo *repository.ProductRepository) *ProductService {
+func NewProductService(db *pgxpool.Pool, productRepo *repository.ProductRepository, cartRepo *repository.CartRepository) *ProductService {
 	return &ProductService{
+		db:                db,
 		ProductRepository: productRepo,
+		CartRepository:    cartRepo,
 	}
 }
 
@@ -32,12 +40,67 @@ func (s *ProductService) Create(product *models.Product) error {
 	return nil
 }
 
-func (s *ProductService) Update(id uuid.UUID) {
+// Update edits a non-deleted product, listed or not. edit is applied to the
+// product while its row is locked, so checkouts, cancellations and refunds
+// that change its stock meanwhile aren't overwritten. If edit refuses the
+// change, wrapping ErrInvalidProduct, the product is left unchanged.
+func (s *ProductService) Update(id uuid.UUID, edit func(*models.Product) error) (*models.Product, error) {
+	ctx := context.Background()
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	product, err := s.ProductRepository.GetByIDIncludingUnavailableForUpdate(ctx, tx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := edit(product); err != nil {
+		return nil, err
+	}
 
+	if err := s.ProductRepository.UpdateTx(ctx, tx, product); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return product, nil
 }
 
-func (s *ProductService) Delete(id uuid.UUID) {
+// Delete soft deletes a product and removes it from every open cart in the
+// same transaction, so nobody can check out an item that is gone.
+func (s *ProductService) Delete(id uuid.UUID) error {
+	ctx := context.Background()
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
 
+	if err := s.ProductRepository.SoftDeleteTx(ctx, tx, id); err != nil {
+		return err
+	}
+
+	removed, err := s.CartRepository.RemoveProductFromAllCarts(ctx, tx, id)
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	if removed > 0 {
+		log.Printf("Deleted product %s and removed it from %d cart(s)", id, removed)
+	}
+	return nil
 }
 
 func (s *ProductService) GetProduct(id uuid.UUID) (*models.Product, error) {
@@ -49,6 +112,21 @@ func (s *ProductService) GetProduct(id uuid.UUID) (*models.Product, error) {
 
 }
 
-func (s *ProductService) GetProducts() ([]*models.Product, error) {
-	return s.ProductRepository.GetAll(context.Background(), "", 0, 0)
+// GetProducts returns one page of the catalog. Out-of-range limits are
+// clamped rather than rejected.
+func (s *ProductService) GetProducts(filter models.ProductFilter) (*models.ProductPage, error) {
+	filter.Limit = models.ClampPageSize(filter.Limit)
+
+	return s.ProductRepository.GetAll(context.Background(), filter)
+}
+
+// SearchProducts ranks catalog products against q, with the same filters
+// and limit clamping as GetProducts
+func (s *ProductService) SearchProducts(q string, filter models.ProductFilter, offset int) (*models.ProductSearchPage, error) {
+	filter.Limit = models.ClampPageSize(filter.Limit)
+	if offset < 0 {
+		offset = 0
+	}
+
+	return s.ProductRepository.Search(context.Background(), q, filter, offset)
 }
@@ -0,0 +1,172 @@
+package promotion
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/diorshelton/golden-market-api/internal/models"
+	"github.com/diorshelton/golden-market-api/internal/repository"
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrNotApplicable is wrapped by every reason a promo code can't be used
+	// on a cart right now
+	ErrNotApplicable = errors.New("promo code can't be used")
+
+	ErrInvalidPromotion = errors.New("invalid promotion")
+)
+
+// codePattern is what promo codes may look like once uppercased
+var codePattern = regexp.MustCompile(`^[A-Z0-9_-]{3,50}$`)
+
+// NormalizeCode trims and uppercases a code as customers might type it
+func NormalizeCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// Discount is what a promotion takes off a cart. ByProduct splits Amount
+// across the cart items it covers, so refunds can give back what was paid.
+type Discount struct {
+	Promotion *models.Promotion
+	Amount    models.Coins
+	ByProduct map[uuid.UUID]models.Coins
+}
+
+// ApplyTo adds the discount to a cart as a discount line
+func (d *Discount) ApplyTo(cart *models.CartSummary) {
+	cart.Discounts = append(cart.Discounts, models.CartDiscount{
+		Code:        d.Promotion.Code,
+		Description: d.Promotion.Description,
+		Amount:      d.Amount,
+	})
+	cart.TotalPrice -= d.Amount
+}
+
+// Evaluate works out what p takes off the cart at now. Redemption limits
+// are checked separately by CheckLimits. Percentages round down, and a
+// fixed discount never exceeds what the covered items cost.
+func Evaluate(p *models.Promotion, cart *models.CartSummary, now time.Time) (*Discount, error) {
+	switch {
+	case !p.IsActive:
+		return nil, fmt.Errorf("%w: it is no longer active", ErrNotApplicable)
+	case p.StartsAt != nil && now.Before(*p.StartsAt):
+		return nil, fmt.Errorf("%w: it starts %s", ErrNotApplicable, p.StartsAt.UTC().Format(time.RFC3339))
+	case p.EndsAt != nil && !now.Before(*p.EndsAt):
+		return nil, fmt.Errorf("%w: it has expired", ErrNotApplicable)
+	}
+
+	var cartTotal, covered models.Coins
+	for _, item := range cart.Items {
+		cartTotal += item.Subtotal
+		if p.Covers(&item.Product) {
+			covered += item.Subtotal
+		}
+	}
+
+	if cartTotal < p.MinCartTotal {
+		return nil, fmt.Errorf("%w: spend at least %d coins", ErrNotApplicable, p.MinCartTotal)
+	}
+	if covered == 0 {
+		return nil, fmt.Errorf("%w: nothing in your cart qualifies", ErrNotApplicable)
+	}
+
+	amount := models.Coins(p.DiscountValue)
+	if p.DiscountType == models.DiscountPercent {
+		amount = covered * models.Coins(p.DiscountValue) / 100
+	}
+	amount = min(amount, covered)
+
+	// Split the discount in proportion to each covered item's subtotal,
+	// giving the rounding remainder to the last one
+	byProduct := map[uuid.UUID]models.Coins{}
+	var allocated models.Coins
+	var last uuid.UUID
+	for _, item := range cart.Items {
+		if !p.Covers(&item.Product) {
+			continue
+		}
+		share := amount * item.Subtotal / covered
+		byProduct[item.Product.ID] = share
+		allocated += share
+		last = item.Product.ID
+	}
+	byProduct[last] += amount - allocated
+
+	return &Discount{Promotion: p, Amount: amount, ByProduct: byProduct}, nil
+}
+
+// CheckLimits reports whether p has redemptions left, both overall and for
+// the user. Inside checkout, lock the promotion row first so the answer
+// holds until the redemption is recorded.
+func CheckLimits(ctx context.Context, db repository.DBTX, repo *repository.PromotionRepository, p *models.Promotion, userID uuid.UUID) error {
+	if p.MaxRedemptions > 0 && p.RedemptionCount >= p.MaxRedemptions {
+		return fmt.Errorf("%w: it has been fully redeemed", ErrNotApplicable)
+	}
+
+	if p.MaxRedemptionsPerUser > 0 {
+		used, err := repo.CountUserRedemptions(ctx, db, p.ID, userID)
+		if err != nil {
+			return err
+		}
+		if used >= p.MaxRedemptionsPerUser {
+			return fmt.Errorf("%w: you've already used it", ErrNotApplicable)
+		}
+	}
+
+	return nil
+}
+
+// PromotionService manages promotions for admins
+type PromotionService struct {
+	promotionRepo *repository.PromotionRepository
+}
+
+func NewPromotionService(promotionRepo *repository.PromotionRepository) *PromotionService {
+	return &PromotionService{promotionRepo: promotionRepo}
+}
+
+// CreatePromotion validates and stores a new promotion. Its code is
+// normalized to uppercase.
+func (s *PromotionService) CreatePromotion(ctx context.Context, p *models.Promotion) error {
+	p.Code = NormalizeCode(p.Code)
+	if err := validate(p); err != nil {
+		return err
+	}
+	return s.promotionRepo.Create(ctx, p)
+}
+
+// ListPromotions returns every promotion, newest first
+func (s *PromotionService) ListPromotions(ctx context.Context) ([]*models.Promotion, error) {
+	return s.promotionRepo.List(ctx)
+}
+
+// SetPromotionActive turns a promotion on or off. Carts it is applied to
+// stop getting the discount while it is off.
+func (s *PromotionService) SetPromotionActive(ctx context.Context, id uuid.UUID, active bool) (*models.Promotion, error) {
+	return s.promotionRepo.SetActive(ctx, id, active)
+}
+
+func validate(p *models.Promotion) error {
+	switch {
+	case !codePattern.MatchString(p.Code):
+		return fmt.Errorf("%w: code must be 3-50 letters, digits, dashes or underscores", ErrInvalidPromotion)
+	case !p.DiscountType.Valid():
+		return fmt.Errorf("%w: discount_type must be percent or fixed", ErrInvalidPromotion)
+	case p.DiscountValue <= 0:
+		return fmt.Errorf("%w: discount_value must be positive", ErrInvalidPromotion)
+	case p.DiscountType == models.DiscountPercent && p.DiscountValue > 100:
+		return fmt.Errorf("%w: a percent discount can't exceed 100", ErrInvalidPromotion)
+	case p.MinCartTotal < 0 || p.MaxRedemptions < 0 || p.MaxRedemptionsPerUser < 0:
+		return fmt.Errorf("%w: minimums and limits can't be negative", ErrInvalidPromotion)
+	case p.Category != nil && p.ProductID != nil:
+		return fmt.Errorf("%w: scope to a category or a product, not both", ErrInvalidPromotion)
+	case p.StartsAt != nil && p.EndsAt != nil && !p.EndsAt.After(*p.StartsAt):
+		return fmt.Errorf("%w: ends_at must be after starts_at", ErrInvalidPromotion)
+	}
+	return nil
+}
@@ -0,0 +1,185 @@
+package promotion
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/diorshelton/golden-market-api/internal/models"
+	"github.com/google/uuid"
+)
+
+func testCart(items ...models.CartItemDetail) *models.CartSummary {
+	cart := &models.CartSummary{Items: items}
+	for _, item := range items {
+		cart.Subtotal += item.Subtotal
+	}
+	cart.TotalPrice = cart.Subtotal
+	return cart
+}
+
+func testItem(category string, price, quantity int) models.CartItemDetail {
+	return models.CartItemDetail{
+		Product:  models.Product{ID: uuid.New(), Category: category, Price: models.Coins(price)},
+		Quantity: quantity,
+		Subtotal: models.Coins(price * quantity),
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	now := time.Now()
+	past := now.Add(-time.Hour)
+	future := now.Add(time.Hour)
+	food := "food"
+
+	tools := testItem("tools", 30, 1)
+	bread := testItem("food", 7, 3)
+	apples := testItem("food", 10, 1)
+
+	tests := []struct {
+		name       string
+		promo      models.Promotion
+		cart       *models.CartSummary
+		wantAmount models.Coins
+		wantErr    bool
+	}{
+		{
+			name:       "percent off whole cart rounds down",
+			promo:      models.Promotion{IsActive: true, DiscountType: models.DiscountPercent, DiscountValue: 15},
+			cart:       testCart(tools, bread),
+			wantAmount: 7, // 15% of 51
+		},
+		{
+			name:       "fixed discount capped at covered items",
+			promo:      models.Promotion{IsActive: true, DiscountType: models.DiscountFixed, DiscountValue: 100, Category: &food},
+			cart:       testCart(tools, bread),
+			wantAmount: 21,
+		},
+		{
+			name:       "category scope",
+			promo:      models.Promotion{IsActive: true, DiscountType: models.DiscountPercent, DiscountValue: 50, Category: &food},
+			cart:       testCart(tools, bread, apples),
+			wantAmount: 15,
+		},
+		{
+			name:       "product scope",
+			promo:      models.Promotion{IsActive: true, DiscountType: models.DiscountFixed, DiscountValue: 5, ProductID: &apples.Product.ID},
+			cart:       testCart(tools, apples),
+			wantAmount: 5,
+		},
+		{
+			name:    "nothing covered",
+			promo:   models.Promotion{IsActive: true, DiscountType: models.DiscountFixed, DiscountValue: 5, Category: &food},
+			cart:    testCart(tools),
+			wantErr: true,
+		},
+		{
+			name:       "minimum met by whole cart",
+			promo:      models.Promotion{IsActive: true, DiscountType: models.DiscountFixed, DiscountValue: 5, MinCartTotal: 40, Category: &food},
+			cart:       testCart(tools, apples),
+			wantAmount: 5,
+		},
+		{
+			name:    "minimum not met",
+			promo:   models.Promotion{IsActive: true, DiscountType: models.DiscountFixed, DiscountValue: 5, MinCartTotal: 100},
+			cart:    testCart(tools, apples),
+			wantErr: true,
+		},
+		{
+			name:    "not started",
+			promo:   models.Promotion{IsActive: true, DiscountType: models.DiscountFixed, DiscountValue: 5, StartsAt: &future},
+			cart:    testCart(tools),
+			wantErr: true,
+		},
+		{
+			name:    "expired",
+			promo:   models.Promotion{IsActive: true, DiscountType: models.DiscountFixed, DiscountValue: 5, EndsAt: &past},
+			cart:    testCart(tools),
+			wantErr: true,
+		},
+		{
+			name:    "inactive",
+			promo:   models.Promotion{DiscountType: models.DiscountFixed, DiscountValue: 5},
+			cart:    testCart(tools),
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			discount, err := Evaluate(&tt.promo, tt.cart, now)
+			if tt.wantErr {
+				if !errors.Is(err, ErrNotApplicable) {
+					t.Fatalf("expected ErrNotApplicable, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if discount.Amount != tt.wantAmount {
+				t.Errorf("amount = %d, want %d", discount.Amount, tt.wantAmount)
+			}
+
+			var allocated models.Coins
+			for _, share := range discount.ByProduct {
+				allocated += share
+			}
+			if allocated != discount.Amount {
+				t.Errorf("allocated %d across items, want %d", allocated, discount.Amount)
+			}
+		})
+	}
+}
+
+func TestDiscountApplyTo(t *testing.T) {
+	cart := testCart(testItem("food", 10, 2))
+	promo := &models.Promotion{Code: "SAVE5", DiscountType: models.DiscountFixed, DiscountValue: 5, IsActive: true}
+
+	discount, err := Evaluate(promo, cart, time.Now())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	discount.ApplyTo(cart)
+
+	if cart.Subtotal != 20 || cart.TotalPrice != 15 {
+		t.Errorf("subtotal/total = %d/%d, want 20/15", cart.Subtotal, cart.TotalPrice)
+	}
+	if len(cart.Discounts) != 1 || cart.Discounts[0].Code != "SAVE5" || cart.Discounts[0].Amount != 5 {
+		t.Errorf("unexpected discount lines: %+v", cart.Discounts)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	food := "food"
+	productID := uuid.New()
+	start := time.Now()
+	end := start.Add(-time.Minute)
+
+	tests := []struct {
+		name    string
+		promo   models.Promotion
+		wantErr bool
+	}{
+		{"valid", models.Promotion{Code: "SPRING-10", DiscountType: models.DiscountPercent, DiscountValue: 10}, false},
+		{"bad code", models.Promotion{Code: "NO SPACES", DiscountType: models.DiscountFixed, DiscountValue: 10}, true},
+		{"bad type", models.Promotion{Code: "SAVE", DiscountType: "bogo", DiscountValue: 10}, true},
+		{"zero value", models.Promotion{Code: "SAVE", DiscountType: models.DiscountFixed}, true},
+		{"over 100 percent", models.Promotion{Code: "SAVE", DiscountType: models.DiscountPercent, DiscountValue: 101}, true},
+		{"both scopes", models.Promotion{Code: "SAVE", DiscountType: models.DiscountFixed, DiscountValue: 1, Category: &food, ProductID: &productID}, true},
+		{"ends before start", models.Promotion{Code: "SAVE", DiscountType: models.DiscountFixed, DiscountValue: 1, StartsAt: &start, EndsAt: &end}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validate(&tt.promo)
+			if tt.wantErr != (err != nil) {
+				t.Errorf("validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrInvalidPromotion) {
+				t.Errorf("expected ErrInvalidPromotion, got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,162 @@
+package repository
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/diorshelton/golden-market-api/internal/models"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// apiKeyPrefix marks Golden Market keys, so they're easy to spot in code
+// and secret scanners
+const apiKeyPrefix = "gmk_"
+
+// ErrAPIKeyInvalid is returned when a key is unknown, revoked or expired
+var ErrAPIKeyInvalid = errors.New("invalid or expired API key")
+
+// APIKeyRepository handles database operations for personal API keys
+type APIKeyRepository struct {
+	db *pgxpool.Pool
+}
+
+// NewAPIKeyRepository creates a new API key repository
+func NewAPIKeyRepository(db *pgxpool.Pool) *APIKeyRepository {
+	return &APIKeyRepository{db: db}
+}
+
+const apiKeyColumns = `id, user_id, name, prefix, key_hash, scopes, expires_at, last_used_at, revoked_at, created_at`
+
+func scanAPIKey(row pgx.Row) (*models.APIKey, error) {
+	var key models.APIKey
+	err := row.Scan(
+		&key.ID,
+		&key.UserID,
+		&key.Name,
+		&key.Prefix,
+		&key.KeyHash,
+		&key.Scopes,
+		&key.ExpiresAt,
+		&key.LastUsedAt,
+		&key.RevokedAt,
+		&key.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+// CreateAPIKey mints a key and returns it with its plaintext, which is
+// never stored
+func (r *APIKeyRepository) CreateAPIKey(ctx context.Context, userID uuid.UUID, name string, scopes []string, expiresAt *time.Time) (*models.APIKey, string, error) {
+	keyBytes := make([]byte, 32)
+	if _, err := rand.Read(keyBytes); err != nil {
+		return nil, "", fmt.Errorf("failed to generate API key: %w", err)
+	}
+	plaintext := apiKeyPrefix + hex.EncodeToString(keyBytes)
+
+	key, err := scanAPIKey(r.db.QueryRow(ctx, `
+		INSERT INTO api_keys (id, user_id, name, prefix, key_hash, scopes, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING `+apiKeyColumns,
+		uuid.New(), userID, name, plaintext[:len(apiKeyPrefix)+8], hashUserToken(plaintext), scopes, expiresAt,
+	))
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to create API key: %w", err)
+	}
+
+	return key, plaintext, nil
+}
+
+// GetActiveAPIKey looks up an unrevoked, unexpired key by its plaintext
+func (r *APIKeyRepository) GetActiveAPIKey(ctx context.Context, plaintext string) (*models.APIKey, error) {
+	key, err := scanAPIKey(r.db.QueryRow(ctx, `
+		SELECT `+apiKeyColumns+`
+		FROM api_keys
+		WHERE key_hash = $1 AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > NOW())
+	`, hashUserToken(plaintext)))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrAPIKeyInvalid
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get API key: %w", err)
+	}
+	return key, nil
+}
+
+// TouchAPIKey records that a key was just used. It writes at most once a
+// minute per key, so busy scripts don't turn every request into an update.
+func (r *APIKeyRepository) TouchAPIKey(ctx context.Context, id uuid.UUID) error {
+	_, err := r.db.Exec(ctx, `
+		UPDATE api_keys
+		SET last_used_at = NOW()
+		WHERE id = $1 AND (last_used_at IS NULL OR last_used_at < NOW() - INTERVAL '1 minute')
+	`, id)
+	if err != nil {
+		return fmt.Errorf("failed to record API key use: %w", err)
+	}
+	return nil
+}
+
+// ListAPIKeys returns a user's unrevoked keys, newest first. Expired keys
+// are included so users can see why a script stopped working.
+func (r *APIKeyRepository) ListAPIKeys(ctx context.Context, userID uuid.UUID) ([]models.APIKey, error) {
+	rows, err := r.db.Query(ctx, `
+		SELECT `+apiKeyColumns+`
+		FROM api_keys
+		WHERE user_id = $1 AND revoked_at IS NULL
+		ORDER BY created_at DESC
+	`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list API keys: %w", err)
+	}
+	defer rows.Close()
+
+	keys := []models.APIKey{}
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan API key: %w", err)
+		}
+		keys = append(keys, *key)
+	}
+	return keys, rows.Err()
+}
+
+// RevokeAPIKey revokes one of a user's keys. It returns an error containing
+// "not found" when the key doesn't exist, belongs to someone else or is
+// already revoked.
+func (r *APIKeyRepository) RevokeAPIKey(ctx context.Context, userID, keyID uuid.UUID) error {
+	result, err := r.db.Exec(ctx, `
+		UPDATE api_keys
+		SET revoked_at = NOW()
+		WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL
+	`, keyID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke API key: %w", err)
+	}
+	if result.RowsAffected() == 0 {
+		return fmt.Errorf("API key not found")
+	}
+	return nil
+}
+
+// RevokeAllAPIKeys revokes every key a user holds, returning how many
+func (r *APIKeyRepository) RevokeAllAPIKeys(ctx context.Context, userID uuid.UUID) (int64, error) {
+	result, err := r.db.Exec(ctx, `
+		UPDATE api_keys
+		SET revoked_at = NOW()
+		WHERE user_id = $1 AND revoked_at IS NULL
+	`, userID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to revoke API keys: %w", err)
+	}
+	return result.RowsAffected(), nil
+}
@@ -2,6 +2,9 @@ package repository
 
 import (
 	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"time"
 
@@ -21,21 +24,28 @@ func NewCartRepository(db *pgxpool.Pool) *CartRepository {
 
 // AddToCart adds a product to the user's cart or updates quantity it if exists
 func (r *CartRepository) AddToCart(ctx context.Context, userID, productID uuid.UUID, quantity int) error {
+	return r.AddToCartTx(ctx, r.db, userID, productID, quantity, nil)
+}
+
+// AddToCartTx adds a product to the user's cart or updates its quantity
+// (within a transaction). The whole cart item is held until reservedUntil;
+// nil leaves it unheld.
+func (r *CartRepository) AddToCartTx(ctx context.Context, tx DBTX, userID, productID uuid.UUID, quantity int, reservedUntil *time.Time) error {
 	// Check if item already exists in cart
 	var existingID uuid.UUID
 	var existingQty int
 
 	query := `SELECT id, quantity FROM cart_items WHERE user_id = $1 AND product_id = $2`
-	err := r.db.QueryRow(ctx, query, userID, productID).Scan(&existingID, &existingQty)
+	err := tx.QueryRow(ctx, query, userID, productID).Scan(&existingID, &existingQty)
 
 	if err == pgx.ErrNoRows {
 		// Insert new item
 		insertQuery := `
-			INSERT INTO cart_items(id, user_id, product_id, quantity, added_at, updated_at)
-			VALUES ($1, $2, $3, $4, $5, $6)
+			INSERT INTO cart_items(id, user_id, product_id, quantity, reserved_until, added_at, updated_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)
 		`
 		now := time.Now().UTC()
-		_, err = r.db.Exec(ctx, insertQuery, uuid.New(), userID, productID, quantity, now, now)
+		_, err = tx.Exec(ctx, insertQuery, uuid.New(), userID, productID, quantity, reservedUntil, now, now)
 		if err != nil {
 			return fmt.Errorf("failed to add to cart: %w", err)
 		}
@@ -49,10 +59,10 @@ func (r *CartRepository) AddToCart(ctx context.Context, userID, productID uuid.U
 	// Updating existing item
 	updateQuery := `
 		UPDATE cart_items
-		SET quantity = quantity + $1, updated_at = $2
-		WHERE id = $3
+		SET quantity = quantity + $1, reserved_until = $2, updated_at = $3
+		WHERE id = $4
 	`
-	_, err = r.db.Exec(ctx, updateQuery, quantity, time.Now().UTC(), existingID)
+	_, err = tx.Exec(ctx, updateQuery, quantity, reservedUntil, time.Now().UTC(), existingID)
 	if err != nil {
 		return fmt.Errorf("failed to update cart quantity: %w", err)
 	}
@@ -60,18 +70,70 @@ func (r *CartRepository) AddToCart(ctx context.Context, userID, productID uuid.U
 	return nil
 }
 
+// CartQuantityTx returns how many of a product are in the user's cart
+// (within a transaction)
+func (r *CartRepository) CartQuantityTx(ctx context.Context, tx DBTX, userID, productID uuid.UUID) (int, error) {
+	var quantity int
+	query := `SELECT COALESCE(SUM(quantity), 0) FROM cart_items WHERE user_id = $1 AND product_id = $2`
+	if err := tx.QueryRow(ctx, query, userID, productID).Scan(&quantity); err != nil {
+		return 0, fmt.Errorf("failed to get cart quantity: %w", err)
+	}
+	return quantity, nil
+}
+
+// HeldByOthersTx returns how many of a product are held by unexpired
+// reservations in other users' carts (within a transaction). Lock the
+// product row first so the total can't change before it is used.
+func (r *CartRepository) HeldByOthersTx(ctx context.Context, tx DBTX, productID, userID uuid.UUID) (int, error) {
+	var held int
+	query := `
+		SELECT COALESCE(SUM(quantity), 0)
+		FROM cart_items
+		WHERE product_id = $1 AND user_id <> $2 AND reserved_until > NOW()
+	`
+	if err := tx.QueryRow(ctx, query, productID, userID).Scan(&held); err != nil {
+		return 0, fmt.Errorf("failed to get held stock: %w", err)
+	}
+	return held, nil
+}
+
+// ReleaseExpiredHolds clears reservations that have run out, returning how
+// many cart items were released. The items stay in their carts.
+func (r *CartRepository) ReleaseExpiredHolds(ctx context.Context) (int64, error) {
+	query := `UPDATE cart_items SET reserved_until = NULL WHERE reserved_until <= NOW()`
+
+	result, err := r.db.Exec(ctx, query)
+	if err != nil {
+		return 0, fmt.Errorf("failed to release expired holds: %w", err)
+	}
+
+	return result.RowsAffected(), nil
+}
+
 // GetCart retrieves all items in a user's cart and product details
 func (r *CartRepository) GetCart(ctx context.Context, userID uuid.UUID) (*models.CartSummary, error) {
+	return r.getCart(ctx, r.db, userID, "")
+}
+
+// GetCartForUpdate retrieves the user's cart like GetCart and locks its
+// items (within a transaction), so they can't change before the caller
+// commits. Items added after the read are not locked or returned.
+func (r *CartRepository) GetCartForUpdate(ctx context.Context, tx DBTX, userID uuid.UUID) (*models.CartSummary, error) {
+	return r.getCart(ctx, tx, userID, "FOR UPDATE OF ci")
+}
+
+func (r *CartRepository) getCart(ctx context.Context, q DBTX, userID uuid.UUID, lock string) (*models.CartSummary, error) {
 	query := `
 		SELECT
 			ci.id, ci.user_id, ci.product_id, ci.quantity, ci.added_at, ci.updated_at,
-			p.id, p.name, p.description, p.price, p.stock, p.image_url, p.category, p.is_available, p.last_restock, p.created_at, p.updated_at
+			CASE WHEN ci.reserved_until > NOW() THEN ci.reserved_until END,
+			p.id, p.name, p.description, p.price, p.stock, ` + availableStockColumn("p") + `, p.image_url, p.category, p.is_available, p.last_restock, p.created_at, p.updated_at
 		FROM cart_items ci
 		JOIN products p ON ci.product_id = p.id
 		WHERE ci.user_id = $1
 		ORDER BY ci.added_at DESC
-	`
-	rows, err := r.db.Query(ctx, query, userID)
+		` + lock
+	rows, err := q.Query(ctx, query, userID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get cart: %w", err)
 	}
@@ -85,6 +147,7 @@ func (r *CartRepository) GetCart(ctx context.Context, userID uuid.UUID) (*models
 		var cartItem models.CartItem
 		var product models.Product
 		var imageURL *string
+		var reservedUntil *time.Time
 
 		err := rows.Scan(
 			&cartItem.ID,
@@ -93,11 +156,13 @@ func (r *CartRepository) GetCart(ctx context.Context, userID uuid.UUID) (*models
 			&cartItem.Quantity,
 			&cartItem.AddedAt,
 			&cartItem.UpdatedAt,
+			&reservedUntil,
 			&product.ID,
 			&product.Name,
 			&product.Description,
 			&product.Price,
 			&product.Stock,
+			&product.Available,
 			&imageURL,
 			&product.Category,
 			&product.IsAvailable,
@@ -118,10 +183,11 @@ func (r *CartRepository) GetCart(ctx context.Context, userID uuid.UUID) (*models
 
 		//Build CartItemDetail with product info and subtotal
 		itemDetail := models.CartItemDetail{
-			CartItemID: cartItem.ID,
-			Product:    product,
-			Quantity:   cartItem.Quantity,
-			Subtotal:   subtotal,
+			CartItemID:    cartItem.ID,
+			Product:       product,
+			Quantity:      cartItem.Quantity,
+			Subtotal:      subtotal,
+			ReservedUntil: reservedUntil,
 		}
 		items = append(items, itemDetail)
 
@@ -136,18 +202,68 @@ func (r *CartRepository) GetCart(ctx context.Context, userID uuid.UUID) (*models
 	return &models.CartSummary{
 		Items:      items,
 		TotalItems: totalItems,
-		TotalPrice: models.Coins(totalPrice),
+		Subtotal:   totalPrice,
+		Discounts:  []models.CartDiscount{},
+		TotalPrice: totalPrice,
+		Version:    encodeCartVersion(items),
 	}, nil
 }
 
+// ErrInvalidCartVersion is returned when a cart version can't be decoded
+var ErrInvalidCartVersion = errors.New("invalid cart version")
+
+// CartVersionItem is one cart item as a cart version recorded it
+type CartVersionItem struct {
+	ProductID uuid.UUID    `json:"p"`
+	Quantity  int          `json:"q"`
+	Price     models.Coins `json:"c"`
+}
+
+// encodeCartVersion records what is in a cart and at what price. Like a
+// catalog cursor it is handed to clients as opaque base64, so checking it
+// needs no stored state.
+func encodeCartVersion(items []models.CartItemDetail) string {
+	version := make([]CartVersionItem, 0, len(items))
+	for _, item := range items {
+		version = append(version, CartVersionItem{
+			ProductID: item.Product.ID,
+			Quantity:  item.Quantity,
+			Price:     item.Product.Price,
+		})
+	}
+
+	raw, _ := json.Marshal(version)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+// DecodeCartVersion reads back a version made by GetCart
+func DecodeCartVersion(version string) ([]CartVersionItem, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(version)
+	if err != nil {
+		return nil, ErrInvalidCartVersion
+	}
+
+	var items []CartVersionItem
+	if err := json.Unmarshal(raw, &items); err != nil {
+		return nil, ErrInvalidCartVersion
+	}
+	return items, nil
+}
+
 // UpdateCartItemQuantity updated the quantity of a specific cart item
 func (r *CartRepository) UpdateCartItemQuantity(ctx context.Context, cartItemID uuid.UUID, quantity int) error {
+	return r.UpdateCartItemQuantityTx(ctx, r.db, cartItemID, quantity, nil)
+}
+
+// UpdateCartItemQuantityTx sets the quantity of a cart item and holds it
+// until reservedUntil (within a transaction). nil leaves it unheld.
+func (r *CartRepository) UpdateCartItemQuantityTx(ctx context.Context, tx DBTX, cartItemID uuid.UUID, quantity int, reservedUntil *time.Time) error {
 	query := `
 		UPDATE cart_items
-		SET quantity = $1, updated_at = $2
-		WHERE id = $3
+		SET quantity = $1, reserved_until = $2, updated_at = $3
+		WHERE id = $4
 	`
-	result, err := r.db.Exec(ctx, query, quantity, time.Now().UTC(), cartItemID)
+	result, err := tx.Exec(ctx, query, quantity, reservedUntil, time.Now().UTC(), cartItemID)
 	if err != nil {
 		return fmt.Errorf("failed to update cart item: %w", err)
 	}
@@ -174,14 +290,42 @@ func (r *CartRepository) RemoveFromCart(ctx context.Context, userID, cartItemID
 	return nil
 }
 
-// ClearCart removes all items from a user's cart (within a transaction)
-func (r *CartRepository) ClearCart(ctx context.Context, tx DBTX, userID uuid.UUID) error {
-	query := `DELETE FROM cart_items WHERE user_id = $1`
+// RemoveFromCartTx removes an item from the user's cart and returns its
+// product and quantity (within a transaction)
+func (r *CartRepository) RemoveFromCartTx(ctx context.Context, tx DBTX, userID, cartItemID uuid.UUID) (productID uuid.UUID, quantity int, err error) {
+	query := `DELETE FROM cart_items WHERE id = $1 AND user_id = $2 RETURNING product_id, quantity`
+	err = tx.QueryRow(ctx, query, cartItemID, userID).Scan(&productID, &quantity)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return uuid.Nil, 0, fmt.Errorf("cart item not found")
+	}
+	if err != nil {
+		return uuid.Nil, 0, fmt.Errorf("failed to remove from cart: %w", err)
+	}
+	return productID, quantity, nil
+}
+
+// RemoveProductsFromCart removes the given products from a user's cart
+// (within a transaction), leaving anything else in it
+func (r *CartRepository) RemoveProductsFromCart(ctx context.Context, tx DBTX, userID uuid.UUID, productIDs []uuid.UUID) error {
+	query := `DELETE FROM cart_items WHERE user_id = $1 AND product_id = ANY($2)`
 
-	_, err := tx.Exec(ctx, query, userID)
+	_, err := tx.Exec(ctx, query, userID, productIDs)
 	if err != nil {
 		return fmt.Errorf("failed to clear cart: %w", err)
 	}
 
 	return nil
 }
+
+// RemoveProductFromAllCarts drops a product from every user's cart (within a
+// transaction), returning how many cart items were removed
+func (r *CartRepository) RemoveProductFromAllCarts(ctx context.Context, tx DBTX, productID uuid.UUID) (int64, error) {
+	query := `DELETE FROM cart_items WHERE product_id = $1`
+
+	result, err := tx.Exec(ctx, query, productID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to remove product from carts: %w", err)
+	}
+
+	return result.RowsAffected(), nil
+}
@@ -0,0 +1,140 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/diorshelton/golden-market-api/internal/models"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// CoinTransactionRepository handles database operations for the coin ledger
+type CoinTransactionRepository struct {
+	db *pgxpool.Pool
+}
+
+// NewCoinTransactionRepository creates a new coin ledger repository
+func NewCoinTransactionRepository(db *pgxpool.Pool) *CoinTransactionRepository {
+	return &CoinTransactionRepository{db: db}
+}
+
+// recordCoinTransaction appends a ledger entry. It must run on the same
+// transaction as the balance update it describes.
+func recordCoinTransaction(ctx context.Context, tx DBTX, userID uuid.UUID, amount int, balanceAfter models.Coins, reason models.CoinReason, referenceID *uuid.UUID) error {
+	query := `
+		INSERT INTO coin_transactions (id, user_id, amount, balance_after, reason, reference_id, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`
+
+	_, err := tx.Exec(ctx, query,
+		uuid.New(),
+		userID,
+		amount,
+		balanceAfter,
+		reason,
+		referenceID,
+		time.Now().UTC(),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to record coin transaction: %w", err)
+	}
+
+	return nil
+}
+
+// GetByUserID retrieves a page of a user's ledger entries, newest first,
+// naming the other player on transfer entries
+func (r *CoinTransactionRepository) GetByUserID(ctx context.Context, userID uuid.UUID, limit, offset int) ([]models.CoinTransaction, error) {
+	query := `
+		SELECT ct.id, ct.user_id, ct.amount, ct.balance_after, ct.reason, ct.reference_id, u.username, ct.created_at
+		FROM coin_transactions ct
+		LEFT JOIN coin_transfers t
+			ON t.id = ct.reference_id AND ct.reason IN ('transfer_sent', 'transfer_received')
+		LEFT JOIN users u
+			ON u.id = CASE WHEN ct.reason = 'transfer_sent' THEN t.recipient_id ELSE t.sender_id END
+		WHERE ct.user_id = $1
+		ORDER BY ct.created_at DESC, ct.id DESC
+		LIMIT $2 OFFSET $3
+	`
+
+	rows, err := r.db.Query(ctx, query, userID, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query coin transactions: %w", err)
+	}
+	defer rows.Close()
+
+	var transactions []models.CoinTransaction
+	for rows.Next() {
+		var t models.CoinTransaction
+		var counterparty *string
+		err := rows.Scan(
+			&t.ID,
+			&t.UserID,
+			&t.Amount,
+			&t.BalanceAfter,
+			&t.Reason,
+			&t.ReferenceID,
+			&counterparty,
+			&t.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan coin transaction: %w", err)
+		}
+		if counterparty != nil {
+			t.Counterparty = *counterparty
+		}
+		transactions = append(transactions, t)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating coin transactions: %w", err)
+	}
+
+	return transactions, nil
+}
+
+// CountByUserID returns the total number of ledger entries for a user
+func (r *CoinTransactionRepository) CountByUserID(ctx context.Context, userID uuid.UUID) (int, error) {
+	var count int
+	err := r.db.QueryRow(ctx, `SELECT COUNT(*) FROM coin_transactions WHERE user_id = $1`, userID).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count coin transactions: %w", err)
+	}
+	return count, nil
+}
+
+// Reconcile returns every user whose balance does not equal the sum of their
+// ledger entries. An empty result means the ledger is consistent.
+func (r *CoinTransactionRepository) Reconcile(ctx context.Context) ([]models.LedgerMismatch, error) {
+	query := `
+		SELECT u.id, u.username, u.balance, COALESCE(SUM(ct.amount), 0)
+		FROM users u
+		LEFT JOIN coin_transactions ct ON ct.user_id = u.id
+		GROUP BY u.id, u.username, u.balance
+		HAVING u.balance <> COALESCE(SUM(ct.amount), 0)
+		ORDER BY u.username
+	`
+
+	rows, err := r.db.Query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reconcile ledger: %w", err)
+	}
+	defer rows.Close()
+
+	var mismatches []models.LedgerMismatch
+	for rows.Next() {
+		var m models.LedgerMismatch
+		if err := rows.Scan(&m.UserID, &m.Username, &m.Balance, &m.LedgerBalance); err != nil {
+			return nil, fmt.Errorf("failed to scan ledger mismatch: %w", err)
+		}
+		mismatches = append(mismatches, m)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating ledger mismatches: %w", err)
+	}
+
+	return mismatches, nil
+}
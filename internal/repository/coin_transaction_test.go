@@ -0,0 +1,98 @@
+package repository
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/diorshelton/golden-market-api/internal/database"
+	"github.com/diorshelton/golden-market-api/internal/models"
+	"github.com/google/uuid"
+	"github.com/joho/godotenv"
+)
+
+func TestCoinLedger(t *testing.T) {
+	_ = godotenv.Load("../../.env")
+
+	if os.Getenv("TEMP_DB_URL") == "" {
+		t.Skip("TEMP_DB_URL not set, skipping database tests")
+	}
+
+	dbConnection, err := database.SetupTestDB()
+	if err != nil {
+		t.Fatalf("Failed to set up test db: %v", err)
+	}
+	defer dbConnection.Close()
+
+	ctx := context.Background()
+	userRepo := NewUserRepository(dbConnection)
+	coinTxRepo := NewCoinTransactionRepository(dbConnection)
+
+	user, err := userRepo.CreateUser("ledger_user", "Lady", "Rainicorn", "lady@example.com", "hashed_password")
+	if err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+
+	orderID := uuid.New()
+	tx, err := dbConnection.Begin(ctx)
+	if err != nil {
+		t.Fatalf("Failed to begin transaction: %v", err)
+	}
+	if err := userRepo.DeductCoins(ctx, tx, user.ID, 300, models.CoinReasonPurchase, &orderID); err != nil {
+		t.Fatalf("DeductCoins failed: %v", err)
+	}
+	if err := userRepo.AddCoins(ctx, tx, user.ID, 50, models.CoinReasonReward, nil); err != nil {
+		t.Fatalf("AddCoins failed: %v", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		t.Fatalf("Failed to commit: %v", err)
+	}
+
+	t.Run("every movement is recorded", func(t *testing.T) {
+		entries, err := coinTxRepo.GetByUserID(ctx, user.ID, 10, 0)
+		if err != nil {
+			t.Fatalf("GetByUserID failed: %v", err)
+		}
+		if len(entries) != 3 {
+			t.Fatalf("Expected 3 ledger entries (opening, purchase, reward), got %d", len(entries))
+		}
+
+		var purchase *models.CoinTransaction
+		for i := range entries {
+			if entries[i].Reason == models.CoinReasonPurchase {
+				purchase = &entries[i]
+			}
+		}
+		if purchase == nil {
+			t.Fatal("Expected a purchase entry")
+		}
+		if purchase.Amount != -300 {
+			t.Errorf("Expected purchase amount -300, got %d", purchase.Amount)
+		}
+		if purchase.ReferenceID == nil || *purchase.ReferenceID != orderID {
+			t.Errorf("Expected purchase reference %s, got %v", orderID, purchase.ReferenceID)
+		}
+	})
+
+	t.Run("failed deduction leaves no entry", func(t *testing.T) {
+		tx, err := dbConnection.Begin(ctx)
+		if err != nil {
+			t.Fatalf("Failed to begin transaction: %v", err)
+		}
+		defer tx.Rollback(ctx)
+
+		if err := userRepo.DeductCoins(ctx, tx, user.ID, 1_000_000, models.CoinReasonPurchase, nil); err == nil {
+			t.Fatal("Expected insufficient coins error")
+		}
+	})
+
+	t.Run("ledger reconciles", func(t *testing.T) {
+		mismatches, err := coinTxRepo.Reconcile(ctx)
+		if err != nil {
+			t.Fatalf("Reconcile failed: %v", err)
+		}
+		if len(mismatches) != 0 {
+			t.Errorf("Expected no mismatches, got %+v", mismatches)
+		}
+	})
+}
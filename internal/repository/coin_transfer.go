@@ -0,0 +1,48 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/diorshelton/golden-market-api/internal/models"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// CoinTransferRepository handles database operations for coins sent
+// between players
+type CoinTransferRepository struct {
+	db *pgxpool.Pool
+}
+
+// NewCoinTransferRepository creates a new coin transfer repository
+func NewCoinTransferRepository(db *pgxpool.Pool) *CoinTransferRepository {
+	return &CoinTransferRepository{db: db}
+}
+
+// CreateTx records a transfer (within a transaction). The balance changes
+// and their ledger entries are made separately, on the same transaction.
+func (r *CoinTransferRepository) CreateTx(ctx context.Context, tx DBTX, transfer *models.CoinTransfer) error {
+	_, err := tx.Exec(ctx, `
+		INSERT INTO coin_transfers (id, sender_id, recipient_id, amount, created_at)
+		VALUES ($1, $2, $3, $4, $5)
+	`, transfer.ID, transfer.SenderID, transfer.RecipientID, transfer.Amount, transfer.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to record transfer: %w", err)
+	}
+	return nil
+}
+
+// SentSinceTx returns how many coins a user has sent since a point in time
+// (within a transaction)
+func (r *CoinTransferRepository) SentSinceTx(ctx context.Context, tx DBTX, senderID uuid.UUID, since time.Time) (int, error) {
+	var sent int
+	err := tx.QueryRow(ctx, `
+		SELECT COALESCE(SUM(amount), 0) FROM coin_transfers WHERE sender_id = $1 AND created_at > $2
+	`, senderID, since).Scan(&sent)
+	if err != nil {
+		return 0, fmt.Errorf("failed to sum sent transfers: %w", err)
+	}
+	return sent, nil
+}
@@ -37,12 +37,38 @@ func (r *InventoryRepository) AddOrUpdate(ctx context.Context, tx DBTX, userID,
 	return nil
 }
 
+// RemoveQuantity takes items back out of a user's inventory (within a
+// transaction), deleting the row once its quantity reaches zero
+func (r *InventoryRepository) RemoveQuantity(ctx context.Context, tx DBTX, userID, productID uuid.UUID, quantity int) error {
+	query := `
+		UPDATE inventory
+		SET quantity = quantity - $1, updated_at = $2
+		WHERE user_id = $3 AND product_id = $4 AND quantity >= $1
+	`
+
+	result, err := tx.Exec(ctx, query, quantity, time.Now().UTC(), userID, productID)
+	if err != nil {
+		return fmt.Errorf("failed to remove from inventory: %w", err)
+	}
+
+	if result.RowsAffected() == 0 {
+		return fmt.Errorf("insufficient inventory")
+	}
+
+	_, err = tx.Exec(ctx, `DELETE FROM inventory WHERE user_id = $1 AND product_id = $2 AND quantity = 0`, userID, productID)
+	if err != nil {
+		return fmt.Errorf("failed to clean up inventory: %w", err)
+	}
+
+	return nil
+}
+
 // GetByUserID retrieves all inventory items for a user with product details
 func (r *InventoryRepository) GetByUserID(ctx context.Context, userID uuid.UUID) ([]models.InventoryItemDetail, error) {
 	query := `
 		SELECT
 			i.user_id, i.product_id, i.quantity, i.acquired_at, i.updated_at,
-			p.id, p.name, p.description, p.price, p.stock, p.image_url, p.category, p.is_available, p.last_restock, p.created_at, p.updated_at
+			p.id, p.name, p.description, p.price, p.stock, ` + availableStockColumn("p") + `, p.image_url, p.category, p.is_available, p.last_restock, p.created_at, p.updated_at
 		FROM inventory i
 		JOIN products p ON i.product_id = p.id
 		WHERE i.user_id = $1
@@ -71,6 +97,7 @@ func (r *InventoryRepository) GetByUserID(ctx context.Context, userID uuid.UUID)
 			&item.Product.Description,
 			&item.Product.Price,
 			&item.Product.Stock,
+			&item.Product.Available,
 			&imageURL,
 			&item.Product.Category,
 			&item.Product.IsAvailable,
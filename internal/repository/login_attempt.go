@@ -0,0 +1,104 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/diorshelton/golden-market-api/internal/models"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// LoginAttemptRepository tracks failed logins for brute-force protection
+type LoginAttemptRepository struct {
+	db *pgxpool.Pool
+}
+
+// NewLoginAttemptRepository creates a new login attempt repository
+func NewLoginAttemptRepository(db *pgxpool.Pool) *LoginAttemptRepository {
+	return &LoginAttemptRepository{db: db}
+}
+
+// GetLockedUntil returns when subject may try to log in again, or the zero
+// time if it isn't locked
+func (r *LoginAttemptRepository) GetLockedUntil(ctx context.Context, scope models.LoginAttemptScope, subject string) (time.Time, error) {
+	var lockedUntil *time.Time
+	err := r.db.QueryRow(ctx, `
+		SELECT locked_until
+		FROM login_attempts
+		WHERE scope = $1 AND subject = $2 AND locked_until > NOW()
+	`, scope, subject).Scan(&lockedUntil)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to get login lockout: %w", err)
+	}
+	if lockedUntil == nil {
+		return time.Time{}, nil
+	}
+	return *lockedUntil, nil
+}
+
+// RecordLoginFailure counts a failed login and returns the number of
+// failures so far. Failures older than window are forgotten, so the count
+// starts again after a quiet period.
+func (r *LoginAttemptRepository) RecordLoginFailure(ctx context.Context, scope models.LoginAttemptScope, subject string, window time.Duration) (int, error) {
+	var failures int
+	err := r.db.QueryRow(ctx, `
+		INSERT INTO login_attempts (scope, subject, failures, last_failed_at)
+		VALUES ($1, $2, 1, NOW())
+		ON CONFLICT (scope, subject) DO UPDATE
+		SET failures = CASE
+				WHEN login_attempts.last_failed_at < NOW() - make_interval(secs => $3) THEN 1
+				ELSE login_attempts.failures + 1
+			END,
+			last_failed_at = NOW()
+		RETURNING failures
+	`, scope, subject, window.Seconds()).Scan(&failures)
+	if err != nil {
+		return 0, fmt.Errorf("failed to record login failure: %w", err)
+	}
+	return failures, nil
+}
+
+// LockLogin refuses logins for subject until the given time
+func (r *LoginAttemptRepository) LockLogin(ctx context.Context, scope models.LoginAttemptScope, subject string, until time.Time) error {
+	_, err := r.db.Exec(ctx, `
+		UPDATE login_attempts
+		SET locked_until = $3
+		WHERE scope = $1 AND subject = $2
+	`, scope, subject, until)
+	if err != nil {
+		return fmt.Errorf("failed to lock login: %w", err)
+	}
+	return nil
+}
+
+// ClearLoginFailures resets the failure count and lifts any lockout
+func (r *LoginAttemptRepository) ClearLoginFailures(ctx context.Context, scope models.LoginAttemptScope, subject string) error {
+	_, err := r.db.Exec(ctx, `
+		DELETE FROM login_attempts
+		WHERE scope = $1 AND subject = $2
+	`, scope, subject)
+	if err != nil {
+		return fmt.Errorf("failed to clear login failures: %w", err)
+	}
+	return nil
+}
+
+// DeleteStaleLoginAttempts removes counters with no failure since before
+// olderThan and no lockout still running
+func (r *LoginAttemptRepository) DeleteStaleLoginAttempts(ctx context.Context, olderThan time.Duration) (int64, error) {
+	result, err := r.db.Exec(ctx, `
+		DELETE FROM login_attempts
+		WHERE last_failed_at < NOW() - make_interval(secs => $1)
+			AND (locked_until IS NULL OR locked_until < NOW())
+	`, olderThan.Seconds())
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete stale login attempts: %w", err)
+	}
+	return result.RowsAffected(), nil
+}
@@ -2,6 +2,7 @@ package repository
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"time"
 
@@ -22,8 +23,8 @@ func NewOrderRepository(db *pgxpool.Pool) *OrderRepository {
 // Create inserts a new order into the database (within a transaction)
 func (r *OrderRepository) Create(ctx context.Context, tx DBTX, order *models.Order) error {
 	query := `
-		INSERT INTO orders (id, user_id, order_number, total_amount, status, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		INSERT INTO orders (id, user_id, order_number, total_amount, discount_amount, status, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
 	`
 
 	_, err := tx.Exec(ctx, query,
@@ -31,6 +32,7 @@ func (r *OrderRepository) Create(ctx context.Context, tx DBTX, order *models.Ord
 		order.UserID,
 		order.OrderNumber,
 		order.TotalAmount,
+		order.DiscountAmount,
 		order.Status,
 		order.CreatedAt,
 		order.UpdatedAt,
@@ -45,7 +47,7 @@ func (r *OrderRepository) Create(ctx context.Context, tx DBTX, order *models.Ord
 // GetByID retrieves an order by its ID
 func (r *OrderRepository) GetByID(ctx context.Context, orderID uuid.UUID) (*models.Order, error) {
 	query := `
-		SELECT id, user_id, order_number, total_amount, status, created_at, updated_at
+		SELECT id, user_id, order_number, total_amount, discount_amount, refunded_amount, status, created_at, updated_at
 		FROM orders
 		WHERE id = $1
 	`
@@ -56,6 +58,8 @@ func (r *OrderRepository) GetByID(ctx context.Context, orderID uuid.UUID) (*mode
 		&order.UserID,
 		&order.OrderNumber,
 		&order.TotalAmount,
+		&order.DiscountAmount,
+		&order.RefundedAmount,
 		&order.Status,
 		&order.CreatedAt,
 		&order.UpdatedAt,
@@ -74,7 +78,7 @@ func (r *OrderRepository) GetByID(ctx context.Context, orderID uuid.UUID) (*mode
 // GetByUserID retrieves all orders for a user
 func (r *OrderRepository) GetByUserID(ctx context.Context, userID uuid.UUID) ([]*models.Order, error) {
 	query := `
-		SELECT id, user_id, order_number, total_amount, status, created_at, updated_at
+		SELECT id, user_id, order_number, total_amount, discount_amount, refunded_amount, status, created_at, updated_at
 		FROM orders
 		WHERE user_id = $1
 		ORDER BY created_at DESC
@@ -94,6 +98,8 @@ func (r *OrderRepository) GetByUserID(ctx context.Context, userID uuid.UUID) ([]
 			&order.UserID,
 			&order.OrderNumber,
 			&order.TotalAmount,
+			&order.DiscountAmount,
+			&order.RefundedAmount,
 			&order.Status,
 			&order.CreatedAt,
 			&order.UpdatedAt,
@@ -111,44 +117,168 @@ func (r *OrderRepository) GetByUserID(ctx context.Context, userID uuid.UUID) ([]
 	return orders, nil
 }
 
-// GetRecentByUserID retrieves orders from the last N seconds for duplicate prevention
-func (r *OrderRepository) GetRecentByUserID(ctx context.Context, userID uuid.UUID, seconds int) ([]*models.Order, error) {
+// GetByIDForUpdate retrieves an order by ID within a transaction with row lock
+func (r *OrderRepository) GetByIDForUpdate(ctx context.Context, tx DBTX, orderID uuid.UUID) (*models.Order, error) {
 	query := `
-		SELECT id, user_id, order_number, total_amount, status, created_at, updated_at
+		SELECT id, user_id, order_number, total_amount, discount_amount, refunded_amount, status, created_at, updated_at
 		FROM orders
-		WHERE user_id = $1 AND created_at > NOW() - INTERVAL '1 second' * $2
-		ORDER BY created_at DESC
+		WHERE id = $1
+		FOR UPDATE
+	`
+
+	var order models.Order
+	err := tx.QueryRow(ctx, query, orderID).Scan(
+		&order.ID,
+		&order.UserID,
+		&order.OrderNumber,
+		&order.TotalAmount,
+		&order.DiscountAmount,
+		&order.RefundedAmount,
+		&order.Status,
+		&order.CreatedAt,
+		&order.UpdatedAt,
+	)
+
+	if err == pgx.ErrNoRows {
+		return nil, fmt.Errorf("order not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get order: %w", err)
+	}
+
+	return &order, nil
+}
+
+// UpdateRefund sets an order's status and refunded total (within a transaction)
+func (r *OrderRepository) UpdateRefund(ctx context.Context, tx DBTX, order *models.Order) error {
+	order.UpdatedAt = time.Now().UTC()
+
+	query := `
+		UPDATE orders
+		SET status = $1, refunded_amount = $2, updated_at = $3
+		WHERE id = $4
+	`
+
+	_, err := tx.Exec(ctx, query, order.Status, order.RefundedAmount, order.UpdatedAt, order.ID)
+	if err != nil {
+		return fmt.Errorf("failed to update order: %w", err)
+	}
+
+	return nil
+}
+
+// AddStatusChange appends an entry to an order's status history (within a transaction)
+func (r *OrderRepository) AddStatusChange(ctx context.Context, tx DBTX, change *models.OrderStatusChange) error {
+	query := `
+		INSERT INTO order_status_history (id, order_id, from_status, to_status, reason, changed_by, created_at)
+		VALUES ($1, $2, $3, $4, NULLIF($5, ''), $6, $7)
+	`
+
+	_, err := tx.Exec(ctx, query,
+		change.ID,
+		change.OrderID,
+		change.FromStatus,
+		change.ToStatus,
+		change.Reason,
+		change.ChangedBy,
+		change.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to record order status change: %w", err)
+	}
+
+	return nil
+}
+
+// GetStatusHistory retrieves an order's status changes, oldest first
+func (r *OrderRepository) GetStatusHistory(ctx context.Context, orderID uuid.UUID) ([]models.OrderStatusChange, error) {
+	query := `
+		SELECT id, order_id, from_status, to_status, COALESCE(reason, ''), changed_by, created_at
+		FROM order_status_history
+		WHERE order_id = $1
+		ORDER BY created_at ASC
 	`
 
-	rows, err := r.db.Query(ctx, query, userID, seconds)
+	rows, err := r.db.Query(ctx, query, orderID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to query recent orders: %w", err)
+		return nil, fmt.Errorf("failed to query order status history: %w", err)
 	}
 	defer rows.Close()
 
-	var orders []*models.Order
+	var history []models.OrderStatusChange
 	for rows.Next() {
-		var order models.Order
+		var change models.OrderStatusChange
 		err := rows.Scan(
-			&order.ID,
-			&order.UserID,
-			&order.OrderNumber,
-			&order.TotalAmount,
-			&order.Status,
-			&order.CreatedAt,
-			&order.UpdatedAt,
+			&change.ID,
+			&change.OrderID,
+			&change.FromStatus,
+			&change.ToStatus,
+			&change.Reason,
+			&change.ChangedBy,
+			&change.CreatedAt,
 		)
 		if err != nil {
-			return nil, fmt.Errorf("failed to scan order: %w", err)
+			return nil, fmt.Errorf("failed to scan order status change: %w", err)
 		}
-		orders = append(orders, &order)
+		history = append(history, change)
 	}
 
 	if err = rows.Err(); err != nil {
-		return nil, fmt.Errorf("error iterating orders: %w", err)
+		return nil, fmt.Errorf("error iterating order status history: %w", err)
 	}
 
-	return orders, nil
+	return history, nil
+}
+
+// GetIdempotencyKey looks up a stored checkout key for a user. It returns
+// nil, nil when the key has not been used.
+func (r *OrderRepository) GetIdempotencyKey(ctx context.Context, tx DBTX, userID uuid.UUID, key string) (*models.OrderIdempotencyKey, error) {
+	query := `
+		SELECT user_id, idempotency_key, request_hash, order_id, response, created_at
+		FROM order_idempotency_keys
+		WHERE user_id = $1 AND idempotency_key = $2
+	`
+
+	var k models.OrderIdempotencyKey
+	err := tx.QueryRow(ctx, query, userID, key).Scan(
+		&k.UserID,
+		&k.Key,
+		&k.RequestHash,
+		&k.OrderID,
+		&k.Response,
+		&k.CreatedAt,
+	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get idempotency key: %w", err)
+	}
+
+	return &k, nil
+}
+
+// SaveIdempotencyKey stores the key with the order it produced. It must run
+// on the checkout transaction so the key only exists if the order does.
+func (r *OrderRepository) SaveIdempotencyKey(ctx context.Context, tx DBTX, k *models.OrderIdempotencyKey) error {
+	query := `
+		INSERT INTO order_idempotency_keys (user_id, idempotency_key, request_hash, order_id, response, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`
+
+	_, err := tx.Exec(ctx, query,
+		k.UserID,
+		k.Key,
+		k.RequestHash,
+		k.OrderID,
+		k.Response,
+		k.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save idempotency key: %w", err)
+	}
+
+	return nil
 }
 
 // GetPool returns the database pool for transaction management
@@ -20,8 +20,8 @@ func NewOrderItemRepository(db *pgxpool.Pool) *OrderItemRepository {
 // Create inserts a new order item into the database (within a transaction)
 func (r *OrderItemRepository) Create(ctx context.Context, tx DBTX, item *models.OrderItem) error {
 	query := `
-		INSERT INTO order_items (id, order_id, product_id, product_name, quantity, price_per_unit, subtotal, created_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		INSERT INTO order_items (id, order_id, product_id, product_name, quantity, price_per_unit, subtotal, discount, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
 	`
 
 	_, err := tx.Exec(ctx, query,
@@ -32,6 +32,7 @@ func (r *OrderItemRepository) Create(ctx context.Context, tx DBTX, item *models.
 		item.Quantity,
 		item.PricePerUnit,
 		item.Subtotal,
+		item.Discount,
 		item.CreatedAt,
 	)
 	if err != nil {
@@ -44,13 +45,51 @@ func (r *OrderItemRepository) Create(ctx context.Context, tx DBTX, item *models.
 // GetByOrderID retrieves all items for an order
 func (r *OrderItemRepository) GetByOrderID(ctx context.Context, orderID uuid.UUID) ([]models.OrderItem, error) {
 	query := `
-		SELECT id, order_id, product_id, product_name, quantity, price_per_unit, subtotal, created_at
+		SELECT id, order_id, product_id, product_name, quantity, refunded_quantity, price_per_unit, subtotal, discount, created_at
 		FROM order_items
 		WHERE order_id = $1
 		ORDER BY created_at ASC
 	`
 
-	rows, err := r.db.Query(ctx, query, orderID)
+	return queryOrderItems(ctx, r.db, query, orderID)
+}
+
+// GetByOrderIDForUpdate retrieves all items for an order within a
+// transaction, locking them against concurrent refunds
+func (r *OrderItemRepository) GetByOrderIDForUpdate(ctx context.Context, tx DBTX, orderID uuid.UUID) ([]models.OrderItem, error) {
+	query := `
+		SELECT id, order_id, product_id, product_name, quantity, refunded_quantity, price_per_unit, subtotal, discount, created_at
+		FROM order_items
+		WHERE order_id = $1
+		ORDER BY created_at ASC
+		FOR UPDATE
+	`
+
+	return queryOrderItems(ctx, tx, query, orderID)
+}
+
+// AddRefundedQuantity marks more units of an order item as refunded (within a transaction)
+func (r *OrderItemRepository) AddRefundedQuantity(ctx context.Context, tx DBTX, itemID uuid.UUID, quantity int) error {
+	query := `
+		UPDATE order_items
+		SET refunded_quantity = refunded_quantity + $1
+		WHERE id = $2 AND refunded_quantity + $1 <= quantity
+	`
+
+	result, err := tx.Exec(ctx, query, quantity, itemID)
+	if err != nil {
+		return fmt.Errorf("failed to update refunded quantity: %w", err)
+	}
+
+	if result.RowsAffected() == 0 {
+		return fmt.Errorf("refund exceeds purchased quantity")
+	}
+
+	return nil
+}
+
+func queryOrderItems(ctx context.Context, db DBTX, query string, orderID uuid.UUID) ([]models.OrderItem, error) {
+	rows, err := db.Query(ctx, query, orderID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query order items: %w", err)
 	}
@@ -65,8 +104,10 @@ func (r *OrderItemRepository) GetByOrderID(ctx context.Context, orderID uuid.UUI
 			&item.ProductID,
 			&item.ProductName,
 			&item.Quantity,
+			&item.RefundedQuantity,
 			&item.PricePerUnit,
 			&item.Subtotal,
+			&item.Discount,
 			&item.CreatedAt,
 		)
 		if err != nil {
@@ -2,8 +2,14 @@ package repository
 
 import (
 	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"strconv"
+	"strings"
 	"time"
+	"unicode"
 
 	"github.com/diorshelton/golden-market-api/internal/models"
 	"github.com/google/uuid"
@@ -21,6 +27,22 @@ func NewProductRepository(db *pgxpool.Pool) *ProductRepository {
 	return &ProductRepository{db: db}
 }
 
+// availableStockColumn is the SQL for a product's stock less every unexpired
+// cart hold on it, never below zero. table is the name or alias the products
+// table is selected as.
+func availableStockColumn(table string) string {
+	return fmt.Sprintf(`GREATEST(%[1]s.stock - COALESCE((
+			SELECT SUM(h.quantity) FROM cart_items h
+			WHERE h.product_id = %[1]s.id AND h.reserved_until > NOW()
+		), 0), 0)`, table)
+}
+
+var productAvailableColumn = availableStockColumn("products")
+
+// ErrProductNotFound is returned when a product doesn't exist or can't be
+// seen the way it was asked for
+var ErrProductNotFound = errors.New("product not found")
+
 // Create adds a new product to the database
 func (r *ProductRepository) Create(ctx context.Context, product *models.Product) error {
 	now := time.Now().UTC()
@@ -28,6 +50,7 @@ func (r *ProductRepository) Create(ctx context.Context, product *models.Product)
 	product.CreatedAt = now
 	product.UpdatedAt = now
 	product.LastRestock = now
+	product.Available = product.Stock
 
 	query := `
 		INSERT INTO products (id, name, description, price, stock, image_url, category, last_restock, is_available, created_at, updated_at)
@@ -103,7 +126,28 @@ func (r *ProductRepository) DecrementStockTx(ctx context.Context, tx DBTX, produ
 	return nil
 }
 
-// Delete removes a product from the database
+// IncrementStockTx puts stock back on a product (within a transaction). It
+// deliberately ignores availability so refunds of unlisted products still
+// restore their stock.
+func (r *ProductRepository) IncrementStockTx(ctx context.Context, tx DBTX, productID uuid.UUID, quantity int) error {
+	query := `
+		UPDATE products
+		SET stock = stock + $1, updated_at = NOW()
+		WHERE id = $2
+	`
+	result, err := tx.Exec(ctx, query, quantity, productID)
+	if err != nil {
+		return fmt.Errorf("failed to increment stock: %w", err)
+	}
+
+	if result.RowsAffected() == 0 {
+		return ErrProductNotFound
+	}
+	return nil
+}
+
+// Delete permanently removes a product from the database. This fails for any
+// product referenced by orders, inventory, or carts; use SoftDeleteTx instead.
 func (r *ProductRepository) Delete(ctx context.Context, productID uuid.UUID) error {
 	query := `DELETE FROM products WHERE id = $1`
 	_, err := r.db.Exec(ctx, query, productID)
@@ -113,35 +157,213 @@ func (r *ProductRepository) Delete(ctx context.Context, productID uuid.UUID) err
 	return nil
 }
 
-// GetAll retrieves all products with optional filtering
-func (r *ProductRepository) GetAll(ctx context.Context, category string, minPrice, maxPrice int) ([]*models.Product, error) {
+// Update saves every editable field of an existing, non-deleted product.
+// last_restock moves forward whenever stock goes up.
+func (r *ProductRepository) Update(ctx context.Context, product *models.Product) error {
+	return r.UpdateTx(ctx, r.db, product)
+}
+
+// UpdateTx is Update within a transaction. Lock the row with
+// GetByIDIncludingUnavailableForUpdate first, or concurrent stock changes
+// are overwritten.
+func (r *ProductRepository) UpdateTx(ctx context.Context, tx DBTX, product *models.Product) error {
+	product.UpdatedAt = time.Now().UTC()
+
 	query := `
-		SELECT id, name, description, price, stock, image_url, category, is_available, last_restock, created_at, updated_at
-		FROM products
-		WHERE 1=1
+		UPDATE products
+		SET name = $1,
+			description = $2,
+			price = $3,
+			last_restock = CASE WHEN $4 > stock THEN $8 ELSE last_restock END,
+			stock = $4,
+			image_url = $5,
+			category = $6,
+			is_available = $7,
+			updated_at = $8
+		WHERE id = $9 AND deleted_at IS NULL
+		RETURNING last_restock, created_at, ` + productAvailableColumn + `
 	`
-	args := []any{}
-	paramCount := 1
 
-	if category != "" {
-		query += fmt.Sprintf(" AND category = $%d", paramCount)
-		args = append(args, category)
-		paramCount++
+	err := tx.QueryRow(
+		ctx,
+		query,
+		product.Name,
+		product.Description,
+		product.Price,
+		product.Stock,
+		product.ImageURL,
+		product.Category,
+		product.IsAvailable,
+		product.UpdatedAt,
+		product.ID,
+	).Scan(&product.LastRestock, &product.CreatedAt, &product.Available)
+
+	if err == pgx.ErrNoRows {
+		return ErrProductNotFound
 	}
+	if err != nil {
+		return fmt.Errorf("failed to update product: %w", err)
+	}
+
+	return nil
+}
 
-	if minPrice > 0 {
-		query += fmt.Sprintf(" AND price >= $%d", paramCount)
-		args = append(args, minPrice)
-		paramCount++
+// SoftDeleteTx hides a product from the catalog by marking it unavailable and
+// stamping deleted_at (within a transaction). The row is kept so existing
+// orders and inventory still resolve.
+func (r *ProductRepository) SoftDeleteTx(ctx context.Context, tx DBTX, productID uuid.UUID) error {
+	query := `
+		UPDATE products
+		SET is_available = false, deleted_at = NOW(), updated_at = NOW()
+		WHERE id = $1 AND deleted_at IS NULL
+	`
+
+	result, err := tx.Exec(ctx, query, productID)
+	if err != nil {
+		return fmt.Errorf("failed to delete product: %w", err)
 	}
 
-	if maxPrice > 0 {
-		query += fmt.Sprintf(" AND price <= $%d", paramCount)
-		args = append(args, maxPrice)
-		paramCount++
+	if result.RowsAffected() == 0 {
+		return ErrProductNotFound
 	}
 
-	query += " ORDER BY name ASC"
+	return nil
+}
+
+// ErrInvalidCursor is returned when a catalog cursor can't be decoded or
+// was issued for a different sort order
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// productSortColumns maps each sort order to its column and the type its
+// cursor value is cast back to
+var productSortColumns = map[models.ProductSort]struct {
+	column string
+	cast   string
+}{
+	models.ProductSortName:        {"name", "text"},
+	models.ProductSortPrice:       {"price", "integer"},
+	models.ProductSortNewest:      {"created_at", "timestamptz"},
+	models.ProductSortLastRestock: {"last_restock", "timestamptz"},
+}
+
+// productCursor is the position after the last product of a page. It is
+// handed to clients as opaque base64.
+type productCursor struct {
+	Sort       models.ProductSort `json:"s"`
+	Descending bool               `json:"d"`
+	Value      string             `json:"v"`
+	ID         uuid.UUID          `json:"id"`
+}
+
+func encodeProductCursor(filter models.ProductFilter, last *models.Product) string {
+	c := productCursor{Sort: filter.Sort, Descending: filter.Descending, ID: last.ID}
+	switch filter.Sort {
+	case models.ProductSortPrice:
+		c.Value = strconv.FormatInt(int64(last.Price), 10)
+	case models.ProductSortNewest:
+		c.Value = last.CreatedAt.UTC().Format(time.RFC3339Nano)
+	case models.ProductSortLastRestock:
+		c.Value = last.LastRestock.UTC().Format(time.RFC3339Nano)
+	default:
+		c.Value = last.Name
+	}
+
+	raw, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func decodeProductCursor(cursor string, filter models.ProductFilter) (*productCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	var c productCursor
+	if err := json.Unmarshal(raw, &c); err != nil {
+		return nil, ErrInvalidCursor
+	}
+	if c.Sort != filter.Sort || c.Descending != filter.Descending {
+		return nil, ErrInvalidCursor
+	}
+
+	return &c, nil
+}
+
+// productFilterConditions builds the WHERE clause shared by the catalog
+// listing and search, which only show listed products. Placeholders
+// continue numbering after args.
+func productFilterConditions(filter models.ProductFilter, args []any) (string, []any) {
+	where := " WHERE deleted_at IS NULL AND is_available = true"
+
+	if filter.Category != "" {
+		args = append(args, filter.Category)
+		where += fmt.Sprintf(" AND category = $%d", len(args))
+	}
+
+	if filter.MinPrice > 0 {
+		args = append(args, filter.MinPrice)
+		where += fmt.Sprintf(" AND price >= $%d", len(args))
+	}
+
+	if filter.MaxPrice > 0 {
+		args = append(args, filter.MaxPrice)
+		where += fmt.Sprintf(" AND price <= $%d", len(args))
+	}
+
+	if filter.InStockOnly {
+		where += " AND " + productAvailableColumn + " > 0"
+	}
+
+	return where, args
+}
+
+// GetAll retrieves one page of the catalog. Pages are keyset paginated on
+// (sort column, id), so results stay stable while products are added.
+func (r *ProductRepository) GetAll(ctx context.Context, filter models.ProductFilter) (*models.ProductPage, error) {
+	if filter.Sort == "" {
+		filter.Sort = models.ProductSortName
+	}
+	sortColumn, ok := productSortColumns[filter.Sort]
+	if !ok {
+		return nil, fmt.Errorf("invalid sort: %s", filter.Sort)
+	}
+
+	where, args := productFilterConditions(filter, nil)
+	paramCount := len(args) + 1
+
+	page := &models.ProductPage{Products: []*models.Product{}}
+
+	// Total ignores the cursor so it's the same on every page
+	if err := r.db.QueryRow(ctx, "SELECT COUNT(*) FROM products"+where, args...).Scan(&page.Total); err != nil {
+		return nil, fmt.Errorf("failed to count products: %w", err)
+	}
+
+	direction, comparison := "ASC", ">"
+	if filter.Descending {
+		direction, comparison = "DESC", "<"
+	}
+
+	if filter.Cursor != "" {
+		c, err := decodeProductCursor(filter.Cursor, filter)
+		if err != nil {
+			return nil, err
+		}
+		where += fmt.Sprintf(" AND (%s, id) %s ($%d::%s, $%d::uuid)",
+			sortColumn.column, comparison, paramCount, sortColumn.cast, paramCount+1)
+		args = append(args, c.Value, c.ID)
+		paramCount += 2
+	}
+
+	query := `
+		SELECT id, name, description, price, stock, ` + productAvailableColumn + `, image_url, category, is_available, last_restock, created_at, updated_at
+		FROM products` + where +
+		fmt.Sprintf(" ORDER BY %s %s, id %s", sortColumn.column, direction, direction)
+
+	// Fetch one extra row to learn whether there is another page
+	if filter.Limit > 0 {
+		query += fmt.Sprintf(" LIMIT $%d", paramCount)
+		args = append(args, filter.Limit+1)
+	}
 
 	rows, err := r.db.Query(ctx, query, args...)
 	if err != nil {
@@ -149,7 +371,6 @@ func (r *ProductRepository) GetAll(ctx context.Context, category string, minPric
 	}
 	defer rows.Close()
 
-	var products []*models.Product
 	for rows.Next() {
 		var product models.Product
 		var imageURL *string
@@ -160,6 +381,7 @@ func (r *ProductRepository) GetAll(ctx context.Context, category string, minPric
 			&product.Description,
 			&product.Price,
 			&product.Stock,
+			&product.Available,
 			&imageURL,
 			&product.Category,
 			&product.IsAvailable,
@@ -175,20 +397,200 @@ func (r *ProductRepository) GetAll(ctx context.Context, category string, minPric
 			product.ImageURL = *imageURL
 		}
 
-		products = append(products, &product)
+		page.Products = append(page.Products, &product)
 	}
 
 	if err = rows.Err(); err != nil {
 		return nil, fmt.Errorf("error iterating products: %w", err)
 	}
 
-	return products, nil
+	if filter.Limit > 0 && len(page.Products) > filter.Limit {
+		page.Products = page.Products[:filter.Limit]
+		page.NextCursor = encodeProductCursor(filter, page.Products[filter.Limit-1])
+	}
+
+	return page, nil
+}
+
+// ErrEmptySearchQuery is returned when a search has no searchable words
+var ErrEmptySearchQuery = errors.New("search query is required")
+
+// fuzzySearchThreshold is the minimum pg_trgm word similarity for the typo
+// fallback. The extension's 0.6 default misses single-letter typos in short
+// words, e.g. "elixer" scores 0.57 against "Elixir".
+const fuzzySearchThreshold = 0.3
+
+// searchHeadlineOptions configures ts_headline for result snippets
+const searchHeadlineOptions = "StartSel=<mark>, StopSel=</mark>, MaxWords=30, MinWords=10, MaxFragments=2"
+
+// prefixTSQuery turns free text into a tsquery that ANDs every word as a
+// prefix, so "mech key" matches "Mechanical Keyboard" while typing. Anything
+// but letters and digits is dropped so user input can't inject tsquery
+// operators.
+func prefixTSQuery(q string) string {
+	words := strings.FieldsFunc(q, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	terms := make([]string, 0, len(words))
+	for _, word := range words {
+		terms = append(terms, word+":*")
+	}
+	return strings.Join(terms, " & ")
+}
+
+// Search ranks products against q using the search_vector column, applying
+// the same filters as GetAll. If nothing matches, it retries with trigram
+// similarity on the product name to tolerate typos.
+func (r *ProductRepository) Search(ctx context.Context, q string, filter models.ProductFilter, offset int) (*models.ProductSearchPage, error) {
+	tsquery := prefixTSQuery(q)
+	if tsquery == "" {
+		return nil, ErrEmptySearchQuery
+	}
+
+	page, err := r.fullTextSearch(ctx, tsquery, filter, offset)
+	if err != nil {
+		return nil, err
+	}
+	if page.Total > 0 {
+		return page, nil
+	}
+
+	return r.fuzzySearch(ctx, strings.TrimSpace(q), filter, offset)
+}
+
+func (r *ProductRepository) fullTextSearch(ctx context.Context, tsquery string, filter models.ProductFilter, offset int) (*models.ProductSearchPage, error) {
+	where, args := productFilterConditions(filter, []any{tsquery})
+	where += " AND search_vector @@ to_tsquery('english', $1)"
+
+	page := &models.ProductSearchPage{Results: []models.ProductSearchResult{}, Limit: filter.Limit, Offset: offset}
+	if err := r.db.QueryRow(ctx, "SELECT COUNT(*) FROM products"+where, args...).Scan(&page.Total); err != nil {
+		return nil, fmt.Errorf("failed to count search results: %w", err)
+	}
+	if page.Total == 0 {
+		return page, nil
+	}
+
+	query := fmt.Sprintf(`
+		SELECT id, name, description, price, stock, `+productAvailableColumn+`, image_url, category, is_available, last_restock, created_at, updated_at,
+			ts_rank(search_vector, to_tsquery('english', $1)) AS rank,
+			ts_headline('english', name, to_tsquery('english', $1), 'StartSel=<mark>, StopSel=</mark>, HighlightAll=true'),
+			ts_headline('english', description, to_tsquery('english', $1), '%s')
+		FROM products%s
+		ORDER BY rank DESC, id
+		LIMIT $%d OFFSET $%d
+	`, searchHeadlineOptions, where, len(args)+1, len(args)+2)
+	args = append(args, filter.Limit, offset)
+
+	rows, err := r.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search products: %w", err)
+	}
+
+	page.Results, err = scanSearchResults(rows)
+	if err != nil {
+		return nil, err
+	}
+	return page, nil
+}
+
+func (r *ProductRepository) fuzzySearch(ctx context.Context, q string, filter models.ProductFilter, offset int) (*models.ProductSearchPage, error) {
+	page := &models.ProductSearchPage{Results: []models.ProductSearchResult{}, Limit: filter.Limit, Offset: offset, Fuzzy: true}
+
+	// The threshold is set per transaction so the <% operator can use the
+	// trigram index instead of scoring every row
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `SELECT set_config('pg_trgm.word_similarity_threshold', $1, true)`,
+		strconv.FormatFloat(fuzzySearchThreshold, 'f', -1, 64)); err != nil {
+		return nil, fmt.Errorf("failed to set similarity threshold: %w", err)
+	}
+
+	where, args := productFilterConditions(filter, []any{q})
+	where += " AND $1 <% name"
+
+	if err := tx.QueryRow(ctx, "SELECT COUNT(*) FROM products"+where, args...).Scan(&page.Total); err != nil {
+		return nil, fmt.Errorf("failed to count search results: %w", err)
+	}
+	if page.Total == 0 {
+		return page, nil
+	}
+
+	query := fmt.Sprintf(`
+		SELECT id, name, description, price, stock, `+productAvailableColumn+`, image_url, category, is_available, last_restock, created_at, updated_at,
+			word_similarity($1, name) AS rank, name, ''
+		FROM products%s
+		ORDER BY rank DESC, id
+		LIMIT $%d OFFSET $%d
+	`, where, len(args)+1, len(args)+2)
+	args = append(args, filter.Limit, offset)
+
+	rows, err := tx.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search products: %w", err)
+	}
+
+	page.Results, err = scanSearchResults(rows)
+	if err != nil {
+		return nil, err
+	}
+	return page, nil
+}
+
+func scanSearchResults(rows pgx.Rows) ([]models.ProductSearchResult, error) {
+	defer rows.Close()
+
+	results := []models.ProductSearchResult{}
+	for rows.Next() {
+		var product models.Product
+		var imageURL *string
+		var rank float32
+
+		result := models.ProductSearchResult{Product: &product}
+		err := rows.Scan(
+			&product.ID,
+			&product.Name,
+			&product.Description,
+			&product.Price,
+			&product.Stock,
+			&product.Available,
+			&imageURL,
+			&product.Category,
+			&product.IsAvailable,
+			&product.LastRestock,
+			&product.CreatedAt,
+			&product.UpdatedAt,
+			&rank,
+			&result.Headline,
+			&result.Snippet,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan search result: %w", err)
+		}
+
+		if imageURL != nil {
+			product.ImageURL = *imageURL
+		}
+		result.Rank = float64(rank)
+
+		results = append(results, result)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating search results: %w", err)
+	}
+
+	return results, nil
 }
 
 // GetByID retrieves a product by its ID
 func (r *ProductRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.Product, error) {
 	query := `
-		SELECT id, name, description, price, stock, image_url, category, is_available, last_restock, created_at, updated_at
+		SELECT id, name, description, price, stock, ` + productAvailableColumn + `, image_url, category, is_available, last_restock, created_at, updated_at
 		FROM products
 		WHERE id = $1 AND is_available = true
 	`
@@ -202,6 +604,59 @@ func (r *ProductRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.
 		&product.Description,
 		&product.Price,
 		&product.Stock,
+		&product.Available,
+		&imageURL,
+		&product.Category,
+		&product.IsAvailable,
+		&product.LastRestock,
+		&product.CreatedAt,
+		&product.UpdatedAt,
+	)
+
+	if err == pgx.ErrNoRows {
+		return nil, ErrProductNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get product: %w", err)
+	}
+
+	if imageURL != nil {
+		product.ImageURL = *imageURL
+	}
+
+	return &product, nil
+}
+
+// GetByIDIncludingUnavailable retrieves a product that has not been deleted,
+// whether or not it is currently listed for sale (for admin edits)
+func (r *ProductRepository) GetByIDIncludingUnavailable(ctx context.Context, id uuid.UUID) (*models.Product, error) {
+	return r.getIncludingUnavailable(ctx, r.db, id, "")
+}
+
+// GetByIDIncludingUnavailableForUpdate is GetByIDIncludingUnavailable with a
+// row lock, within a transaction, so an edit can't overwrite stock changes
+// made while it runs
+func (r *ProductRepository) GetByIDIncludingUnavailableForUpdate(ctx context.Context, tx DBTX, id uuid.UUID) (*models.Product, error) {
+	return r.getIncludingUnavailable(ctx, tx, id, "FOR UPDATE")
+}
+
+func (r *ProductRepository) getIncludingUnavailable(ctx context.Context, q DBTX, id uuid.UUID, lock string) (*models.Product, error) {
+	query := `
+		SELECT id, name, description, price, stock, ` + productAvailableColumn + `, image_url, category, is_available, last_restock, created_at, updated_at
+		FROM products
+		WHERE id = $1 AND deleted_at IS NULL
+		` + lock
+
+	var product models.Product
+	var imageURL *string
+
+	err := q.QueryRow(ctx, query, id).Scan(
+		&product.ID,
+		&product.Name,
+		&product.Description,
+		&product.Price,
+		&product.Stock,
+		&product.Available,
 		&imageURL,
 		&product.Category,
 		&product.IsAvailable,
@@ -211,7 +666,7 @@ func (r *ProductRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.
 	)
 
 	if err == pgx.ErrNoRows {
-		return nil, fmt.Errorf("product not found")
+		return nil, ErrProductNotFound
 	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to get product: %w", err)
@@ -227,7 +682,7 @@ func (r *ProductRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.
 // GetByIDForUpdate retrieves a product by ID within a transaction with row lock
 func (r *ProductRepository) GetByIDForUpdate(ctx context.Context, tx DBTX, id uuid.UUID) (*models.Product, error) {
 	query := `
-		SELECT id, name, description, price, stock, image_url, category, is_available, last_restock, created_at, updated_at
+		SELECT id, name, description, price, stock, ` + productAvailableColumn + `, image_url, category, is_available, last_restock, created_at, updated_at
 		FROM products
 		WHERE id = $1 AND is_available = true
 		FOR UPDATE
@@ -242,6 +697,7 @@ func (r *ProductRepository) GetByIDForUpdate(ctx context.Context, tx DBTX, id uu
 		&product.Description,
 		&product.Price,
 		&product.Stock,
+		&product.Available,
 		&imageURL,
 		&product.Category,
 		&product.IsAvailable,
@@ -251,7 +707,7 @@ func (r *ProductRepository) GetByIDForUpdate(ctx context.Context, tx DBTX, id uu
 	)
 
 	if err == pgx.ErrNoRows {
-		return nil, fmt.Errorf("product not found")
+		return nil, ErrProductNotFound
 	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to get product: %w", err)
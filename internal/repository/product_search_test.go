@@ -0,0 +1,25 @@
+package repository
+
+import "testing"
+
+func TestPrefixTSQuery(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{name: "single word", input: "elixir", expected: "elixir:*"},
+		{name: "partial words", input: "mech key", expected: "mech:* & key:*"},
+		{name: "operators stripped", input: "sword & !shield | (bow)", expected: "sword:* & shield:* & bow:*"},
+		{name: "quotes stripped", input: "o'brien's", expected: "o:* & brien:* & s:*"},
+		{name: "nothing searchable", input: " !&| ", expected: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := prefixTSQuery(tt.input); got != tt.expected {
+				t.Errorf("prefixTSQuery(%q) = %q, want %q", tt.input, got, tt.expected)
+			}
+		})
+	}
+}
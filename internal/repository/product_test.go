@@ -2,7 +2,10 @@ package repository
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"os"
+	"strings"
 	"testing"
 
 	"github.com/diorshelton/golden-market-api/internal/database"
@@ -80,6 +83,161 @@ func TestProductRepository(t *testing.T) {
 		}
 
 	})
+
+	t.Run("Soft delete hides product but keeps the row", func(t *testing.T) {
+		ctx := context.Background()
+		mouse := productCreator(products[4])
+		mouse.IsAvailable = true
+
+		if err := productRepo.Create(ctx, mouse); err != nil {
+			t.Fatalf("Failed to create product: %v", err)
+		}
+
+		if err := productRepo.SoftDeleteTx(ctx, dbConnection, mouse.ID); err != nil {
+			t.Fatalf("SoftDeleteTx failed: %v", err)
+		}
+
+		if _, err := productRepo.GetByID(ctx, mouse.ID); err == nil {
+			t.Error("Expected deleted product to be hidden from GetByID")
+		}
+
+		all, err := productRepo.GetAll(ctx, models.ProductFilter{})
+		if err != nil {
+			t.Fatalf("GetAll failed: %v", err)
+		}
+		for _, p := range all.Products {
+			if p.ID == mouse.ID {
+				t.Error("Expected deleted product to be excluded from GetAll")
+			}
+		}
+
+		var deleted bool
+		err = dbConnection.QueryRow(ctx, `SELECT deleted_at IS NOT NULL FROM products WHERE id = $1`, mouse.ID).Scan(&deleted)
+		if err != nil || !deleted {
+			t.Errorf("Expected row to remain with deleted_at set, got deleted=%v err=%v", deleted, err)
+		}
+
+		if err := productRepo.SoftDeleteTx(ctx, dbConnection, mouse.ID); err == nil {
+			t.Error("Expected deleting an already deleted product to fail")
+		}
+	})
+
+	t.Run("Keyset pagination walks every product once", func(t *testing.T) {
+		ctx := context.Background()
+		category := "paging-" + uuid.NewString()
+
+		for i, price := range []int{300, 100, 200, 100, 500} {
+			p := productCreator(ProductData{Name: fmt.Sprintf("Paged %d", i), Description: "paging", Price: price})
+			p.Category = category
+			p.Stock = i // the first product is out of stock
+			if err := productRepo.Create(ctx, p); err != nil {
+				t.Fatalf("Failed to create product: %v", err)
+			}
+		}
+
+		// An unlisted product never shows up, even with stock
+		unlisted := productCreator(ProductData{Name: "Unlisted", Description: "paging", Price: 100})
+		unlisted.Category = category
+		unlisted.IsAvailable = false
+		if err := productRepo.Create(ctx, unlisted); err != nil {
+			t.Fatalf("Failed to create product: %v", err)
+		}
+
+		filter := models.ProductFilter{Category: category, Sort: models.ProductSortPrice, Limit: 2}
+		var prices []models.Coins
+		seen := map[uuid.UUID]bool{}
+		for pages := 0; ; pages++ {
+			if pages > 5 {
+				t.Fatal("Pagination did not terminate")
+			}
+			page, err := productRepo.GetAll(ctx, filter)
+			if err != nil {
+				t.Fatalf("GetAll failed: %v", err)
+			}
+			if page.Total != 5 {
+				t.Errorf("Expected total 5, got %d", page.Total)
+			}
+			for _, p := range page.Products {
+				if seen[p.ID] {
+					t.Errorf("Product %s returned twice", p.ID)
+				}
+				seen[p.ID] = true
+				prices = append(prices, p.Price)
+			}
+			if page.NextCursor == "" {
+				break
+			}
+			filter.Cursor = page.NextCursor
+		}
+
+		want := []models.Coins{100, 100, 200, 300, 500}
+		if fmt.Sprint(prices) != fmt.Sprint(want) {
+			t.Errorf("Expected prices %v, got %v", want, prices)
+		}
+
+		inStock, err := productRepo.GetAll(ctx, models.ProductFilter{Category: category, InStockOnly: true})
+		if err != nil {
+			t.Fatalf("GetAll failed: %v", err)
+		}
+		if inStock.Total != 4 {
+			t.Errorf("Expected 4 in-stock products, got %d", inStock.Total)
+		}
+
+		if _, err := productRepo.GetAll(ctx, models.ProductFilter{Category: category, Sort: models.ProductSortName, Cursor: filter.Cursor}); !errors.Is(err, ErrInvalidCursor) {
+			t.Errorf("Expected cursor from another sort to be rejected, got %v", err)
+		}
+	})
+
+	t.Run("Search ranks matches and falls back to trigrams for typos", func(t *testing.T) {
+		ctx := context.Background()
+		category := "search-" + uuid.NewString()
+
+		for _, d := range []ProductData{
+			{Name: "Elixir of Vigor", Description: "A bubbling potion that restores stamina.", Price: 150},
+			{Name: "Iron Sword", Description: "A sturdy blade. Pairs well with an elixir.", Price: 400},
+			{Name: "Elixir of Ruin", Description: "Unlisted.", Price: 200},
+		} {
+			p := productCreator(d)
+			p.Category = category
+			p.IsAvailable = d.Name != "Elixir of Ruin"
+			if err := productRepo.Create(ctx, p); err != nil {
+				t.Fatalf("Failed to create product: %v", err)
+			}
+		}
+
+		filter := models.ProductFilter{Category: category, Limit: 10}
+
+		page, err := productRepo.Search(ctx, "elix", filter, 0)
+		if err != nil {
+			t.Fatalf("Search failed: %v", err)
+		}
+		if page.Fuzzy || page.Total != 2 {
+			t.Fatalf("Expected 2 full-text matches, got total=%d fuzzy=%v", page.Total, page.Fuzzy)
+		}
+		if page.Results[0].Name != "Elixir of Vigor" {
+			t.Errorf("Expected name match to rank first, got %q", page.Results[0].Name)
+		}
+		if !strings.Contains(page.Results[0].Headline, "<mark>Elixir</mark>") {
+			t.Errorf("Expected highlighted headline, got %q", page.Results[0].Headline)
+		}
+
+		fuzzy, err := productRepo.Search(ctx, "elixer", filter, 0)
+		if err != nil {
+			t.Fatalf("Fuzzy search failed: %v", err)
+		}
+		if !fuzzy.Fuzzy || len(fuzzy.Results) == 0 || fuzzy.Results[0].Name != "Elixir of Vigor" {
+			t.Errorf("Expected typo to fall back to Elixir of Vigor, got %+v", fuzzy)
+		}
+
+		filter.MaxPrice = 100
+		none, err := productRepo.Search(ctx, "elixir", filter, 0)
+		if err != nil {
+			t.Fatalf("Filtered search failed: %v", err)
+		}
+		if none.Total != 0 {
+			t.Errorf("Expected price filter to exclude every match, got %d", none.Total)
+		}
+	})
 }
 
 func productCreator(d ProductData) *models.Product {
@@ -89,6 +247,7 @@ func productCreator(d ProductData) *models.Product {
 	product.Description = d.Description
 	product.Price = models.Coins(d.Price)
 	product.Stock = d.Price
+	product.IsAvailable = true
 
 	return &product
 }
@@ -0,0 +1,264 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/diorshelton/golden-market-api/internal/models"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var (
+	ErrPromotionNotFound  = errors.New("promo code not found")
+	ErrPromotionCodeTaken = errors.New("promo code already exists")
+	ErrPromotionExhausted = errors.New("promo code has been fully redeemed")
+)
+
+// PromotionRepository handles database operations for promo codes, their
+// redemptions and the code applied to each cart
+type PromotionRepository struct {
+	db *pgxpool.Pool
+}
+
+// NewPromotionRepository creates a new promotion repository
+func NewPromotionRepository(db *pgxpool.Pool) *PromotionRepository {
+	return &PromotionRepository{db: db}
+}
+
+const promotionColumns = `id, code, description, discount_type, discount_value, min_cart_total, category, product_id,
+	max_redemptions, max_redemptions_per_user, redemption_count, starts_at, ends_at, is_active, created_at, updated_at`
+
+func scanPromotion(row pgx.Row) (*models.Promotion, error) {
+	var p models.Promotion
+	err := row.Scan(
+		&p.ID,
+		&p.Code,
+		&p.Description,
+		&p.DiscountType,
+		&p.DiscountValue,
+		&p.MinCartTotal,
+		&p.Category,
+		&p.ProductID,
+		&p.MaxRedemptions,
+		&p.MaxRedemptionsPerUser,
+		&p.RedemptionCount,
+		&p.StartsAt,
+		&p.EndsAt,
+		&p.IsActive,
+		&p.CreatedAt,
+		&p.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// Create adds a promotion. It returns ErrPromotionCodeTaken if another
+// promotion has the same code, ignoring case.
+func (r *PromotionRepository) Create(ctx context.Context, p *models.Promotion) error {
+	now := time.Now().UTC()
+	p.ID = uuid.New()
+	p.CreatedAt = now
+	p.UpdatedAt = now
+
+	_, err := r.db.Exec(ctx, `
+		INSERT INTO promotions (id, code, description, discount_type, discount_value, min_cart_total, category, product_id,
+			max_redemptions, max_redemptions_per_user, starts_at, ends_at, is_active, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)
+	`,
+		p.ID, p.Code, p.Description, p.DiscountType, p.DiscountValue, p.MinCartTotal, p.Category, p.ProductID,
+		p.MaxRedemptions, p.MaxRedemptionsPerUser, p.StartsAt, p.EndsAt, p.IsActive, p.CreatedAt, p.UpdatedAt,
+	)
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation {
+		return ErrPromotionCodeTaken
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create promotion: %w", err)
+	}
+
+	return nil
+}
+
+// List returns every promotion, newest first
+func (r *PromotionRepository) List(ctx context.Context) ([]*models.Promotion, error) {
+	rows, err := r.db.Query(ctx, `SELECT `+promotionColumns+` FROM promotions ORDER BY created_at DESC`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query promotions: %w", err)
+	}
+	defer rows.Close()
+
+	promotions := []*models.Promotion{}
+	for rows.Next() {
+		p, err := scanPromotion(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan promotion: %w", err)
+		}
+		promotions = append(promotions, p)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating promotions: %w", err)
+	}
+
+	return promotions, nil
+}
+
+// GetByCode looks up a promotion by code, ignoring case
+func (r *PromotionRepository) GetByCode(ctx context.Context, code string) (*models.Promotion, error) {
+	p, err := scanPromotion(r.db.QueryRow(ctx,
+		`SELECT `+promotionColumns+` FROM promotions WHERE upper(code) = upper($1)`, code))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrPromotionNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get promotion: %w", err)
+	}
+	return p, nil
+}
+
+// GetByIDForUpdate retrieves a promotion within a transaction with row
+// lock, serializing checkouts that redeem it
+func (r *PromotionRepository) GetByIDForUpdate(ctx context.Context, tx DBTX, id uuid.UUID) (*models.Promotion, error) {
+	p, err := scanPromotion(tx.QueryRow(ctx,
+		`SELECT `+promotionColumns+` FROM promotions WHERE id = $1 FOR UPDATE`, id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrPromotionNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get promotion: %w", err)
+	}
+	return p, nil
+}
+
+// SetActive turns a promotion on or off
+func (r *PromotionRepository) SetActive(ctx context.Context, id uuid.UUID, active bool) (*models.Promotion, error) {
+	p, err := scanPromotion(r.db.QueryRow(ctx, `
+		UPDATE promotions
+		SET is_active = $2, updated_at = NOW()
+		WHERE id = $1
+		RETURNING `+promotionColumns,
+		id, active,
+	))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrPromotionNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to update promotion: %w", err)
+	}
+	return p, nil
+}
+
+// CountUserRedemptions returns how many times a user has redeemed a
+// promotion (within a transaction)
+func (r *PromotionRepository) CountUserRedemptions(ctx context.Context, tx DBTX, promotionID, userID uuid.UUID) (int, error) {
+	var count int
+	err := tx.QueryRow(ctx, `
+		SELECT COUNT(*) FROM promotion_redemptions WHERE promotion_id = $1 AND user_id = $2
+	`, promotionID, userID).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count redemptions: %w", err)
+	}
+	return count, nil
+}
+
+// RecordRedemption stores a redemption and counts it against the
+// promotion's global limit (within a transaction). It returns
+// ErrPromotionExhausted if the limit has already been reached.
+func (r *PromotionRepository) RecordRedemption(ctx context.Context, tx DBTX, redemption *models.PromotionRedemption) error {
+	result, err := tx.Exec(ctx, `
+		UPDATE promotions
+		SET redemption_count = redemption_count + 1, updated_at = NOW()
+		WHERE id = $1 AND (max_redemptions = 0 OR redemption_count < max_redemptions)
+	`, redemption.PromotionID)
+	if err != nil {
+		return fmt.Errorf("failed to count redemption: %w", err)
+	}
+	if result.RowsAffected() == 0 {
+		return ErrPromotionExhausted
+	}
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO promotion_redemptions (id, promotion_id, user_id, order_id, discount, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`, redemption.ID, redemption.PromotionID, redemption.UserID, redemption.OrderID, redemption.Discount, redemption.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to record redemption: %w", err)
+	}
+
+	return nil
+}
+
+// ReleaseRedemption undoes an order's redemption, if it had one, so the
+// code can be used again (within a transaction). It is for orders that were
+// cancelled or refunded in full.
+func (r *PromotionRepository) ReleaseRedemption(ctx context.Context, tx DBTX, orderID uuid.UUID) error {
+	var promotionID uuid.UUID
+	err := tx.QueryRow(ctx, `
+		DELETE FROM promotion_redemptions WHERE order_id = $1 RETURNING promotion_id
+	`, orderID).Scan(&promotionID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to release redemption: %w", err)
+	}
+
+	_, err = tx.Exec(ctx, `
+		UPDATE promotions
+		SET redemption_count = redemption_count - 1, updated_at = NOW()
+		WHERE id = $1 AND redemption_count > 0
+	`, promotionID)
+	if err != nil {
+		return fmt.Errorf("failed to uncount redemption: %w", err)
+	}
+
+	return nil
+}
+
+// SetCartPromotion applies a promotion to a user's cart, replacing any
+// code applied before
+func (r *PromotionRepository) SetCartPromotion(ctx context.Context, userID, promotionID uuid.UUID) error {
+	_, err := r.db.Exec(ctx, `
+		INSERT INTO cart_promotions (user_id, promotion_id, applied_at)
+		VALUES ($1, $2, NOW())
+		ON CONFLICT (user_id) DO UPDATE SET promotion_id = EXCLUDED.promotion_id, applied_at = EXCLUDED.applied_at
+	`, userID, promotionID)
+	if err != nil {
+		return fmt.Errorf("failed to apply promotion: %w", err)
+	}
+	return nil
+}
+
+// GetCartPromotion returns the promotion applied to a user's cart, or nil
+// if there is none
+func (r *PromotionRepository) GetCartPromotion(ctx context.Context, tx DBTX, userID uuid.UUID) (*models.Promotion, error) {
+	p, err := scanPromotion(tx.QueryRow(ctx, `
+		SELECT `+promotionColumns+`
+		FROM promotions
+		WHERE id = (SELECT promotion_id FROM cart_promotions WHERE user_id = $1)
+	`, userID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get cart promotion: %w", err)
+	}
+	return p, nil
+}
+
+// ClearCartPromotion removes the code applied to a user's cart (within a
+// transaction)
+func (r *PromotionRepository) ClearCartPromotion(ctx context.Context, tx DBTX, userID uuid.UUID) error {
+	if _, err := tx.Exec(ctx, `DELETE FROM cart_promotions WHERE user_id = $1`, userID); err != nil {
+		return fmt.Errorf("failed to remove cart promotion: %w", err)
+	}
+	return nil
+}
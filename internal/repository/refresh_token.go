@@ -4,7 +4,10 @@ import (
 	"context"
 	"crypto/rand"
 	"encoding/hex"
+	"errors"
+	"fmt"
 	"time"
+	"unicode/utf8"
 
 	"github.com/diorshelton/golden-market-api/internal/models"
 	"github.com/google/uuid"
@@ -20,54 +23,133 @@ func NewRefreshTokenRepository(db *pgxpool.Pool) *RefreshTokenRepository {
 	return &RefreshTokenRepository{db: db}
 }
 
-// CreateRefreshToken creates a new refresh token for a user with secure random token
-func (r *RefreshTokenRepository) CreateRefreshToken(userID uuid.UUID, ttl time.Duration) (*models.RefreshToken, error) {
+// ErrRefreshTokenReused is returned when a token is rotated after it was
+// already used or revoked
+var ErrRefreshTokenReused = errors.New("refresh token already used")
+
+// CreateRefreshToken creates a new refresh token for a user with secure
+// random token. Each call starts a new token family, i.e. a new session.
+func (r *RefreshTokenRepository) CreateRefreshToken(userID uuid.UUID, ttl time.Duration, client models.ClientInfo) (*models.RefreshToken, error) {
+	tokenID := uuid.New()
+
+	token, err := newRefreshToken(tokenID, userID, tokenID, ttl, client)
+	if err != nil {
+		return nil, err
+	}
+	token.SessionStartedAt = token.CreatedAt
+
+	if err := insertRefreshToken(context.Background(), r.db, token); err != nil {
+		return nil, err
+	}
+
+	return token, nil
+}
+
+// RotateRefreshToken marks old as used and issues its successor in the same
+// family, atomically. The successor records client as the device last seen
+// for the session. If old was already used or revoked, nothing is issued and
+// ErrRefreshTokenReused is returned.
+func (r *RefreshTokenRepository) RotateRefreshToken(ctx context.Context, old *models.RefreshToken, ttl time.Duration, client models.ClientInfo) (*models.RefreshToken, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin rotation transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// The used_at check makes concurrent rotations of one token race safely:
+	// only one of them can win
+	result, err := tx.Exec(ctx, `
+		UPDATE refresh_tokens
+		SET used_at = NOW()
+		WHERE id = $1 AND used_at IS NULL AND revoked = false
+	`, old.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to mark refresh token used: %w", err)
+	}
+	if result.RowsAffected() == 0 {
+		return nil, ErrRefreshTokenReused
+	}
+
+	token, err := newRefreshToken(uuid.New(), old.UserID, old.FamilyID, ttl, client)
+	if err != nil {
+		return nil, err
+	}
+	token.SessionStartedAt = old.SessionStartedAt
+
+	if err := insertRefreshToken(ctx, tx, token); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit rotation: %w", err)
+	}
+
+	return token, nil
+}
+
+// RevokeFamily revokes every token descended from the same login
+func (r *RefreshTokenRepository) RevokeFamily(ctx context.Context, familyID uuid.UUID) (int64, error) {
+	result, err := r.db.Exec(ctx, `
+		UPDATE refresh_tokens
+		SET revoked = true
+		WHERE family_id = $1 AND revoked = false
+	`, familyID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to revoke token family: %w", err)
+	}
+	return result.RowsAffected(), nil
+}
+
+// maxUserAgentLength matches the refresh_tokens.user_agent column
+const maxUserAgentLength = 512
+
+func newRefreshToken(id, userID, familyID uuid.UUID, ttl time.Duration, client models.ClientInfo) (*models.RefreshToken, error) {
 	// Generate a random token
 	tokenBytes := make([]byte, 32)
 	if _, err := rand.Read(tokenBytes); err != nil {
 		return nil, err
 	}
-	tokenString := hex.EncodeToString(tokenBytes)
 
-	//Create UUID for the tokenID
-	tokenID := uuid.New()
-	expiresAt := time.Now().Add(ttl)
-
-	token := &models.RefreshToken{
-		ID:        tokenID,
+	now := time.Now()
+	return &models.RefreshToken{
+		ID:        id,
 		UserID:    userID,
-		Token:     tokenString,
-		ExpiresAt: expiresAt,
-		CreatedAt: time.Now(),
+		FamilyID:  familyID,
+		Token:     hex.EncodeToString(tokenBytes),
+		UserAgent: truncate(client.UserAgent, maxUserAgentLength),
+		IPAddress: client.IPAddress,
+		ExpiresAt: now.Add(ttl),
+		CreatedAt: now,
 		Revoked:   false,
-	}
+	}, nil
+}
 
+func insertRefreshToken(ctx context.Context, db DBTX, token *models.RefreshToken) error {
 	query := `
-		INSERT INTO refresh_tokens (id, user_id, token, expires_at, created_at, revoked) 
-		VALUES ($1, $2, $3, $4, $5, $6)
+		INSERT INTO refresh_tokens (id, user_id, family_id, token, user_agent, ip_address, session_started_at, expires_at, created_at, revoked)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
 	`
-	ctx := context.Background()
 
-	_, err := r.db.Exec(
+	_, err := db.Exec(
 		ctx, query,
 		token.ID,
 		token.UserID,
+		token.FamilyID,
 		token.Token,
+		token.UserAgent,
+		token.IPAddress,
+		token.SessionStartedAt,
 		token.ExpiresAt,
 		token.CreatedAt,
 		token.Revoked,
 	)
-	if err != nil {
-		return nil, err
-	}
-
-	return token, nil
+	return err
 }
 
 // GetRefreshToken retrieves a refresh token by its token string
 func (r *RefreshTokenRepository) GetRefreshToken(tokenString string) (*models.RefreshToken, error) {
 	query := `
-		SELECT id, user_id, token, expires_at, created_at, revoked
+		SELECT id, user_id, family_id, token, user_agent, ip_address, session_started_at, expires_at, created_at, used_at, revoked
 		FROM refresh_tokens
 		WHERE token = $1
 	`
@@ -79,9 +161,14 @@ func (r *RefreshTokenRepository) GetRefreshToken(tokenString string) (*models.Re
 	err := r.db.QueryRow(ctx, query, tokenString).Scan(
 		&token.ID,
 		&token.UserID,
+		&token.FamilyID,
 		&token.Token,
+		&token.UserAgent,
+		&token.IPAddress,
+		&token.SessionStartedAt,
 		&token.ExpiresAt,
 		&token.CreatedAt,
+		&token.UsedAt,
 		&token.Revoked,
 	)
 
@@ -131,16 +218,91 @@ func (r *RefreshTokenRepository) DeleteExpiredTokens() error {
 	return err
 }
 
-// RevokeAllUserTokens revokes all refresh tokens for a specific user
-func (r *RefreshTokenRepository) RevokeAllUserTokens(userID uuid.UUID) error {
+// RevokeAllUserTokens revokes all refresh tokens for a specific user,
+// except those in the given families
+func (r *RefreshTokenRepository) RevokeAllUserTokens(userID uuid.UUID, exceptFamilyIDs ...uuid.UUID) error {
 	query := `
 		UPDATE refresh_tokens
 		SET revoked = true
-		WHERE user_id = $1 AND revoked = false
+		WHERE user_id = $1 AND revoked = false AND NOT (family_id = ANY($2))
 	`
 
 	ctx := context.Background()
 
-	_, err := r.db.Exec(ctx, query, userID)
+	if exceptFamilyIDs == nil {
+		exceptFamilyIDs = []uuid.UUID{}
+	}
+
+	_, err := r.db.Exec(ctx, query, userID, exceptFamilyIDs)
 	return err
 }
+
+// RevokeUserSession revokes one of a user's sessions. It fails with
+// "session not found" if the family has no live tokens or isn't the user's.
+func (r *RefreshTokenRepository) RevokeUserSession(ctx context.Context, userID, familyID uuid.UUID) error {
+	result, err := r.db.Exec(ctx, `
+		UPDATE refresh_tokens
+		SET revoked = true
+		WHERE user_id = $1 AND family_id = $2 AND revoked = false
+	`, userID, familyID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke session: %w", err)
+	}
+
+	if result.RowsAffected() == 0 {
+		return fmt.Errorf("session not found")
+	}
+
+	return nil
+}
+
+// ListActiveSessions returns a user's signed-in devices, most recently used
+// first. Each session is represented by the one live token in its family.
+func (r *RefreshTokenRepository) ListActiveSessions(ctx context.Context, userID uuid.UUID) ([]models.Session, error) {
+	query := `
+		SELECT family_id, user_agent, ip_address, session_started_at, created_at, expires_at
+		FROM refresh_tokens
+		WHERE user_id = $1 AND revoked = false AND used_at IS NULL AND expires_at > NOW()
+		ORDER BY created_at DESC
+	`
+
+	rows, err := r.db.Query(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query sessions: %w", err)
+	}
+	defer rows.Close()
+
+	sessions := []models.Session{}
+	for rows.Next() {
+		var session models.Session
+		err := rows.Scan(
+			&session.ID,
+			&session.UserAgent,
+			&session.IPAddress,
+			&session.CreatedAt,
+			&session.LastUsedAt,
+			&session.ExpiresAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan session: %w", err)
+		}
+		sessions = append(sessions, session)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating sessions: %w", err)
+	}
+
+	return sessions, nil
+}
+
+// truncate shortens s to at most n bytes without splitting a UTF-8 rune
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
@@ -3,11 +3,14 @@ package repository
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/diorshelton/golden-market-api/internal/models"
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
@@ -21,11 +24,8 @@ func NewUserRepository(db *pgxpool.Pool) *UserRepository {
 	return &UserRepository{db: db}
 }
 
-// Fixed identity for the single shared guest account
-const (
-	GuestUsername = "guest"
-	GuestEmail    = "guest@goldenmarket.local"
-)
+// GuestEmailDomain is the reserved domain generated guest emails use
+const GuestEmailDomain = "guest.goldenmarket.local"
 
 // CreateUser adds a new user to the database
 func (r *UserRepository) CreateUser(username, firstName, lastName, email, passwordHash string) (*models.User, error) {
@@ -39,14 +39,29 @@ func (r *UserRepository) CreateUser(username, firstName, lastName, email, passwo
 		CreatedAt:    time.Now().UTC(),
 	}
 
+	if err := r.insertUser(context.Background(), user); err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// insertUser writes a new user row and the opening ledger entry for the
+// column-default starting balance in one transaction.
+func (r *UserRepository) insertUser(ctx context.Context, user *models.User) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin create user transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
 	query := `
-	INSERT INTO users (id, username, first_name, last_name, email, password_hash, created_at, last_login)
-	VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
-	RETURNING balance
+	INSERT INTO users (id, username, first_name, last_name, email, password_hash, is_guest, guest_expires_at, created_at, last_login)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+	RETURNING balance, role
 	`
-	ctx := context.Background()
 
-	err := r.db.QueryRow(
+	err = tx.QueryRow(
 		ctx,
 		query,
 		user.ID,
@@ -55,22 +70,31 @@ func (r *UserRepository) CreateUser(username, firstName, lastName, email, passwo
 		user.LastName,
 		user.Email,
 		user.PasswordHash,
+		user.IsGuest,
+		user.GuestExpiresAt,
 		user.CreatedAt,
 		user.LastLogin,
-	).Scan(&user.Balance)
+	).Scan(&user.Balance, &user.Role)
 	if err != nil {
-		return nil, err
+		return uniqueUserError(err)
 	}
 
-	return user, nil
+	if user.Balance != 0 {
+		err = recordCoinTransaction(ctx, tx, user.ID, int(user.Balance), user.Balance, models.CoinReasonOpeningBalance, nil)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit(ctx)
 }
 
-// GetUserByEmail retrieves a user by their email address
+// GetUserByEmail retrieves a user by their email address, ignoring case
 func (r *UserRepository) GetUserByEmail(email string) (*models.User, error) {
 	query := `
-		SELECT id, username, first_name, last_name, email, password_hash, balance, created_at, last_login
+		SELECT id, username, first_name, last_name, email, password_hash, balance, is_guest, role, guest_expires_at, email_verified_at, mfa_enabled_at, deletion_scheduled_at, created_at, last_login
 		FROM users
-		WHERE email = $1
+		WHERE lower(email) = lower($1)
 	`
 
 	var user models.User
@@ -86,6 +110,12 @@ func (r *UserRepository) GetUserByEmail(email string) (*models.User, error) {
 		&user.Email,
 		&user.PasswordHash,
 		&user.Balance,
+		&user.IsGuest,
+		&user.Role,
+		&user.GuestExpiresAt,
+		&user.EmailVerifiedAt,
+		&user.MFAEnabledAt,
+		&user.DeletionScheduledAt,
 		&user.CreatedAt,
 		&lastLogin,
 	)
@@ -101,114 +131,98 @@ func (r *UserRepository) GetUserByEmail(email string) (*models.User, error) {
 	return &user, nil
 }
 
-// GetGuestUser retrieves the single shared guest account, if it exists
-func (r *UserRepository) GetGuestUser() (*models.User, error) {
-	query := `
-		SELECT id, username, first_name, last_name, email, password_hash, balance, is_guest, created_at, last_login
-		FROM users
-		WHERE is_guest = true
-		LIMIT 1
-	`
-
-	var user models.User
-	var lastLogin sql.NullTime
-
-	ctx := context.Background()
-
-	err := r.db.QueryRow(ctx, query).Scan(
-		&user.ID,
-		&user.Username,
-		&user.FirstName,
-		&user.LastName,
-		&user.Email,
-		&user.PasswordHash,
-		&user.Balance,
-		&user.IsGuest,
-		&user.CreatedAt,
-		&lastLogin,
-	)
+// CreateGuestUser creates a throwaway guest account with a generated
+// username and email. It starts with the default balance and lives until
+// expiresAt, after which DeleteExpiredGuests removes it.
+func (r *UserRepository) CreateGuestUser(passwordHash string, expiresAt time.Time) (*models.User, error) {
+	id := uuid.New()
+	suffix := strings.ReplaceAll(id.String(), "-", "")[:12]
+	expiresAt = expiresAt.UTC()
 
-	if err != nil {
-		return nil, err
+	user := &models.User{
+		ID:             id,
+		Username:       "guest_" + suffix,
+		FirstName:      "Guest",
+		LastName:       "User",
+		Email:          "guest_" + suffix + "@" + GuestEmailDomain,
+		PasswordHash:   passwordHash,
+		IsGuest:        true,
+		GuestExpiresAt: &expiresAt,
+		CreatedAt:      time.Now().UTC(),
 	}
 
-	if lastLogin.Valid {
-		user.LastLogin = lastLogin.Time.UTC()
+	if err := r.insertUser(context.Background(), user); err != nil {
+		return nil, err
 	}
 
-	return &user, nil
+	return user, nil
 }
 
-// CreateGuestUser creates the single shared guest account
-func (r *UserRepository) CreateGuestUser(passwordHash string) (*models.User, error) {
-	user := &models.User{
-		ID:           uuid.New(),
-		Username:     GuestUsername,
-		FirstName:    "Guest",
-		LastName:     "User",
-		Email:        GuestEmail,
-		PasswordHash: passwordHash,
-		IsGuest:      true,
-		CreatedAt:    time.Now().UTC(),
-	}
-
+// UpgradeGuestUser turns an unexpired guest into a registered user in place,
+// keeping its ID and so its cart, inventory, orders and ledger.
+func (r *UserRepository) UpgradeGuestUser(ctx context.Context, user *models.User) error {
 	query := `
-	INSERT INTO users (id, username, first_name, last_name, email, password_hash, is_guest, created_at, last_login)
-	VALUES ($1, $2, $3, $4, $5, $6, true, $7, $8)
-	RETURNING balance
+		UPDATE users
+		SET username = $2, first_name = $3, last_name = $4, email = $5, password_hash = $6,
+			is_guest = false, guest_expires_at = NULL
+		WHERE id = $1 AND is_guest = true AND guest_expires_at > NOW()
 	`
-	ctx := context.Background()
 
-	err := r.db.QueryRow(
-		ctx,
-		query,
+	result, err := r.db.Exec(ctx, query,
 		user.ID,
 		user.Username,
 		user.FirstName,
 		user.LastName,
 		user.Email,
 		user.PasswordHash,
-		user.CreatedAt,
-		user.LastLogin,
-	).Scan(&user.Balance)
+	)
 	if err != nil {
-		return nil, err
+		return fmt.Errorf("failed to upgrade guest: %w", uniqueUserError(err))
 	}
 
-	return user, nil
+	if result.RowsAffected() == 0 {
+		return fmt.Errorf("guest not found")
+	}
+
+	user.IsGuest = false
+	user.GuestExpiresAt = nil
+	return nil
 }
 
-// ResetGuestData wipes the guest account's cart, inventory, and order history,
-// and resets its coin balance back to the starting amount. Runs in a transaction
-// so a partial reset never persists.
-func (r *UserRepository) ResetGuestData(ctx context.Context, userID uuid.UUID) error {
-	tx, err := r.db.Begin(ctx)
+// CountActiveGuests returns the number of guest accounts that have not
+// expired yet
+func (r *UserRepository) CountActiveGuests(ctx context.Context) (int, error) {
+	var count int
+	err := r.db.QueryRow(ctx, `
+		SELECT COUNT(*) FROM users
+		WHERE is_guest = true AND guest_expires_at > NOW()
+	`).Scan(&count)
 	if err != nil {
-		return fmt.Errorf("failed to begin guest reset transaction: %w", err)
+		return 0, fmt.Errorf("failed to count active guests: %w", err)
 	}
-	defer tx.Rollback(ctx)
+	return count, nil
+}
 
-	if _, err := tx.Exec(ctx, `DELETE FROM cart_items WHERE user_id = $1`, userID); err != nil {
-		return fmt.Errorf("failed to clear guest cart: %w", err)
-	}
-	if _, err := tx.Exec(ctx, `DELETE FROM inventory WHERE user_id = $1`, userID); err != nil {
-		return fmt.Errorf("failed to clear guest inventory: %w", err)
-	}
-	if _, err := tx.Exec(ctx, `DELETE FROM orders WHERE user_id = $1`, userID); err != nil {
-		return fmt.Errorf("failed to clear guest orders: %w", err)
-	}
-	if _, err := tx.Exec(ctx, `UPDATE users SET balance = 5000 WHERE id = $1`, userID); err != nil {
-		return fmt.Errorf("failed to reset guest balance: %w", err)
+// DeleteExpiredGuests removes every expired guest account. Their carts,
+// inventory, orders, ledger entries and refresh tokens are removed by
+// ON DELETE CASCADE.
+func (r *UserRepository) DeleteExpiredGuests(ctx context.Context) (int64, error) {
+	result, err := r.db.Exec(ctx, `
+		DELETE FROM users
+		WHERE is_guest = true AND guest_expires_at <= NOW()
+	`)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete expired guests: %w", err)
 	}
-
-	return tx.Commit(ctx)
+	return result.RowsAffected(), nil
 }
 
+// GetUserByUsername retrieves a user by their username, ignoring case
 func (r *UserRepository) GetUserByUsername(username string) (*models.User, error) {
 	query := `
-		SELECT id, username, first_name, last_name, email, password_hash, balance, created_at, last_login
+		SELECT id, username, first_name, last_name, email, password_hash, balance, is_guest, role, guest_expires_at, email_verified_at, mfa_enabled_at, deletion_scheduled_at, created_at, last_login
 		FROM users
-		WHERE username = $1
+		WHERE lower(username) = lower($1)
 	`
 
 	var user models.User
@@ -224,6 +238,12 @@ func (r *UserRepository) GetUserByUsername(username string) (*models.User, error
 		&user.Email,
 		&user.PasswordHash,
 		&user.Balance,
+		&user.IsGuest,
+		&user.Role,
+		&user.GuestExpiresAt,
+		&user.EmailVerifiedAt,
+		&user.MFAEnabledAt,
+		&user.DeletionScheduledAt,
 		&user.CreatedAt,
 		&lastLogin,
 	)
@@ -242,7 +262,7 @@ func (r *UserRepository) GetUserByUsername(username string) (*models.User, error
 // GetUserByID retrieves a user by their ID
 func (r *UserRepository) GetUserByID(id uuid.UUID) (*models.User, error) {
 	query := `
-		SELECT id, username, first_name, last_name, email, password_hash, balance, created_at, last_login
+		SELECT id, username, first_name, last_name, email, password_hash, balance, is_guest, role, guest_expires_at, email_verified_at, mfa_enabled_at, deletion_scheduled_at, created_at, last_login
 		FROM users
 		WHERE id = $1
 	`
@@ -260,6 +280,12 @@ func (r *UserRepository) GetUserByID(id uuid.UUID) (*models.User, error) {
 		&user.Email,
 		&user.PasswordHash,
 		&user.Balance,
+		&user.IsGuest,
+		&user.Role,
+		&user.GuestExpiresAt,
+		&user.EmailVerifiedAt,
+		&user.MFAEnabledAt,
+		&user.DeletionScheduledAt,
 		&user.CreatedAt,
 		&lastLogin,
 	)
@@ -276,7 +302,7 @@ func (r *UserRepository) GetUserByID(id uuid.UUID) (*models.User, error) {
 }
 func (r *UserRepository) GetUserProfile(id uuid.UUID) (*models.User, error) {
 	query := `
-		SELECT id, username, first_name, last_name, email, balance, created_at
+		SELECT id, username, first_name, last_name, email, balance, is_guest, role, guest_expires_at, email_verified_at, mfa_enabled_at, deletion_scheduled_at, created_at
 		FROM users
 		WHERE id = $1
 	`
@@ -293,6 +319,12 @@ func (r *UserRepository) GetUserProfile(id uuid.UUID) (*models.User, error) {
 		&user.LastName,
 		&user.Email,
 		&user.Balance,
+		&user.IsGuest,
+		&user.Role,
+		&user.GuestExpiresAt,
+		&user.EmailVerifiedAt,
+		&user.MFAEnabledAt,
+		&user.DeletionScheduledAt,
 		&user.CreatedAt,
 	)
 
@@ -307,14 +339,43 @@ func (r *UserRepository) GetUserProfile(id uuid.UUID) (*models.User, error) {
 	return &user, nil
 }
 
-// UpdateBalance updates a user's coin balance
+// UpdateBalance sets a user's coin balance, recording the difference in the
+// ledger as an admin adjustment
 func (r *UserRepository) UpdateBalance(userID uuid.UUID, newBalance models.Coins) error {
-	query := `UPDATE users SET balance = $1 WHERE id = $2`
-
 	ctx := context.Background()
 
-	_, err := r.db.Exec(ctx, query, newBalance, userID)
-	return err
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin balance update transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if err := setBalance(ctx, tx, userID, newBalance, models.CoinReasonAdminAdjustment, nil); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// setBalance moves a user's balance to an absolute value and records the
+// delta in the ledger (within a transaction)
+func setBalance(ctx context.Context, tx DBTX, userID uuid.UUID, newBalance models.Coins, reason models.CoinReason, referenceID *uuid.UUID) error {
+	var current models.Coins
+	err := tx.QueryRow(ctx, `SELECT balance FROM users WHERE id = $1 FOR UPDATE`, userID).Scan(&current)
+	if err != nil {
+		return fmt.Errorf("user not found: %w", err)
+	}
+
+	delta := int(newBalance - current)
+	if delta == 0 {
+		return nil
+	}
+
+	if _, err := tx.Exec(ctx, `UPDATE users SET balance = $1 WHERE id = $2`, newBalance, userID); err != nil {
+		return fmt.Errorf("failed to update balance: %w", err)
+	}
+
+	return recordCoinTransaction(ctx, tx, userID, delta, newBalance, reason, referenceID)
 }
 
 // UpdateLastLogin updates the user's last login timestamp
@@ -327,41 +388,84 @@ func (r *UserRepository) UpdateLastLogin(userID uuid.UUID) error {
 	return err
 }
 
+// UpdatePassword replaces a user's password hash
+func (r *UserRepository) UpdatePassword(ctx context.Context, userID uuid.UUID, passwordHash string) error {
+	result, err := r.db.Exec(ctx, `UPDATE users SET password_hash = $1 WHERE id = $2`, passwordHash, userID)
+	if err != nil {
+		return fmt.Errorf("failed to update password: %w", err)
+	}
+
+	if result.RowsAffected() == 0 {
+		return fmt.Errorf("user not found")
+	}
+
+	return nil
+}
+
+// MarkEmailVerified records that the user proved they own their email.
+// Verifying again keeps the original timestamp.
+func (r *UserRepository) MarkEmailVerified(ctx context.Context, userID uuid.UUID) error {
+	result, err := r.db.Exec(ctx, `
+		UPDATE users
+		SET email_verified_at = COALESCE(email_verified_at, NOW())
+		WHERE id = $1
+	`, userID)
+	if err != nil {
+		return fmt.Errorf("failed to mark email verified: %w", err)
+	}
+
+	if result.RowsAffected() == 0 {
+		return fmt.Errorf("user not found")
+	}
+
+	return nil
+}
+
 // DeductCoins safely deducts coins from a user's balance (within a transaction)
-// Returns error if insufficient balance
-func (r *UserRepository) DeductCoins(ctx context.Context, tx DBTX, userID uuid.UUID, amount int) error {
+// and records the debit in the ledger. Returns error if insufficient balance
+func (r *UserRepository) DeductCoins(ctx context.Context, tx DBTX, userID uuid.UUID, amount int, reason models.CoinReason, referenceID *uuid.UUID) error {
+	if amount <= 0 {
+		return fmt.Errorf("amount must be greater than 0")
+	}
+
 	query := `
 		UPDATE users
 		SET balance = balance - $1
 		WHERE id = $2 AND balance >= $1
+		RETURNING balance
 	`
 
-	result, err := tx.Exec(ctx, query, amount, userID)
+	var balanceAfter models.Coins
+	err := tx.QueryRow(ctx, query, amount, userID).Scan(&balanceAfter)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return fmt.Errorf("insufficient coins")
+	}
 	if err != nil {
 		return fmt.Errorf("failed to deduct coins: %w", err)
 	}
 
-	if result.RowsAffected() == 0 {
-		return fmt.Errorf("insufficient coins")
-	}
-
-	return nil
+	return recordCoinTransaction(ctx, tx, userID, -amount, balanceAfter, reason, referenceID)
 }
 
-// AddCoins adds coins to a user's balance (within a transaction)
-func (r *UserRepository) AddCoins(ctx context.Context, tx DBTX, userID uuid.UUID, amount int) error {
-	query := `UPDATE users SET balance = balance + $1 WHERE id = $2`
-
-	result, err := tx.Exec(ctx, query, amount, userID)
-	if err != nil {
-		return fmt.Errorf("failed to add coins: %w", err)
+// AddCoins adds coins to a user's balance (within a transaction) and records
+// the credit in the ledger
+func (r *UserRepository) AddCoins(ctx context.Context, tx DBTX, userID uuid.UUID, amount int, reason models.CoinReason, referenceID *uuid.UUID) error {
+	if amount <= 0 {
+		return fmt.Errorf("amount must be greater than 0")
 	}
 
-	if result.RowsAffected() == 0 {
+	query := `UPDATE users SET balance = balance + $1 WHERE id = $2 RETURNING balance`
+
+	var balanceAfter models.Coins
+	err := tx.QueryRow(ctx, query, amount, userID).Scan(&balanceAfter)
+	if errors.Is(err, pgx.ErrNoRows) {
 		return fmt.Errorf("user not found")
 	}
+	if err != nil {
+		return fmt.Errorf("failed to add coins: %w", err)
+	}
 
-	return nil
+	return recordCoinTransaction(ctx, tx, userID, amount, balanceAfter, reason, referenceID)
 }
 
 // GetPool returns the database pool for transaction management
@@ -372,7 +476,7 @@ func (r *UserRepository) GetPool() *pgxpool.Pool {
 // GetUserByIDTx retrieves a user by ID within a transaction (with row lock for update)
 func (r *UserRepository) GetUserByIDTx(ctx context.Context, tx DBTX, id uuid.UUID) (*models.User, error) {
 	query := `
-		SELECT id, username, first_name, last_name, email, password_hash, balance, created_at, last_login
+		SELECT id, username, first_name, last_name, email, password_hash, balance, is_guest, role, guest_expires_at, email_verified_at, mfa_enabled_at, deletion_scheduled_at, created_at, last_login
 		FROM users
 		WHERE id = $1
 		FOR UPDATE
@@ -389,6 +493,12 @@ func (r *UserRepository) GetUserByIDTx(ctx context.Context, tx DBTX, id uuid.UUI
 		&user.Email,
 		&user.PasswordHash,
 		&user.Balance,
+		&user.IsGuest,
+		&user.Role,
+		&user.GuestExpiresAt,
+		&user.EmailVerifiedAt,
+		&user.MFAEnabledAt,
+		&user.DeletionScheduledAt,
 		&user.CreatedAt,
 		&lastLogin,
 	)
@@ -405,7 +515,10 @@ func (r *UserRepository) GetUserByIDTx(ctx context.Context, tx DBTX, id uuid.UUI
 }
 
 func (r *UserRepository) GetAllUsers() ([]*models.User, error) {
-	query := `SELECT * FROM users`
+	query := `
+		SELECT id, username, first_name, last_name, email, password_hash, balance, is_guest, role, guest_expires_at, email_verified_at, mfa_enabled_at, deletion_scheduled_at, created_at, last_login
+		FROM users
+	`
 
 	ctx := context.Background()
 
@@ -426,6 +539,12 @@ func (r *UserRepository) GetAllUsers() ([]*models.User, error) {
 			&u.Email,
 			&u.PasswordHash,
 			&u.Balance,
+			&u.IsGuest,
+			&u.Role,
+			&u.GuestExpiresAt,
+			&u.EmailVerifiedAt,
+			&u.MFAEnabledAt,
+			&u.DeletionScheduledAt,
 			&u.CreatedAt,
 			&u.LastLogin,
 		)
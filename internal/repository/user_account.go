@@ -0,0 +1,141 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// ErrEmailTaken and ErrUsernameTaken are returned when a write collides
+// with another account's email or username, ignoring case
+var (
+	ErrEmailTaken    = errors.New("email already in use")
+	ErrUsernameTaken = errors.New("username already exists")
+)
+
+// uniqueViolation is the Postgres error code for a unique constraint failure
+const uniqueViolation = "23505"
+
+// uniqueUserError turns a unique violation on the users table into
+// ErrEmailTaken or ErrUsernameTaken. Other errors are returned unchanged.
+func uniqueUserError(err error) error {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) || pgErr.Code != uniqueViolation {
+		return err
+	}
+
+	switch {
+	case strings.Contains(pgErr.ConstraintName, "email"):
+		return ErrEmailTaken
+	case strings.Contains(pgErr.ConstraintName, "username"):
+		return ErrUsernameTaken
+	default:
+		return err
+	}
+}
+
+// UpdateUserNames sets a user's first and last name
+func (r *UserRepository) UpdateUserNames(ctx context.Context, userID uuid.UUID, firstName, lastName string) error {
+	result, err := r.db.Exec(ctx, `
+		UPDATE users
+		SET first_name = $2, last_name = $3
+		WHERE id = $1
+	`, userID, firstName, lastName)
+	if err != nil {
+		return fmt.Errorf("failed to update names: %w", err)
+	}
+
+	if result.RowsAffected() == 0 {
+		return fmt.Errorf("user not found")
+	}
+
+	return nil
+}
+
+// SetPendingEmail stores an address the user wants to switch to. It only
+// becomes their email once ConfirmPendingEmail runs.
+func (r *UserRepository) SetPendingEmail(ctx context.Context, userID uuid.UUID, email string) error {
+	result, err := r.db.Exec(ctx, `UPDATE users SET pending_email = $2 WHERE id = $1`, userID, email)
+	if err != nil {
+		return fmt.Errorf("failed to set pending email: %w", err)
+	}
+
+	if result.RowsAffected() == 0 {
+		return fmt.Errorf("user not found")
+	}
+
+	return nil
+}
+
+// ConfirmPendingEmail makes the pending email the user's address and marks
+// it verified, returning the new address. It returns ErrEmailTaken if
+// another account claimed the address first.
+func (r *UserRepository) ConfirmPendingEmail(ctx context.Context, userID uuid.UUID) (string, error) {
+	var email string
+	err := r.db.QueryRow(ctx, `
+		UPDATE users
+		SET email = pending_email, pending_email = NULL, email_verified_at = NOW()
+		WHERE id = $1 AND pending_email IS NOT NULL
+		RETURNING email
+	`, userID).Scan(&email)
+
+	if errors.Is(uniqueUserError(err), ErrEmailTaken) {
+		return "", ErrEmailTaken
+	}
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", fmt.Errorf("no pending email change")
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to confirm email change: %w", err)
+	}
+
+	return email, nil
+}
+
+// ScheduleDeletion marks a registered account for deletion at the given
+// time. DeleteScheduledUsers removes it once that time has passed.
+func (r *UserRepository) ScheduleDeletion(ctx context.Context, userID uuid.UUID, at time.Time) error {
+	result, err := r.db.Exec(ctx, `
+		UPDATE users
+		SET deletion_scheduled_at = $2
+		WHERE id = $1 AND is_guest = false
+	`, userID, at)
+	if err != nil {
+		return fmt.Errorf("failed to schedule deletion: %w", err)
+	}
+
+	if result.RowsAffected() == 0 {
+		return fmt.Errorf("user not found")
+	}
+
+	return nil
+}
+
+// CancelDeletion keeps an account that was scheduled for deletion
+func (r *UserRepository) CancelDeletion(ctx context.Context, userID uuid.UUID) error {
+	_, err := r.db.Exec(ctx, `UPDATE users SET deletion_scheduled_at = NULL WHERE id = $1`, userID)
+	if err != nil {
+		return fmt.Errorf("failed to cancel deletion: %w", err)
+	}
+	return nil
+}
+
+// DeleteScheduledUsers removes every account whose deletion date has
+// passed. Like DeleteExpiredGuests, everything they own goes with them by
+// ON DELETE CASCADE.
+func (r *UserRepository) DeleteScheduledUsers(ctx context.Context) (int64, error) {
+	result, err := r.db.Exec(ctx, `
+		DELETE FROM users
+		WHERE deletion_scheduled_at <= NOW()
+	`)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete scheduled users: %w", err)
+	}
+	return result.RowsAffected(), nil
+}
@@ -0,0 +1,139 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/diorshelton/golden-market-api/internal/models"
+	"github.com/google/uuid"
+)
+
+// GetUserMFA returns a user's two-factor state
+func (r *UserRepository) GetUserMFA(ctx context.Context, userID uuid.UUID) (*models.UserMFA, error) {
+	var mfa models.UserMFA
+	err := r.db.QueryRow(ctx, `
+		SELECT mfa_secret, mfa_enabled_at, mfa_last_step
+		FROM users
+		WHERE id = $1
+	`, userID).Scan(&mfa.Secret, &mfa.EnabledAt, &mfa.LastStep)
+	if err != nil {
+		return nil, fmt.Errorf("user not found: %w", err)
+	}
+	return &mfa, nil
+}
+
+// StartMFAEnrollment stores a new encrypted secret and recovery code hashes,
+// replacing any unfinished enrollment. Two-factor stays off until EnableMFA.
+func (r *UserRepository) StartMFAEnrollment(ctx context.Context, userID uuid.UUID, sealedSecret []byte, recoveryCodeHashes []string) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin mfa enrollment: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	result, err := tx.Exec(ctx, `
+		UPDATE users
+		SET mfa_secret = $2, mfa_enabled_at = NULL, mfa_last_step = NULL
+		WHERE id = $1 AND mfa_enabled_at IS NULL
+	`, userID, sealedSecret)
+	if err != nil {
+		return fmt.Errorf("failed to store mfa secret: %w", err)
+	}
+	if result.RowsAffected() == 0 {
+		return fmt.Errorf("user not found or mfa already enabled")
+	}
+
+	if err := replaceRecoveryCodes(ctx, tx, userID, recoveryCodeHashes); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// EnableMFA turns two-factor on once the user has proven their app works.
+// step is the time step of the confirming code, which can't be reused.
+func (r *UserRepository) EnableMFA(ctx context.Context, userID uuid.UUID, step int64) error {
+	result, err := r.db.Exec(ctx, `
+		UPDATE users
+		SET mfa_enabled_at = NOW(), mfa_last_step = $2
+		WHERE id = $1 AND mfa_secret IS NOT NULL AND mfa_enabled_at IS NULL
+	`, userID, step)
+	if err != nil {
+		return fmt.Errorf("failed to enable mfa: %w", err)
+	}
+	if result.RowsAffected() == 0 {
+		return fmt.Errorf("mfa enrollment not found")
+	}
+	return nil
+}
+
+// DisableMFA turns two-factor off and forgets the secret and recovery codes
+func (r *UserRepository) DisableMFA(ctx context.Context, userID uuid.UUID) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin mfa disable: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, `
+		UPDATE users
+		SET mfa_secret = NULL, mfa_enabled_at = NULL, mfa_last_step = NULL
+		WHERE id = $1
+	`, userID)
+	if err != nil {
+		return fmt.Errorf("failed to disable mfa: %w", err)
+	}
+
+	if err := replaceRecoveryCodes(ctx, tx, userID, nil); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// ClaimMFAStep records step as the latest accepted TOTP step. It returns
+// false when that step (or a later one) was already used, so an intercepted
+// code can't be replayed within its validity window.
+func (r *UserRepository) ClaimMFAStep(ctx context.Context, userID uuid.UUID, step int64) (bool, error) {
+	result, err := r.db.Exec(ctx, `
+		UPDATE users
+		SET mfa_last_step = $2
+		WHERE id = $1 AND (mfa_last_step IS NULL OR mfa_last_step < $2)
+	`, userID, step)
+	if err != nil {
+		return false, fmt.Errorf("failed to record mfa step: %w", err)
+	}
+	return result.RowsAffected() == 1, nil
+}
+
+// UseRecoveryCode spends an unused recovery code. It returns false if the
+// code doesn't exist or was already used.
+func (r *UserRepository) UseRecoveryCode(ctx context.Context, userID uuid.UUID, codeHash string) (bool, error) {
+	result, err := r.db.Exec(ctx, `
+		UPDATE mfa_recovery_codes
+		SET used_at = NOW()
+		WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL
+	`, userID, codeHash)
+	if err != nil {
+		return false, fmt.Errorf("failed to use recovery code: %w", err)
+	}
+	return result.RowsAffected() == 1, nil
+}
+
+func replaceRecoveryCodes(ctx context.Context, tx DBTX, userID uuid.UUID, codeHashes []string) error {
+	if _, err := tx.Exec(ctx, `DELETE FROM mfa_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return fmt.Errorf("failed to clear recovery codes: %w", err)
+	}
+
+	for _, hash := range codeHashes {
+		_, err := tx.Exec(ctx, `
+			INSERT INTO mfa_recovery_codes (id, user_id, code_hash)
+			VALUES ($1, $2, $3)
+		`, uuid.New(), userID, hash)
+		if err != nil {
+			return fmt.Errorf("failed to store recovery code: %w", err)
+		}
+	}
+
+	return nil
+}
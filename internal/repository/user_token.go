@@ -0,0 +1,108 @@
+package repository
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/diorshelton/golden-market-api/internal/models"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// UserTokenRepository handles database operations for mailed single-use
+// tokens
+type UserTokenRepository struct {
+	db *pgxpool.Pool
+}
+
+// NewUserTokenRepository creates a new user token repository
+func NewUserTokenRepository(db *pgxpool.Pool) *UserTokenRepository {
+	return &UserTokenRepository{db: db}
+}
+
+// ErrUserTokenInvalid is returned when a token is unknown, expired, already
+// used or issued for a different purpose
+var ErrUserTokenInvalid = errors.New("invalid or expired token")
+
+// CreateUserToken issues a token for purpose and returns its plaintext,
+// which is never stored. Any earlier unused token for the same purpose stops
+// working, so only the most recent email is valid.
+func (r *UserTokenRepository) CreateUserToken(ctx context.Context, userID uuid.UUID, purpose models.TokenPurpose, ttl time.Duration) (string, error) {
+	tokenBytes := make([]byte, 32)
+	if _, err := rand.Read(tokenBytes); err != nil {
+		return "", fmt.Errorf("failed to generate token: %w", err)
+	}
+	plaintext := hex.EncodeToString(tokenBytes)
+
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to begin token transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, `
+		DELETE FROM user_tokens
+		WHERE user_id = $1 AND purpose = $2 AND used_at IS NULL
+	`, userID, purpose)
+	if err != nil {
+		return "", fmt.Errorf("failed to clear previous tokens: %w", err)
+	}
+
+	now := time.Now().UTC()
+	_, err = tx.Exec(ctx, `
+		INSERT INTO user_tokens (id, user_id, purpose, token_hash, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`, uuid.New(), userID, purpose, hashUserToken(plaintext), now.Add(ttl), now)
+	if err != nil {
+		return "", fmt.Errorf("failed to create token: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return "", fmt.Errorf("failed to commit token: %w", err)
+	}
+
+	return plaintext, nil
+}
+
+// ConsumeUserToken marks a valid token as used and returns it. A token can
+// only be consumed once; every later attempt gets ErrUserTokenInvalid.
+func (r *UserTokenRepository) ConsumeUserToken(ctx context.Context, purpose models.TokenPurpose, plaintext string) (*models.UserToken, error) {
+	query := `
+		UPDATE user_tokens
+		SET used_at = NOW()
+		WHERE token_hash = $1 AND purpose = $2 AND used_at IS NULL AND expires_at > NOW()
+		RETURNING id, user_id, purpose, token_hash, expires_at, used_at, created_at
+	`
+
+	var token models.UserToken
+	err := r.db.QueryRow(ctx, query, hashUserToken(plaintext), purpose).Scan(
+		&token.ID,
+		&token.UserID,
+		&token.Purpose,
+		&token.TokenHash,
+		&token.ExpiresAt,
+		&token.UsedAt,
+		&token.CreatedAt,
+	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrUserTokenInvalid
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to consume token: %w", err)
+	}
+
+	return &token, nil
+}
+
+// hashUserToken returns the hex SHA-256 stored in place of a token. The
+// tokens are 256 random bits, so an unsalted fast hash is enough.
+func hashUserToken(plaintext string) string {
+	sum := sha256.Sum256([]byte(plaintext))
+	return hex.EncodeToString(sum[:])
+}
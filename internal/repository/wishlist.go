@@ -0,0 +1,131 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/diorshelton/golden-market-api/internal/models"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var ErrWishlistItemNotFound = errors.New("wishlist item not found")
+
+// WishlistRepository handles database operations for saved products
+type WishlistRepository struct {
+	db *pgxpool.Pool
+}
+
+// NewWishlistRepository creates a new wishlist repository
+func NewWishlistRepository(db *pgxpool.Pool) *WishlistRepository {
+	return &WishlistRepository{db: db}
+}
+
+// AddTx saves quantity of a product to the user's wishlist, adding to the
+// quantity if it is already there (within a transaction). The price and
+// stock it was first saved with are kept.
+func (r *WishlistRepository) AddTx(ctx context.Context, tx DBTX, userID uuid.UUID, product *models.Product, quantity int) error {
+	now := time.Now().UTC()
+	_, err := tx.Exec(ctx, `
+		INSERT INTO wishlist_items (id, user_id, product_id, quantity, saved_price, saved_in_stock, added_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $7)
+		ON CONFLICT (user_id, product_id)
+		DO UPDATE SET quantity = wishlist_items.quantity + EXCLUDED.quantity, updated_at = EXCLUDED.updated_at
+	`, uuid.New(), userID, product.ID, quantity, product.Price, product.Available > 0, now)
+	if err != nil {
+		return fmt.Errorf("failed to add to wishlist: %w", err)
+	}
+	return nil
+}
+
+// GetWishlist returns the user's saved products with their product
+// details, leaving out deleted products
+func (r *WishlistRepository) GetWishlist(ctx context.Context, userID uuid.UUID) (*models.Wishlist, error) {
+	query := `
+		SELECT
+			wi.id, wi.quantity, wi.saved_price, wi.saved_in_stock, wi.added_at,
+			p.id, p.name, p.description, p.price, p.stock, ` + availableStockColumn("p") + `, p.image_url, p.category, p.is_available, p.last_restock, p.created_at, p.updated_at
+		FROM wishlist_items wi
+		JOIN products p ON wi.product_id = p.id
+		WHERE wi.user_id = $1 AND p.deleted_at IS NULL
+		ORDER BY wi.added_at DESC
+	`
+	rows, err := r.db.Query(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get wishlist: %w", err)
+	}
+	defer rows.Close()
+
+	items := []models.WishlistItemDetail{}
+	totalItems := 0
+
+	for rows.Next() {
+		var item models.WishlistItemDetail
+		var product models.Product
+		var imageURL *string
+		var savedInStock bool
+
+		err := rows.Scan(
+			&item.WishlistItemID,
+			&item.Quantity,
+			&item.SavedPrice,
+			&savedInStock,
+			&item.AddedAt,
+			&product.ID,
+			&product.Name,
+			&product.Description,
+			&product.Price,
+			&product.Stock,
+			&product.Available,
+			&imageURL,
+			&product.Category,
+			&product.IsAvailable,
+			&product.LastRestock,
+			&product.CreatedAt,
+			&product.UpdatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan wishlist item: %w", err)
+		}
+
+		if imageURL != nil {
+			product.ImageURL = *imageURL
+		}
+
+		item.Product = product
+		item.PriceDropped = product.Price < item.SavedPrice
+		item.BackInStock = !savedInStock && product.IsAvailable && product.Available > 0
+		items = append(items, item)
+
+		totalItems += item.Quantity
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating wishlist items: %w", err)
+	}
+
+	return &models.Wishlist{
+		Items:      items,
+		TotalItems: totalItems,
+	}, nil
+}
+
+// RemoveTx takes an item off the user's wishlist and returns its product
+// and quantity (within a transaction)
+func (r *WishlistRepository) RemoveTx(ctx context.Context, tx DBTX, userID, wishlistItemID uuid.UUID) (productID uuid.UUID, quantity int, err error) {
+	err = tx.QueryRow(ctx, `
+		DELETE FROM wishlist_items
+		WHERE id = $1 AND user_id = $2
+		RETURNING product_id, quantity
+	`, wishlistItemID, userID).Scan(&productID, &quantity)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return uuid.Nil, 0, ErrWishlistItemNotFound
+	}
+	if err != nil {
+		return uuid.Nil, 0, fmt.Errorf("failed to remove from wishlist: %w", err)
+	}
+	return productID, quantity, nil
+}
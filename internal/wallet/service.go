@@ -0,0 +1,75 @@
+package wallet
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/diorshelton/golden-market-api/internal/models"
+	"github.com/diorshelton/golden-market-api/internal/repository"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type WalletService struct {
+	db           *pgxpool.Pool
+	userRepo     *repository.UserRepository
+	coinTxRepo   *repository.CoinTransactionRepository
+	transferRepo *repository.CoinTransferRepository
+
+	// Transfer limits; zero disables each
+	transferDailyLimit    int
+	transferMinAccountAge time.Duration
+}
+
+func NewWalletService(
+	db *pgxpool.Pool,
+	userRepo *repository.UserRepository,
+	coinTxRepo *repository.CoinTransactionRepository,
+	transferRepo *repository.CoinTransferRepository,
+) *WalletService {
+	return &WalletService{
+		db:           db,
+		userRepo:     userRepo,
+		coinTxRepo:   coinTxRepo,
+		transferRepo: transferRepo,
+	}
+}
+
+// ConfigureTransfers caps how many coins a user may send in any 24 hours
+// and how old their account must be to send any. Zero turns either off.
+func (s *WalletService) ConfigureTransfers(dailyLimit int, minAccountAge time.Duration) {
+	s.transferDailyLimit = dailyLimit
+	s.transferMinAccountAge = minAccountAge
+}
+
+// GetTransactions returns a page of the user's coin ledger, newest first.
+// Out-of-range limits are clamped rather than rejected.
+func (s *WalletService) GetTransactions(ctx context.Context, userID uuid.UUID, limit, offset int) (*models.CoinTransactionPage, error) {
+	limit = models.ClampPageSize(limit)
+	if offset < 0 {
+		offset = 0
+	}
+
+	transactions, err := s.coinTxRepo.GetByUserID(ctx, userID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+
+	total, err := s.coinTxRepo.CountByUserID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count transactions: %w", err)
+	}
+
+	// Return empty array instead of null
+	if transactions == nil {
+		transactions = []models.CoinTransaction{}
+	}
+
+	return &models.CoinTransactionPage{
+		Transactions: transactions,
+		Total:        total,
+		Limit:        limit,
+		Offset:       offset,
+	}, nil
+}
@@ -0,0 +1,116 @@
+package wallet
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/diorshelton/golden-market-api/internal/models"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+var (
+	ErrInvalidTransferAmount = errors.New("amount must be greater than 0")
+	ErrRecipientNotFound     = errors.New("recipient not found")
+	ErrSelfTransfer          = errors.New("you can't send coins to yourself")
+	ErrGuestTransfer         = errors.New("guest accounts can't send or receive coins")
+	ErrAccountTooNew         = errors.New("account is too new to send coins")
+	ErrTransferLimit         = errors.New("daily transfer limit reached")
+	ErrInsufficientCoins     = errors.New("insufficient coins")
+)
+
+// transferWindow is the period the daily limit applies to
+const transferWindow = 24 * time.Hour
+
+// Transfer sends amount coins from the sender to the player with
+// recipientUsername. Both users are locked, lower ID first so opposite
+// transfers can't deadlock, and the debit, the credit and their ledger
+// entries commit together.
+func (s *WalletService) Transfer(ctx context.Context, senderID uuid.UUID, recipientUsername string, amount int) (*models.CoinTransfer, error) {
+	if amount <= 0 {
+		return nil, ErrInvalidTransferAmount
+	}
+
+	recipient, err := s.userRepo.GetUserByUsername(strings.TrimSpace(recipientUsername))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrRecipientNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get recipient: %w", err)
+	}
+	if recipient.ID == senderID {
+		return nil, ErrSelfTransfer
+	}
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	first, second := senderID, recipient.ID
+	if bytes.Compare(first[:], second[:]) > 0 {
+		first, second = second, first
+	}
+	locked := make(map[uuid.UUID]*models.User, 2)
+	for _, id := range []uuid.UUID{first, second} {
+		user, err := s.userRepo.GetUserByIDTx(ctx, tx, id)
+		if err != nil {
+			return nil, err
+		}
+		locked[id] = user
+	}
+	sender, recipient := locked[senderID], locked[recipient.ID]
+
+	if sender.IsGuest || recipient.IsGuest {
+		return nil, ErrGuestTransfer
+	}
+	if s.transferMinAccountAge > 0 && time.Since(sender.CreatedAt) < s.transferMinAccountAge {
+		return nil, fmt.Errorf("%w: accounts can send coins once they are %s old", ErrAccountTooNew, s.transferMinAccountAge)
+	}
+
+	now := time.Now().UTC()
+	if s.transferDailyLimit > 0 {
+		sent, err := s.transferRepo.SentSinceTx(ctx, tx, senderID, now.Add(-transferWindow))
+		if err != nil {
+			return nil, err
+		}
+		if sent+amount > s.transferDailyLimit {
+			return nil, fmt.Errorf("%w: you can send %d more coins today", ErrTransferLimit, max(s.transferDailyLimit-sent, 0))
+		}
+	}
+
+	if int(sender.Balance) < amount {
+		return nil, fmt.Errorf("%w: have %d, need %d", ErrInsufficientCoins, sender.Balance, amount)
+	}
+
+	transfer := &models.CoinTransfer{
+		ID:                uuid.New(),
+		SenderID:          sender.ID,
+		SenderUsername:    sender.Username,
+		RecipientID:       recipient.ID,
+		RecipientUsername: recipient.Username,
+		Amount:            models.Coins(amount),
+		CreatedAt:         now,
+	}
+
+	if err := s.transferRepo.CreateTx(ctx, tx, transfer); err != nil {
+		return nil, err
+	}
+	if err := s.userRepo.DeductCoins(ctx, tx, sender.ID, amount, models.CoinReasonTransferSent, &transfer.ID); err != nil {
+		return nil, err
+	}
+	if err := s.userRepo.AddCoins(ctx, tx, recipient.ID, amount, models.CoinReasonTransferReceived, &transfer.ID); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return transfer, nil
+}
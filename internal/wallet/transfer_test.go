@@ -0,0 +1,152 @@
+package wallet
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/diorshelton/golden-market-api/internal/database"
+	"github.com/diorshelton/golden-market-api/internal/models"
+	"github.com/diorshelton/golden-market-api/internal/repository"
+	"github.com/joho/godotenv"
+)
+
+type testDeps struct {
+	walletService *WalletService
+	userRepo      *repository.UserRepository
+}
+
+func setupWalletTest(t *testing.T) *testDeps {
+	t.Helper()
+
+	_ = godotenv.Load("../../.env")
+	if os.Getenv("TEMP_DB_URL") == "" {
+		t.Skip("TEMP_DB_URL not set, skipping database tests")
+	}
+
+	db, err := database.SetupTestDB()
+	if err != nil {
+		t.Fatalf("failed to set up test db: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	userRepo := repository.NewUserRepository(db)
+	walletService := NewWalletService(db, userRepo, repository.NewCoinTransactionRepository(db), repository.NewCoinTransferRepository(db))
+
+	return &testDeps{
+		walletService: walletService,
+		userRepo:      userRepo,
+	}
+}
+
+var testCounter int
+
+func createTestUser(t *testing.T, deps *testDeps, balance int) *models.User {
+	t.Helper()
+	testCounter++
+	suffix := fmt.Sprintf("%d_%d", time.Now().UnixNano(), testCounter)
+
+	user, err := deps.userRepo.CreateUser(
+		"user_"+suffix,
+		"Test",
+		"User",
+		"user_"+suffix+"@example.com",
+		"hashed_password",
+	)
+	if err != nil {
+		t.Fatalf("failed to create test user: %v", err)
+	}
+
+	if err := deps.userRepo.UpdateBalance(user.ID, models.Coins(balance)); err != nil {
+		t.Fatalf("failed to set test user balance: %v", err)
+	}
+	user.Balance = models.Coins(balance)
+
+	return user
+}
+
+// TestTransfer_MovesCoinsAndShowsInBothHistories verifies a transfer moves
+// the coins and both players see it in their ledger, naming the other.
+func TestTransfer_MovesCoinsAndShowsInBothHistories(t *testing.T) {
+	deps := setupWalletTest(t)
+	ctx := context.Background()
+
+	sender := createTestUser(t, deps, 500)
+	recipient := createTestUser(t, deps, 100)
+
+	transfer, err := deps.walletService.Transfer(ctx, sender.ID, recipient.Username, 200)
+	if err != nil {
+		t.Fatalf("Transfer returned unexpected error: %v", err)
+	}
+
+	for _, tc := range []struct {
+		user         *models.User
+		balance      models.Coins
+		amount       models.Coins
+		counterparty string
+	}{
+		{sender, 300, -200, recipient.Username},
+		{recipient, 300, 200, sender.Username},
+	} {
+		updated, err := deps.userRepo.GetUserByID(tc.user.ID)
+		if err != nil {
+			t.Fatalf("failed to reload user: %v", err)
+		}
+		if updated.Balance != tc.balance {
+			t.Errorf("%s: expected balance %d, got %d", tc.user.Username, tc.balance, updated.Balance)
+		}
+
+		page, err := deps.walletService.GetTransactions(ctx, tc.user.ID, 1, 0)
+		if err != nil {
+			t.Fatalf("failed to load history: %v", err)
+		}
+		entry := page.Transactions[0]
+		if entry.Amount != tc.amount || entry.Counterparty != tc.counterparty ||
+			entry.ReferenceID == nil || *entry.ReferenceID != transfer.ID {
+			t.Errorf("%s: unexpected latest ledger entry %+v", tc.user.Username, entry)
+		}
+	}
+}
+
+// TestTransfer_Limits verifies the daily cap, minimum account age and guest
+// block each refuse a transfer without moving any coins.
+func TestTransfer_Limits(t *testing.T) {
+	deps := setupWalletTest(t)
+	ctx := context.Background()
+
+	sender := createTestUser(t, deps, 1000)
+	recipient := createTestUser(t, deps, 0)
+
+	deps.walletService.ConfigureTransfers(300, 0)
+	if _, err := deps.walletService.Transfer(ctx, sender.ID, recipient.Username, 200); err != nil {
+		t.Fatalf("Transfer returned unexpected error: %v", err)
+	}
+	if _, err := deps.walletService.Transfer(ctx, sender.ID, recipient.Username, 200); !errors.Is(err, ErrTransferLimit) {
+		t.Errorf("expected ErrTransferLimit, got %v", err)
+	}
+
+	deps.walletService.ConfigureTransfers(0, time.Hour)
+	if _, err := deps.walletService.Transfer(ctx, sender.ID, recipient.Username, 50); !errors.Is(err, ErrAccountTooNew) {
+		t.Errorf("expected ErrAccountTooNew, got %v", err)
+	}
+
+	deps.walletService.ConfigureTransfers(0, 0)
+	guest, err := deps.userRepo.CreateGuestUser("hashed_password", time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("failed to create guest: %v", err)
+	}
+	if _, err := deps.walletService.Transfer(ctx, sender.ID, guest.Username, 50); !errors.Is(err, ErrGuestTransfer) {
+		t.Errorf("expected ErrGuestTransfer, got %v", err)
+	}
+
+	updated, err := deps.userRepo.GetUserByID(sender.ID)
+	if err != nil {
+		t.Fatalf("failed to reload sender: %v", err)
+	}
+	if updated.Balance != 800 {
+		t.Errorf("expected only the first transfer to go through, balance %d", updated.Balance)
+	}
+}
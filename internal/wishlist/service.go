@@ -0,0 +1,107 @@
+package wishlist
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/diorshelton/golden-market-api/internal/cart"
+	"github.com/diorshelton/golden-market-api/internal/models"
+	"github.com/diorshelton/golden-market-api/internal/repository"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type WishlistService struct {
+	db           *pgxpool.Pool
+	wishlistRepo *repository.WishlistRepository
+	cartRepo     *repository.CartRepository
+	productRepo  *repository.ProductRepository
+	cartService  *cart.CartService
+}
+
+func NewWishlistService(
+	db *pgxpool.Pool,
+	wishlistRepo *repository.WishlistRepository,
+	cartRepo *repository.CartRepository,
+	productRepo *repository.ProductRepository,
+	cartService *cart.CartService,
+) *WishlistService {
+	return &WishlistService{
+		db:           db,
+		wishlistRepo: wishlistRepo,
+		cartRepo:     cartRepo,
+		productRepo:  productRepo,
+		cartService:  cartService,
+	}
+}
+
+// AddToWishlist saves a listed product, in stock or not
+func (s *WishlistService) AddToWishlist(ctx context.Context, userID, productID uuid.UUID, quantity int) error {
+	product, err := s.productRepo.GetByID(ctx, productID)
+	if err != nil {
+		return fmt.Errorf("product not found or unavailable: %w", err)
+	}
+
+	return s.wishlistRepo.AddTx(ctx, s.db, userID, product, quantity)
+}
+
+func (s *WishlistService) GetWishlist(ctx context.Context, userID uuid.UUID) (*models.Wishlist, error) {
+	return s.wishlistRepo.GetWishlist(ctx, userID)
+}
+
+func (s *WishlistService) RemoveFromWishlist(ctx context.Context, userID, wishlistItemID uuid.UUID) error {
+	_, _, err := s.wishlistRepo.RemoveTx(ctx, s.db, userID, wishlistItemID)
+	return err
+}
+
+// MoveToCart moves a wishlist item's whole quantity into the cart. Stock is
+// checked as for any cart addition; if it falls short, nothing moves.
+func (s *WishlistService) MoveToCart(ctx context.Context, userID, wishlistItemID uuid.UUID) error {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	productID, quantity, err := s.wishlistRepo.RemoveTx(ctx, tx, userID, wishlistItemID)
+	if err != nil {
+		return err
+	}
+
+	if err := s.cartService.AddToCartTx(ctx, tx, userID, productID, quantity); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// SaveForLater moves a cart item to the wishlist, releasing any hold on it
+func (s *WishlistService) SaveForLater(ctx context.Context, userID, cartItemID uuid.UUID) error {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	productID, quantity, err := s.cartRepo.RemoveFromCartTx(ctx, tx, userID, cartItemID)
+	if err != nil {
+		return err
+	}
+
+	product, err := s.productRepo.GetByIDForUpdate(ctx, tx, productID)
+	if err != nil {
+		return fmt.Errorf("product not found or unavailable: %w", err)
+	}
+
+	if err := s.wishlistRepo.AddTx(ctx, tx, userID, product, quantity); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
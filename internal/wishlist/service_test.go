@@ -0,0 +1,200 @@
+package wishlist
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/diorshelton/golden-market-api/internal/cart"
+	"github.com/diorshelton/golden-market-api/internal/database"
+	"github.com/diorshelton/golden-market-api/internal/models"
+	"github.com/diorshelton/golden-market-api/internal/repository"
+	"github.com/google/uuid"
+	"github.com/joho/godotenv"
+)
+
+type testDeps struct {
+	wishlistService *WishlistService
+	userRepo        *repository.UserRepository
+	productRepo     *repository.ProductRepository
+	cartRepo        *repository.CartRepository
+}
+
+func setupWishlistTest(t *testing.T) *testDeps {
+	t.Helper()
+
+	_ = godotenv.Load("../../.env")
+	if os.Getenv("TEMP_DB_URL") == "" {
+		t.Skip("TEMP_DB_URL not set, skipping database tests")
+	}
+
+	db, err := database.SetupTestDB()
+	if err != nil {
+		t.Fatalf("failed to set up test db: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	userRepo := repository.NewUserRepository(db)
+	productRepo := repository.NewProductRepository(db)
+	cartRepo := repository.NewCartRepository(db)
+	wishlistRepo := repository.NewWishlistRepository(db)
+
+	cartService := cart.NewCartService(db, cartRepo, productRepo, repository.NewPromotionRepository(db))
+
+	return &testDeps{
+		wishlistService: NewWishlistService(db, wishlistRepo, cartRepo, productRepo, cartService),
+		userRepo:        userRepo,
+		productRepo:     productRepo,
+		cartRepo:        cartRepo,
+	}
+}
+
+var testCounter int
+
+func uniqueSuffix() string {
+	testCounter++
+	return fmt.Sprintf("%d_%d", time.Now().UnixNano(), testCounter)
+}
+
+func createTestUser(t *testing.T, deps *testDeps) *models.User {
+	t.Helper()
+	suffix := uniqueSuffix()
+
+	user, err := deps.userRepo.CreateUser(
+		"user_"+suffix,
+		"Test",
+		"User",
+		"user_"+suffix+"@example.com",
+		"hashed_password",
+	)
+	if err != nil {
+		t.Fatalf("failed to create test user: %v", err)
+	}
+
+	return user
+}
+
+func createTestProduct(t *testing.T, deps *testDeps, price, stock int) *models.Product {
+	t.Helper()
+	suffix := uniqueSuffix()
+
+	product := &models.Product{
+		ID:          uuid.New(),
+		Name:        "Test Product " + suffix,
+		Description: "A product used for wishlist service tests",
+		Price:       models.Coins(price),
+		Stock:       stock,
+		Category:    "test",
+		IsAvailable: true,
+	}
+
+	if err := deps.productRepo.Create(context.Background(), product); err != nil {
+		t.Fatalf("failed to create test product: %v", err)
+	}
+
+	return product
+}
+
+// TestWishlist_FlagsRestockAndPriceDrop verifies an out-of-stock item is
+// flagged once restocked, and a repriced one once cheaper than when saved.
+func TestWishlist_FlagsRestockAndPriceDrop(t *testing.T) {
+	deps := setupWishlistTest(t)
+	ctx := context.Background()
+
+	user := createTestUser(t, deps)
+	product := createTestProduct(t, deps, 100, 0)
+
+	if err := deps.wishlistService.AddToWishlist(ctx, user.ID, product.ID, 1); err != nil {
+		t.Fatalf("AddToWishlist returned unexpected error: %v", err)
+	}
+
+	wishlist, err := deps.wishlistService.GetWishlist(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("failed to load wishlist: %v", err)
+	}
+	if len(wishlist.Items) != 1 || wishlist.Items[0].BackInStock || wishlist.Items[0].PriceDropped {
+		t.Fatalf("expected 1 unflagged item, got %+v", wishlist.Items)
+	}
+
+	product.Stock = 3
+	product.Price = 80
+	if err := deps.productRepo.Update(ctx, product); err != nil {
+		t.Fatalf("failed to update product: %v", err)
+	}
+
+	wishlist, err = deps.wishlistService.GetWishlist(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("failed to reload wishlist: %v", err)
+	}
+	item := wishlist.Items[0]
+	if !item.BackInStock || !item.PriceDropped || item.SavedPrice != 100 {
+		t.Errorf("expected back in stock and price dropped from 100, got %+v", item)
+	}
+}
+
+// TestWishlist_MoveBetweenCartAndWishlist verifies items move both ways
+// with their quantity, and that a move short on stock changes nothing.
+func TestWishlist_MoveBetweenCartAndWishlist(t *testing.T) {
+	deps := setupWishlistTest(t)
+	ctx := context.Background()
+
+	user := createTestUser(t, deps)
+	product := createTestProduct(t, deps, 100, 2)
+
+	if err := deps.cartRepo.AddToCart(ctx, user.ID, product.ID, 2); err != nil {
+		t.Fatalf("failed to seed cart item: %v", err)
+	}
+	cart, err := deps.cartRepo.GetCart(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("failed to load cart: %v", err)
+	}
+
+	if err := deps.wishlistService.SaveForLater(ctx, user.ID, cart.Items[0].CartItemID); err != nil {
+		t.Fatalf("SaveForLater returned unexpected error: %v", err)
+	}
+
+	cart, err = deps.cartRepo.GetCart(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("failed to reload cart: %v", err)
+	}
+	wishlist, err := deps.wishlistService.GetWishlist(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("failed to load wishlist: %v", err)
+	}
+	if len(cart.Items) != 0 || len(wishlist.Items) != 1 || wishlist.Items[0].Quantity != 2 {
+		t.Fatalf("expected the item moved to the wishlist, got cart %+v, wishlist %+v", cart.Items, wishlist.Items)
+	}
+	wishlistItemID := wishlist.Items[0].WishlistItemID
+
+	// Another shopper takes a unit, so both no longer fit in the cart
+	if err := deps.productRepo.UpdateStock(ctx, product.ID, 1); err != nil {
+		t.Fatalf("failed to update stock: %v", err)
+	}
+	if err := deps.wishlistService.MoveToCart(ctx, user.ID, wishlistItemID); err == nil {
+		t.Fatal("expected insufficient stock error, got nil")
+	}
+	wishlist, err = deps.wishlistService.GetWishlist(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("failed to reload wishlist: %v", err)
+	}
+	if len(wishlist.Items) != 1 {
+		t.Fatalf("expected the failed move to leave the wishlist alone, got %+v", wishlist.Items)
+	}
+
+	if err := deps.productRepo.UpdateStock(ctx, product.ID, 2); err != nil {
+		t.Fatalf("failed to update stock: %v", err)
+	}
+	if err := deps.wishlistService.MoveToCart(ctx, user.ID, wishlistItemID); err != nil {
+		t.Fatalf("MoveToCart returned unexpected error: %v", err)
+	}
+
+	cart, err = deps.cartRepo.GetCart(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("failed to reload cart: %v", err)
+	}
+	if len(cart.Items) != 1 || cart.Items[0].Quantity != 2 {
+		t.Errorf("expected 2 back in the cart, got %+v", cart.Items)
+	}
+}